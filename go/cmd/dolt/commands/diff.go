@@ -813,7 +813,7 @@ func createSplitter(ctx context.Context, vrw types.ValueReadWriter, fromSch sche
 		unionSch = toSch
 	}
 
-	newToUnionConv := rowconv.IdentityConverter
+	newToUnionConv := rowconv.NewIdentityConverter()
 	if toSch != nil {
 		newToUnionMapping, err := rowconv.TagMapping(toSch, unionSch)
 
@@ -824,7 +824,7 @@ func createSplitter(ctx context.Context, vrw types.ValueReadWriter, fromSch sche
 		newToUnionConv, _ = rowconv.NewRowConverter(ctx, vrw, newToUnionMapping)
 	}
 
-	oldToUnionConv := rowconv.IdentityConverter
+	oldToUnionConv := rowconv.NewIdentityConverter()
 	if fromSch != nil {
 		oldToUnionMapping, err := rowconv.TagMapping(fromSch, unionSch)
 
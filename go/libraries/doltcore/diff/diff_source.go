@@ -42,8 +42,8 @@ func NewRowDiffSource(ad RowDiffer, joiner *rowconv.Joiner) *RowDiffSource {
 	return &RowDiffSource{
 		ad,
 		joiner,
-		rowconv.IdentityConverter,
-		rowconv.IdentityConverter,
+		rowconv.NewIdentityConverter(),
+		rowconv.NewIdentityConverter(),
 	}
 }
 
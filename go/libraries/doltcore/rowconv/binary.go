@@ -0,0 +1,100 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rowconv
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/dolthub/go-mysql-server/sql"
+
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema/typeinfo"
+	"github.com/dolthub/dolt/go/store/types"
+)
+
+// BinaryEncoding is how the bytes of BINARY, VARBINARY and BLOB values are written when they are converted to a text
+// column.
+type BinaryEncoding int
+
+const (
+	// BinaryRaw copies the bytes unchanged. They must be valid UTF-8 and representable in the character set of the
+	// destination column. This is the default.
+	BinaryRaw BinaryEncoding = iota
+	// BinaryHex writes each byte as two upper case hexadecimal digits, as MySQL's HEX function does.
+	BinaryHex
+	// BinaryBase64 writes the bytes in padded standard base64, as MySQL's TO_BASE64 function does.
+	BinaryBase64
+)
+
+// String returns the name of the encoding.
+func (e BinaryEncoding) String() string {
+	switch e {
+	case BinaryRaw:
+		return "raw"
+	case BinaryHex:
+		return "hex"
+	case BinaryBase64:
+		return "base64"
+	default:
+		return fmt.Sprintf("BinaryEncoding(%d)", int(e))
+	}
+}
+
+// BinaryConvFunc converts a binary value to a text column, writing its bytes using |encoding|.
+type BinaryConvFunc func(v types.Value, encoding BinaryEncoding) (types.Value, error)
+
+// binaryConv returns the conversion from the BINARY, VARBINARY or BLOB type |srcTi| to the CHAR, VARCHAR or TEXT type
+// |destTi|, or nil for any other pair of types. Errors name the column |colName|.
+func binaryConv(ctx context.Context, vrw types.ValueReadWriter, srcTi, destTi typeinfo.TypeInfo, colName string) BinaryConvFunc {
+	if !sql.IsBlob(srcTi.ToSqlType()) || !sql.IsTextOnly(destTi.ToSqlType()) {
+		return nil
+	}
+
+	strType := destTi.ToSqlType().(sql.StringType)
+	return func(v types.Value, encoding BinaryEncoding) (types.Value, error) {
+		if types.IsNull(v) {
+			return types.NullValue, nil
+		}
+
+		val, err := srcTi.ConvertNomsValueToValue(v)
+
+		if err != nil {
+			return nil, err
+		}
+
+		bytes := val.(string)
+
+		var str string
+		switch encoding {
+		case BinaryRaw:
+			if err := checkCharset(bytes, strType, colName); err != nil {
+				return nil, err
+			}
+
+			str = bytes
+		case BinaryHex:
+			str = strings.ToUpper(hex.EncodeToString([]byte(bytes)))
+		case BinaryBase64:
+			str = base64.StdEncoding.EncodeToString([]byte(bytes))
+		default:
+			return nil, fmt.Errorf("unknown binary encoding %s", encoding.String())
+		}
+
+		return destTi.ConvertValueToNomsValue(ctx, vrw, str)
+	}
+}
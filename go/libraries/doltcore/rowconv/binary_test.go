@@ -0,0 +1,106 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rowconv
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/vitess/go/sqltypes"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dolthub/dolt/go/libraries/doltcore/row"
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema"
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema/typeinfo"
+	"github.com/dolthub/dolt/go/store/types"
+)
+
+func TestBinaryToText(t *testing.T) {
+	typeInfo := func(sqlType sql.Type) typeinfo.TypeInfo {
+		ti, err := typeinfo.FromSqlType(sqlType)
+		require.NoError(t, err)
+		return ti
+	}
+
+	srcSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.IntKind, true),
+		mustColumnWithTypeInfo("varbinary", 1, typeInfo(sql.MustCreateBinary(sqltypes.VarBinary, 64)), false),
+		mustColumnWithTypeInfo("blob", 2, typeInfo(sql.Blob), false),
+	))
+	destSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.IntKind, true),
+		mustColumnWithTypeInfo("varbinary", 1, typeInfo(sql.MustCreateStringWithDefaults(sqltypes.VarChar, 8)), false),
+		mustColumnWithTypeInfo("blob", 2, typeInfo(sql.Text), false),
+	))
+
+	mapping, err := TagMapping(srcSch, destSch)
+	require.NoError(t, err)
+
+	vrw := types.NewMemoryValueStore()
+	rConv, err := NewRowConverter(context.Background(), vrw, mapping)
+	require.NoError(t, err)
+
+	// convert converts |bytes| as the value of the column with |tag| and returns the text it is converted to
+	convert := func(t *testing.T, encoding BinaryEncoding, tag uint64, bytes string) (string, error) {
+		rConv.BinaryEncoding = encoding
+		srcCol, _ := srcSch.GetAllCols().GetByTag(tag)
+		srcVal, err := srcCol.TypeInfo.ConvertValueToNomsValue(context.Background(), vrw, bytes)
+		require.NoError(t, err)
+
+		inRow, err := row.New(vrw.Format(), srcSch, row.TaggedValues{0: types.Int(1), tag: srcVal})
+		require.NoError(t, err)
+
+		outRow, err := rConv.Convert(inRow)
+
+		if err != nil {
+			return "", err
+		}
+
+		outVal, _ := outRow.GetColVal(tag)
+		destCol, _ := destSch.GetAllCols().GetByTag(tag)
+		str, err := destCol.TypeInfo.ConvertNomsValueToValue(outVal)
+		require.NoError(t, err)
+		return str.(string), nil
+	}
+
+	for _, tag := range []uint64{1, 2} {
+		str, err := convert(t, BinaryRaw, tag, "héllo")
+		require.NoError(t, err)
+		require.Equal(t, "héllo", str)
+
+		str, err = convert(t, BinaryHex, tag, "\x00\xffab")
+		require.NoError(t, err)
+		require.Equal(t, "00FF6162", str)
+
+		str, err = convert(t, BinaryBase64, tag, "\x00\xffa")
+		require.NoError(t, err)
+		require.Equal(t, "AP9h", str)
+
+		_, err = convert(t, BinaryRaw, tag, "ab\xffcd")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid utf8 at byte 2")
+	}
+
+	// the encoded value must still fit the destination column
+	_, err = convert(t, BinaryHex, 1, "abcde")
+	require.Error(t, err)
+	str, err := convert(t, BinaryHex, 2, "abcde")
+	require.NoError(t, err)
+	require.Equal(t, "6162636465", str)
+
+	require.Nil(t, binaryConv(context.Background(), vrw, typeinfo.StringDefaultType, typeinfo.StringDefaultType, "col"))
+	require.Nil(t, binaryConv(context.Background(), vrw, typeInfo(sql.Blob), typeInfo(sql.Blob), "col"))
+}
@@ -0,0 +1,89 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rowconv
+
+import (
+	"fmt"
+
+	"github.com/dolthub/go-mysql-server/sql"
+
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema/typeinfo"
+	"github.com/dolthub/dolt/go/store/types"
+)
+
+// booleanConv returns the conversion between booleans, integers and bits when one of |srcTi| and |destTi| holds a
+// boolean, or nil for any other pair of types. BOOLEAN and BIT(1) columns both hold booleans. Zero converts to false
+// and any other value to true, and false and true convert to 0 and 1.
+func booleanConv(srcTi, destTi typeinfo.TypeInfo) types.MarshalCallback {
+	if !isBooleanType(srcTi) && !isBooleanType(destTi) {
+		return nil
+	}
+
+	if !isIntegerOrBitType(srcTi) || !isIntegerOrBitType(destTi) {
+		return nil
+	}
+
+	destKind := destTi.NomsKind()
+	return func(v types.Value) (types.Value, error) {
+		if types.IsNull(v) {
+			return types.NullValue, nil
+		}
+
+		var truth bool
+		switch val := v.(type) {
+		case types.Bool:
+			truth = bool(val)
+		case types.Int:
+			truth = val != 0
+		case types.Uint:
+			truth = val != 0
+		default:
+			return nil, fmt.Errorf("unexpected type converting %s to %s: %T", srcTi.String(), destTi.String(), v)
+		}
+
+		var n uint64
+		if truth {
+			n = 1
+		}
+
+		switch destKind {
+		case types.BoolKind:
+			return types.Bool(truth), nil
+		case types.IntKind:
+			return types.Int(n), nil
+		default:
+			return types.Uint(n), nil
+		}
+	}
+}
+
+// isBooleanType returns whether |ti| holds booleans, which is true of BOOLEAN and BIT(1) types. Columns declared in
+// SQL as BOOLEAN or TINYINT(1) are not included, as they are stored as TINYINT columns without their display width, so
+// they can't be told apart from any other TINYINT column and are converted as integers.
+func isBooleanType(ti typeinfo.TypeInfo) bool {
+	bitType, ok := ti.ToSqlType().(sql.BitType)
+	return ok && bitType.NumberOfBits() == 1
+}
+
+// isIntegerOrBitType returns whether |ti| is a signed or unsigned integer, BOOLEAN or BIT type.
+func isIntegerOrBitType(ti typeinfo.TypeInfo) bool {
+	sqlType := ti.ToSqlType()
+
+	if _, ok := sqlType.(sql.BitType); ok {
+		return true
+	}
+
+	return sql.IsInteger(sqlType)
+}
@@ -0,0 +1,123 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rowconv
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dolthub/dolt/go/libraries/doltcore/row"
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema"
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema/typeinfo"
+	"github.com/dolthub/dolt/go/store/types"
+)
+
+func TestBooleanConversions(t *testing.T) {
+	bitType := func(bits uint8) typeinfo.TypeInfo {
+		ti, err := typeinfo.FromSqlType(sql.MustCreateBitType(bits))
+		require.NoError(t, err)
+		return ti
+	}
+
+	bit1 := bitType(1)
+	bit8 := bitType(8)
+
+	tests := []struct {
+		name     string
+		srcTi    typeinfo.TypeInfo
+		destTi   typeinfo.TypeInfo
+		val      types.Value
+		expected types.Value
+	}{
+		{"bool true to int", typeinfo.BoolType, typeinfo.Int8Type, types.Bool(true), types.Int(1)},
+		{"bool false to int", typeinfo.BoolType, typeinfo.Int8Type, types.Bool(false), types.Int(0)},
+		{"bool true to uint", typeinfo.BoolType, typeinfo.Uint32Type, types.Bool(true), types.Uint(1)},
+		{"bool true to bit", typeinfo.BoolType, bit8, types.Bool(true), types.Uint(1)},
+		{"bool false to bit", typeinfo.BoolType, bit8, types.Bool(false), types.Uint(0)},
+		{"bool true to bit(1)", typeinfo.BoolType, bit1, types.Bool(true), types.Uint(1)},
+		{"int 0 to bool", typeinfo.Int8Type, typeinfo.BoolType, types.Int(0), types.Bool(false)},
+		{"int 1 to bool", typeinfo.Int8Type, typeinfo.BoolType, types.Int(1), types.Bool(true)},
+		{"int 5 to bool", typeinfo.Int64Type, typeinfo.BoolType, types.Int(5), types.Bool(true)},
+		{"negative int to bool", typeinfo.Int64Type, typeinfo.BoolType, types.Int(-1), types.Bool(true)},
+		{"uint 7 to bool", typeinfo.Uint8Type, typeinfo.BoolType, types.Uint(7), types.Bool(true)},
+		{"int 5 to bit(1)", typeinfo.Int32Type, bit1, types.Int(5), types.Uint(1)},
+		{"int 0 to bit(1)", typeinfo.Int32Type, bit1, types.Int(0), types.Uint(0)},
+		{"bit(1) to bool", bit1, typeinfo.BoolType, types.Uint(1), types.Bool(true)},
+		{"bit(1) to int", bit1, typeinfo.Int8Type, types.Uint(1), types.Int(1)},
+		{"bit 5 to bool", bit8, typeinfo.BoolType, types.Uint(5), types.Bool(true)},
+		{"bit 0 to bool", bit8, typeinfo.BoolType, types.Uint(0), types.Bool(false)},
+	}
+
+	vrw := types.NewMemoryValueStore()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srcSch := schema.MustSchemaFromCols(schema.NewColCollection(
+				schema.NewColumn("id", 0, types.IntKind, true),
+				mustColumnWithTypeInfo("flag", 1, test.srcTi, false),
+			))
+			destSch := schema.MustSchemaFromCols(schema.NewColCollection(
+				schema.NewColumn("id", 0, types.IntKind, true),
+				mustColumnWithTypeInfo("flag", 1, test.destTi, false),
+			))
+
+			mapping, err := TagMapping(srcSch, destSch)
+			require.NoError(t, err)
+			rConv, err := NewRowConverter(context.Background(), vrw, mapping)
+			require.NoError(t, err)
+
+			inRow, err := row.New(vrw.Format(), srcSch, row.TaggedValues{0: types.Int(1), 1: test.val})
+			require.NoError(t, err)
+
+			outRow, err := rConv.Convert(inRow)
+			require.NoError(t, err)
+			val, ok := outRow.GetColVal(1)
+			require.True(t, ok)
+			require.Equal(t, test.expected, val)
+		})
+	}
+}
+
+func TestBooleanConvOnlyForBooleans(t *testing.T) {
+	bit8, err := typeinfo.FromSqlType(sql.MustCreateBitType(8))
+	require.NoError(t, err)
+
+	for _, tis := range [][2]typeinfo.TypeInfo{
+		{typeinfo.Int8Type, typeinfo.Int64Type},
+		{typeinfo.Int8Type, bit8},
+		{typeinfo.BoolType, typeinfo.StringDefaultType},
+		{typeinfo.Float64Type, typeinfo.BoolType},
+	} {
+		t.Run(fmt.Sprintf("%s to %s", tis[0].String(), tis[1].String()), func(t *testing.T) {
+			require.Nil(t, booleanConv(tis[0], tis[1]))
+		})
+	}
+
+	require.NotNil(t, booleanConv(typeinfo.Int8Type, typeinfo.BoolType))
+}
+
+func TestSqlBooleanIsTinyInt(t *testing.T) {
+	// BOOLEAN and TINYINT(1) columns are stored as TINYINT, so they are converted as integers rather than booleans
+	for _, sqlType := range []sql.Type{sql.Boolean, sql.Int8} {
+		ti, err := typeinfo.FromSqlType(sqlType)
+		require.NoError(t, err)
+		require.Equal(t, typeinfo.Int8Type, ti)
+		require.False(t, isBooleanType(ti))
+		require.Nil(t, booleanConv(ti, typeinfo.Int64Type))
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rowconv
+
+import (
+	"container/list"
+	"math"
+	"sync"
+
+	"github.com/dolthub/dolt/go/store/types"
+)
+
+// ConversionCache remembers the converted values of recently converted source values, so that columns holding few
+// distinct values, such as enums, booleans and repeated strings, only convert each distinct value once. Each column
+// has a cache of its own holding at most the ConversionCache's size of values, which evicts the least recently used
+// value when it is full. It is safe for concurrent use.
+//
+// Only values converted without loss are cached, along with only values of kinds which can be compared cheaply, so
+// that a cached value is always the value the conversion would have produced. A ConversionCache should be used by a
+// single RowConverter, as columns are identified by their source tags, and the converter's DecimalRounding and
+// BinaryEncoding shouldn't change once the cache is in use.
+type ConversionCache struct {
+	size int
+	mu   sync.Mutex
+	cols map[uint64]*columnCache
+}
+
+// NewConversionCache returns a ConversionCache holding up to |size| values for each column.
+func NewConversionCache(size int) *ConversionCache {
+	return &ConversionCache{size: size, cols: make(map[uint64]*columnCache)}
+}
+
+// columnCache is the least recently used cache of the values of a single column. The front of order is the most
+// recently used entry.
+type columnCache struct {
+	entries map[interface{}]*list.Element
+	order   *list.List
+}
+
+type cacheEntry struct {
+	key interface{}
+	val types.Value
+}
+
+// floatKey is the cache key of a float, which is keyed by its bits so that NaN can be found again and -0 isn't
+// mistaken for 0.
+type floatKey uint64
+
+// cacheKey returns the key |val| is cached under, and false if values of its kind aren't cached.
+func cacheKey(val types.Value) (interface{}, bool) {
+	switch v := val.(type) {
+	case types.Bool, types.Int, types.Uint, types.String, types.UUID:
+		return v, true
+	case types.Float:
+		return floatKey(math.Float64bits(float64(v))), true
+	default:
+		return nil, false
+	}
+}
+
+// get returns the cached conversion of |val| in the column with source tag |srcTag|.
+func (c *ConversionCache) get(srcTag uint64, val types.Value) (types.Value, bool) {
+	if c.size <= 0 {
+		return nil, false
+	}
+
+	key, ok := cacheKey(val)
+
+	if !ok {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	col, ok := c.cols[srcTag]
+
+	if !ok {
+		return nil, false
+	}
+
+	elem, ok := col.entries[key]
+
+	if !ok {
+		return nil, false
+	}
+
+	col.order.MoveToFront(elem)
+	return elem.Value.(*cacheEntry).val, true
+}
+
+// put caches |outVal| as the conversion of |val| in the column with source tag |srcTag|, evicting the column's least
+// recently used value if its cache is full.
+func (c *ConversionCache) put(srcTag uint64, val, outVal types.Value) {
+	if c.size <= 0 {
+		return
+	}
+
+	key, ok := cacheKey(val)
+
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	col, ok := c.cols[srcTag]
+
+	if !ok {
+		col = &columnCache{entries: make(map[interface{}]*list.Element), order: list.New()}
+		c.cols[srcTag] = col
+	}
+
+	if elem, ok := col.entries[key]; ok {
+		elem.Value.(*cacheEntry).val = outVal
+		col.order.MoveToFront(elem)
+		return
+	}
+
+	if col.order.Len() >= c.size {
+		oldest := col.order.Back()
+		col.order.Remove(oldest)
+		delete(col.entries, oldest.Value.(*cacheEntry).key)
+	}
+
+	col.entries[key] = col.order.PushFront(&cacheEntry{key, outVal})
+}
+
+// len returns the number of values cached for the column with source tag |srcTag|.
+func (c *ConversionCache) len(srcTag uint64) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if col, ok := c.cols[srcTag]; ok {
+		return col.order.Len()
+	}
+
+	return 0
+}
@@ -0,0 +1,215 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rowconv
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dolthub/dolt/go/libraries/doltcore/row"
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema"
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema/typeinfo"
+	"github.com/dolthub/dolt/go/store/types"
+)
+
+func TestConversionCache(t *testing.T) {
+	t.Run("least recently used", func(t *testing.T) {
+		c := NewConversionCache(2)
+		c.put(1, types.String("a"), types.Int(1))
+		c.put(1, types.String("b"), types.Int(2))
+
+		val, ok := c.get(1, types.String("a"))
+		require.True(t, ok)
+		require.Equal(t, types.Int(1), val)
+
+		// b is the least recently used, so it is evicted to make room for c
+		c.put(1, types.String("c"), types.Int(3))
+		require.Equal(t, 2, c.len(1))
+		_, ok = c.get(1, types.String("b"))
+		require.False(t, ok)
+		_, ok = c.get(1, types.String("a"))
+		require.True(t, ok)
+		_, ok = c.get(1, types.String("c"))
+		require.True(t, ok)
+	})
+
+	t.Run("columns", func(t *testing.T) {
+		c := NewConversionCache(1)
+		c.put(1, types.String("a"), types.Int(1))
+		c.put(2, types.String("a"), types.Int(2))
+
+		val, ok := c.get(1, types.String("a"))
+		require.True(t, ok)
+		require.Equal(t, types.Int(1), val)
+		val, ok = c.get(2, types.String("a"))
+		require.True(t, ok)
+		require.Equal(t, types.Int(2), val)
+	})
+
+	t.Run("kinds", func(t *testing.T) {
+		c := NewConversionCache(8)
+
+		// values of different kinds are never mistaken for each other
+		c.put(1, types.Int(1), types.String("int"))
+		c.put(1, types.Uint(1), types.String("uint"))
+		val, ok := c.get(1, types.Int(1))
+		require.True(t, ok)
+		require.Equal(t, types.String("int"), val)
+
+		// floats are keyed by their bits
+		c.put(1, types.Float(0), types.String("0"))
+		_, ok = c.get(1, types.Float(math.Copysign(0, -1)))
+		require.False(t, ok)
+		c.put(1, types.Float(math.NaN()), types.String("NaN"))
+		_, ok = c.get(1, types.Float(math.NaN()))
+		require.True(t, ok)
+
+		// timestamps aren't cached
+		now := types.Timestamp(time.Now())
+		c.put(1, now, types.String("now"))
+		_, ok = c.get(1, now)
+		require.False(t, ok)
+	})
+}
+
+// lowCardinalitySchemas returns schemas whose columns are converted from a few distinct values, along with the source
+// values of |n| rows.
+func lowCardinalitySchemas(t testing.TB, n int) (schema.Schema, schema.Schema, []row.TaggedValues) {
+	enumTi, err := typeinfo.FromSqlType(sql.MustCreateEnumType([]string{"active", "inactive", "banned"}, sql.Collation_Default))
+	require.NoError(t, err)
+
+	srcSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.IntKind, true),
+		schema.NewColumn("status", 1, types.StringKind, false),
+		schema.NewColumn("created", 2, types.StringKind, false),
+		schema.NewColumn("score", 3, types.IntKind, false),
+		schema.NewColumn("ratio", 4, types.FloatKind, false),
+	))
+	destSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.IntKind, true),
+		mustColumnWithTypeInfo("status", 1, enumTi, false),
+		mustColumnWithTypeInfo("created", 2, typeinfo.DatetimeType, false),
+		mustColumnWithTypeInfo("score", 3, typeinfo.Int8Type, false),
+		schema.NewColumn("ratio", 4, types.StringKind, false),
+	))
+
+	statuses := []string{"active", "inactive", "banned"}
+	created := []string{"2021-01-02 03:04:05", "2021-06-07 08:09:10"}
+	scores := []int64{1, 50, 1000}
+	ratios := []float64{0.5, math.Copysign(0, -1), 0}
+
+	vals := make([]row.TaggedValues, n)
+	for i := range vals {
+		vals[i] = row.TaggedValues{
+			0: types.Int(i),
+			1: types.String(statuses[i%len(statuses)]),
+			2: types.String(created[i%len(created)]),
+			3: types.Int(scores[i%len(scores)]),
+			4: types.Float(ratios[i%len(ratios)]),
+		}
+	}
+
+	return srcSch, destSch, vals
+}
+
+func TestCachedConversion(t *testing.T) {
+	srcSch, destSch, vals := lowCardinalitySchemas(t, 100)
+	mapping, err := TagMapping(srcSch, destSch)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	vrw := types.NewMemoryValueStore()
+
+	convertAll := func(t *testing.T, cache *ConversionCache) ([]row.Row, int) {
+		rConv, err := NewRowConverter(ctx, vrw, mapping)
+		require.NoError(t, err)
+		rConv.Cache = cache
+
+		warnings := 0
+		rConv.Warn = func(LossyConversion) {
+			warnings++
+		}
+
+		outRows := make([]row.Row, len(vals))
+		for i, tv := range vals {
+			inRow, err := row.New(vrw.Format(), srcSch, tv)
+			require.NoError(t, err)
+			outRows[i], err = rConv.Convert(inRow)
+			require.NoError(t, err)
+		}
+
+		return outRows, warnings
+	}
+
+	uncached, uncachedWarnings := convertAll(t, nil)
+	cache := NewConversionCache(16)
+	cached, cachedWarnings := convertAll(t, cache)
+
+	for i := range uncached {
+		require.True(t, row.AreEqual(uncached[i], cached[i], destSch), "row %d differs", i)
+	}
+
+	// lossy conversions aren't cached, so every one of them is still reported
+	require.Equal(t, uncachedWarnings, cachedWarnings)
+	require.Greater(t, cachedWarnings, 0)
+
+	require.Equal(t, 3, cache.len(1))
+	require.Equal(t, 2, cache.len(2))
+	require.Equal(t, 2, cache.len(3), "only the scores which fit are cached")
+	require.Equal(t, 3, cache.len(4))
+	require.Equal(t, 0, cache.len(0), "pass through columns aren't cached")
+
+	outVal, ok := cached[1].GetColVal(4)
+	require.True(t, ok)
+	require.Equal(t, types.String("-0"), outVal)
+}
+
+func BenchmarkCachedConversion(b *testing.B) {
+	srcSch, destSch, vals := lowCardinalitySchemas(b, 1024)
+	mapping, err := TagMapping(srcSch, destSch)
+	require.NoError(b, err)
+
+	vrw := types.NewMemoryValueStore()
+	rows := make([]row.Row, len(vals))
+	for i, tv := range vals {
+		// the lossy score isn't cached, so it is left out of the benchmark
+		delete(tv, 3)
+		rows[i], err = row.New(vrw.Format(), srcSch, tv)
+		require.NoError(b, err)
+	}
+
+	for _, size := range []int{0, 16} {
+		b.Run(fmt.Sprintf("cache size %d", size), func(b *testing.B) {
+			rConv, err := NewRowConverter(context.Background(), vrw, mapping)
+			require.NoError(b, err)
+
+			if size > 0 {
+				rConv.Cache = NewConversionCache(size)
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, err := rConv.ConvertBatch(rows)
+				require.NoError(b, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rowconv
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/dolthub/go-mysql-server/sql"
+)
+
+// cp1252Runes are the characters which MySQL's latin1 character set, which is cp1252, encodes in place of the C1
+// control characters 0x80-0x9F. Every other character of latin1 has the same code point as its encoding.
+var cp1252Runes = map[rune]struct{}{
+	'€': {}, '‚': {}, 'ƒ': {}, '„': {}, '…': {}, '†': {}, '‡': {}, 'ˆ': {}, '‰': {}, 'Š': {}, '‹': {}, 'Œ': {}, 'Ž': {},
+	'‘': {}, '’': {}, '“': {}, '”': {}, '•': {}, '–': {}, '—': {}, '˜': {}, '™': {}, 'š': {}, '›': {}, 'œ': {}, 'ž': {},
+	'Ÿ': {},
+}
+
+// charsetContains returns whether the character set |cs| can represent |r|. Character sets which aren't known are
+// assumed to be able to represent every character.
+func charsetContains(cs sql.CharacterSet, r rune) bool {
+	switch cs {
+	case sql.CharacterSet_ascii:
+		return r < utf8.RuneSelf
+	case sql.CharacterSet_latin1:
+		if r <= 0xFF {
+			return true
+		}
+
+		_, ok := cp1252Runes[r]
+		return ok
+	case sql.CharacterSet_utf8mb3:
+		return r <= 0xFFFF
+	default:
+		return true
+	}
+}
+
+// checkCharset returns an error if |str| is not valid utf8, or contains a character which the character set of the
+// string column |col| can't represent. The collation of the column only affects how its values are compared, so it
+// doesn't restrict which values can be stored.
+func checkCharset(str string, strType sql.StringType, colName string) error {
+	cs := strType.CharacterSet()
+
+	if cs == sql.CharacterSet_binary {
+		return nil
+	}
+
+	for i, r := range str {
+		if r == utf8.RuneError {
+			if _, size := utf8.DecodeRuneInString(str[i:]); size == 1 {
+				return fmt.Errorf("invalid utf8 at byte %d of value for column `%s`", i, colName)
+			}
+		}
+
+		if !charsetContains(cs, r) {
+			return fmt.Errorf("character %q at byte %d can't be represented in character set %s of column `%s`", r, i, cs.String(), colName)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rowconv
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/vitess/go/sqltypes"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dolthub/dolt/go/libraries/doltcore/row"
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema"
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema/typeinfo"
+	"github.com/dolthub/dolt/go/store/types"
+)
+
+func TestConvertIntoCharset(t *testing.T) {
+	tests := []struct {
+		name      string
+		collation sql.Collation
+		value     string
+		valid     bool
+	}{
+		{"latin1", sql.Collation_latin1_swedish_ci, "café", true},
+		{"latin1 cp1252", sql.Collation_latin1_swedish_ci, "€5 – naïve", true},
+		{"latin1 cjk", sql.Collation_latin1_swedish_ci, "日本", false},
+		{"latin1 greek", sql.Collation_latin1_swedish_ci, "café α", false},
+		{"ascii", sql.Collation_ascii_general_ci, "cafe", true},
+		{"ascii accent", sql.Collation_ascii_general_ci, "café", false},
+		{"utf8mb3", sql.Collation_utf8mb3_general_ci, "日本", true},
+		{"utf8mb3 emoji", sql.Collation_utf8mb3_general_ci, "\U0001F600", false},
+		{"utf8mb4 emoji", sql.Collation_Default, "\U0001F600", true},
+		{"invalid utf8", sql.Collation_Default, "caf\xe9", false},
+	}
+
+	srcSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.IntKind, true),
+		schema.NewColumn("name", 1, types.BlobKind, false),
+	))
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			strType, err := sql.CreateString(sqltypes.VarChar, 100, test.collation)
+			require.NoError(t, err)
+			ti, err := typeinfo.FromSqlType(strType)
+			require.NoError(t, err)
+
+			destSch := schema.MustSchemaFromCols(schema.NewColCollection(
+				schema.NewColumn("id", 0, types.IntKind, true),
+				mustColumnWithTypeInfo("name", 1, ti, false),
+			))
+
+			mapping, err := TagMapping(srcSch, destSch)
+			require.NoError(t, err)
+
+			vrw := types.NewMemoryValueStore()
+			rConv, err := NewRowConverter(context.Background(), vrw, mapping)
+			require.NoError(t, err)
+
+			blob, err := types.NewBlob(context.Background(), vrw, strings.NewReader(test.value))
+			require.NoError(t, err)
+
+			inRow, err := row.New(vrw.Format(), srcSch, row.TaggedValues{0: types.Int(1), 1: blob})
+			require.NoError(t, err)
+
+			outRow, err := rConv.Convert(inRow)
+
+			if !test.valid {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "`name`")
+				return
+			}
+
+			require.NoError(t, err)
+			val, ok := outRow.GetColVal(1)
+			require.True(t, ok)
+			require.Equal(t, types.String(test.value), val)
+		})
+	}
+}
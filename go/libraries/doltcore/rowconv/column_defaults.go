@@ -0,0 +1,102 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rowconv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/dolthub/dolt/go/store/types"
+)
+
+// ColumnDefault is a destination column which has the same value in every converted row.
+type ColumnDefault struct {
+	DestTag uint64
+	Value   types.Value
+}
+
+// SetDefault gives the destination column with tag |destTag| the value |val| in every converted row, such as for a
+// column which was added to the destination schema and has no source column. The destination column must not already
+// be mapped, merged, derived or have a default, and |val| must be of the destination column's type.
+func (rc *RowConverter) SetDefault(destTag uint64, val types.Value) error {
+	if rc.FieldMapping == nil {
+		return errors.New("cannot set defaults without a field mapping")
+	}
+
+	if err := rc.checkUnmappedDestTag(destTag); err != nil {
+		return err
+	}
+
+	col := rc.DestSch.GetAllCols().TagToCol[destTag]
+
+	if types.IsNull(val) {
+		return fmt.Errorf("default of column `%s` is null", col.Name)
+	} else if val.Kind() != col.Kind {
+		return fmt.Errorf("default of column `%s` is a %s, not a %s", col.Name, val.Kind(), col.Kind)
+	}
+
+	rc.Defaults = append(rc.Defaults, ColumnDefault{DestTag: destTag, Value: val})
+	return nil
+}
+
+// SetDefaultsByName is SetDefault for each of |defaults|, which are keyed by the name of their destination column. An
+// error is returned if a name is not a column of the destination schema.
+func (rc *RowConverter) SetDefaultsByName(defaults map[string]types.Value) error {
+	if rc.FieldMapping == nil {
+		return errors.New("cannot set defaults without a field mapping")
+	}
+
+	// defaults are resolved in name order so that the same error is returned for the same defaults
+	names := make([]string, 0, len(defaults))
+	for name := range defaults {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	destCols := rc.DestSch.GetAllCols()
+	for _, name := range names {
+		col, ok := destCols.GetByName(name)
+
+		if !ok {
+			return fmt.Errorf("cannot set the default of unknown column `%s`", name)
+		}
+
+		if err := rc.SetDefault(col.Tag, defaults[name]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// NewRowConverterWithDefaults is NewRowConverter, but the destination columns named in |defaults| are given their
+// default in every converted row, as by SetDefaultsByName. The names are resolved against the destination schema when
+// the converter is created, and an error is returned for any which are not columns of it.
+func NewRowConverterWithDefaults(ctx context.Context, vrw types.ValueReadWriter, mapping *FieldMapping, defaults map[string]types.Value) (*RowConverter, error) {
+	rc, err := NewRowConverter(ctx, vrw, mapping)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := rc.SetDefaultsByName(defaults); err != nil {
+		return nil, err
+	}
+
+	return rc, nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rowconv
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dolthub/dolt/go/libraries/doltcore/row"
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema"
+	"github.com/dolthub/dolt/go/store/types"
+)
+
+func TestRowConverterWithDefaults(t *testing.T) {
+	srcSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.IntKind, true),
+		schema.NewColumn("name", 1, types.StringKind, false),
+	))
+	destSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.IntKind, true),
+		schema.NewColumn("name", 1, types.StringKind, false),
+		schema.NewColumn("active", 2, types.BoolKind, false),
+		schema.NewColumn("region", 3, types.StringKind, false),
+		schema.NewColumn("score", 4, types.IntKind, false),
+		schema.NewColumn("notes", 5, types.StringKind, false),
+	))
+
+	mapping, err := TagMapping(srcSch, destSch)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	vrw := types.NewMemoryValueStore()
+	rConv, err := NewRowConverterWithDefaults(ctx, vrw, mapping, map[string]types.Value{
+		"active": types.Bool(true),
+		"region": types.String("us-west"),
+		"score":  types.Int(0),
+	})
+	require.NoError(t, err)
+
+	for i, name := range []string{"alice", "bob"} {
+		inRow, err := row.New(vrw.Format(), srcSch, row.TaggedValues{0: types.Int(i), 1: types.String(name)})
+		require.NoError(t, err)
+
+		outRow, err := rConv.Convert(inRow)
+		require.NoError(t, err)
+
+		// columns without a default are left without a value
+		expected, err := row.New(vrw.Format(), destSch, row.TaggedValues{
+			0: types.Int(i),
+			1: types.String(name),
+			2: types.Bool(true),
+			3: types.String("us-west"),
+			4: types.Int(0),
+		})
+		require.NoError(t, err)
+		require.True(t, row.AreEqual(expected, outRow, destSch), row.Fmt(ctx, outRow, destSch))
+	}
+
+	tests := []struct {
+		name     string
+		defaults map[string]types.Value
+	}{
+		{"unknown column", map[string]types.Value{"region": types.String("us-west"), "country": types.String("us")}},
+		{"mapped column", map[string]types.Value{"name": types.String("anonymous")}},
+		{"wrong type", map[string]types.Value{"score": types.String("0")}},
+		{"null", map[string]types.Value{"notes": types.NullValue}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := NewRowConverterWithDefaults(ctx, vrw, mapping, test.defaults)
+			require.Error(t, err)
+		})
+	}
+
+	_, err = NewRowConverterWithDefaults(ctx, vrw, mapping, map[string]types.Value{"country": types.String("us")})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "`country`")
+
+	rConv, err = NewRowConverter(ctx, vrw, mapping)
+	require.NoError(t, err)
+	require.NoError(t, rConv.SetDefault(5, types.String("none")))
+	require.Error(t, rConv.SetDefaultsByName(map[string]types.Value{"notes": types.String("none")}), "column already has a default")
+	require.Empty(t, rConv.Derived)
+	require.True(t, rConv.TransformedTags().Contains(5))
+
+	// defaults have no source column, so the inverse drops them
+	inverse, err := rConv.Inverse(ctx, vrw)
+	require.NoError(t, err)
+	inRow, err := row.New(vrw.Format(), srcSch, row.TaggedValues{0: types.Int(1), 1: types.String("carol")})
+	require.NoError(t, err)
+	outRow, err := rConv.Convert(inRow)
+	require.NoError(t, err)
+	roundTripped, err := inverse.Convert(outRow)
+	require.NoError(t, err)
+	require.True(t, row.AreEqual(inRow, roundTripped, srcSch), row.Fmt(ctx, roundTripped, srcSch))
+}
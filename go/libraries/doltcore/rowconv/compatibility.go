@@ -0,0 +1,114 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rowconv
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema/typeinfo"
+)
+
+// Compatibility describes how the values of a source column can be converted to the type of its destination column.
+type Compatibility int
+
+const (
+	// Identity is the Compatibility of columns of the same type, whose values are copied unchanged
+	Identity Compatibility = iota
+	// SafeWiden is the Compatibility of a destination type which can hold every value of the source type
+	SafeWiden
+	// LossyNarrow is the Compatibility of a destination type which can hold some, but not necessarily all, values of
+	// the source type. Converting values may fail, or may change them.
+	LossyNarrow
+	// Unsupported is the Compatibility of a destination type which no value of the source type can be converted to
+	Unsupported
+)
+
+// String returns the name of the Compatibility.
+func (c Compatibility) String() string {
+	switch c {
+	case Identity:
+		return "identity"
+	case SafeWiden:
+		return "safe widen"
+	case LossyNarrow:
+		return "lossy narrow"
+	case Unsupported:
+		return "unsupported"
+	default:
+		return fmt.Sprintf("unknown compatibility %d", int(c))
+	}
+}
+
+// ColumnCompatibility is the Compatibility of a source column with the destination column it is mapped to.
+type ColumnCompatibility struct {
+	SrcTag        uint64
+	DestTag       uint64
+	SrcName       string
+	DestName      string
+	SrcType       typeinfo.TypeInfo
+	DestType      typeinfo.TypeInfo
+	Compatibility Compatibility
+	// Reason describes why a conversion is Unsupported. It is empty for the other kinds of Compatibility.
+	Reason string
+}
+
+// CheckCompatibility reports the Compatibility of each column mapped by |mapping|, ordered by source tag, without
+// converting any rows. It lets tooling warn about lossy or impossible conversions before starting a long import.
+// LossyNarrow is reported for any conversion which can't be shown to be lossless, so some of the conversions it is
+// reported for never lose data in practice.
+func CheckCompatibility(ctx context.Context, mapping *FieldMapping) ([]ColumnCompatibility, error) {
+	srcCols := mapping.SrcSch.GetAllCols()
+	destCols := mapping.DestSch.GetAllCols()
+
+	report := make([]ColumnCompatibility, 0, len(mapping.SrcToDest))
+	for srcTag, destTag := range mapping.SrcToDest {
+		srcCol, srcOk := srcCols.GetByTag(srcTag)
+		destCol, destOk := destCols.GetByTag(destTag)
+
+		if !srcOk || !destOk {
+			return nil, fmt.Errorf("Could not find column being mapped. src tag: %d, dest tag: %d", srcTag, destTag)
+		}
+
+		cc := ColumnCompatibility{
+			SrcTag:   srcTag,
+			DestTag:  destTag,
+			SrcName:  srcCol.Name,
+			DestName: destCol.Name,
+			SrcType:  srcCol.TypeInfo,
+			DestType: destCol.TypeInfo,
+		}
+
+		if srcCol.TypeInfo.Equals(destCol.TypeInfo) {
+			cc.Compatibility = Identity
+		} else if _, _, err := typeinfo.GetTypeConverter(ctx, srcCol.TypeInfo, destCol.TypeInfo); err != nil {
+			cc.Compatibility = Unsupported
+			cc.Reason = err.Error()
+		} else if isLosslessConversion(srcCol.TypeInfo, destCol.TypeInfo) {
+			cc.Compatibility = SafeWiden
+		} else {
+			cc.Compatibility = LossyNarrow
+		}
+
+		report = append(report, cc)
+	}
+
+	sort.Slice(report, func(i, j int) bool {
+		return report[i].SrcTag < report[j].SrcTag
+	})
+
+	return report, nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rowconv
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/vitess/go/sqltypes"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema"
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema/typeinfo"
+	"github.com/dolthub/dolt/go/store/types"
+)
+
+func TestCheckCompatibility(t *testing.T) {
+	fromSqlType := func(sqlType sql.Type) typeinfo.TypeInfo {
+		ti, err := typeinfo.FromSqlType(sqlType)
+		require.NoError(t, err)
+		return ti
+	}
+
+	varchar := func(length int64) typeinfo.TypeInfo {
+		return fromSqlType(sql.MustCreateStringWithDefaults(sqltypes.VarChar, length))
+	}
+
+	tests := []struct {
+		name     string
+		srcType  typeinfo.TypeInfo
+		destType typeinfo.TypeInfo
+		expected Compatibility
+	}{
+		{"int identity", typeinfo.Int32Type, typeinfo.Int32Type, Identity},
+		{"int widen", typeinfo.Int32Type, typeinfo.Int64Type, SafeWiden},
+		{"uint to wider int", typeinfo.Uint32Type, typeinfo.Int64Type, SafeWiden},
+		{"float widen", typeinfo.Float32Type, typeinfo.Float64Type, SafeWiden},
+		{"int narrow", typeinfo.Int64Type, typeinfo.Int32Type, LossyNarrow},
+		{"int to uint", typeinfo.Int32Type, typeinfo.Uint64Type, LossyNarrow},
+		{"float to int", typeinfo.Float64Type, typeinfo.Int64Type, LossyNarrow},
+		{"bool to datetime", typeinfo.BoolType, typeinfo.DatetimeType, Unsupported},
+
+		{"varchar identity", varchar(10), varchar(10), Identity},
+		{"varchar widen", varchar(10), varchar(20), SafeWiden},
+		{"int to varchar", typeinfo.Int32Type, varchar(20), SafeWiden},
+		{"varchar narrow", varchar(20), varchar(10), LossyNarrow},
+		{"int to short varchar", typeinfo.Int64Type, varchar(10), LossyNarrow},
+		{"varchar to int", varchar(10), typeinfo.Int64Type, LossyNarrow},
+		{"bool to uuid", typeinfo.BoolType, typeinfo.UuidType, Unsupported},
+
+		{"text identity", fromSqlType(sql.Text), fromSqlType(sql.Text), Identity},
+		{"varchar to text", varchar(100), fromSqlType(sql.Text), SafeWiden},
+		{"text to longtext", fromSqlType(sql.Text), fromSqlType(sql.LongText), SafeWiden},
+		{"blob to longblob", fromSqlType(sql.Blob), fromSqlType(sql.LongBlob), SafeWiden},
+		{"text to varchar", fromSqlType(sql.Text), varchar(100), LossyNarrow},
+		{"blob to text", fromSqlType(sql.Blob), fromSqlType(sql.Text), LossyNarrow},
+		{"longblob to blob", fromSqlType(sql.LongBlob), fromSqlType(sql.Blob), LossyNarrow},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srcSch := schema.MustSchemaFromCols(schema.NewColCollection(
+				schema.NewColumn("id", 0, types.IntKind, true),
+				mustColumnWithTypeInfo("val", 1, test.srcType, false),
+			))
+			destSch := schema.MustSchemaFromCols(schema.NewColCollection(
+				schema.NewColumn("id", 0, types.IntKind, true),
+				mustColumnWithTypeInfo("val", 1, test.destType, false),
+			))
+
+			mapping, err := TagMapping(srcSch, destSch)
+			require.NoError(t, err)
+
+			report, err := CheckCompatibility(context.Background(), mapping)
+			require.NoError(t, err)
+			require.Len(t, report, 2)
+
+			require.Equal(t, uint64(0), report[0].SrcTag)
+			require.Equal(t, Identity, report[0].Compatibility)
+
+			require.Equal(t, uint64(1), report[1].SrcTag)
+			require.Equal(t, uint64(1), report[1].DestTag)
+			require.Equal(t, "val", report[1].DestName)
+			require.Equal(t, test.expected, report[1].Compatibility, report[1].Compatibility.String())
+
+			if test.expected == Unsupported {
+				require.NotEmpty(t, report[1].Reason)
+			} else {
+				require.Empty(t, report[1].Reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rowconv
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/shopspring/decimal"
+
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema/typeinfo"
+	"github.com/dolthub/dolt/go/store/types"
+)
+
+// DecimalRounding is how values are rounded when they are converted to a DECIMAL column with fewer decimal places.
+type DecimalRounding int
+
+const (
+	// RoundHalfUp rounds to the nearest value, rounding values exactly halfway between away from zero. This is how
+	// MySQL rounds, and is the default.
+	RoundHalfUp DecimalRounding = iota
+	// RoundTruncate drops the extra decimal places, rounding towards zero.
+	RoundTruncate
+	// RoundHalfEven rounds to the nearest value, rounding values exactly halfway between to the value with an even
+	// last digit. This is also known as banker's rounding.
+	RoundHalfEven
+)
+
+// String returns the name of the rounding mode.
+func (r DecimalRounding) String() string {
+	switch r {
+	case RoundHalfUp:
+		return "half up"
+	case RoundTruncate:
+		return "truncate"
+	case RoundHalfEven:
+		return "half even"
+	default:
+		return fmt.Sprintf("DecimalRounding(%d)", int(r))
+	}
+}
+
+// DecimalConvFunc converts a value to a DECIMAL column, rounding it to the column's scale using |rounding|. When the
+// value is rounded the returned string describes the change.
+type DecimalConvFunc func(v types.Value, rounding DecimalRounding) (types.Value, string, error)
+
+// decimalConv returns the conversion from the numeric type |srcTi| to the DECIMAL type |destTi|, or nil for any other
+// pair of types. Values whose integer part has more digits than |destTi| allows fail with an error naming the column
+// |colName|, rather than being rounded.
+func decimalConv(ctx context.Context, vrw types.ValueReadWriter, srcTi, destTi typeinfo.TypeInfo, colName string) DecimalConvFunc {
+	decType, ok := destTi.ToSqlType().(sql.DecimalType)
+
+	if !ok {
+		return nil
+	}
+
+	switch srcTi.NomsKind() {
+	case types.DecimalKind, types.IntKind, types.UintKind, types.FloatKind:
+	default:
+		return nil
+	}
+
+	scale := int32(decType.Scale())
+	intDigits := int(decType.Precision()) - int(decType.Scale())
+	upperBound := decimal.New(1, int32(intDigits))
+	return func(v types.Value, rounding DecimalRounding) (types.Value, string, error) {
+		var dec decimal.Decimal
+		switch val := v.(type) {
+		case types.Null:
+			return types.NullValue, "", nil
+		case types.Decimal:
+			dec = decimal.Decimal(val)
+		case types.Int:
+			dec = decimal.NewFromInt(int64(val))
+		case types.Uint:
+			dec = decimal.NewFromBigInt(new(big.Int).SetUint64(uint64(val)), 0)
+		case types.Float:
+			dec = decimal.NewFromFloat(float64(val))
+		default:
+			return nil, "", fmt.Errorf("unexpected type converting %s to %s: %T", srcTi.String(), destTi.String(), v)
+		}
+
+		var rounded decimal.Decimal
+		switch rounding {
+		case RoundHalfUp:
+			rounded = dec.Round(scale)
+		case RoundTruncate:
+			rounded = dec.Truncate(scale)
+		case RoundHalfEven:
+			rounded = dec.RoundBank(scale)
+		default:
+			return nil, "", fmt.Errorf("unknown decimal rounding %s", rounding.String())
+		}
+
+		if !rounded.Abs().LessThan(upperBound) {
+			return nil, "", fmt.Errorf("value %s of column `%s` is out of range for %s, which allows %d digits before the decimal point", dec.String(), colName, decType.String(), intDigits)
+		}
+
+		out, err := destTi.ConvertValueToNomsValue(ctx, vrw, rounded)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		if !rounded.Equal(dec) {
+			return out, fmt.Sprintf("rounded (%s) from %s to %s", rounding.String(), dec.String(), rounded.StringFixed(scale)), nil
+		}
+
+		return out, "", nil
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rowconv
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dolthub/dolt/go/libraries/doltcore/row"
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema"
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema/typeinfo"
+	"github.com/dolthub/dolt/go/store/types"
+)
+
+func TestDecimalRounding(t *testing.T) {
+	decimalType := func(precision, scale uint8) typeinfo.TypeInfo {
+		ti, err := typeinfo.FromSqlType(sql.MustCreateDecimalType(precision, scale))
+		require.NoError(t, err)
+		return ti
+	}
+
+	srcSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.IntKind, true),
+		mustColumnWithTypeInfo("amount", 1, decimalType(10, 4), false),
+		schema.NewColumn("count", 2, types.IntKind, false),
+	))
+	destSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.IntKind, true),
+		mustColumnWithTypeInfo("amount", 1, decimalType(5, 2), false),
+		mustColumnWithTypeInfo("count", 2, decimalType(5, 2), false),
+	))
+
+	mapping, err := TagMapping(srcSch, destSch)
+	require.NoError(t, err)
+
+	vrw := types.NewMemoryValueStore()
+	rConv, err := NewRowConverter(context.Background(), vrw, mapping)
+	require.NoError(t, err)
+
+	convert := func(t *testing.T, rounding DecimalRounding, tag uint64, val types.Value) (types.Value, error) {
+		rConv.DecimalRounding = rounding
+		inRow, err := row.New(vrw.Format(), srcSch, row.TaggedValues{0: types.Int(1), tag: val})
+		require.NoError(t, err)
+
+		outRow, err := rConv.Convert(inRow)
+
+		if err != nil {
+			return nil, err
+		}
+
+		outVal, _ := outRow.GetColVal(tag)
+		return outVal, nil
+	}
+
+	dec := func(str string) types.Value {
+		return types.Decimal(decimal.RequireFromString(str))
+	}
+
+	tests := []struct {
+		val      string
+		halfUp   string
+		truncate string
+		halfEven string
+	}{
+		{"1.2300", "1.23", "1.23", "1.23"},
+		{"1.2449", "1.24", "1.24", "1.24"},
+		{"1.2450", "1.25", "1.24", "1.24"},
+		{"1.2350", "1.24", "1.23", "1.24"},
+		{"1.2451", "1.25", "1.24", "1.25"},
+		{"-1.2450", "-1.25", "-1.24", "-1.24"},
+		{"999.9949", "999.99", "999.99", "999.99"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.val, func(t *testing.T) {
+			for rounding, expected := range map[DecimalRounding]string{RoundHalfUp: test.halfUp, RoundTruncate: test.truncate, RoundHalfEven: test.halfEven} {
+				outVal, err := convert(t, rounding, 1, dec(test.val))
+				require.NoError(t, err, rounding.String())
+				require.True(t, decimal.RequireFromString(expected).Equal(decimal.Decimal(outVal.(types.Decimal))), "%s: expected %s, got %s", rounding.String(), expected, outVal.HumanReadableString())
+			}
+		})
+	}
+
+	t.Run("integer part overflow", func(t *testing.T) {
+		_, err := convert(t, RoundHalfUp, 1, dec("1234.5"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "value 1234.5 of column `amount`")
+		require.Contains(t, err.Error(), "3 digits before the decimal point")
+
+		// rounding up can carry into a digit the integer part doesn't have room for, where truncating doesn't
+		_, err = convert(t, RoundHalfUp, 1, dec("999.995"))
+		require.Error(t, err)
+		outVal, err := convert(t, RoundTruncate, 1, dec("999.995"))
+		require.NoError(t, err)
+		require.Equal(t, "999.99", decimal.Decimal(outVal.(types.Decimal)).StringFixed(2))
+
+		_, err = convert(t, RoundHalfUp, 2, types.Int(-12345))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "column `count`")
+		outVal, err = convert(t, RoundHalfUp, 2, types.Int(-123))
+		require.NoError(t, err)
+		require.True(t, decimal.NewFromInt(-123).Equal(decimal.Decimal(outVal.(types.Decimal))))
+	})
+
+	t.Run("warnings", func(t *testing.T) {
+		var warnings []LossyConversion
+		rConv.Warn = func(lc LossyConversion) {
+			warnings = append(warnings, lc)
+		}
+		defer func() {
+			rConv.Warn = nil
+		}()
+
+		_, err := convert(t, RoundHalfEven, 1, dec("1.2300"))
+		require.NoError(t, err)
+		require.Empty(t, warnings)
+
+		_, err = convert(t, RoundHalfEven, 1, dec("1.2350"))
+		require.NoError(t, err)
+		require.Len(t, warnings, 1)
+		require.Equal(t, "rounded (half even) from 1.235 to 1.24", warnings[0].Reason)
+	})
+}
@@ -0,0 +1,48 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rowconv
+
+import (
+	"errors"
+
+	"github.com/dolthub/dolt/go/libraries/doltcore/row"
+	"github.com/dolthub/dolt/go/store/types"
+)
+
+// ColumnDeriver computes the value of a derived column from the source row.
+type ColumnDeriver func(row.Row) (types.Value, error)
+
+// DerivedColumn is a destination column whose value is computed from the whole source row.
+type DerivedColumn struct {
+	DestTag uint64
+	Derive  ColumnDeriver
+}
+
+// DeriveColumn registers the destination column with tag |destTag| as the result of calling |derive| with each source
+// row. Derived columns are computed after the mapped and merged columns, in the order they were registered. The
+// destination column must not already be mapped, merged, derived or have a default, and the value returned by |derive|
+// must be of the destination column's type. A null result leaves the column without a value.
+func (rc *RowConverter) DeriveColumn(destTag uint64, derive ColumnDeriver) error {
+	if rc.FieldMapping == nil {
+		return errors.New("cannot derive columns without a field mapping")
+	}
+
+	if err := rc.checkUnmappedDestTag(destTag); err != nil {
+		return err
+	}
+
+	rc.Derived = append(rc.Derived, DerivedColumn{DestTag: destTag, Derive: derive})
+	return nil
+}
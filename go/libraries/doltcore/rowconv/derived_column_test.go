@@ -0,0 +1,92 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rowconv
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dolthub/dolt/go/libraries/doltcore/row"
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema"
+	"github.com/dolthub/dolt/go/store/types"
+)
+
+func TestDeriveColumn(t *testing.T) {
+	srcSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.IntKind, true),
+		schema.NewColumn("price", 1, types.IntKind, false),
+		schema.NewColumn("tax", 2, types.IntKind, false),
+	))
+	destSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.IntKind, true),
+		schema.NewColumn("price", 1, types.IntKind, false),
+		schema.NewColumn("tax", 2, types.IntKind, false),
+		schema.NewColumn("total", 3, types.IntKind, false),
+	))
+
+	mapping, err := TagMapping(srcSch, destSch)
+	require.NoError(t, err)
+
+	vrw := types.NewMemoryValueStore()
+	rConv, err := NewRowConverter(context.Background(), vrw, mapping)
+	require.NoError(t, err)
+
+	errMissingPrice := errors.New("missing price")
+	sum := func(r row.Row) (types.Value, error) {
+		price, ok := r.GetColVal(1)
+
+		if !ok {
+			return nil, errMissingPrice
+		}
+
+		tax, ok := r.GetColVal(2)
+
+		if !ok {
+			tax = types.Int(0)
+		}
+
+		return price.(types.Int) + tax.(types.Int), nil
+	}
+
+	require.Error(t, rConv.DeriveColumn(1, sum), "column is already mapped")
+	require.Error(t, rConv.DeriveColumn(4, sum), "unknown column")
+	require.NoError(t, rConv.DeriveColumn(3, sum))
+	require.Error(t, rConv.DeriveColumn(3, sum), "column is already derived")
+
+	inRow, err := row.New(vrw.Format(), srcSch, row.TaggedValues{0: types.Int(1), 1: types.Int(100), 2: types.Int(8)})
+	require.NoError(t, err)
+
+	outRow, err := rConv.Convert(inRow)
+	require.NoError(t, err)
+
+	expected, err := row.New(vrw.Format(), destSch, row.TaggedValues{0: types.Int(1), 1: types.Int(100), 2: types.Int(8), 3: types.Int(108)})
+	require.NoError(t, err)
+	require.True(t, row.AreEqual(expected, outRow, destSch), row.Fmt(context.Background(), outRow, destSch))
+
+	// errors from the derived column fail the conversion
+	inRow, err = row.New(vrw.Format(), srcSch, row.TaggedValues{0: types.Int(2), 2: types.Int(8)})
+	require.NoError(t, err)
+
+	_, err = rConv.Convert(inRow)
+	require.True(t, errors.Is(err, errMissingPrice))
+
+	_, colErrs, err := rConv.ConvertCollectingErrors(context.Background(), inRow)
+	require.NoError(t, err)
+	require.Len(t, colErrs, 1)
+	require.Equal(t, uint64(3), colErrs[0].DestTag)
+}
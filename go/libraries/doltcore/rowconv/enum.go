@@ -0,0 +1,124 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rowconv
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dolthub/go-mysql-server/sql"
+
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema/typeinfo"
+	"github.com/dolthub/dolt/go/store/types"
+)
+
+// memberConv returns the conversion between ENUM and SET types |srcTi| and |destTi|, or nil unless both are ENUM or
+// SET types. ENUM and SET values are stored as the indexes of their members, which differ between definitions with
+// different member lists, so members are matched by their string value instead. A member which the destination
+// definition doesn't have fails with an error naming the column |colName|.
+func memberConv(srcTi, destTi typeinfo.TypeInfo, colName string) types.MarshalCallback {
+	_, srcIsSet, ok := enumOrSetMembers(srcTi)
+
+	if !ok {
+		return nil
+	}
+
+	destMembers, destIsSet, ok := enumOrSetMembers(destTi)
+
+	if !ok {
+		return nil
+	}
+
+	binary := isBinaryCollation(destTi.ToSqlType())
+	return func(v types.Value) (types.Value, error) {
+		if types.IsNull(v) {
+			return types.NullValue, nil
+		}
+
+		val, err := srcTi.ConvertNomsValueToValue(v)
+
+		if err != nil {
+			return nil, err
+		}
+
+		str := val.(string)
+
+		// the empty string is the enum's error value, and the set without any members
+		var members []string
+		if str != "" && srcIsSet {
+			members = strings.Split(str, ",")
+		} else if str != "" {
+			members = []string{str}
+		}
+
+		if !destIsSet && len(members) > 1 {
+			return nil, fmt.Errorf("value '%s' of column `%s` has more than one member, so can't be converted to %s", str, colName, destTi.ToSqlType().String())
+		}
+
+		var out uint64
+		for _, member := range members {
+			idx := memberIndex(destMembers, member, binary)
+
+			if idx < 0 {
+				return nil, fmt.Errorf("'%s' of column `%s` is not a member of %s", member, colName, destTi.ToSqlType().String())
+			}
+
+			if destIsSet {
+				out |= 1 << uint(idx)
+			} else {
+				// enum indexes start at 1, as 0 is the error value
+				out = uint64(idx) + 1
+			}
+		}
+
+		return types.Uint(out), nil
+	}
+}
+
+// enumOrSetMembers returns the members of |ti| and whether it is a SET, or false if it is neither an ENUM nor a SET.
+func enumOrSetMembers(ti typeinfo.TypeInfo) ([]string, bool, bool) {
+	switch sqlType := ti.ToSqlType().(type) {
+	case sql.EnumType:
+		return sqlType.Values(), false, true
+	case sql.SetType:
+		return sqlType.Values(), true, true
+	default:
+		return nil, false, false
+	}
+}
+
+// isBinaryCollation returns whether the ENUM or SET type |sqlType| compares its members byte by byte, rather than
+// ignoring case.
+func isBinaryCollation(sqlType sql.Type) bool {
+	switch sqlType := sqlType.(type) {
+	case sql.EnumType:
+		return sqlType.Collation().Name == sql.Collation_binary.Name
+	case sql.SetType:
+		return sqlType.Collation().Name == sql.Collation_binary.Name
+	default:
+		return false
+	}
+}
+
+// memberIndex returns the position of |member| in |members|, or -1 if it isn't one of them.
+func memberIndex(members []string, member string, binary bool) int {
+	for i, m := range members {
+		if m == member || (!binary && strings.EqualFold(m, member)) {
+			return i
+		}
+	}
+
+	return -1
+}
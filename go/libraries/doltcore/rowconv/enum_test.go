@@ -0,0 +1,139 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rowconv
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dolthub/dolt/go/libraries/doltcore/row"
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema"
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema/typeinfo"
+	"github.com/dolthub/dolt/go/store/types"
+)
+
+func TestEnumAndSetConversion(t *testing.T) {
+	enumType := func(members ...string) typeinfo.TypeInfo {
+		ti, err := typeinfo.FromSqlType(sql.MustCreateEnumType(members, sql.Collation_Default))
+		require.NoError(t, err)
+		return ti
+	}
+	setType := func(members ...string) typeinfo.TypeInfo {
+		ti, err := typeinfo.FromSqlType(sql.MustCreateSetType(members, sql.Collation_Default))
+		require.NoError(t, err)
+		return ti
+	}
+
+	vrw := types.NewMemoryValueStore()
+
+	// convert converts |val|, the string form of a value of |srcTi|, to |destTi| and returns the string form of the result
+	convert := func(t *testing.T, srcTi, destTi typeinfo.TypeInfo, val string) (string, error) {
+		srcSch := schema.MustSchemaFromCols(schema.NewColCollection(
+			schema.NewColumn("id", 0, types.IntKind, true),
+			mustColumnWithTypeInfo("size", 1, srcTi, false),
+		))
+		destSch := schema.MustSchemaFromCols(schema.NewColCollection(
+			schema.NewColumn("id", 0, types.IntKind, true),
+			mustColumnWithTypeInfo("size", 1, destTi, false),
+		))
+
+		mapping, err := TagMapping(srcSch, destSch)
+		require.NoError(t, err)
+		rConv, err := NewRowConverter(context.Background(), vrw, mapping)
+		require.NoError(t, err)
+
+		srcVal, err := srcTi.ConvertValueToNomsValue(context.Background(), vrw, val)
+		require.NoError(t, err)
+		inRow, err := row.New(vrw.Format(), srcSch, row.TaggedValues{0: types.Int(1), 1: srcVal})
+		require.NoError(t, err)
+
+		outRow, err := rConv.Convert(inRow)
+
+		if err != nil {
+			return "", err
+		}
+
+		outVal, _ := outRow.GetColVal(1)
+		str, err := destTi.ConvertNomsValueToValue(outVal)
+		require.NoError(t, err)
+		return str.(string), nil
+	}
+
+	t.Run("reordered enum members", func(t *testing.T) {
+		for _, member := range []string{"small", "medium", "large"} {
+			out, err := convert(t, enumType("small", "medium", "large"), enumType("large", "small", "medium"), member)
+			require.NoError(t, err)
+			require.Equal(t, member, out)
+		}
+	})
+
+	t.Run("added enum member", func(t *testing.T) {
+		out, err := convert(t, enumType("small", "large"), enumType("small", "medium", "large"), "large")
+		require.NoError(t, err)
+		require.Equal(t, "large", out)
+	})
+
+	t.Run("removed enum member", func(t *testing.T) {
+		_, err := convert(t, enumType("small", "medium", "large"), enumType("small", "large"), "medium")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "'medium' of column `size` is not a member")
+	})
+
+	t.Run("numeric enum members", func(t *testing.T) {
+		// members which look like indexes must still be matched by value
+		out, err := convert(t, enumType("3", "1", "2"), enumType("1", "2", "3"), "3")
+		require.NoError(t, err)
+		require.Equal(t, "3", out)
+	})
+
+	t.Run("reordered set members", func(t *testing.T) {
+		out, err := convert(t, setType("a", "b", "c"), setType("c", "a", "b"), "a,c")
+		require.NoError(t, err)
+		require.Equal(t, "c,a", out)
+
+		out, err = convert(t, setType("a", "b", "c"), setType("c", "a", "b"), "")
+		require.NoError(t, err)
+		require.Equal(t, "", out)
+	})
+
+	t.Run("added set member", func(t *testing.T) {
+		out, err := convert(t, setType("a", "b"), setType("a", "b", "c"), "a,b")
+		require.NoError(t, err)
+		require.Equal(t, "a,b", out)
+	})
+
+	t.Run("removed set member", func(t *testing.T) {
+		_, err := convert(t, setType("a", "b", "c"), setType("a", "c"), "a,b")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "'b' of column `size` is not a member")
+	})
+
+	t.Run("between enums and sets", func(t *testing.T) {
+		out, err := convert(t, enumType("small", "large"), setType("large", "small"), "small")
+		require.NoError(t, err)
+		require.Equal(t, "small", out)
+
+		out, err = convert(t, setType("a", "b"), enumType("b", "a"), "a")
+		require.NoError(t, err)
+		require.Equal(t, "a", out)
+
+		_, err = convert(t, setType("a", "b"), enumType("b", "a"), "a,b")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "more than one member")
+	})
+}
@@ -18,6 +18,7 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/dolthub/dolt/go/cmd/dolt/errhand"
 	"github.com/dolthub/dolt/go/libraries/doltcore/schema"
@@ -35,6 +36,13 @@ var ErrUnmarshallingMapping = errors.New("error unmarshalling mapping")
 // ErrEmptyMapping is an error returned when the mapping is empty (No src columns, no destination columns)
 var ErrEmptyMapping = errors.New("empty mapping error")
 
+// ErrIncompleteMapping is an error returned when a source column is neither mapped nor explicitly dropped
+var ErrIncompleteMapping = errors.New("incomplete mapping")
+
+// ErrColumnCountMismatch is an error returned when columns are mapped by position and the schemas have different
+// numbers of columns
+var ErrColumnCountMismatch = errors.New("column count mismatch")
+
 // BadMappingErr is a struct which implements the error interface and is used when there is an error with a mapping.
 type BadMappingErr struct {
 	srcField  string
@@ -84,6 +92,54 @@ type FieldMapping struct {
 
 	// SrcToDest is a map from a tag in the source schema to a tag in the dest schema.
 	SrcToDest map[uint64]uint64
+
+	// DroppedSrcTags holds the tags of the source columns which are dropped on purpose. It is nil if no columns are
+	// dropped.
+	DroppedSrcTags *set.Uint64Set
+}
+
+// DropSrcColumns marks the source columns with the tags |srcTags| as dropped on purpose, so that CheckComplete
+// doesn't report them and converters skip them. Mapped columns can't be dropped.
+func (fm *FieldMapping) DropSrcColumns(srcTags ...uint64) error {
+	for _, tag := range srcTags {
+		col, ok := fm.SrcSch.GetAllCols().GetByTag(tag)
+
+		if !ok {
+			return fmt.Errorf("cannot drop unknown source column with tag %d", tag)
+		}
+
+		if _, ok := fm.SrcToDest[tag]; ok {
+			return fmt.Errorf("cannot drop source column `%s` which is mapped", col.Name)
+		}
+	}
+
+	if fm.DroppedSrcTags == nil {
+		fm.DroppedSrcTags = set.NewUint64Set(nil)
+	}
+
+	fm.DroppedSrcTags.Add(srcTags...)
+	return nil
+}
+
+// IsDropped returns whether the source column with tag |srcTag| is dropped on purpose.
+func (fm *FieldMapping) IsDropped(srcTag uint64) bool {
+	return fm.DroppedSrcTags != nil && fm.DroppedSrcTags.Contains(srcTag)
+}
+
+// CheckComplete returns an ErrIncompleteMapping naming any source columns which are neither mapped nor dropped.
+func (fm *FieldMapping) CheckComplete() error {
+	var unmapped []string
+	for _, col := range fm.SrcSch.GetAllCols().GetColumns() {
+		if _, ok := fm.SrcToDest[col.Tag]; !ok && !fm.IsDropped(col.Tag) {
+			unmapped = append(unmapped, col.Name)
+		}
+	}
+
+	if len(unmapped) > 0 {
+		return fmt.Errorf("%w: source columns %v are neither mapped nor dropped", ErrIncompleteMapping, unmapped)
+	}
+
+	return nil
 }
 
 // MapsAllDestPKs checks that each PK column in DestSch has a corresponding column in SrcSch
@@ -131,7 +187,7 @@ func NewFieldMapping(srcSch, destSch schema.Schema, srcTagToDestTag map[uint64]u
 		return nil, ErrEmptyMapping
 	}
 
-	return &FieldMapping{srcSch, destSch, srcTagToDestTag}, nil
+	return &FieldMapping{srcSch, destSch, srcTagToDestTag, nil}, nil
 }
 
 // Returns the identity mapping for the schema given.
@@ -204,6 +260,177 @@ func NameMapping(srcSch, destSch schema.Schema, nameMapper NameMapper) (*FieldMa
 	return NewFieldMapping(srcSch, destSch, srcToDest)
 }
 
+// UnmatchedColumns are the names of the columns left out of a mapping built by ColumnNameMapping or HeaderMapping, in
+// the order they are declared in their schemas.
+type UnmatchedColumns struct {
+	// Src are the source columns with no destination column of the same name.
+	Src []string
+	// Dest are the destination columns with no source column of the same name.
+	Dest []string
+}
+
+// ColumnNameMapping maps each source column to the destination column with the same name, and reports the columns on
+// either side which weren't matched. When |caseInsensitive| is true, source columns without an exact match are then
+// matched to a remaining destination column whose name differs only in case, in the order the source columns are
+// declared. A source column which matches more than one destination column in this way is an error.
+func ColumnNameMapping(srcSch, destSch schema.Schema, caseInsensitive bool) (*FieldMapping, UnmatchedColumns, error) {
+	srcCols := srcSch.GetAllCols().GetColumns()
+	destCols := destSch.GetAllCols()
+
+	srcToDest := make(map[uint64]uint64, len(srcCols))
+	matchedDest := make(map[uint64]bool, destCols.Size())
+	for _, srcCol := range srcCols {
+		if destCol, ok := destCols.GetByName(srcCol.Name); ok {
+			srcToDest[srcCol.Tag] = destCol.Tag
+			matchedDest[destCol.Tag] = true
+		}
+	}
+
+	if caseInsensitive {
+		for _, srcCol := range srcCols {
+			if _, ok := srcToDest[srcCol.Tag]; ok {
+				continue
+			}
+
+			var matches []schema.Column
+			for _, destCol := range destCols.GetColumns() {
+				if !matchedDest[destCol.Tag] && strings.EqualFold(srcCol.Name, destCol.Name) {
+					matches = append(matches, destCol)
+				}
+			}
+
+			if len(matches) > 1 {
+				return nil, UnmatchedColumns{}, fmt.Errorf("source column `%s` matches destination columns `%s` and `%s` ignoring case", srcCol.Name, matches[0].Name, matches[1].Name)
+			} else if len(matches) == 1 {
+				srcToDest[srcCol.Tag] = matches[0].Tag
+				matchedDest[matches[0].Tag] = true
+			}
+		}
+	}
+
+	var unmatched UnmatchedColumns
+	for _, srcCol := range srcCols {
+		if _, ok := srcToDest[srcCol.Tag]; !ok {
+			unmatched.Src = append(unmatched.Src, srcCol.Name)
+		}
+	}
+
+	for _, destCol := range destCols.GetColumns() {
+		if !matchedDest[destCol.Tag] {
+			unmatched.Dest = append(unmatched.Dest, destCol.Name)
+		}
+	}
+
+	if len(srcToDest) == 0 {
+		return nil, unmatched, ErrEmptyMapping
+	}
+
+	fm, err := NewFieldMapping(srcSch, destSch, srcToDest)
+
+	if err != nil {
+		return nil, UnmatchedColumns{}, err
+	}
+
+	return fm, unmatched, nil
+}
+
+// PositionMapping maps the source and destination columns by their position, pairing the first source column with
+// the first destination column and so on, for imports whose column names can't be relied on. ErrColumnCountMismatch
+// is returned if the schemas have different numbers of columns, unless |allowMismatch| is true. In that case the extra
+// destination columns are left unmapped and the extra source columns are dropped.
+func PositionMapping(srcSch, destSch schema.Schema, allowMismatch bool) (*FieldMapping, error) {
+	srcCols := srcSch.GetAllCols().GetColumns()
+	destCols := destSch.GetAllCols().GetColumns()
+
+	if len(srcCols) != len(destCols) && !allowMismatch {
+		return nil, fmt.Errorf("%w: %d source columns and %d destination columns", ErrColumnCountMismatch, len(srcCols), len(destCols))
+	}
+
+	n := len(srcCols)
+	if len(destCols) < n {
+		n = len(destCols)
+	}
+
+	srcToDest := make(map[uint64]uint64, n)
+	for i := 0; i < n; i++ {
+		srcToDest[srcCols[i].Tag] = destCols[i].Tag
+	}
+
+	fm, err := NewFieldMapping(srcSch, destSch, srcToDest)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(srcCols) > n {
+		extra := make([]uint64, 0, len(srcCols)-n)
+		for _, col := range srcCols[n:] {
+			extra = append(extra, col.Tag)
+		}
+
+		if err := fm.DropSrcColumns(extra...); err != nil {
+			return nil, err
+		}
+	}
+
+	return fm, nil
+}
+
+// HeaderMapping maps the columns named by the header of a CSV file to the columns of |destSch| with the same name,
+// after renaming any headers found in |aliases|. The source schema of the mapping is the untyped schema the CSV reader
+// creates from |header|. The unmatched headers and the destination columns no header maps to are reported, in the
+// order they are declared. Duplicate headers, or headers which map to the same destination column, are an error.
+func HeaderMapping(header []string, destSch schema.Schema, aliases NameMapper) (*FieldMapping, UnmatchedColumns, error) {
+	seen := make(map[string]bool, len(header))
+	for _, name := range header {
+		if seen[name] {
+			return nil, UnmatchedColumns{}, fmt.Errorf("header `%s` appears more than once", name)
+		}
+
+		seen[name] = true
+	}
+
+	nameToTag, srcSch := untyped.NewUntypedSchema(header...)
+	destCols := destSch.GetAllCols()
+
+	srcToDest := make(map[uint64]uint64, len(header))
+	mappedFrom := make(map[uint64]string, destCols.Size())
+	var unmatched UnmatchedColumns
+	for _, name := range header {
+		destCol, ok := destCols.GetByName(aliases.Map(name))
+
+		if !ok {
+			unmatched.Src = append(unmatched.Src, name)
+			continue
+		}
+
+		if other, ok := mappedFrom[destCol.Tag]; ok {
+			return nil, UnmatchedColumns{}, fmt.Errorf("headers `%s` and `%s` both map to column `%s`", other, name, destCol.Name)
+		}
+
+		srcToDest[nameToTag[name]] = destCol.Tag
+		mappedFrom[destCol.Tag] = name
+	}
+
+	for _, destCol := range destCols.GetColumns() {
+		if _, ok := mappedFrom[destCol.Tag]; !ok {
+			unmatched.Dest = append(unmatched.Dest, destCol.Name)
+		}
+	}
+
+	if len(srcToDest) == 0 {
+		return nil, unmatched, ErrEmptyMapping
+	}
+
+	fm, err := NewFieldMapping(srcSch, destSch, srcToDest)
+
+	if err != nil {
+		return nil, UnmatchedColumns{}, err
+	}
+
+	return fm, unmatched, nil
+}
+
 // NameMapperFromFile reads a JSON file containing a name mapping and returns a NameMapper.
 func NameMapperFromFile(mappingFile string, FS filesys.ReadableFS) (NameMapper, error) {
 	var nm NameMapper
@@ -15,9 +15,14 @@
 package rowconv
 
 import (
+	"context"
+	"errors"
 	"reflect"
 	"testing"
 
+	"github.com/stretchr/testify/require"
+
+	"github.com/dolthub/dolt/go/libraries/doltcore/row"
 	"github.com/dolthub/dolt/go/libraries/doltcore/schema"
 	"github.com/dolthub/dolt/go/libraries/utils/filesys"
 	"github.com/dolthub/dolt/go/store/types"
@@ -112,3 +117,200 @@ func TestFieldMapping(t *testing.T) {
 		}
 	}
 }
+
+func TestDropSrcColumns(t *testing.T) {
+	// schemaA has a column c which schemaB doesn't
+	mapping, err := TagMapping(schemaA, schemaB)
+	require.NoError(t, err)
+	require.True(t, errors.Is(mapping.CheckComplete(), ErrIncompleteMapping))
+
+	require.Error(t, mapping.DropSrcColumns(0), "mapped columns can't be dropped")
+	require.Error(t, mapping.DropSrcColumns(7), "unknown columns can't be dropped")
+	require.False(t, mapping.IsDropped(2))
+
+	require.NoError(t, mapping.DropSrcColumns(2))
+	require.True(t, mapping.IsDropped(2))
+	require.NoError(t, mapping.CheckComplete())
+
+	vrw := types.NewMemoryValueStore()
+	rConv, err := NewRowConverter(context.Background(), vrw, mapping)
+	require.NoError(t, err)
+
+	inRow, err := row.New(vrw.Format(), schemaA, row.TaggedValues{
+		0: types.String("a"),
+		1: types.String("b"),
+		2: types.String("dropped"),
+	})
+	require.NoError(t, err)
+
+	outRow, err := rConv.Convert(inRow)
+	require.NoError(t, err)
+
+	_, ok := outRow.GetColVal(2)
+	require.False(t, ok)
+
+	expected, err := row.New(vrw.Format(), schemaB, row.TaggedValues{
+		0: types.String("a"),
+		1: types.String("b"),
+	})
+	require.NoError(t, err)
+	require.True(t, row.AreEqual(expected, outRow, schemaB), row.Fmt(context.Background(), outRow, schemaB))
+}
+
+func TestColumnNameMapping(t *testing.T) {
+	srcSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.IntKind, true),
+		schema.NewColumn("Name", 1, types.StringKind, false),
+		schema.NewColumn("EMAIL", 2, types.StringKind, false),
+		schema.NewColumn("only_src", 3, types.StringKind, false),
+	))
+	destSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 10, types.IntKind, true),
+		schema.NewColumn("name", 11, types.StringKind, false),
+		schema.NewColumn("Name", 12, types.StringKind, false),
+		schema.NewColumn("email", 13, types.StringKind, false),
+		schema.NewColumn("only_dest", 14, types.StringKind, false),
+	))
+
+	t.Run("exact names", func(t *testing.T) {
+		mapping, unmatched, err := ColumnNameMapping(srcSch, destSch, false)
+		require.NoError(t, err)
+		require.Equal(t, map[uint64]uint64{0: 10, 1: 12}, mapping.SrcToDest)
+		require.Equal(t, []string{"EMAIL", "only_src"}, unmatched.Src)
+		require.Equal(t, []string{"name", "email", "only_dest"}, unmatched.Dest)
+	})
+
+	t.Run("case insensitive", func(t *testing.T) {
+		// Name matches Name exactly, leaving name unmatched rather than making Name ambiguous
+		mapping, unmatched, err := ColumnNameMapping(srcSch, destSch, true)
+		require.NoError(t, err)
+		require.Equal(t, map[uint64]uint64{0: 10, 1: 12, 2: 13}, mapping.SrcToDest)
+		require.Equal(t, []string{"only_src"}, unmatched.Src)
+		require.Equal(t, []string{"name", "only_dest"}, unmatched.Dest)
+	})
+
+	t.Run("ambiguous", func(t *testing.T) {
+		srcSch := schema.MustSchemaFromCols(schema.NewColCollection(
+			schema.NewColumn("id", 0, types.IntKind, true),
+			schema.NewColumn("NAME", 1, types.StringKind, false),
+		))
+
+		_, _, err := ColumnNameMapping(srcSch, destSch, true)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "`NAME`")
+	})
+
+	t.Run("no matches", func(t *testing.T) {
+		otherSch := schema.MustSchemaFromCols(schema.NewColCollection(
+			schema.NewColumn("other", 0, types.IntKind, true),
+		))
+
+		_, unmatched, err := ColumnNameMapping(otherSch, destSch, true)
+		require.True(t, errors.Is(err, ErrEmptyMapping))
+		require.Equal(t, []string{"other"}, unmatched.Src)
+		require.Len(t, unmatched.Dest, 5)
+	})
+}
+
+func TestPositionMapping(t *testing.T) {
+	// the tags and names don't line up with each other, only the positions do
+	threeCols := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("col1", 7, types.StringKind, true),
+		schema.NewColumn("col2", 3, types.StringKind, false),
+		schema.NewColumn("col3", 5, types.StringKind, false),
+	))
+	threeOtherCols := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.IntKind, true),
+		schema.NewColumn("name", 1, types.StringKind, false),
+		schema.NewColumn("age", 2, types.IntKind, false),
+	))
+	twoCols := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 10, types.IntKind, true),
+		schema.NewColumn("name", 11, types.StringKind, false),
+	))
+
+	t.Run("equal counts", func(t *testing.T) {
+		mapping, err := PositionMapping(threeCols, threeOtherCols, false)
+		require.NoError(t, err)
+		require.Equal(t, map[uint64]uint64{7: 0, 3: 1, 5: 2}, mapping.SrcToDest)
+		require.NoError(t, mapping.CheckComplete())
+	})
+
+	t.Run("extra source columns", func(t *testing.T) {
+		_, err := PositionMapping(threeCols, twoCols, false)
+		require.True(t, errors.Is(err, ErrColumnCountMismatch))
+
+		mapping, err := PositionMapping(threeCols, twoCols, true)
+		require.NoError(t, err)
+		require.Equal(t, map[uint64]uint64{7: 10, 3: 11}, mapping.SrcToDest)
+		require.True(t, mapping.IsDropped(5))
+		require.NoError(t, mapping.CheckComplete())
+	})
+
+	t.Run("extra destination columns", func(t *testing.T) {
+		_, err := PositionMapping(twoCols, threeCols, false)
+		require.True(t, errors.Is(err, ErrColumnCountMismatch))
+
+		mapping, err := PositionMapping(twoCols, threeCols, true)
+		require.NoError(t, err)
+		require.Equal(t, map[uint64]uint64{10: 7, 11: 3}, mapping.SrcToDest)
+		require.Nil(t, mapping.DroppedSrcTags)
+	})
+}
+
+func TestHeaderMapping(t *testing.T) {
+	destSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 10, types.IntKind, true),
+		schema.NewColumn("name", 11, types.StringKind, false),
+		schema.NewColumn("email", 12, types.StringKind, false),
+	))
+
+	t.Run("exact matches", func(t *testing.T) {
+		mapping, unmatched, err := HeaderMapping([]string{"name", "id", "email"}, destSch, nil)
+		require.NoError(t, err)
+		require.Equal(t, map[uint64]uint64{0: 11, 1: 10, 2: 12}, mapping.SrcToDest)
+		require.Empty(t, unmatched.Src)
+		require.Empty(t, unmatched.Dest)
+
+		col, ok := mapping.SrcSch.GetAllCols().GetByTag(1)
+		require.True(t, ok)
+		require.Equal(t, "id", col.Name)
+		require.Equal(t, types.StringKind, col.Kind)
+	})
+
+	t.Run("aliases", func(t *testing.T) {
+		aliases := NameMapper{"user_id": "id", "e-mail": "email"}
+		mapping, unmatched, err := HeaderMapping([]string{"user_id", "name", "e-mail"}, destSch, aliases)
+		require.NoError(t, err)
+		require.Equal(t, map[uint64]uint64{0: 10, 1: 11, 2: 12}, mapping.SrcToDest)
+		require.Empty(t, unmatched.Src)
+		require.Empty(t, unmatched.Dest)
+	})
+
+	t.Run("extra and missing headers", func(t *testing.T) {
+		mapping, unmatched, err := HeaderMapping([]string{"id", "age", "name", "city"}, destSch, nil)
+		require.NoError(t, err)
+		require.Equal(t, map[uint64]uint64{0: 10, 2: 11}, mapping.SrcToDest)
+		require.Equal(t, []string{"age", "city"}, unmatched.Src)
+		require.Equal(t, []string{"email"}, unmatched.Dest)
+	})
+
+	t.Run("no matches", func(t *testing.T) {
+		_, unmatched, err := HeaderMapping([]string{"other"}, destSch, nil)
+		require.True(t, errors.Is(err, ErrEmptyMapping))
+		require.Equal(t, []string{"other"}, unmatched.Src)
+		require.Equal(t, []string{"id", "name", "email"}, unmatched.Dest)
+	})
+
+	t.Run("duplicate header", func(t *testing.T) {
+		_, _, err := HeaderMapping([]string{"id", "name", "id"}, destSch, nil)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "`id`")
+	})
+
+	t.Run("alias collides with header", func(t *testing.T) {
+		_, _, err := HeaderMapping([]string{"id", "name", "user_id"}, destSch, NameMapper{"user_id": "id"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "`user_id`")
+	})
+}
@@ -0,0 +1,71 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rowconv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/dolthub/go-mysql-server/sql"
+
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema/typeinfo"
+	"github.com/dolthub/dolt/go/store/types"
+)
+
+// jsonConv returns the conversion from the text type |srcTi| to the JSON type |destTi|, which parses each value as a
+// JSON document. Malformed documents fail with an error giving the position of the problem. It returns nil for any
+// other pair of types. Conversions from JSON to text need no special handling, as JSON values are formatted in the
+// canonical form MySQL uses, with object keys in sorted order.
+func jsonConv(ctx context.Context, vrw types.ValueReadWriter, srcTi, destTi typeinfo.TypeInfo, colName string) types.MarshalCallback {
+	if !sql.IsText(srcTi.ToSqlType()) || destTi.NomsKind() != types.JSONKind {
+		return nil
+	}
+
+	return func(v types.Value) (types.Value, error) {
+		str, err := srcTi.FormatValue(v)
+
+		if err != nil {
+			return nil, err
+		} else if str == nil {
+			return types.NullValue, nil
+		}
+
+		var doc interface{}
+		if err := json.Unmarshal([]byte(*str), &doc); err != nil {
+			return nil, jsonSyntaxErr(*str, colName, err)
+		}
+
+		return destTi.ConvertValueToNomsValue(ctx, vrw, sql.JSONDocument{Val: doc})
+	}
+}
+
+// jsonSyntaxErr describes the error |err| parsing the JSON document |doc| from the column |colName|, including the
+// line and column of the problem when it is known.
+func jsonSyntaxErr(doc, colName string, err error) error {
+	var syntaxErr *json.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		return fmt.Errorf("invalid JSON in column `%s`: %w", colName, err)
+	}
+
+	// the offset is the number of bytes read before the error, so the problem is at the byte before it
+	read := []byte(doc)[:syntaxErr.Offset]
+	line := bytes.Count(read, []byte("\n")) + 1
+	col := len(read) - bytes.LastIndexByte(read, '\n') - 1
+
+	return fmt.Errorf("invalid JSON in column `%s` at line %d, column %d: %w", colName, line, col, err)
+}
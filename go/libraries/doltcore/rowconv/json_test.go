@@ -0,0 +1,98 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rowconv
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dolthub/dolt/go/libraries/doltcore/row"
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema"
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema/typeinfo"
+	"github.com/dolthub/dolt/go/store/types"
+)
+
+func TestJSONConversion(t *testing.T) {
+	strSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.IntKind, true),
+		mustColumnWithTypeInfo("doc", 1, typeinfo.StringDefaultType, false),
+	))
+	jsonSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.IntKind, true),
+		mustColumnWithTypeInfo("doc", 1, typeinfo.JSONType, false),
+	))
+
+	vrw := types.NewMemoryValueStore()
+	toJSON, err := TagMapping(strSch, jsonSch)
+	require.NoError(t, err)
+	strToJSON, err := NewRowConverter(context.Background(), vrw, toJSON)
+	require.NoError(t, err)
+
+	toStr, err := TagMapping(jsonSch, strSch)
+	require.NoError(t, err)
+	jsonToStr, err := NewRowConverter(context.Background(), vrw, toStr)
+	require.NoError(t, err)
+
+	convert := func(t *testing.T, rc *RowConverter, sch schema.Schema, val types.Value) (types.Value, error) {
+		inRow, err := row.New(vrw.Format(), sch, row.TaggedValues{0: types.Int(1), 1: val})
+		require.NoError(t, err)
+
+		outRow, err := rc.Convert(inRow)
+
+		if err != nil {
+			return nil, err
+		}
+
+		outVal, _ := outRow.GetColVal(1)
+		return outVal, nil
+	}
+
+	t.Run("valid document", func(t *testing.T) {
+		doc, err := convert(t, strToJSON, strSch, types.String(`{"b": [1, 2, null], "a": {"c": "str"}}`))
+		require.NoError(t, err)
+		require.Equal(t, types.JSONKind, doc.Kind())
+
+		str, err := convert(t, jsonToStr, jsonSch, doc)
+		require.NoError(t, err)
+		require.Equal(t, types.String(`{"a": {"c": "str"}, "b": [1, 2, null]}`), str)
+	})
+
+	t.Run("malformed document", func(t *testing.T) {
+		_, err := convert(t, strToJSON, strSch, types.String("{\n  \"a\": 1,\n  \"b\": }"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "column `doc` at line 3, column 8")
+
+		_, err = convert(t, strToJSON, strSch, types.String(`{"a": 1} trailing`))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "line 1, column 10")
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		for _, str := range []string{`{"a": 1, "b": "two"}`, `[true, false, null]`, `"just a string"`, `1.5`, `{}`} {
+			doc, err := convert(t, strToJSON, strSch, types.String(str))
+			require.NoError(t, err)
+
+			outStr, err := convert(t, jsonToStr, jsonSch, doc)
+			require.NoError(t, err)
+			require.Equal(t, types.String(str), outStr)
+
+			outDoc, err := convert(t, strToJSON, strSch, outStr)
+			require.NoError(t, err)
+			require.True(t, doc.Equals(outDoc))
+		}
+	})
+}
@@ -0,0 +1,238 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rowconv
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/vitess/go/sqltypes"
+	"github.com/dolthub/vitess/go/vt/proto/query"
+
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema"
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema/typeinfo"
+	"github.com/dolthub/dolt/go/store/types"
+)
+
+// LossyConversion describes a value which was changed in order to fit its destination column.
+type LossyConversion struct {
+	// SrcTag is the tag of the column in the source schema
+	SrcTag uint64
+	// DestTag is the tag of the column in the destination schema
+	DestTag uint64
+	// Original is the source value
+	Original types.Value
+	// Converted is the value which was stored in the destination column
+	Converted types.Value
+	// Reason describes how the value was changed
+	Reason string
+}
+
+// ConversionWarningFunc receives the lossy conversions made by a RowConverter.
+type ConversionWarningFunc func(LossyConversion)
+
+// LossyConvFunc converts a value, changing it if needed to fit its destination column. If the value was changed the
+// returned string describes why.
+type LossyConvFunc func(types.Value) (types.Value, string, error)
+
+// truncatingStringConv returns a LossyConvFunc which formats values using |convFunc| and then truncates them to the
+// maximum length of the string type |destTi|.
+func truncatingStringConv(convFunc types.MarshalCallback, destTi typeinfo.TypeInfo) LossyConvFunc {
+	strType, ok := destTi.ToSqlType().(sql.StringType)
+
+	if !ok {
+		return nil
+	}
+
+	maxLen := strType.MaxCharacterLength()
+	return func(v types.Value) (types.Value, string, error) {
+		out, err := convFunc(v)
+
+		if err != nil {
+			return nil, "", err
+		}
+
+		str, ok := out.(types.String)
+
+		if !ok {
+			return out, "", nil
+		}
+
+		runes := []rune(string(str))
+
+		if int64(len(runes)) <= maxLen {
+			return out, "", nil
+		}
+
+		return types.String(runes[:maxLen]), fmt.Sprintf("truncated from %d to %d characters", len(runes), maxLen), nil
+	}
+}
+
+// fittingConv returns a LossyConvFunc which converts values from |srcTi| to |destTi|. Integers which are out of range
+// for |destTi| are clamped to its minimum or maximum value, and values which convert successfully but can't be
+// converted back to the original value, such as floats rounded to integers, are reported as changed.
+func fittingConv(ctx context.Context, vrw types.ValueReadWriter, srcTi, destTi typeinfo.TypeInfo) LossyConvFunc {
+	return func(v types.Value) (types.Value, string, error) {
+		out, err := typeinfo.Convert(ctx, vrw, v, srcTi, destTi)
+
+		if err != nil {
+			clamped, ok := clampInteger(v, srcTi, destTi)
+
+			if !ok {
+				return nil, "", err
+			}
+
+			out, err = destTi.ParseValue(ctx, vrw, &clamped)
+
+			if err != nil {
+				return nil, "", err
+			}
+
+			return out, fmt.Sprintf("out of range for %s. clamped to %s", destTi.String(), clamped), nil
+		}
+
+		back, err := typeinfo.Convert(ctx, vrw, out, destTi, srcTi)
+
+		if err == nil && !back.Equals(v) {
+			return out, fmt.Sprintf("changed by conversion to %s", destTi.String()), nil
+		}
+
+		return out, "", nil
+	}
+}
+
+// integerBounds are the minimum and maximum values of each integer type.
+var integerBounds = map[query.Type][2]*big.Int{
+	sqltypes.Int8:   {big.NewInt(math.MinInt8), big.NewInt(math.MaxInt8)},
+	sqltypes.Int16:  {big.NewInt(math.MinInt16), big.NewInt(math.MaxInt16)},
+	sqltypes.Int24:  {big.NewInt(-1 << 23), big.NewInt(1<<23 - 1)},
+	sqltypes.Int32:  {big.NewInt(math.MinInt32), big.NewInt(math.MaxInt32)},
+	sqltypes.Int64:  {big.NewInt(math.MinInt64), big.NewInt(math.MaxInt64)},
+	sqltypes.Uint8:  {big.NewInt(0), big.NewInt(math.MaxUint8)},
+	sqltypes.Uint16: {big.NewInt(0), big.NewInt(math.MaxUint16)},
+	sqltypes.Uint24: {big.NewInt(0), big.NewInt(1<<24 - 1)},
+	sqltypes.Uint32: {big.NewInt(0), big.NewInt(math.MaxUint32)},
+	sqltypes.Uint64: {big.NewInt(0), new(big.Int).SetUint64(math.MaxUint64)},
+}
+
+// clampInteger returns the value of the integer type |destTi| nearest to the numeric value |v| when |v| is outside of
+// its range.
+func clampInteger(v types.Value, srcTi, destTi typeinfo.TypeInfo) (string, bool) {
+	bounds, ok := integerBounds[destTi.ToSqlType().Type()]
+
+	if !ok {
+		return "", false
+	}
+
+	str, err := srcTi.FormatValue(v)
+
+	if err != nil || str == nil {
+		return "", false
+	}
+
+	f, ok := new(big.Float).SetString(*str)
+
+	if !ok {
+		return "", false
+	}
+
+	if f.Cmp(new(big.Float).SetInt(bounds[0])) < 0 {
+		return bounds[0].String(), true
+	} else if f.Cmp(new(big.Float).SetInt(bounds[1])) > 0 {
+		return bounds[1].String(), true
+	}
+
+	return "", false
+}
+
+// IsLossless returns whether converting rows of |srcSch| to |destSch|, with the columns mapped by |srcToDest|, keeps
+// the value of every mapped column, which is the case when each mapped column keeps its type or is widened to a type
+// which can hold every value of it. If it doesn't, the tags of the source columns which may lose data are returned in
+// ascending order. Columns which aren't mapped aren't considered.
+func IsLossless(srcSch, destSch schema.Schema, srcToDest map[uint64]uint64) (bool, []uint64, error) {
+	srcCols := srcSch.GetAllCols()
+	destCols := destSch.GetAllCols()
+
+	var lossyTags []uint64
+	for srcTag, destTag := range srcToDest {
+		srcCol, ok := srcCols.GetByTag(srcTag)
+
+		if !ok {
+			return false, nil, fmt.Errorf("mapped tag %d is not a column of the source schema", srcTag)
+		}
+
+		destCol, ok := destCols.GetByTag(destTag)
+
+		if !ok {
+			return false, nil, fmt.Errorf("mapped tag %d is not a column of the destination schema", destTag)
+		}
+
+		if !isLosslessConversion(srcCol.TypeInfo, destCol.TypeInfo) {
+			lossyTags = append(lossyTags, srcTag)
+		}
+	}
+
+	sort.Slice(lossyTags, func(i, j int) bool {
+		return lossyTags[i] < lossyTags[j]
+	})
+
+	return len(lossyTags) == 0, lossyTags, nil
+}
+
+// isLosslessConversion returns whether converting values of |srcTi| to |destTi| and back always produces the original
+// values. It is conservative, and returns false for any conversion which it can't show is lossless.
+func isLosslessConversion(srcTi, destTi typeinfo.TypeInfo) bool {
+	if srcTi.Equals(destTi) {
+		return true
+	}
+
+	srcType := srcTi.ToSqlType()
+	destType := destTi.ToSqlType()
+	srcBounds, srcIsInt := integerBounds[srcType.Type()]
+	destBounds, destIsInt := integerBounds[destType.Type()]
+
+	if srcIsInt && destIsInt {
+		return destBounds[0].Cmp(srcBounds[0]) <= 0 && destBounds[1].Cmp(srcBounds[1]) >= 0
+	} else if srcType.Type() == sqltypes.Float32 && destType.Type() == sqltypes.Float64 {
+		return true
+	}
+
+	destStr, ok := destType.(sql.StringType)
+
+	if !ok {
+		return false
+	}
+
+	// CHAR and BINARY columns drop or add trailing padding
+	if (destType.Type() == sqltypes.Char || destType.Type() == sqltypes.Binary) && srcType.Type() != destType.Type() {
+		return false
+	}
+
+	maxLen := destStr.MaxCharacterLength()
+	if srcStr, ok := srcType.(sql.StringType); ok {
+		// any other character set may not be able to represent every character of the source's, see checkCharset
+		srcCs, destCs := srcStr.CharacterSet(), destStr.CharacterSet()
+		sameCs := srcCs == destCs || (srcCs != sql.CharacterSet_binary && destCs == sql.CharacterSet_utf8mb4)
+		return sameCs && maxLen >= srcStr.MaxCharacterLength()
+	} else if srcIsInt && destStr.CharacterSet() != sql.CharacterSet_binary {
+		return maxLen >= int64(len(srcBounds[0].String())) && maxLen >= int64(len(srcBounds[1].String()))
+	}
+
+	return false
+}
@@ -0,0 +1,122 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rowconv
+
+import (
+	"testing"
+
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/vitess/go/sqltypes"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema"
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema/typeinfo"
+)
+
+func TestIsLossless(t *testing.T) {
+	srcSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		mustColumnWithTypeInfo("id", 0, typeinfo.Int32Type, true),
+		mustColumnWithTypeInfo("price", 1, typeinfo.Float32Type, false),
+		mustColumnWithTypeInfo("name", 2, typeinfo.StringDefaultType, false),
+		mustColumnWithTypeInfo("count", 3, typeinfo.Int64Type, false),
+	))
+
+	tests := []struct {
+		name      string
+		destSch   schema.Schema
+		lossless  bool
+		lossyTags []uint64
+	}{
+		{
+			name:     "identity",
+			destSch:  srcSch,
+			lossless: true,
+		},
+		{
+			name: "widenings",
+			destSch: schema.MustSchemaFromCols(schema.NewColCollection(
+				mustColumnWithTypeInfo("id", 0, typeinfo.Int64Type, true),
+				mustColumnWithTypeInfo("price", 1, typeinfo.Float64Type, false),
+				mustColumnWithTypeInfo("name", 2, typeinfo.StringDefaultType, false),
+				mustColumnWithTypeInfo("count", 3, typeinfo.Int64Type, false),
+			)),
+			lossless: true,
+		},
+		{
+			name: "narrowings",
+			destSch: schema.MustSchemaFromCols(schema.NewColCollection(
+				mustColumnWithTypeInfo("id", 0, typeinfo.Int32Type, true),
+				mustColumnWithTypeInfo("price", 1, typeinfo.Int64Type, false),
+				mustColumnWithTypeInfo("name", 2, typeinfo.StringDefaultType, false),
+				mustColumnWithTypeInfo("count", 3, typeinfo.Int16Type, false),
+			)),
+			lossless:  false,
+			lossyTags: []uint64{1, 3},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mapping, err := TagMapping(srcSch, test.destSch)
+			require.NoError(t, err)
+
+			lossless, lossyTags, err := IsLossless(srcSch, test.destSch, mapping.SrcToDest)
+			require.NoError(t, err)
+			require.Equal(t, test.lossless, lossless)
+			require.Equal(t, test.lossyTags, lossyTags)
+		})
+	}
+
+	// columns which aren't mapped are ignored
+	lossless, lossyTags, err := IsLossless(srcSch, srcSch, map[uint64]uint64{0: 0})
+	require.NoError(t, err)
+	require.True(t, lossless)
+	require.Empty(t, lossyTags)
+
+	_, _, err = IsLossless(srcSch, srcSch, map[uint64]uint64{0: 4})
+	require.Error(t, err)
+	_, _, err = IsLossless(srcSch, srcSch, map[uint64]uint64{4: 0})
+	require.Error(t, err)
+}
+
+func TestIsLosslessCharset(t *testing.T) {
+	varchar := func(length int64, collation sql.Collation) typeinfo.TypeInfo {
+		strType, err := sql.CreateString(sqltypes.VarChar, length, collation)
+		require.NoError(t, err)
+		ti, err := typeinfo.FromSqlType(strType)
+		require.NoError(t, err)
+		return ti
+	}
+
+	tests := []struct {
+		name     string
+		src      typeinfo.TypeInfo
+		dest     typeinfo.TypeInfo
+		lossless bool
+	}{
+		{"same charset", varchar(10, sql.Collation_latin1_swedish_ci), varchar(20, sql.Collation_latin1_bin), true},
+		{"into utf8mb4", varchar(10, sql.Collation_latin1_swedish_ci), varchar(10, sql.Collation_Default), true},
+		{"out of utf8mb4", varchar(10, sql.Collation_Default), varchar(10, sql.Collation_latin1_swedish_ci), false},
+		{"into utf8mb3", varchar(10, sql.Collation_Default), varchar(10, sql.Collation_utf8mb3_general_ci), false},
+		{"into binary", varchar(10, sql.Collation_Default), varchar(10, sql.Collation_binary), false},
+		{"out of binary", varchar(10, sql.Collation_binary), varchar(10, sql.Collation_Default), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.lossless, isLosslessConversion(test.src, test.dest))
+		})
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rowconv
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/dolthub/dolt/go/store/types"
+)
+
+// ColumnReducer computes the value of a merged column from the values of its source columns, which are given in the
+// order the source columns were registered. Source columns which have no value are given as types.NullValue.
+type ColumnReducer func([]types.Value) (types.Value, error)
+
+// MergedColumn is a destination column whose value is computed from the values of several source columns.
+type MergedColumn struct {
+	DestTag uint64
+	SrcTags []uint64
+	Reduce  ColumnReducer
+}
+
+// MergeColumns registers the destination column with tag |destTag| as the result of calling |reduce| with the values
+// of the source columns |srcTags|. The destination column must not already be mapped from a source column, and the
+// value returned by |reduce| must be of the destination column's type. A null result leaves the column without a
+// value. Source columns may be merged into several destination columns, and may also be mapped as usual. Identity
+// converters map every destination column, so columns can't be merged by them.
+func (rc *RowConverter) MergeColumns(destTag uint64, srcTags []uint64, reduce ColumnReducer) error {
+	if rc.FieldMapping == nil {
+		return errors.New("cannot merge columns without a field mapping")
+	}
+
+	if len(srcTags) == 0 {
+		return fmt.Errorf("no source columns to merge into the column with tag %d", destTag)
+	}
+
+	if err := rc.checkUnmappedDestTag(destTag); err != nil {
+		return err
+	}
+
+	for _, tag := range srcTags {
+		if _, ok := rc.SrcSch.GetAllCols().GetByTag(tag); !ok {
+			return fmt.Errorf("unknown source column with tag %d", tag)
+		}
+	}
+
+	rc.Merges = append(rc.Merges, MergedColumn{DestTag: destTag, SrcTags: srcTags, Reduce: reduce})
+	return nil
+}
+
+// checkUnmappedDestTag returns an error if |destTag| is not a column of the destination schema, or if its value is
+// already provided by a mapped, merged or derived column, or has a default.
+func (rc *RowConverter) checkUnmappedDestTag(destTag uint64) error {
+	if _, ok := rc.DestSch.GetAllCols().GetByTag(destTag); !ok {
+		return fmt.Errorf("unknown destination column with tag %d", destTag)
+	}
+
+	for srcTag, tag := range rc.SrcToDest {
+		if tag == destTag {
+			return fmt.Errorf("column with tag %d is already mapped from the column with tag %d", destTag, srcTag)
+		}
+	}
+
+	for _, merge := range rc.Merges {
+		if merge.DestTag == destTag {
+			return fmt.Errorf("column with tag %d is already merged", destTag)
+		}
+	}
+
+	for _, derived := range rc.Derived {
+		if derived.DestTag == destTag {
+			return fmt.Errorf("column with tag %d is already derived", destTag)
+		}
+	}
+
+	for _, def := range rc.Defaults {
+		if def.DestTag == destTag {
+			return fmt.Errorf("column with tag %d already has a default", destTag)
+		}
+	}
+
+	return nil
+}
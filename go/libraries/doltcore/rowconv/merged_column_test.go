@@ -0,0 +1,126 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rowconv
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dolthub/dolt/go/libraries/doltcore/row"
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema"
+	"github.com/dolthub/dolt/go/store/types"
+)
+
+var mergeSrcSch = schema.MustSchemaFromCols(schema.NewColCollection(
+	schema.NewColumn("id", 0, types.IntKind, true),
+	schema.NewColumn("first", 1, types.StringKind, false),
+	schema.NewColumn("last", 2, types.StringKind, false),
+	schema.NewColumn("mobile", 3, types.StringKind, false),
+	schema.NewColumn("home", 4, types.StringKind, false),
+))
+
+var mergeDestSch = schema.MustSchemaFromCols(schema.NewColCollection(
+	schema.NewColumn("id", 0, types.IntKind, true),
+	schema.NewColumn("full_name", 10, types.StringKind, false),
+	schema.NewColumn("phone", 11, types.StringKind, false),
+))
+
+func concat(vals []types.Value) (types.Value, error) {
+	var str string
+	for _, val := range vals {
+		if !types.IsNull(val) {
+			str += string(val.(types.String))
+		}
+	}
+
+	return types.String(str), nil
+}
+
+func coalesce(vals []types.Value) (types.Value, error) {
+	for _, val := range vals {
+		if !types.IsNull(val) {
+			return val, nil
+		}
+	}
+
+	return types.NullValue, nil
+}
+
+func TestMergeColumns(t *testing.T) {
+	mapping, err := NewFieldMapping(mergeSrcSch, mergeDestSch, map[uint64]uint64{0: 0})
+	require.NoError(t, err)
+
+	vrw := types.NewMemoryValueStore()
+	rConv, err := NewRowConverter(context.Background(), vrw, mapping)
+	require.NoError(t, err)
+
+	require.NoError(t, rConv.MergeColumns(10, []uint64{1, 2}, concat))
+	require.NoError(t, rConv.MergeColumns(11, []uint64{3, 4}, coalesce))
+
+	tests := []struct {
+		name     string
+		in       row.TaggedValues
+		expected row.TaggedValues
+	}{
+		{
+			"both phones",
+			row.TaggedValues{0: types.Int(1), 1: types.String("Ada"), 2: types.String("Lovelace"), 3: types.String("555-0100"), 4: types.String("555-0199")},
+			row.TaggedValues{0: types.Int(1), 10: types.String("AdaLovelace"), 11: types.String("555-0100")},
+		},
+		{
+			"home phone only",
+			row.TaggedValues{0: types.Int(2), 1: types.String("Grace"), 4: types.String("555-0199")},
+			row.TaggedValues{0: types.Int(2), 10: types.String("Grace"), 11: types.String("555-0199")},
+		},
+		{
+			"no phone",
+			row.TaggedValues{0: types.Int(3), 2: types.String("Hopper")},
+			row.TaggedValues{0: types.Int(3), 10: types.String("Hopper")},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inRow, err := row.New(vrw.Format(), mergeSrcSch, test.in)
+			require.NoError(t, err)
+
+			outRow, err := rConv.Convert(inRow)
+			require.NoError(t, err)
+
+			expected, err := row.New(vrw.Format(), mergeDestSch, test.expected)
+			require.NoError(t, err)
+			require.True(t, row.AreEqual(expected, outRow, mergeDestSch), row.Fmt(context.Background(), outRow, mergeDestSch))
+		})
+	}
+}
+
+func TestMergeColumnsErrors(t *testing.T) {
+	mapping, err := NewFieldMapping(mergeSrcSch, mergeDestSch, map[uint64]uint64{0: 0, 1: 10})
+	require.NoError(t, err)
+
+	vrw := types.NewMemoryValueStore()
+	rConv, err := NewRowConverter(context.Background(), vrw, mapping)
+	require.NoError(t, err)
+
+	require.Error(t, rConv.MergeColumns(10, []uint64{1, 2}, concat), "destination is already mapped")
+	require.Error(t, rConv.MergeColumns(12, []uint64{1, 2}, concat), "unknown destination")
+	require.Error(t, rConv.MergeColumns(11, []uint64{3, 7}, coalesce), "unknown source")
+	require.Error(t, rConv.MergeColumns(11, nil, coalesce), "no sources")
+
+	require.NoError(t, rConv.MergeColumns(11, []uint64{3, 4}, coalesce))
+	require.Error(t, rConv.MergeColumns(11, []uint64{3, 4}, coalesce), "destination is already merged")
+}
@@ -0,0 +1,86 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rowconv
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/dolthub/dolt/go/libraries/doltcore/row"
+)
+
+// ConvertParallel converts each of |rows| in the same way as ConvertBatch, spreading the rows across |workers|
+// goroutines. The returned rows are in the same order as |rows|. If |workers| is less than 1, GOMAXPROCS workers are
+// used.
+//
+// The conversion funcs of the plan don't modify any shared state, so a single plan can be used from several
+// goroutines. The first row which fails to convert cancels the remaining work, and its error, which identifies the
+// index of the row, is returned. When set, |rc.Warn| and the merge and derive funcs are called from several goroutines
+// at once and must be safe for concurrent use.
+func (rc *RowConverter) ConvertParallel(ctx context.Context, rows []row.Row, workers int) ([]row.Row, error) {
+	if rc.IdentityConverter {
+		return rc.ConvertBatchWithContext(ctx, rows)
+	}
+
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	if workers > len(rows) {
+		workers = len(rows)
+	}
+
+	if workers <= 1 {
+		return rc.ConvertBatchWithContext(ctx, rows)
+	}
+
+	outRows := make([]row.Row, len(rows))
+	next := int64(-1)
+	eg, egCtx := errgroup.WithContext(ctx)
+	for w := 0; w < workers; w++ {
+		eg.Go(func() error {
+			// each worker has its own scratch map as the tagged values are reused for every row it converts
+			scratch := make(row.TaggedValues, len(rc.Plan.Steps))
+			for {
+				i := int(atomic.AddInt64(&next, 1))
+
+				if i >= len(rows) {
+					return nil
+				}
+
+				if err := egCtx.Err(); err != nil {
+					return err
+				}
+
+				var err error
+				outRows[i], err = rc.convertInto(egCtx, rows[i], scratch)
+
+				if err != nil {
+					return fmt.Errorf("failed to convert row %d: %w", i, err)
+				}
+			}
+		})
+	}
+
+	if err := eg.Wait(); err != nil {
+		return nil, err
+	}
+
+	return outRows, nil
+}
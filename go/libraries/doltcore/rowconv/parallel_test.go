@@ -0,0 +1,132 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rowconv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dolthub/dolt/go/libraries/doltcore/row"
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema"
+	"github.com/dolthub/dolt/go/store/types"
+)
+
+func TestConvertParallel(t *testing.T) {
+	mapping, err := TypedToUntypedMapping(srcSch)
+	require.NoError(t, err)
+
+	vrw := types.NewMemoryValueStore()
+	rConv, err := NewRowConverter(context.Background(), vrw, mapping)
+	require.NoError(t, err)
+
+	rows := make([]row.Row, 1000)
+	for i := range rows {
+		rows[i], err = row.New(vrw.Format(), srcSch, row.TaggedValues{
+			0: types.UUID(uuid.New()),
+			4: types.Int(i),
+		})
+		require.NoError(t, err)
+	}
+
+	for _, workers := range []int{0, 1, 2, 7, 64, 2000} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			outRows, err := rConv.ConvertParallel(context.Background(), rows, workers)
+			require.NoError(t, err)
+			require.Len(t, outRows, len(rows))
+
+			for i, outRow := range outRows {
+				val, ok := outRow.GetColVal(4)
+				require.True(t, ok)
+				require.Equal(t, types.String(fmt.Sprint(i)), val, "row %d", i)
+			}
+		})
+	}
+
+	outRows, err := rConv.ConvertParallel(context.Background(), nil, 4)
+	require.NoError(t, err)
+	require.Empty(t, outRows)
+
+	// the identity converter returns the rows unchanged
+	identity := newIdentityConverter(mapping)
+	outRows, err = identity.ConvertParallel(context.Background(), rows, 4)
+	require.NoError(t, err)
+	require.Equal(t, rows, outRows)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = rConv.ConvertParallel(ctx, rows, 4)
+	require.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestConvertParallelError(t *testing.T) {
+	srcSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.StringKind, true),
+	))
+	destSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.IntKind, true),
+	))
+
+	mapping, err := TagMapping(srcSch, destSch)
+	require.NoError(t, err)
+
+	vrw := types.NewMemoryValueStore()
+	rConv, err := NewRowConverter(context.Background(), vrw, mapping)
+	require.NoError(t, err)
+
+	rows := make([]row.Row, 1000)
+	for i := range rows {
+		id := fmt.Sprint(i)
+
+		if i == 500 {
+			id = "five hundred"
+		}
+
+		rows[i], err = row.New(vrw.Format(), srcSch, row.TaggedValues{0: types.String(id)})
+		require.NoError(t, err)
+	}
+
+	outRows, err := rConv.ConvertParallel(context.Background(), rows, 8)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "row 500")
+	require.Nil(t, outRows)
+}
+
+func BenchmarkConvertParallel(b *testing.B) {
+	mapping, err := TypedToUntypedMapping(srcSch)
+	require.NoError(b, err)
+
+	vrw := types.NewMemoryValueStore()
+	rConv, err := NewRowConverter(context.Background(), vrw, mapping)
+	require.NoError(b, err)
+
+	rows := make([]row.Row, 4096)
+	for i := range rows {
+		rows[i] = benchmarkRow(b, vrw)
+	}
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("%d workers", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, err := rConv.ConvertParallel(context.Background(), rows, workers)
+				require.NoError(b, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rowconv
+
+import (
+	"context"
+	"io"
+
+	"github.com/dolthub/dolt/go/libraries/doltcore/row"
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema"
+)
+
+// RowReader reads rows one at a time, returning io.EOF once there are no rows left. Table readers are RowReaders.
+type RowReader interface {
+	ReadRow(ctx context.Context) (row.Row, error)
+}
+
+type schemaReader interface {
+	GetSchema() schema.Schema
+}
+
+type readCloser interface {
+	Close(ctx context.Context) error
+}
+
+// ConvertingReader is a RowReader which converts each row read from another RowReader as it is read, so that tables
+// of any size can be converted without holding more than a row in memory. It implements table.TableReadCloser.
+type ConvertingReader struct {
+	rd RowReader
+	rc *RowConverter
+}
+
+// NewConvertingReader returns a ConvertingReader which converts the rows read from |rd| using |rc|.
+func NewConvertingReader(rd RowReader, rc *RowConverter) *ConvertingReader {
+	return &ConvertingReader{rd, rc}
+}
+
+// GetSchema returns the schema of the converted rows. For an identity converter, which has no mapping, it is the
+// schema of the underlying reader if that reader has one.
+func (cr *ConvertingReader) GetSchema() schema.Schema {
+	if cr.rc.FieldMapping != nil {
+		return cr.rc.DestSch
+	}
+
+	if sr, ok := cr.rd.(schemaReader); ok {
+		return sr.GetSchema()
+	}
+
+	return nil
+}
+
+// ReadRow reads the next row from the underlying reader and converts it. Errors from the underlying reader, including
+// io.EOF, are returned unchanged, as is the error of a row which fails to convert. A nil row without an error is
+// treated as the end of the rows, and io.EOF is returned rather than a nil row.
+func (cr *ConvertingReader) ReadRow(ctx context.Context) (row.Row, error) {
+	r, err := cr.rd.ReadRow(ctx)
+
+	if r == nil {
+		if err == nil {
+			err = io.EOF
+		}
+
+		return nil, err
+	}
+
+	// some readers return their last row along with io.EOF
+	converted, convErr := cr.rc.ConvertWithContext(ctx, r)
+
+	if convErr != nil {
+		return nil, convErr
+	}
+
+	return converted, err
+}
+
+// Close closes the underlying reader if it can be closed.
+func (cr *ConvertingReader) Close(ctx context.Context) error {
+	if closer, ok := cr.rd.(readCloser); ok {
+		return closer.Close(ctx)
+	}
+
+	return nil
+}
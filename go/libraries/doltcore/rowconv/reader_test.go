@@ -0,0 +1,136 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rowconv
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dolthub/dolt/go/libraries/doltcore/row"
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema"
+	"github.com/dolthub/dolt/go/store/types"
+)
+
+// sliceReader reads |rows| and then |err|, which is io.EOF unless the reader should fail.
+type sliceReader struct {
+	rows   []row.Row
+	err    error
+	closed bool
+}
+
+func (rd *sliceReader) ReadRow(ctx context.Context) (row.Row, error) {
+	if len(rd.rows) == 0 {
+		return nil, rd.err
+	}
+
+	r := rd.rows[0]
+	rd.rows = rd.rows[1:]
+	return r, nil
+}
+
+func (rd *sliceReader) Close(ctx context.Context) error {
+	rd.closed = true
+	return nil
+}
+
+func TestConvertingReader(t *testing.T) {
+	srcSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.StringKind, true),
+	))
+	destSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.IntKind, true),
+	))
+
+	mapping, err := TagMapping(srcSch, destSch)
+	require.NoError(t, err)
+
+	vrw := types.NewMemoryValueStore()
+	rConv, err := NewRowConverter(context.Background(), vrw, mapping)
+	require.NoError(t, err)
+
+	readRows := func(ids ...string) []row.Row {
+		var rows []row.Row
+		for _, id := range ids {
+			r, err := row.New(vrw.Format(), srcSch, row.TaggedValues{0: types.String(id)})
+			require.NoError(t, err)
+			rows = append(rows, r)
+		}
+
+		return rows
+	}
+
+	t.Run("converts every row", func(t *testing.T) {
+		rd := &sliceReader{rows: readRows("1", "2", "3"), err: io.EOF}
+		cr := NewConvertingReader(rd, rConv)
+		require.Equal(t, destSch, cr.GetSchema())
+
+		for i := 1; i <= 3; i++ {
+			r, err := cr.ReadRow(context.Background())
+			require.NoError(t, err)
+			val, _ := r.GetColVal(0)
+			require.Equal(t, types.Int(i), val)
+		}
+
+		r, err := cr.ReadRow(context.Background())
+		require.Equal(t, io.EOF, err)
+		require.Nil(t, r)
+
+		require.NoError(t, cr.Close(context.Background()))
+		require.True(t, rd.closed)
+	})
+
+	t.Run("forwards read errors", func(t *testing.T) {
+		readErr := errors.New("read failed")
+		cr := NewConvertingReader(&sliceReader{rows: readRows("1"), err: readErr}, rConv)
+
+		_, err := cr.ReadRow(context.Background())
+		require.NoError(t, err)
+
+		_, err = cr.ReadRow(context.Background())
+		require.Equal(t, readErr, err)
+	})
+
+	t.Run("nil row without an error ends the rows", func(t *testing.T) {
+		cr := NewConvertingReader(&sliceReader{rows: readRows("1"), err: nil}, rConv)
+
+		_, err := cr.ReadRow(context.Background())
+		require.NoError(t, err)
+
+		r, err := cr.ReadRow(context.Background())
+		require.Equal(t, io.EOF, err)
+		require.Nil(t, r)
+	})
+
+	t.Run("forwards conversion errors", func(t *testing.T) {
+		cr := NewConvertingReader(&sliceReader{rows: readRows("1", "two", "3"), err: io.EOF}, rConv)
+
+		_, err := cr.ReadRow(context.Background())
+		require.NoError(t, err)
+
+		r, err := cr.ReadRow(context.Background())
+		require.Error(t, err)
+		require.Nil(t, r)
+
+		// the reader can carry on past a row which fails to convert
+		r, err = cr.ReadRow(context.Background())
+		require.NoError(t, err)
+		val, _ := r.GetColVal(0)
+		require.Equal(t, types.Int(3), val)
+	})
+}
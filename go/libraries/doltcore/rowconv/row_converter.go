@@ -16,15 +16,56 @@ package rowconv
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"time"
+
+	sqle "github.com/dolthub/go-mysql-server"
+	"github.com/dolthub/go-mysql-server/sql"
 
 	"github.com/dolthub/dolt/go/libraries/doltcore/row"
 	"github.com/dolthub/dolt/go/libraries/doltcore/schema"
 	"github.com/dolthub/dolt/go/libraries/doltcore/schema/typeinfo"
+	"github.com/dolthub/dolt/go/libraries/utils/set"
 	"github.com/dolthub/dolt/go/store/types"
 )
 
-var IdentityConverter = &RowConverter{nil, true, nil}
+// ErrNotInvertible is returned when building the inverse of a RowConverter whose conversion loses data.
+var ErrNotInvertible = errors.New("row conversion is not invertible")
+
+// ErrUnmappedPrimaryKey is returned when rows of a keyless schema are converted to a keyed schema by a mapping which
+// leaves some of the destination's primary key columns without a source column.
+var ErrUnmappedPrimaryKey = errors.New("primary key column is not mapped")
+
+// ErrUnsupportedConversion is matched by the UnsupportedConversionError returned when creating a converter for a
+// column whose type can't be converted to the type of its destination column.
+var ErrUnsupportedConversion = errors.New("unsupported conversion")
+
+// UnsupportedConversionError describes a column whose type can't be converted to the type of its destination column.
+// It is returned when the converter is created, before any rows are converted.
+type UnsupportedConversionError struct {
+	// SrcTag is the tag of the column in the source schema
+	SrcTag uint64
+	// DestTag is the tag of the column in the destination schema
+	DestTag  uint64
+	SrcType  typeinfo.TypeInfo
+	DestType typeinfo.TypeInfo
+	Err      error
+}
+
+func (e UnsupportedConversionError) Error() string {
+	return fmt.Sprintf("cannot convert column with tag %d from %s to %s: %v", e.SrcTag, e.SrcType.String(), e.DestType.String(), e.Err)
+}
+
+func (e UnsupportedConversionError) Unwrap() error {
+	return e.Err
+}
+
+// Is returns whether |target| is ErrUnsupportedConversion.
+func (e UnsupportedConversionError) Is(target error) bool {
+	return target == ErrUnsupportedConversion
+}
 
 // RowConverter converts rows from one schema to another
 type RowConverter struct {
@@ -32,23 +73,231 @@ type RowConverter struct {
 	*FieldMapping
 	// IdentityConverter is a bool which is true if the converter is doing nothing.
 	IdentityConverter bool
-	ConvFuncs         map[uint64]types.MarshalCallback
+	// ConvFuncs maps each source tag to the function converting its values. It holds the same functions as Plan.
+	ConvFuncs map[uint64]types.MarshalCallback
+	// Plan is the compiled conversion used to convert rows.
+	Plan *ConversionPlan
+	// Warn, when set, is called for each value which is changed to fit its destination column. Values which would
+	// otherwise fail to convert, such as integers which overflow their destination type, are converted to the nearest
+	// value the destination column can hold instead. When Warn is nil such values fail the conversion.
+	Warn ConversionWarningFunc
+	// Merges are the destination columns whose values are computed from several source columns.
+	Merges []MergedColumn
+	// Derived are the destination columns whose values are computed from the whole source row.
+	Derived []DerivedColumn
+	// Defaults are the destination columns which have the same value in every converted row.
+	Defaults []ColumnDefault
+	// Stats, when set, accumulates counts of the rows and values converted. It is nil by default, which disables
+	// counting.
+	Stats *ConversionStats
+	// DecimalRounding is how values are rounded when they are converted to a DECIMAL column with fewer decimal places.
+	// It is RoundHalfUp by default.
+	DecimalRounding DecimalRounding
+	// BinaryEncoding is how the bytes of binary values are written when they are converted to a text column. It is
+	// BinaryRaw by default.
+	BinaryEncoding BinaryEncoding
+	// Cache, when set, remembers the conversions of recently converted values, which saves converting the same value
+	// over and over in columns with few distinct values. It is nil by default, which converts every value.
+	Cache *ConversionCache
+	// TargetFormat, when set, is the NomsBinFormat of the converted rows, which converts rows from one storage format to
+	// another. It is nil by default, which builds converted rows in the format of the row they were converted from.
+	TargetFormat *types.NomsBinFormat
+}
+
+// NewIdentityConverter returns a RowConverter which returns rows unchanged. Each call returns a new converter, so
+// setting options such as Stats or TargetFormat on it doesn't affect other users.
+func NewIdentityConverter() *RowConverter {
+	return newIdentityConverter(nil)
 }
 
 func newIdentityConverter(mapping *FieldMapping) *RowConverter {
-	return &RowConverter{mapping, true, nil}
+	return &RowConverter{
+		FieldMapping:      mapping,
+		IdentityConverter: true,
+		DecimalRounding:   RoundHalfUp,
+		BinaryEncoding:    BinaryRaw,
+	}
 }
 
 // NewRowConverter creates a row converter from a given FieldMapping.
 func NewRowConverter(ctx context.Context, vrw types.ValueReadWriter, mapping *FieldMapping) (*RowConverter, error) {
+	return NewRowConverterInLocation(ctx, vrw, mapping, nil)
+}
+
+// NewRowConverterInLocation is NewRowConverter, but conversions between TIMESTAMP columns, which hold instants in
+// UTC, and DATETIME or DATE columns, which hold wall clock times, use the wall clock time in |loc|.
+func NewRowConverterInLocation(ctx context.Context, vrw types.ValueReadWriter, mapping *FieldMapping, loc *time.Location) (*RowConverter, error) {
 	if nec, err := IsNecessary(mapping.SrcSch, mapping.DestSch, mapping.SrcToDest); err != nil {
 		return nil, err
 	} else if !nec {
 		return newIdentityConverter(mapping), nil
 	}
 
-	convFuncs := make(map[uint64]types.MarshalCallback, len(mapping.SrcToDest))
+	plan, err := NewConversionPlanInLocation(ctx, vrw, mapping, loc)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewRowConverterFromPlan(mapping, plan), nil
+}
+
+// NewRowConverterToFormat is NewRowConverter, but the converted rows are built in the format |nbf| rather than in the
+// format of the rows they are converted from. Rows are rebuilt in |nbf| even when the mapping doesn't change them.
+func NewRowConverterToFormat(ctx context.Context, vrw types.ValueReadWriter, mapping *FieldMapping, nbf *types.NomsBinFormat) (*RowConverter, error) {
+	rc, err := NewRowConverter(ctx, vrw, mapping)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rc.TargetFormat = nbf
+	return rc, nil
+}
+
+// NewRowConverterFromPlan creates a row converter which uses a previously compiled ConversionPlan for |mapping|, so
+// that callers which create a converter for each batch of rows only compile the plan once.
+func NewRowConverterFromPlan(mapping *FieldMapping, plan *ConversionPlan) *RowConverter {
+	return &RowConverter{
+		FieldMapping:    mapping,
+		ConvFuncs:       plan.ConvFuncs(),
+		Plan:            plan,
+		DecimalRounding: RoundHalfUp,
+		BinaryEncoding:  BinaryRaw,
+	}
+}
+
+// ConversionPlan is the compiled conversion of each column mapped by a FieldMapping. Its steps are ordered by source
+// tag, so rows are converted by iterating them rather than by looking up the conversion of each column.
+type ConversionPlan struct {
+	Steps []ConversionStep
+}
+
+// ConversionStep converts the values of a source column into values of its destination column.
+type ConversionStep struct {
+	SrcTag  uint64
+	DestTag uint64
+	Conv    types.MarshalCallback
+	// LossyConv converts values in the same way as Conv, except that values which don't fit the destination column
+	// are converted to the nearest value which does, along with a description of what was lost. It is nil when the
+	// conversion can never lose anything.
+	LossyConv LossyConvFunc
+	// NullConv returns the value to store in the destination column when the source value is null. It is nil when the
+	// destination column is nullable.
+	NullConv func(ctx context.Context) (types.Value, error)
+	// PassThrough is true when the source and destination columns have the same type, so Conv returns values
+	// unchanged.
+	PassThrough bool
+	// DecimalConv converts values to a DECIMAL column with a given rounding. It is nil unless the destination column is
+	// a DECIMAL and the source column is numeric, and is used instead of Conv and LossyConv when set.
+	DecimalConv DecimalConvFunc
+	// BinaryConv converts values to a text column with a given encoding. It is nil unless the source column is binary
+	// and the destination column is text, and is used instead of Conv and LossyConv when set.
+	BinaryConv BinaryConvFunc
+}
+
+// TransformedTags returns the tags of the destination columns whose values are transformed rather than copied from
+// the source row unchanged. These are the columns converted from a different type, along with any merged and derived
+// columns. It is empty for an identity converter.
+func (rc *RowConverter) TransformedTags() *set.Uint64Set {
+	tags := set.NewUint64Set(nil)
+
+	if rc.IdentityConverter {
+		return tags
+	}
+
+	for _, step := range rc.Plan.Steps {
+		if !step.PassThrough {
+			tags.Add(step.DestTag)
+		}
+	}
+
+	for _, merge := range rc.Merges {
+		tags.Add(merge.DestTag)
+	}
+
+	for _, derived := range rc.Derived {
+		tags.Add(derived.DestTag)
+	}
+
+	for _, def := range rc.Defaults {
+		tags.Add(def.DestTag)
+	}
+
+	return tags
+}
+
+// Inverse returns a RowConverter which converts the rows produced by |rc| back to the source schema. ErrNotInvertible
+// is returned if |rc| loses data, either by dropping source columns, mapping several source columns to the same
+// destination column, or converting values to a type which can't hold every value of the source type. Columns with
+// defaults have no source column, so the inverse drops them.
+func (rc *RowConverter) Inverse(ctx context.Context, vrw types.ValueReadWriter) (*RowConverter, error) {
+	if rc.FieldMapping == nil {
+		return rc, nil
+	}
+
+	srcCols := rc.SrcSch.GetAllCols()
+	destCols := rc.DestSch.GetAllCols()
+	destTags := make(map[uint64]struct{}, len(rc.SrcToDest))
+	for _, srcCol := range srcCols.GetColumns() {
+		destTag, ok := rc.SrcToDest[srcCol.Tag]
+
+		if !ok && rc.IsDropped(srcCol.Tag) {
+			return nil, fmt.Errorf("%w: column `%s` is dropped", ErrNotInvertible, srcCol.Name)
+		} else if !ok {
+			return nil, fmt.Errorf("%w: column `%s` is not mapped to a destination column", ErrNotInvertible, srcCol.Name)
+		}
+
+		destCol, ok := destCols.GetByTag(destTag)
+
+		if !ok {
+			return nil, fmt.Errorf("Could not find column being mapped. src tag: %d, dest tag: %d", srcCol.Tag, destTag)
+		}
+
+		if _, ok := destTags[destTag]; ok {
+			return nil, fmt.Errorf("%w: more than one column is mapped to column `%s`", ErrNotInvertible, destCol.Name)
+		}
+
+		destTags[destTag] = struct{}{}
+
+		if !isLosslessConversion(srcCol.TypeInfo, destCol.TypeInfo) {
+			return nil, fmt.Errorf("%w: converting column `%s` from %s to %s may lose data", ErrNotInvertible, srcCol.Name, srcCol.TypeInfo.String(), destCol.TypeInfo.String())
+		}
+	}
+
+	if len(rc.Merges) > 0 {
+		return nil, fmt.Errorf("%w: column `%s` is merged from several columns", ErrNotInvertible, rc.DestSch.GetAllCols().TagToCol[rc.Merges[0].DestTag].Name)
+	} else if len(rc.Derived) > 0 {
+		return nil, fmt.Errorf("%w: column `%s` is derived from the source row", ErrNotInvertible, rc.DestSch.GetAllCols().TagToCol[rc.Derived[0].DestTag].Name)
+	}
+
+	inverse := InvertMapping(rc.FieldMapping)
+
+	if rc.IdentityConverter {
+		return newIdentityConverter(inverse), nil
+	}
+
+	return NewRowConverter(ctx, vrw, inverse)
+}
+
+// NewConversionPlan compiles the conversion of every column mapped by |mapping|.
+func NewConversionPlan(ctx context.Context, vrw types.ValueReadWriter, mapping *FieldMapping) (*ConversionPlan, error) {
+	return NewConversionPlanInLocation(ctx, vrw, mapping, nil)
+}
+
+// NewConversionPlanInLocation is NewConversionPlan, but conversions between TIMESTAMP columns and DATETIME or DATE
+// columns use the wall clock time in |loc|. When |loc| is nil the wall clock time in UTC is used.
+func NewConversionPlanInLocation(ctx context.Context, vrw types.ValueReadWriter, mapping *FieldMapping, loc *time.Location) (*ConversionPlan, error) {
+	if err := checkKeylessToKeyed(mapping); err != nil {
+		return nil, err
+	}
+
+	steps := make([]ConversionStep, 0, len(mapping.SrcToDest))
 	for srcTag, destTag := range mapping.SrcToDest {
+		if mapping.IsDropped(srcTag) {
+			continue
+		}
+
 		destCol, destOk := mapping.DestSch.GetAllCols().GetByTag(destTag)
 		srcCol, srcOk := mapping.SrcSch.GetAllCols().GetByTag(srcTag)
 
@@ -56,13 +305,23 @@ func NewRowConverter(ctx context.Context, vrw types.ValueReadWriter, mapping *Fi
 			return nil, fmt.Errorf("Could not find column being mapped. src tag: %d, dest tag: %d", srcTag, destTag)
 		}
 
-		if srcCol.TypeInfo.Equals(destCol.TypeInfo) {
-			convFuncs[srcTag] = func(v types.Value) (types.Value, error) {
+		var convFunc types.MarshalCallback
+		var lossyConv LossyConvFunc
+		var decConv DecimalConvFunc
+		var binConv BinaryConvFunc
+		passThrough := srcCol.TypeInfo.Equals(destCol.TypeInfo)
+		if passThrough {
+			convFunc = func(v types.Value) (types.Value, error) {
 				return v, nil
 			}
-		}
-		if typeinfo.IsStringType(destCol.TypeInfo) {
-			convFuncs[srcTag] = func(v types.Value) (types.Value, error) {
+		} else if binConv = binaryConv(ctx, vrw, srcCol.TypeInfo, destCol.TypeInfo, srcCol.Name); binConv != nil {
+			convFunc = func(v types.Value) (types.Value, error) {
+				return binConv(v, BinaryRaw)
+			}
+		} else if typeinfo.IsStringType(destCol.TypeInfo) {
+			strType := destCol.TypeInfo.ToSqlType().(sql.StringType)
+			destName := destCol.Name
+			convFunc = func(v types.Value) (types.Value, error) {
 				val, err := srcCol.TypeInfo.FormatValue(v)
 				if err != nil {
 					return nil, err
@@ -70,52 +329,681 @@ func NewRowConverter(ctx context.Context, vrw types.ValueReadWriter, mapping *Fi
 				if val == nil {
 					return types.NullValue, nil
 				}
+				if err := checkCharset(*val, strType, destName); err != nil {
+					return nil, err
+				}
 				return types.String(*val), nil
 			}
+			lossyConv = truncatingStringConv(convFunc, destCol.TypeInfo)
+		} else if docConv := jsonConv(ctx, vrw, srcCol.TypeInfo, destCol.TypeInfo, srcCol.Name); docConv != nil {
+			convFunc = docConv
+		} else if enumConv := memberConv(srcCol.TypeInfo, destCol.TypeInfo, srcCol.Name); enumConv != nil {
+			convFunc = enumConv
+		} else if boolConv := booleanConv(srcCol.TypeInfo, destCol.TypeInfo); boolConv != nil {
+			convFunc = boolConv
+		} else if zoneConv := timeZoneConv(ctx, vrw, srcCol.TypeInfo, destCol.TypeInfo, loc); zoneConv != nil {
+			convFunc = zoneConv
+		} else if decConv = decimalConv(ctx, vrw, srcCol.TypeInfo, destCol.TypeInfo, srcCol.Name); decConv != nil {
+			convFunc = func(v types.Value) (types.Value, error) {
+				out, _, err := decConv(v, RoundHalfUp)
+				return out, err
+			}
+		} else if sql.IsNumber(destCol.TypeInfo.ToSqlType()) {
+			convFunc = func(v types.Value) (types.Value, error) {
+				out, err := typeinfo.Convert(ctx, vrw, v, srcCol.TypeInfo, destCol.TypeInfo)
+
+				if err != nil {
+					return nil, numericConvErr(srcCol, destCol, v, err)
+				}
+
+				return out, nil
+			}
+			fitting := fittingConv(ctx, vrw, srcCol.TypeInfo, destCol.TypeInfo)
+			lossyConv = func(v types.Value) (types.Value, string, error) {
+				out, reason, err := fitting(v)
+
+				if err != nil {
+					return nil, "", numericConvErr(srcCol, destCol, v, err)
+				}
+
+				return out, reason, nil
+			}
 		} else {
-			convFuncs[srcTag] = func(v types.Value) (types.Value, error) {
+			// there are no spatial type infos yet, so geometry columns can't reach a conversion of their own. Once they
+			// exist, widening a POINT to a GEOMETRY and narrowing a GEOMETRY holding a point need a branch above which
+			// also checks that the SRIDs of the columns are compatible.
+			if _, _, err := typeinfo.GetTypeConverter(ctx, srcCol.TypeInfo, destCol.TypeInfo); err != nil {
+				// no value could be converted, so fail now rather than on the first row
+				return nil, UnsupportedConversionError{SrcTag: srcTag, DestTag: destTag, SrcType: srcCol.TypeInfo, DestType: destCol.TypeInfo, Err: err}
+			}
+
+			convFunc = func(v types.Value) (types.Value, error) {
 				return typeinfo.Convert(ctx, vrw, v, srcCol.TypeInfo, destCol.TypeInfo)
 			}
+			lossyConv = fittingConv(ctx, vrw, srcCol.TypeInfo, destCol.TypeInfo)
+		}
+
+		convFunc, lossyConv = skipNulls(convFunc, lossyConv)
+
+		var nullConv func(ctx context.Context) (types.Value, error)
+		if !destCol.IsNullable() {
+			var err error
+			nullConv, err = notNullConv(vrw, destCol)
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		steps = append(steps, ConversionStep{SrcTag: srcTag, DestTag: destTag, Conv: convFunc, LossyConv: lossyConv, NullConv: nullConv, PassThrough: passThrough, DecimalConv: decConv, BinaryConv: binConv})
+	}
+
+	sort.Slice(steps, func(i, j int) bool {
+		return steps[i].SrcTag < steps[j].SrcTag
+	})
+
+	return &ConversionPlan{steps}, nil
+}
+
+// checkKeylessToKeyed returns an ErrUnmappedPrimaryKey naming the destination primary key columns which no source
+// column is mapped to when |mapping| converts a keyless schema to a keyed one, as the rows of a keyless table have no
+// key to fall back on. Converting a keyed schema to a keyless one needs no check, as the converted rows are built for
+// the destination schema and so drop their key.
+func checkKeylessToKeyed(mapping *FieldMapping) error {
+	if !schema.IsKeyless(mapping.SrcSch) || schema.IsKeyless(mapping.DestSch) {
+		return nil
+	}
+
+	mapped := set.NewUint64Set(nil)
+	for srcTag, destTag := range mapping.SrcToDest {
+		if !mapping.IsDropped(srcTag) {
+			mapped.Add(destTag)
+		}
+	}
+
+	var unmapped []string
+	for _, col := range mapping.DestSch.GetPKCols().GetColumns() {
+		if !mapped.Contains(col.Tag) {
+			unmapped = append(unmapped, col.Name)
+		}
+	}
+
+	if len(unmapped) > 0 {
+		return fmt.Errorf("%w: converting a keyless schema to a keyed schema needs a source column for each primary key column, but %v have none", ErrUnmappedPrimaryKey, unmapped)
+	}
+
+	return nil
+}
+
+// skipNulls wraps |convFunc| and |lossyConv|, if it isn't nil, so that null values convert to null without calling
+// them, as the type specific conversions can't be relied on to handle nulls.
+func skipNulls(convFunc types.MarshalCallback, lossyConv LossyConvFunc) (types.MarshalCallback, LossyConvFunc) {
+	nullSafeConv := func(v types.Value) (types.Value, error) {
+		if types.IsNull(v) {
+			return types.NullValue, nil
+		}
+
+		return convFunc(v)
+	}
+
+	if lossyConv == nil {
+		return nullSafeConv, nil
+	}
+
+	return nullSafeConv, func(v types.Value) (types.Value, string, error) {
+		if types.IsNull(v) {
+			return types.NullValue, "", nil
+		}
+
+		return lossyConv(v)
+	}
+}
+
+// numericConvErr wraps |err|, the error converting |v| from |srcCol| to the numeric column |destCol|, with the name of
+// the source column, the value and the destination type, so that the cell which failed can be found.
+func numericConvErr(srcCol, destCol schema.Column, v types.Value, err error) error {
+	str := v.HumanReadableString()
+
+	if formatted, fmtErr := srcCol.TypeInfo.FormatValue(v); fmtErr == nil && formatted != nil {
+		str = *formatted
+	}
+
+	return fmt.Errorf("value %s of column `%s` can't be converted to %s: %w", str, srcCol.Name, destCol.TypeInfo.ToSqlType().String(), err)
+}
+
+// notNullConv returns a function which provides the value of the NOT NULL column |col| in place of a null. If |col|
+// has a default the function evaluates it, otherwise it returns an error naming the column.
+func notNullConv(vrw types.ValueReadWriter, col schema.Column) (func(ctx context.Context) (types.Value, error), error) {
+	if col.Default == "" {
+		return func(ctx context.Context) (types.Value, error) {
+			return nil, fmt.Errorf("column `%s` does not allow null values", col.Name)
+		}, nil
+	}
+
+	sqlSch, err := sqle.ResolveDefaults("", []*sqle.ColumnWithRawDefault{{
+		SqlColumn: &sql.Column{Name: col.Name, Type: col.TypeInfo.ToSqlType(), Nullable: false},
+		Default:   col.Default,
+	}})
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid default for column `%s`: %w", col.Name, err)
+	}
+
+	def := sqlSch[0].Default
+	return func(ctx context.Context) (types.Value, error) {
+		sqlCtx, ok := ctx.(*sql.Context)
+		if !ok {
+			sqlCtx = sql.NewContext(ctx)
 		}
+
+		val, err := def.Eval(sqlCtx, nil)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate the default of column `%s`: %w", col.Name, err)
+		}
+
+		return col.TypeInfo.ConvertValueToNomsValue(ctx, vrw, val)
+	}, nil
+}
+
+// ConvFuncs returns a map from each source tag to the function converting its values.
+func (p *ConversionPlan) ConvFuncs() map[uint64]types.MarshalCallback {
+	convFuncs := make(map[uint64]types.MarshalCallback, len(p.Steps))
+	for _, step := range p.Steps {
+		convFuncs[step.SrcTag] = step.Conv
 	}
 
-	return &RowConverter{mapping, false, convFuncs}, nil
+	return convFuncs
 }
 
 // Convert takes a row maps its columns to their destination columns, and performs any type conversion needed to create
 // a row of the expected destination schema.
 func (rc *RowConverter) Convert(inRow row.Row) (row.Row, error) {
+	return rc.ConvertWithContext(context.Background(), inRow)
+}
+
+// ConvertWithContext is Convert, but checks |ctx| before converting each column and returns the context's error once
+// it has been cancelled.
+func (rc *RowConverter) ConvertWithContext(ctx context.Context, inRow row.Row) (row.Row, error) {
+	outRow, _, err := rc.convert(ctx, inRow, false)
+	return outRow, err
+}
+
+// ColumnConversionError describes a column value which could not be converted to its destination type.
+type ColumnConversionError struct {
+	// SrcTag is the tag of the column in the source schema
+	SrcTag uint64
+	// DestTag is the tag of the column in the destination schema
+	DestTag uint64
+	// Value is the source value which could not be converted
+	Value types.Value
+	Err   error
+}
+
+func (e ColumnConversionError) Error() string {
+	return fmt.Sprintf("failed to convert column with tag %d: %v", e.SrcTag, e.Err)
+}
+
+func (e ColumnConversionError) Unwrap() error {
+	return e.Err
+}
+
+// ConvertCollectingErrors is ConvertWithContext, but rather than failing on the first column which can't be
+// converted it converts every column it can. The returned row leaves out the columns which failed, and an error for
+// each of them is returned in source tag order, so that the caller can decide whether to use the row, skip it, or
+// abort. The returned error is only non-nil if the row could not be converted at all.
+func (rc *RowConverter) ConvertCollectingErrors(ctx context.Context, inRow row.Row) (row.Row, []ColumnConversionError, error) {
+	return rc.convert(ctx, inRow, true)
+}
+
+// ConvertInto is Convert, but converts the values of |inRow| into |scratch| rather than allocating a new map for them,
+// so that callers converting many rows can reuse a single map. Any values already in |scratch| are removed first, and
+// it holds the converted values until the next call. The returned row doesn't reference |scratch|, so it remains
+// valid after |scratch| is reused.
+func (rc *RowConverter) ConvertInto(inRow row.Row, scratch row.TaggedValues) (row.Row, error) {
 	if rc.IdentityConverter {
-		return inRow, nil
+		if rc.Stats != nil {
+			rc.Stats.addIdentityRows(1)
+		}
+
+		return rc.reformat(inRow)
+	}
+
+	return rc.convertInto(context.Background(), inRow, scratch)
+}
+
+func (rc *RowConverter) convertInto(ctx context.Context, inRow row.Row, scratch row.TaggedValues) (row.Row, error) {
+	for tag := range scratch {
+		delete(scratch, tag)
+	}
+
+	_, err := rc.convertTaggedValues(ctx, inRow, scratch, false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// row.New copies the tagged values, so the row doesn't reference |scratch|
+	return row.New(rc.format(inRow), rc.DestSch, scratch)
+}
+
+// ConvertMap converts the values of |in|, which may hold any subset of the source columns, such as the columns changed
+// by an update. The values of mapped columns are converted and keyed by their destination tags, while the values of
+// tags which aren't mapped are copied unchanged, and the values of dropped columns are left out. Null values are kept,
+// so that columns being set to null can be told apart from columns which aren't in |in|, except that null values of
+// NOT NULL columns are replaced by the column's default. Merged and derived columns need the whole row, so they
+// aren't computed.
+func (rc *RowConverter) ConvertMap(in row.TaggedValues) (row.TaggedValues, error) {
+	out := make(row.TaggedValues, len(in))
+
+	if rc.IdentityConverter {
+		for tag, val := range in {
+			out[tag] = val
+		}
+
+		return out, nil
 	}
 
-	outTaggedVals := make(row.TaggedValues, len(rc.SrcToDest))
-	_, err := inRow.IterCols(func(tag uint64, val types.Value) (stop bool, err error) {
-		convFunc, ok := rc.ConvFuncs[tag]
+	ctx := context.Background()
+	for _, step := range rc.Plan.Steps {
+		val, ok := in[step.SrcTag]
+
+		if !ok {
+			continue
+		}
+
+		outVal, err := rc.convertValue(step, val, nil)
+
+		if err != nil {
+			return nil, ColumnConversionError{SrcTag: step.SrcTag, DestTag: step.DestTag, Value: val, Err: err}
+		}
 
-		if ok {
-			outTag := rc.SrcToDest[tag]
-			outVal, err := convFunc(val)
+		if types.IsNull(outVal) && step.NullConv != nil {
+			outVal, err = step.NullConv(ctx)
 
 			if err != nil {
-				return false, err
+				return nil, ColumnConversionError{SrcTag: step.SrcTag, DestTag: step.DestTag, Value: val, Err: err}
 			}
+		}
+
+		if types.IsNull(outVal) {
+			outVal = types.NullValue
+		}
+
+		out[step.DestTag] = outVal
+	}
+
+	for tag, val := range in {
+		if _, ok := rc.SrcToDest[tag]; ok || rc.IsDropped(tag) {
+			continue
+		}
+
+		if _, ok := out[tag]; ok {
+			return nil, fmt.Errorf("unmapped tag %d is also the tag of a converted column", tag)
+		}
+
+		out[tag] = val
+	}
+
+	return out, nil
+}
 
-			if types.IsNull(outVal) {
-				return false, nil
+// ConvertBatch converts each of |rows| in the same way as Convert. The returned rows are in the same order as |rows|.
+// The batch fails as a whole: if any row can't be converted no rows are returned, and the error identifies the index
+// of the row which failed.
+func (rc *RowConverter) ConvertBatch(rows []row.Row) ([]row.Row, error) {
+	return rc.ConvertBatchWithContext(context.Background(), rows)
+}
+
+// ConvertBatchWithContext is ConvertBatch, but checks |ctx| before converting each row and returns the context's
+// error once it has been cancelled.
+func (rc *RowConverter) ConvertBatchWithContext(ctx context.Context, rows []row.Row) ([]row.Row, error) {
+	if rc.IdentityConverter {
+		if rc.Stats != nil {
+			rc.Stats.addIdentityRows(len(rows))
+		}
+
+		if rc.TargetFormat == nil {
+			return rows, nil
+		}
+
+		outRows := make([]row.Row, len(rows))
+		for i, inRow := range rows {
+			var err error
+			outRows[i], err = rc.reformat(inRow)
+
+			if err != nil {
+				return nil, fmt.Errorf("failed to convert row %d: %w", i, err)
 			}
+		}
+
+		return outRows, nil
+	}
 
-			outTaggedVals[outTag] = outVal
+	outRows := make([]row.Row, len(rows))
+	outTaggedVals := make(row.TaggedValues, len(rc.Plan.Steps))
+	for i, inRow := range rows {
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
 
-		return false, nil
-	})
+		var err error
+		outRows[i], err = rc.convertInto(ctx, inRow, outTaggedVals)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert row %d: %w", i, err)
+		}
+	}
+
+	return outRows, nil
+}
+
+// ConvertToSqlRow is Convert, but returns the converted values as a sql.Row with a value for each column of the
+// destination schema, in schema order. Columns which have no value are nil.
+func (rc *RowConverter) ConvertToSqlRow(inRow row.Row) (sql.Row, error) {
+	taggedVals, err := rc.convertToTaggedValues(inRow)
+
+	if err != nil {
+		return nil, err
+	}
+
+	destCols := rc.DestSch.GetAllCols()
+	sqlRow := make(sql.Row, destCols.Size())
+	for i, col := range destCols.GetColumns() {
+		val, ok := taggedVals[col.Tag]
+
+		if !ok {
+			continue
+		}
+
+		sqlRow[i], err = col.TypeInfo.ConvertNomsValueToValue(val)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return sqlRow, nil
+}
+
+// ConvertToSlice is Convert, but returns the converted values in a slice with a slot for each column of the
+// destination schema, in schema order, for encoders which write values by position. Columns which have no value are
+// types.NullValue.
+func (rc *RowConverter) ConvertToSlice(inRow row.Row) ([]types.Value, error) {
+	taggedVals, err := rc.convertToTaggedValues(inRow)
+
+	if err != nil {
+		return nil, err
+	}
+
+	destCols := rc.DestSch.GetAllCols().GetColumns()
+	vals := make([]types.Value, len(destCols))
+	for i, col := range destCols {
+		val, ok := taggedVals[col.Tag]
+
+		if !ok || types.IsNull(val) {
+			val = types.NullValue
+		}
+
+		vals[i] = val
+	}
+
+	return vals, nil
+}
+
+// convertToTaggedValues converts the values of |inRow| in the same way as Convert, keyed by their destination tags.
+func (rc *RowConverter) convertToTaggedValues(inRow row.Row) (row.TaggedValues, error) {
+	if rc.IdentityConverter {
+		taggedVals, err := inRow.TaggedValues()
+
+		if err == nil && rc.Stats != nil {
+			rc.Stats.addIdentityRows(1)
+		}
+
+		return taggedVals, err
+	}
+
+	taggedVals := make(row.TaggedValues, len(rc.Plan.Steps))
+	_, err := rc.convertTaggedValues(context.Background(), inRow, taggedVals, false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return taggedVals, nil
+}
+
+func (rc *RowConverter) convert(ctx context.Context, inRow row.Row, collectErrs bool) (row.Row, []ColumnConversionError, error) {
+	if rc.IdentityConverter {
+		if rc.Stats != nil {
+			rc.Stats.addIdentityRows(1)
+		}
+
+		outRow, err := rc.reformat(inRow)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return outRow, nil, nil
+	}
+
+	outTaggedVals := make(row.TaggedValues, len(rc.Plan.Steps))
+	colErrs, err := rc.convertTaggedValues(ctx, inRow, outTaggedVals, collectErrs)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	outRow, err := row.New(rc.format(inRow), rc.DestSch, outTaggedVals)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return outRow, colErrs, nil
+}
+
+// format returns the NomsBinFormat of the row converted from |inRow|.
+func (rc *RowConverter) format(inRow row.Row) *types.NomsBinFormat {
+	if rc.TargetFormat != nil {
+		return rc.TargetFormat
+	}
+
+	return inRow.Format()
+}
+
+// reformat returns |inRow| built in the converter's TargetFormat, for identity converters which otherwise return their
+// input unchanged. |inRow| is returned as is if it is already in that format.
+func (rc *RowConverter) reformat(inRow row.Row) (row.Row, error) {
+	if rc.TargetFormat == nil || inRow.Format() == rc.TargetFormat {
+		return inRow, nil
+	}
+
+	taggedVals, err := inRow.TaggedValues()
 
 	if err != nil {
 		return nil, err
 	}
 
-	return row.New(inRow.Format(), rc.DestSch, outTaggedVals)
+	return row.New(rc.TargetFormat, rc.DestSch, taggedVals)
+}
+
+// convertTaggedValues converts the values of |inRow| to the values of the destination columns, and stores them in
+// |outTaggedVals| keyed by destination tag.
+func (rc *RowConverter) convertTaggedValues(ctx context.Context, inRow row.Row, outTaggedVals row.TaggedValues, collectErrs bool) ([]ColumnConversionError, error) {
+	if rc.Stats == nil {
+		return rc.convertValues(ctx, inRow, outTaggedVals, collectErrs, nil)
+	}
+
+	var counts conversionCounts
+	colErrs, err := rc.convertValues(ctx, inRow, outTaggedVals, collectErrs, &counts)
+	rc.Stats.addRow(counts, len(outTaggedVals), len(colErrs), err)
+
+	return colErrs, err
+}
+
+// convertValue converts |val| using |step|, rounding decimals with the converter's DecimalRounding, encoding binary
+// values with its BinaryEncoding and reporting lossy conversions to Warn. Lossy conversions are counted in |counts|
+// when it's non-nil.
+func (rc *RowConverter) convertValue(step ConversionStep, val types.Value, counts *conversionCounts) (types.Value, error) {
+	// pass through conversions return their values unchanged, so there is nothing to save by caching them
+	cached := rc.Cache != nil && !step.PassThrough
+	if cached {
+		if outVal, ok := rc.Cache.get(step.SrcTag, val); ok {
+			return outVal, nil
+		}
+	}
+
+	var outVal types.Value
+	var reason string
+	var err error
+	if step.DecimalConv != nil {
+		outVal, reason, err = step.DecimalConv(val, rc.DecimalRounding)
+	} else if step.BinaryConv != nil {
+		outVal, err = step.BinaryConv(val, rc.BinaryEncoding)
+	} else if rc.Warn != nil && step.LossyConv != nil {
+		outVal, reason, err = step.LossyConv(val)
+	} else {
+		outVal, err = step.Conv(val)
+	}
+
+	if err == nil && reason != "" && rc.Warn != nil {
+		rc.Warn(LossyConversion{SrcTag: step.SrcTag, DestTag: step.DestTag, Original: val, Converted: outVal, Reason: reason})
+
+		if counts != nil {
+			counts.lossy++
+		}
+	} else if err == nil && reason == "" && cached {
+		rc.Cache.put(step.SrcTag, val, outVal)
+	}
+
+	return outVal, err
+}
+
+// convertValues does the work of convertTaggedValues, and counts nulls and lossy conversions in |counts| when it's
+// non-nil.
+func (rc *RowConverter) convertValues(ctx context.Context, inRow row.Row, outTaggedVals row.TaggedValues, collectErrs bool, counts *conversionCounts) ([]ColumnConversionError, error) {
+	var colErrs []ColumnConversionError
+	for _, step := range rc.Plan.Steps {
+		val, ok := inRow.GetColVal(step.SrcTag)
+
+		if !ok && step.NullConv == nil {
+			if counts != nil {
+				counts.nulls++
+			}
+
+			continue
+		}
+
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var outVal types.Value
+		var err error
+		if !ok {
+			val = types.NullValue
+			outVal = types.NullValue
+		} else {
+			outVal, err = rc.convertValue(step, val, counts)
+		}
+
+		if err != nil && collectErrs {
+			colErrs = append(colErrs, ColumnConversionError{SrcTag: step.SrcTag, DestTag: step.DestTag, Value: val, Err: err})
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if types.IsNull(outVal) && step.NullConv != nil {
+			outVal, err = step.NullConv(ctx)
+
+			if err != nil && collectErrs {
+				colErrs = append(colErrs, ColumnConversionError{SrcTag: step.SrcTag, DestTag: step.DestTag, Value: val, Err: err})
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+		}
+
+		if types.IsNull(outVal) {
+			if counts != nil {
+				counts.nulls++
+			}
+
+			continue
+		}
+
+		outTaggedVals[step.DestTag] = outVal
+	}
+
+	for _, merge := range rc.Merges {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		vals := make([]types.Value, len(merge.SrcTags))
+		for i, tag := range merge.SrcTags {
+			val, ok := inRow.GetColVal(tag)
+
+			if !ok {
+				val = types.NullValue
+			}
+
+			vals[i] = val
+		}
+
+		outVal, err := merge.Reduce(vals)
+
+		if err != nil && collectErrs {
+			colErrs = append(colErrs, ColumnConversionError{SrcTag: merge.SrcTags[0], DestTag: merge.DestTag, Value: vals[0], Err: err})
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if types.IsNull(outVal) {
+			if counts != nil {
+				counts.nulls++
+			}
+
+			continue
+		}
+
+		outTaggedVals[merge.DestTag] = outVal
+	}
+
+	for _, derived := range rc.Derived {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		outVal, err := derived.Derive(inRow)
+
+		if err != nil && collectErrs {
+			colErrs = append(colErrs, ColumnConversionError{DestTag: derived.DestTag, Err: err})
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if types.IsNull(outVal) {
+			if counts != nil {
+				counts.nulls++
+			}
+
+			continue
+		}
+
+		outTaggedVals[derived.DestTag] = outVal
+	}
+
+	for _, def := range rc.Defaults {
+		outTaggedVals[def.DestTag] = def.Value
+	}
+
+	return colErrs, nil
 }
 
 func IsNecessary(srcSch, destSch schema.Schema, destToSrc map[uint64]uint64) (bool, error) {
@@ -134,8 +1022,10 @@ func IsNecessary(srcSch, destSch schema.Schema, destToSrc map[uint64]uint64) (bo
 		srcCol, srcOk := srcCols.GetByTag(v)
 		destCol, destOk := destCols.GetByTag(k)
 
-		if !srcOk || !destOk {
-			panic("There is a bug.  FieldMapping creation should prevent this from happening")
+		if !srcOk {
+			return false, fmt.Errorf("mapped tag %d is not a column of the source schema", v)
+		} else if !destOk {
+			return false, fmt.Errorf("mapped tag %d is not a column of the destination schema", k)
 		}
 
 		if srcCol.IsPartOfPK != destCol.IsPartOfPK {
@@ -154,20 +1044,11 @@ func IsNecessary(srcSch, destSch schema.Schema, destToSrc map[uint64]uint64) (bo
 		return true, nil
 	}
 
-	i := 0
-	err := destPKCols.Iter(func(tag uint64, col schema.Column) (stop bool, err error) {
-		srcPKCol := srcPKCols.GetByIndex(i)
-
-		if srcPKCol.Tag != col.Tag {
+	// the primary keys of the schemas must also be in the same order
+	for i, col := range destPKCols.GetColumns() {
+		if srcPKCols.GetByIndex(i).Tag != col.Tag {
 			return true, nil
 		}
-
-		i++
-		return false, nil
-	})
-
-	if err != nil {
-		return false, err
 	}
 
 	return false, nil
@@ -16,14 +16,20 @@ package rowconv
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math"
 	"testing"
 	"time"
 
+	"github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/vitess/go/sqltypes"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/require"
 
 	"github.com/dolthub/dolt/go/libraries/doltcore/row"
 	"github.com/dolthub/dolt/go/libraries/doltcore/schema"
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema/typeinfo"
 	"github.com/dolthub/dolt/go/store/types"
 )
 
@@ -85,6 +91,985 @@ func TestRowConverter(t *testing.T) {
 	}
 }
 
+func TestRowConverterEqualTypesPassThrough(t *testing.T) {
+	mapping, err := TypedToUntypedMapping(srcSch)
+	require.NoError(t, err)
+
+	vrw := types.NewMemoryValueStore()
+	rConv, err := NewRowConverter(context.Background(), vrw, mapping)
+	require.NoError(t, err)
+
+	srcCol, ok := srcSch.GetAllCols().GetByTag(5)
+	require.True(t, ok)
+	destCol, ok := mapping.DestSch.GetAllCols().GetByTag(mapping.SrcToDest[5])
+	require.True(t, ok)
+	require.True(t, srcCol.TypeInfo.Equals(destCol.TypeInfo))
+
+	convFunc := rConv.ConvFuncs[5]
+	str := types.String("string string string")
+	outVal, err := convFunc(str)
+	require.NoError(t, err)
+	require.Equal(t, str, outVal)
+
+	// the pass through returns whatever it is given, where formatting as a string would not
+	outVal, err = convFunc(types.Int(5))
+	require.NoError(t, err)
+	require.Equal(t, types.Int(5), outVal)
+}
+
+func TestNullSourceValues(t *testing.T) {
+	srcSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.IntKind, true),
+		schema.NewColumn("passthrough", 1, types.IntKind, false),
+		schema.NewColumn("tostring", 2, types.IntKind, false),
+		schema.NewColumn("tojson", 3, types.StringKind, false),
+		mustColumnWithTypeInfo("toint", 4, typeinfo.BoolType, false),
+		mustColumnWithTypeInfo("todatetime", 5, typeinfo.TimestampType, false),
+		schema.NewColumn("tonumber", 6, types.StringKind, false),
+		schema.NewColumn("touuid", 7, types.StringKind, false),
+	))
+	destSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.IntKind, true),
+		schema.NewColumn("passthrough", 1, types.IntKind, false),
+		schema.NewColumn("tostring", 2, types.StringKind, false),
+		mustColumnWithTypeInfo("tojson", 3, typeinfo.JSONType, false),
+		mustColumnWithTypeInfo("toint", 4, typeinfo.Int8Type, false),
+		mustColumnWithTypeInfo("todatetime", 5, typeinfo.DatetimeType, false),
+		schema.NewColumn("tonumber", 6, types.FloatKind, false),
+		schema.NewColumn("touuid", 7, types.UUIDKind, false),
+	))
+
+	mapping, err := TagMapping(srcSch, destSch)
+	require.NoError(t, err)
+
+	vrw := types.NewMemoryValueStore()
+	rConv, err := NewRowConverterInLocation(context.Background(), vrw, mapping, time.UTC)
+	require.NoError(t, err)
+	require.Len(t, rConv.Plan.Steps, 8)
+
+	for _, step := range rConv.Plan.Steps {
+		outVal, err := step.Conv(types.NullValue)
+		require.NoError(t, err, "tag %d", step.SrcTag)
+		require.Equal(t, types.NullValue, outVal, "tag %d", step.SrcTag)
+
+		outVal, err = step.Conv(nil)
+		require.NoError(t, err, "tag %d", step.SrcTag)
+		require.Equal(t, types.NullValue, outVal, "tag %d", step.SrcTag)
+
+		if step.LossyConv != nil {
+			outVal, reason, err := step.LossyConv(types.NullValue)
+			require.NoError(t, err, "tag %d", step.SrcTag)
+			require.Equal(t, types.NullValue, outVal, "tag %d", step.SrcTag)
+			require.Empty(t, reason)
+		}
+	}
+
+	// columns missing from a row are null, and are left out of the converted row
+	inRow, err := row.New(vrw.Format(), srcSch, row.TaggedValues{0: types.Int(1)})
+	require.NoError(t, err)
+	outRow, err := rConv.Convert(inRow)
+	require.NoError(t, err)
+
+	expected, err := row.New(vrw.Format(), destSch, row.TaggedValues{0: types.Int(1)})
+	require.NoError(t, err)
+	require.True(t, row.AreEqual(expected, outRow, destSch), row.Fmt(context.Background(), outRow, destSch))
+}
+
+func TestRowConverterCancellation(t *testing.T) {
+	mapping, err := TypedToUntypedMapping(srcSch)
+	require.NoError(t, err)
+
+	vrw := types.NewMemoryValueStore()
+	rConv, err := NewRowConverter(context.Background(), vrw, mapping)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the first column converted cancels the context, so no other column should be converted
+	calls := 0
+	for i := range rConv.Plan.Steps {
+		convFunc := rConv.Plan.Steps[i].Conv
+		rConv.Plan.Steps[i].Conv = func(v types.Value) (types.Value, error) {
+			calls++
+			cancel()
+			return convFunc(v)
+		}
+	}
+
+	inRow, err := row.New(vrw.Format(), srcSch, row.TaggedValues{
+		0: types.UUID(uuid.New()),
+		1: types.Float(1.25),
+		2: types.Uint(12345678),
+		3: types.Bool(true),
+		4: types.Int(-1234),
+		5: types.String("string string string"),
+		6: types.Timestamp(time.Now()),
+	})
+	require.NoError(t, err)
+
+	_, err = rConv.ConvertWithContext(ctx, inRow)
+	require.True(t, errors.Is(err, context.Canceled))
+	require.Equal(t, 1, calls)
+
+	_, err = rConv.ConvertWithContext(ctx, inRow)
+	require.True(t, errors.Is(err, context.Canceled))
+	require.Equal(t, 1, calls)
+}
+
+func TestConvertCollectingErrors(t *testing.T) {
+	srcSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.StringKind, true),
+		schema.NewColumn("count", 1, types.StringKind, false),
+		schema.NewColumn("total", 2, types.StringKind, false),
+		schema.NewColumn("name", 3, types.StringKind, false),
+	))
+	destSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.IntKind, true),
+		schema.NewColumn("count", 1, types.IntKind, false),
+		schema.NewColumn("total", 2, types.UintKind, false),
+		schema.NewColumn("name", 3, types.StringKind, false),
+	))
+
+	mapping, err := TagMapping(srcSch, destSch)
+	require.NoError(t, err)
+
+	vrw := types.NewMemoryValueStore()
+	rConv, err := NewRowConverter(context.Background(), vrw, mapping)
+	require.NoError(t, err)
+
+	inRow, err := row.New(vrw.Format(), srcSch, row.TaggedValues{
+		0: types.String("7"),
+		1: types.String("not a number"),
+		2: types.String("also not a number"),
+		3: types.String("name"),
+	})
+	require.NoError(t, err)
+
+	// the default fails on the first bad column
+	_, err = rConv.Convert(inRow)
+	require.Error(t, err)
+
+	outRow, colErrs, err := rConv.ConvertCollectingErrors(context.Background(), inRow)
+	require.NoError(t, err)
+	require.Len(t, colErrs, 2)
+
+	require.Equal(t, uint64(1), colErrs[0].SrcTag)
+	require.Equal(t, uint64(1), colErrs[0].DestTag)
+	require.Equal(t, types.String("not a number"), colErrs[0].Value)
+	require.Error(t, colErrs[0].Err)
+
+	require.Equal(t, uint64(2), colErrs[1].SrcTag)
+	require.Equal(t, uint64(2), colErrs[1].DestTag)
+	require.Equal(t, types.String("also not a number"), colErrs[1].Value)
+	require.Error(t, colErrs[1].Err)
+	require.True(t, errors.Is(colErrs[1], colErrs[1].Err))
+
+	expected, err := row.New(vrw.Format(), destSch, row.TaggedValues{
+		0: types.Int(7),
+		3: types.String("name"),
+	})
+	require.NoError(t, err)
+	require.True(t, row.AreEqual(outRow, expected, destSch), row.Fmt(context.Background(), outRow, destSch))
+
+	// rows which convert cleanly have no errors
+	goodRow, err := row.New(vrw.Format(), srcSch, row.TaggedValues{
+		0: types.String("7"),
+		1: types.String("8"),
+		2: types.String("9"),
+	})
+	require.NoError(t, err)
+
+	_, colErrs, err = rConv.ConvertCollectingErrors(context.Background(), goodRow)
+	require.NoError(t, err)
+	require.Empty(t, colErrs)
+}
+
+func TestLossyConversionWarnings(t *testing.T) {
+	varchar := func(length int64) typeinfo.TypeInfo {
+		ti, err := typeinfo.FromSqlType(sql.MustCreateStringWithDefaults(sqltypes.VarChar, length))
+		require.NoError(t, err)
+		return ti
+	}
+
+	srcSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		mustColumnWithTypeInfo("id", 0, typeinfo.Int64Type, true),
+		mustColumnWithTypeInfo("count", 1, typeinfo.Int64Type, false),
+		mustColumnWithTypeInfo("name", 2, varchar(20), false),
+	))
+	destSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		mustColumnWithTypeInfo("id", 0, typeinfo.Int64Type, true),
+		mustColumnWithTypeInfo("count", 1, typeinfo.Int32Type, false),
+		mustColumnWithTypeInfo("name", 2, varchar(5), false),
+	))
+
+	mapping, err := TagMapping(srcSch, destSch)
+	require.NoError(t, err)
+
+	vrw := types.NewMemoryValueStore()
+	rConv, err := NewRowConverter(context.Background(), vrw, mapping)
+	require.NoError(t, err)
+
+	inRow, err := row.New(vrw.Format(), srcSch, row.TaggedValues{
+		0: types.Int(1),
+		1: types.Int(1 << 40),
+		2: types.String("hello world"),
+	})
+	require.NoError(t, err)
+
+	// without a warning func an overflowing integer fails the conversion
+	_, err = rConv.Convert(inRow)
+	require.Error(t, err)
+
+	var warnings []LossyConversion
+	rConv.Warn = func(lc LossyConversion) {
+		warnings = append(warnings, lc)
+	}
+
+	outRow, err := rConv.Convert(inRow)
+	require.NoError(t, err)
+
+	expected, err := row.New(vrw.Format(), destSch, row.TaggedValues{
+		0: types.Int(1),
+		1: types.Int(math.MaxInt32),
+		2: types.String("hello"),
+	})
+	require.NoError(t, err)
+	require.True(t, row.AreEqual(outRow, expected, destSch), row.Fmt(context.Background(), outRow, destSch))
+
+	require.Len(t, warnings, 2)
+	require.Equal(t, uint64(1), warnings[0].SrcTag)
+	require.Equal(t, uint64(1), warnings[0].DestTag)
+	require.Equal(t, types.Int(1<<40), warnings[0].Original)
+	require.Equal(t, types.Int(math.MaxInt32), warnings[0].Converted)
+	require.Contains(t, warnings[0].Reason, "out of range")
+
+	require.Equal(t, uint64(2), warnings[1].SrcTag)
+	require.Equal(t, types.String("hello world"), warnings[1].Original)
+	require.Equal(t, types.String("hello"), warnings[1].Converted)
+	require.Contains(t, warnings[1].Reason, "truncated")
+
+	// values which fit their destination columns produce no warnings
+	warnings = nil
+	goodRow, err := row.New(vrw.Format(), srcSch, row.TaggedValues{
+		0: types.Int(2),
+		1: types.Int(-7),
+		2: types.String("hi"),
+	})
+	require.NoError(t, err)
+
+	_, err = rConv.Convert(goodRow)
+	require.NoError(t, err)
+	require.Empty(t, warnings)
+}
+
+func TestNullInNotNullColumn(t *testing.T) {
+	srcSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.IntKind, true),
+		schema.NewColumn("count", 1, types.StringKind, false),
+		schema.NewColumn("name", 2, types.StringKind, false),
+	))
+
+	count, err := schema.NewColumnWithTypeInfo("count", 1, typeinfo.Int64Type, false, "", false, "", schema.NotNullConstraint{})
+	require.NoError(t, err)
+	name, err := schema.NewColumnWithTypeInfo("name", 2, typeinfo.StringDefaultType, false, `"unknown"`, false, "", schema.NotNullConstraint{})
+	require.NoError(t, err)
+	destSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.IntKind, true, schema.NotNullConstraint{}),
+		count,
+		name,
+	))
+
+	mapping, err := TagMapping(srcSch, destSch)
+	require.NoError(t, err)
+
+	vrw := types.NewMemoryValueStore()
+	rConv, err := NewRowConverter(context.Background(), vrw, mapping)
+	require.NoError(t, err)
+
+	// a null in a NOT NULL column with a default is replaced by the default
+	inRow, err := row.New(vrw.Format(), srcSch, row.TaggedValues{
+		0: types.Int(1),
+		1: types.String("7"),
+	})
+	require.NoError(t, err)
+
+	outRow, err := rConv.Convert(inRow)
+	require.NoError(t, err)
+
+	expected, err := row.New(vrw.Format(), destSch, row.TaggedValues{
+		0: types.Int(1),
+		1: types.Int(7),
+		2: types.String("unknown"),
+	})
+	require.NoError(t, err)
+	require.True(t, row.AreEqual(outRow, expected, destSch), row.Fmt(context.Background(), outRow, destSch))
+
+	// a null in a NOT NULL column without a default is an error naming the column
+	inRow, err = row.New(vrw.Format(), srcSch, row.TaggedValues{
+		0: types.Int(2),
+		2: types.String("name"),
+	})
+	require.NoError(t, err)
+
+	_, err = rConv.Convert(inRow)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "`count`")
+
+	_, colErrs, err := rConv.ConvertCollectingErrors(context.Background(), inRow)
+	require.NoError(t, err)
+	require.Len(t, colErrs, 1)
+	require.Equal(t, uint64(1), colErrs[0].DestTag)
+	require.Equal(t, types.NullValue, colErrs[0].Value)
+}
+
+func TestConvertToSqlRow(t *testing.T) {
+	srcSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.StringKind, true),
+		schema.NewColumn("price", 1, types.StringKind, false),
+		schema.NewColumn("in_stock", 2, types.IntKind, false),
+		schema.NewColumn("count", 3, types.UintKind, false),
+		schema.NewColumn("name", 4, types.StringKind, false),
+		schema.NewColumn("notes", 5, types.StringKind, false),
+	))
+	// the destination column order differs from the source's, and from tag order
+	destSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.IntKind, true),
+		schema.NewColumn("name", 4, types.StringKind, false),
+		schema.NewColumn("price", 1, types.FloatKind, false),
+		schema.NewColumn("in_stock", 2, types.BoolKind, false),
+		schema.NewColumn("count", 3, types.IntKind, false),
+		schema.NewColumn("notes", 5, types.StringKind, false),
+	))
+
+	mapping, err := TagMapping(srcSch, destSch)
+	require.NoError(t, err)
+
+	vrw := types.NewMemoryValueStore()
+	rConv, err := NewRowConverter(context.Background(), vrw, mapping)
+	require.NoError(t, err)
+
+	inRow, err := row.New(vrw.Format(), srcSch, row.TaggedValues{
+		0: types.String("42"),
+		1: types.String("9.75"),
+		2: types.Int(1),
+		3: types.Uint(12),
+		4: types.String("widget"),
+	})
+	require.NoError(t, err)
+
+	sqlRow, err := rConv.ConvertToSqlRow(inRow)
+	require.NoError(t, err)
+	require.Equal(t, sql.NewRow(int64(42), "widget", 9.75, uint64(1), int64(12), nil), sqlRow)
+
+	// the sql row holds the same values as the converted row.Row
+	outRow, err := rConv.Convert(inRow)
+	require.NoError(t, err)
+
+	for i, col := range destSch.GetAllCols().GetColumns() {
+		val, ok := outRow.GetColVal(col.Tag)
+
+		if !ok {
+			require.Nil(t, sqlRow[i])
+			continue
+		}
+
+		expected, err := col.TypeInfo.ConvertNomsValueToValue(val)
+		require.NoError(t, err)
+		require.Equal(t, expected, sqlRow[i], col.Name)
+	}
+
+	// conversion errors are returned in the same way
+	badRow, err := row.New(vrw.Format(), srcSch, row.TaggedValues{
+		0: types.String("not a number"),
+	})
+	require.NoError(t, err)
+
+	_, err = rConv.ConvertToSqlRow(badRow)
+	require.Error(t, err)
+}
+
+func TestConvertToSlice(t *testing.T) {
+	srcSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.StringKind, true),
+		schema.NewColumn("price", 1, types.StringKind, false),
+		schema.NewColumn("name", 2, types.StringKind, false),
+		schema.NewColumn("notes", 3, types.StringKind, false),
+	))
+	// the destination column order differs from the source's, and from tag order
+	destSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.IntKind, true),
+		schema.NewColumn("notes", 3, types.StringKind, false),
+		schema.NewColumn("name", 2, types.StringKind, false),
+		schema.NewColumn("price", 1, types.FloatKind, false),
+		schema.NewColumn("unmapped", 10, types.StringKind, false),
+	))
+
+	mapping, err := TagMapping(srcSch, destSch)
+	require.NoError(t, err)
+
+	vrw := types.NewMemoryValueStore()
+	rConv, err := NewRowConverter(context.Background(), vrw, mapping)
+	require.NoError(t, err)
+
+	inRow, err := row.New(vrw.Format(), srcSch, row.TaggedValues{
+		0: types.String("42"),
+		1: types.String("9.75"),
+		2: types.String("widget"),
+	})
+	require.NoError(t, err)
+
+	vals, err := rConv.ConvertToSlice(inRow)
+	require.NoError(t, err)
+	// notes has no value and unmapped has no source column, so both are null
+	require.Equal(t, []types.Value{types.Int(42), types.NullValue, types.String("widget"), types.Float(9.75), types.NullValue}, vals)
+
+	// the slice holds the same values as the converted row.Row
+	outRow, err := rConv.Convert(inRow)
+	require.NoError(t, err)
+
+	for i, col := range destSch.GetAllCols().GetColumns() {
+		val, ok := outRow.GetColVal(col.Tag)
+
+		if !ok {
+			val = types.NullValue
+		}
+
+		require.Equal(t, val, vals[i], col.Name)
+	}
+
+	t.Run("identity", func(t *testing.T) {
+		rConv, err := NewRowConverter(context.Background(), vrw, IdentityMapping(srcSch))
+		require.NoError(t, err)
+		require.True(t, rConv.IdentityConverter)
+
+		vals, err := rConv.ConvertToSlice(inRow)
+		require.NoError(t, err)
+		require.Equal(t, []types.Value{types.String("42"), types.String("9.75"), types.String("widget"), types.NullValue}, vals)
+	})
+
+	t.Run("conversion error", func(t *testing.T) {
+		badRow, err := row.New(vrw.Format(), srcSch, row.TaggedValues{
+			0: types.String("not a number"),
+		})
+		require.NoError(t, err)
+
+		_, err = rConv.ConvertToSlice(badRow)
+		require.Error(t, err)
+	})
+}
+
+func TestConvertMap(t *testing.T) {
+	srcSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.IntKind, true),
+		schema.NewColumn("count", 1, types.StringKind, false),
+		schema.NewColumn("name", 2, types.StringKind, false),
+		schema.NewColumn("dropped", 3, types.StringKind, false),
+	))
+	destSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 10, types.IntKind, true),
+		schema.NewColumn("count", 11, types.IntKind, false),
+		schema.NewColumn("name", 12, types.StringKind, false),
+	))
+
+	mapping, err := NewFieldMapping(srcSch, destSch, map[uint64]uint64{0: 10, 1: 11, 2: 12})
+	require.NoError(t, err)
+	require.NoError(t, mapping.DropSrcColumns(3))
+
+	vrw := types.NewMemoryValueStore()
+	rConv, err := NewRowConverter(context.Background(), vrw, mapping)
+	require.NoError(t, err)
+
+	out, err := rConv.ConvertMap(row.TaggedValues{
+		1:  types.String("5"),
+		3:  types.String("dropped"),
+		20: types.String("untouched"),
+	})
+	require.NoError(t, err)
+	require.Equal(t, row.TaggedValues{
+		11: types.Int(5),
+		20: types.String("untouched"),
+	}, out)
+
+	// nulls are kept so that they can set columns to null
+	out, err = rConv.ConvertMap(row.TaggedValues{2: types.NullValue})
+	require.NoError(t, err)
+	require.Equal(t, row.TaggedValues{12: types.NullValue}, out)
+
+	_, err = rConv.ConvertMap(row.TaggedValues{1: types.String("five")})
+	require.Error(t, err)
+	var colErr ColumnConversionError
+	require.True(t, errors.As(err, &colErr))
+	require.Equal(t, uint64(1), colErr.SrcTag)
+
+	// an unmapped tag can't be passed through to a tag which a mapped column is converted to
+	_, err = rConv.ConvertMap(row.TaggedValues{1: types.String("5"), 11: types.Int(6)})
+	require.Error(t, err)
+
+	in := row.TaggedValues{0: types.Int(1)}
+	out, err = newIdentityConverter(IdentityMapping(srcSch)).ConvertMap(in)
+	require.NoError(t, err)
+	require.Equal(t, in, out)
+}
+
+func TestConvertBatch(t *testing.T) {
+	mapping, err := TypedToUntypedMapping(srcSch)
+	require.NoError(t, err)
+
+	vrw := types.NewMemoryValueStore()
+	rConv, err := NewRowConverter(context.Background(), vrw, mapping)
+	require.NoError(t, err)
+
+	rows := make([]row.Row, 16)
+	for i := range rows {
+		rows[i], err = row.New(vrw.Format(), srcSch, row.TaggedValues{
+			0: types.UUID(uuid.New()),
+			4: types.Int(i),
+		})
+		require.NoError(t, err)
+	}
+
+	// the row in the middle has a value for a column which the others don't, so values must not carry over between
+	// rows
+	rows[8], err = row.New(vrw.Format(), srcSch, row.TaggedValues{
+		0: types.UUID(uuid.New()),
+		5: types.String("only in row 8"),
+	})
+	require.NoError(t, err)
+
+	outRows, err := rConv.ConvertBatch(rows)
+	require.NoError(t, err)
+	require.Len(t, outRows, len(rows))
+
+	for i, inRow := range rows {
+		expected, err := rConv.Convert(inRow)
+		require.NoError(t, err)
+		require.True(t, row.AreEqual(expected, outRows[i], mapping.DestSch), "row %d", i)
+	}
+
+	// the identity converter returns the rows unchanged
+	identity := newIdentityConverter(mapping)
+	outRows, err = identity.ConvertBatch(rows)
+	require.NoError(t, err)
+	require.Equal(t, rows, outRows)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = rConv.ConvertBatchWithContext(ctx, rows)
+	require.True(t, errors.Is(err, context.Canceled))
+}
+
+func TestConvertBatchFailsWholeBatch(t *testing.T) {
+	srcSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.StringKind, true),
+	))
+	destSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.IntKind, true),
+	))
+
+	mapping, err := TagMapping(srcSch, destSch)
+	require.NoError(t, err)
+
+	vrw := types.NewMemoryValueStore()
+	rConv, err := NewRowConverter(context.Background(), vrw, mapping)
+	require.NoError(t, err)
+
+	var rows []row.Row
+	for _, id := range []string{"1", "2", "three", "4"} {
+		r, err := row.New(vrw.Format(), srcSch, row.TaggedValues{0: types.String(id)})
+		require.NoError(t, err)
+		rows = append(rows, r)
+	}
+
+	outRows, err := rConv.ConvertBatch(rows)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "row 2")
+	require.Nil(t, outRows)
+}
+
+func TestNumericConversionError(t *testing.T) {
+	srcSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		mustColumnWithTypeInfo("id", 0, typeinfo.Int64Type, true),
+		mustColumnWithTypeInfo("quantity", 1, typeinfo.Int64Type, false),
+	))
+	destSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		mustColumnWithTypeInfo("id", 0, typeinfo.Int64Type, true),
+		mustColumnWithTypeInfo("quantity", 1, typeinfo.Int8Type, false),
+	))
+
+	mapping, err := TagMapping(srcSch, destSch)
+	require.NoError(t, err)
+
+	vrw := types.NewMemoryValueStore()
+	rConv, err := NewRowConverter(context.Background(), vrw, mapping)
+	require.NoError(t, err)
+
+	inRow, err := row.New(vrw.Format(), srcSch, row.TaggedValues{0: types.Int(1), 1: types.Int(300)})
+	require.NoError(t, err)
+
+	_, err = rConv.Convert(inRow)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "`quantity`")
+	require.Contains(t, err.Error(), "300")
+	require.Contains(t, err.Error(), "TINYINT")
+
+	_, colErrs, err := rConv.ConvertCollectingErrors(context.Background(), inRow)
+	require.NoError(t, err)
+	require.Len(t, colErrs, 1)
+	require.Contains(t, colErrs[0].Error(), "value 300 of column `quantity`")
+
+	// values which fit convert as before
+	inRow, err = row.New(vrw.Format(), srcSch, row.TaggedValues{0: types.Int(1), 1: types.Int(100)})
+	require.NoError(t, err)
+
+	outRow, err := rConv.Convert(inRow)
+	require.NoError(t, err)
+	val, _ := outRow.GetColVal(1)
+	require.Equal(t, types.Int(100), val)
+}
+
+func TestInverseRoundTrip(t *testing.T) {
+	varchar := func(length int64) typeinfo.TypeInfo {
+		ti, err := typeinfo.FromSqlType(sql.MustCreateStringWithDefaults(sqltypes.VarChar, length))
+		require.NoError(t, err)
+		return ti
+	}
+
+	schA := schema.MustSchemaFromCols(schema.NewColCollection(
+		mustColumnWithTypeInfo("id", 0, typeinfo.Int32Type, true),
+		mustColumnWithTypeInfo("count", 1, typeinfo.Int16Type, false),
+		mustColumnWithTypeInfo("name", 2, varchar(10), false),
+		mustColumnWithTypeInfo("score", 3, typeinfo.Float32Type, false),
+	))
+	schB := schema.MustSchemaFromCols(schema.NewColCollection(
+		mustColumnWithTypeInfo("id", 0, typeinfo.Int64Type, true),
+		mustColumnWithTypeInfo("count", 1, varchar(20), false),
+		mustColumnWithTypeInfo("name", 2, varchar(20), false),
+		mustColumnWithTypeInfo("score", 3, typeinfo.Float64Type, false),
+	))
+
+	mapping, err := TagMapping(schA, schB)
+	require.NoError(t, err)
+
+	vrw := types.NewMemoryValueStore()
+	toB, err := NewRowConverter(context.Background(), vrw, mapping)
+	require.NoError(t, err)
+
+	toA, err := toB.Inverse(context.Background(), vrw)
+	require.NoError(t, err)
+	require.Equal(t, schB, toA.SrcSch)
+	require.Equal(t, schA, toA.DestSch)
+
+	for _, vals := range []row.TaggedValues{
+		{0: types.Int(math.MinInt32), 1: types.Int(math.MinInt16), 2: types.String("name"), 3: types.Float(1.5)},
+		{0: types.Int(math.MaxInt32), 1: types.Int(math.MaxInt16), 2: types.String("0123456789")},
+		{0: types.Int(0)},
+	} {
+		inRow, err := row.New(vrw.Format(), schA, vals)
+		require.NoError(t, err)
+
+		rowB, err := toB.Convert(inRow)
+		require.NoError(t, err)
+
+		rowA, err := toA.Convert(rowB)
+		require.NoError(t, err)
+		require.True(t, row.AreEqual(inRow, rowA, schA), row.Fmt(context.Background(), rowA, schA))
+	}
+}
+
+func TestInverseOfLossyConversion(t *testing.T) {
+	tests := []struct {
+		name    string
+		srcCols []schema.Column
+		dstCols []schema.Column
+	}{
+		{
+			"narrowing int",
+			[]schema.Column{schema.NewColumn("id", 0, types.IntKind, true)},
+			[]schema.Column{mustColumnWithTypeInfo("id", 0, typeinfo.Int32Type, true)},
+		},
+		{
+			"narrowing float",
+			[]schema.Column{schema.NewColumn("id", 0, types.FloatKind, true)},
+			[]schema.Column{mustColumnWithTypeInfo("id", 0, typeinfo.Float32Type, true)},
+		},
+		{
+			"string to int",
+			[]schema.Column{schema.NewColumn("id", 0, types.StringKind, true)},
+			[]schema.Column{schema.NewColumn("id", 0, types.IntKind, true)},
+		},
+		{
+			"dropped column",
+			[]schema.Column{schema.NewColumn("id", 0, types.IntKind, true), schema.NewColumn("name", 1, types.StringKind, false)},
+			[]schema.Column{schema.NewColumn("id", 0, types.IntKind, true)},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srcSch := schema.MustSchemaFromCols(schema.NewColCollection(test.srcCols...))
+			destSch := schema.MustSchemaFromCols(schema.NewColCollection(test.dstCols...))
+
+			mapping, err := TagMapping(srcSch, destSch)
+			require.NoError(t, err)
+
+			vrw := types.NewMemoryValueStore()
+			rConv, err := NewRowConverter(context.Background(), vrw, mapping)
+			require.NoError(t, err)
+
+			_, err = rConv.Inverse(context.Background(), vrw)
+			require.True(t, errors.Is(err, ErrNotInvertible), "%v", err)
+		})
+	}
+}
+
+func mustColumnWithTypeInfo(name string, tag uint64, ti typeinfo.TypeInfo, partOfPK bool) schema.Column {
+	col, err := schema.NewColumnWithTypeInfo(name, tag, ti, partOfPK, "", false, "")
+
+	if err != nil {
+		panic(err)
+	}
+
+	return col
+}
+
+func TestConvertInto(t *testing.T) {
+	mapping, err := TypedToUntypedMapping(srcSch)
+	require.NoError(t, err)
+
+	vrw := types.NewMemoryValueStore()
+	rConv, err := NewRowConverter(context.Background(), vrw, mapping)
+	require.NoError(t, err)
+
+	// values left in the scratch map must not end up in the converted row
+	scratch := row.TaggedValues{5: types.String("stale")}
+
+	first, err := row.New(vrw.Format(), srcSch, row.TaggedValues{0: types.UUID(uuid.New()), 4: types.Int(1)})
+	require.NoError(t, err)
+	second, err := row.New(vrw.Format(), srcSch, row.TaggedValues{0: types.UUID(uuid.New()), 5: types.String("second")})
+	require.NoError(t, err)
+
+	firstOut, err := rConv.ConvertInto(first, scratch)
+	require.NoError(t, err)
+	expected, err := rConv.Convert(first)
+	require.NoError(t, err)
+	require.True(t, row.AreEqual(expected, firstOut, mapping.DestSch), row.Fmt(context.Background(), firstOut, mapping.DestSch))
+
+	secondOut, err := rConv.ConvertInto(second, scratch)
+	require.NoError(t, err)
+	expected, err = rConv.Convert(second)
+	require.NoError(t, err)
+	require.True(t, row.AreEqual(expected, secondOut, mapping.DestSch), row.Fmt(context.Background(), secondOut, mapping.DestSch))
+
+	// reusing the scratch map doesn't change rows which were already returned
+	expected, err = rConv.Convert(first)
+	require.NoError(t, err)
+	require.True(t, row.AreEqual(expected, firstOut, mapping.DestSch), row.Fmt(context.Background(), firstOut, mapping.DestSch))
+}
+
+func TestConversionPlan(t *testing.T) {
+	mapping, err := TypedToUntypedMapping(srcSch)
+	require.NoError(t, err)
+
+	vrw := types.NewMemoryValueStore()
+	plan, err := NewConversionPlan(context.Background(), vrw, mapping)
+	require.NoError(t, err)
+	require.Len(t, plan.Steps, len(mapping.SrcToDest))
+
+	for i, step := range plan.Steps {
+		if i > 0 {
+			require.Less(t, plan.Steps[i-1].SrcTag, step.SrcTag)
+		}
+
+		require.Equal(t, mapping.SrcToDest[step.SrcTag], step.DestTag)
+	}
+
+	// converters sharing a plan convert in the same way as one which compiled its own
+	rConv, err := NewRowConverter(context.Background(), vrw, mapping)
+	require.NoError(t, err)
+	shared := NewRowConverterFromPlan(mapping, plan)
+
+	inRow := benchmarkRow(t, vrw)
+	expected, err := rConv.Convert(inRow)
+	require.NoError(t, err)
+	actual, err := shared.Convert(inRow)
+	require.NoError(t, err)
+	require.True(t, row.AreEqual(expected, actual, mapping.DestSch))
+}
+
+func TestTransformedTags(t *testing.T) {
+	srcSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.IntKind, true),
+		schema.NewColumn("name", 1, types.StringKind, false),
+		schema.NewColumn("count", 2, types.StringKind, false),
+		mustColumnWithTypeInfo("flag", 3, typeinfo.BoolType, false),
+	))
+	destSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 10, types.IntKind, true),
+		schema.NewColumn("name", 11, types.StringKind, false),
+		schema.NewColumn("count", 12, types.IntKind, false),
+		mustColumnWithTypeInfo("flag", 13, typeinfo.Int8Type, false),
+		schema.NewColumn("derived", 14, types.IntKind, false),
+	))
+
+	mapping, err := NewFieldMapping(srcSch, destSch, map[uint64]uint64{0: 10, 1: 11, 2: 12, 3: 13})
+	require.NoError(t, err)
+
+	vrw := types.NewMemoryValueStore()
+	rConv, err := NewRowConverter(context.Background(), vrw, mapping)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []uint64{12, 13}, rConv.TransformedTags().AsSlice())
+
+	err = rConv.DeriveColumn(14, func(r row.Row) (types.Value, error) {
+		return types.Int(1), nil
+	})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []uint64{12, 13, 14}, rConv.TransformedTags().AsSlice())
+
+	identity, err := NewRowConverter(context.Background(), vrw, IdentityMapping(srcSch))
+	require.NoError(t, err)
+	require.True(t, identity.IdentityConverter)
+	require.Equal(t, 0, identity.TransformedTags().Size())
+}
+
+func benchmarkRow(t testing.TB, vrw types.ValueReadWriter) row.Row {
+	inRow, err := row.New(vrw.Format(), srcSch, row.TaggedValues{
+		0: types.UUID(uuid.New()),
+		1: types.Float(1.25),
+		2: types.Uint(12345678),
+		3: types.Bool(true),
+		4: types.Int(-1234),
+		5: types.String("string string string"),
+		6: types.Timestamp(time.Now()),
+	})
+	require.NoError(t, err)
+
+	return inRow
+}
+
+// convertWithMap converts |inRow| by iterating its columns and looking up the conversion of each one, which is how
+// rows were converted before ConversionPlan.
+func convertWithMap(rc *RowConverter, inRow row.Row) (row.Row, error) {
+	outTaggedVals := make(row.TaggedValues, len(rc.SrcToDest))
+	_, err := inRow.IterCols(func(tag uint64, val types.Value) (stop bool, err error) {
+		convFunc, ok := rc.ConvFuncs[tag]
+
+		if ok {
+			outVal, err := convFunc(val)
+
+			if err != nil {
+				return false, err
+			}
+
+			if !types.IsNull(outVal) {
+				outTaggedVals[rc.SrcToDest[tag]] = outVal
+			}
+		}
+
+		return false, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return row.New(inRow.Format(), rc.DestSch, outTaggedVals)
+}
+
+func BenchmarkConvert(b *testing.B) {
+	mapping, err := TypedToUntypedMapping(srcSch)
+	require.NoError(b, err)
+
+	vrw := types.NewMemoryValueStore()
+	rConv, err := NewRowConverter(context.Background(), vrw, mapping)
+	require.NoError(b, err)
+
+	inRow := benchmarkRow(b, vrw)
+
+	b.Run("map", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, err := convertWithMap(rConv, inRow)
+			require.NoError(b, err)
+		}
+	})
+
+	b.Run("plan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, err := rConv.Convert(inRow)
+			require.NoError(b, err)
+		}
+	})
+}
+
+func BenchmarkConvertBatch(b *testing.B) {
+	mapping, err := TypedToUntypedMapping(srcSch)
+	require.NoError(b, err)
+
+	vrw := types.NewMemoryValueStore()
+	rConv, err := NewRowConverter(context.Background(), vrw, mapping)
+	require.NoError(b, err)
+
+	rows := make([]row.Row, 1024)
+	for i := range rows {
+		rows[i] = benchmarkRow(b, vrw)
+	}
+
+	b.Run("loop", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			outRows := make([]row.Row, len(rows))
+			for j, inRow := range rows {
+				outRows[j], err = rConv.Convert(inRow)
+				require.NoError(b, err)
+			}
+		}
+	})
+
+	b.Run("batch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, err := rConv.ConvertBatch(rows)
+			require.NoError(b, err)
+		}
+	})
+}
+
+func BenchmarkConvertInto(b *testing.B) {
+	// rows must be wide enough that their tagged values don't fit in a map allocated on the stack
+	cols := make([]schema.Column, 32)
+	vals := make(row.TaggedValues, len(cols))
+	for i := range cols {
+		cols[i] = schema.NewColumn(fmt.Sprintf("col%d", i), uint64(i), types.IntKind, i == 0)
+		vals[uint64(i)] = types.Int(i)
+	}
+
+	wideSch := schema.MustSchemaFromCols(schema.NewColCollection(cols...))
+	mapping, err := TypedToUntypedMapping(wideSch)
+	require.NoError(b, err)
+
+	vrw := types.NewMemoryValueStore()
+	rConv, err := NewRowConverter(context.Background(), vrw, mapping)
+	require.NoError(b, err)
+
+	inRow, err := row.New(vrw.Format(), wideSch, vals)
+	require.NoError(b, err)
+
+	b.Run("convert", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, err := rConv.Convert(inRow)
+			require.NoError(b, err)
+		}
+	})
+
+	b.Run("convert into", func(b *testing.B) {
+		b.ReportAllocs()
+		scratch := make(row.TaggedValues, len(cols))
+		for i := 0; i < b.N; i++ {
+			_, err := rConv.ConvertInto(inRow, scratch)
+			require.NoError(b, err)
+		}
+	})
+}
+
 func TestUnneccessaryConversion(t *testing.T) {
 	mapping, err := TagMapping(srcSch, srcSch)
 	if err != nil {
@@ -100,3 +1085,204 @@ func TestUnneccessaryConversion(t *testing.T) {
 		t.Fatal("expected identity converter")
 	}
 }
+
+func TestNewIdentityConverter(t *testing.T) {
+	rc := NewIdentityConverter()
+	require.True(t, rc.IdentityConverter)
+	rc.Stats = &ConversionStats{}
+	rc.TargetFormat = types.Format_LD_1
+
+	other := NewIdentityConverter()
+	require.Nil(t, other.Stats)
+	require.Nil(t, other.TargetFormat)
+}
+
+func TestIsNecessaryUnknownTag(t *testing.T) {
+	sch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.IntKind, true),
+	))
+
+	require.NotPanics(t, func() {
+		_, err := IsNecessary(sch, sch, map[uint64]uint64{5: 5})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "tag 5")
+	})
+
+	mapping := &FieldMapping{SrcSch: sch, DestSch: sch, SrcToDest: map[uint64]uint64{5: 5}}
+	require.NotPanics(t, func() {
+		_, err := NewRowConverter(context.Background(), types.NewMemoryValueStore(), mapping)
+		require.Error(t, err)
+	})
+}
+
+func TestKeylessAndKeyedConversion(t *testing.T) {
+	keylessSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.StringKind, false),
+		schema.NewColumn("name", 1, types.StringKind, false),
+	))
+	keyedSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.IntKind, true, schema.NotNullConstraint{}),
+		schema.NewColumn("name", 1, types.StringKind, false),
+	))
+	require.True(t, schema.IsKeyless(keylessSch))
+
+	ctx := context.Background()
+	vrw := types.NewMemoryValueStore()
+
+	requireConverted := func(t *testing.T, rConv *RowConverter, in row.TaggedValues, expectedVals row.TaggedValues) {
+		inRow, err := row.New(vrw.Format(), rConv.SrcSch, in)
+		require.NoError(t, err)
+		outRow, err := rConv.Convert(inRow)
+		require.NoError(t, err)
+
+		expected, err := row.New(vrw.Format(), rConv.DestSch, expectedVals)
+		require.NoError(t, err)
+		require.True(t, row.AreEqual(expected, outRow, rConv.DestSch))
+
+		// the converted row has the key of a row of the destination schema
+		expectedKey, _, err := row.ToNoms(ctx, rConv.DestSch, expected)
+		require.NoError(t, err)
+		outKey, _, err := row.ToNoms(ctx, rConv.DestSch, outRow)
+		require.NoError(t, err)
+		require.True(t, expectedKey.Equals(outKey))
+	}
+
+	t.Run("keyless to keyed", func(t *testing.T) {
+		mapping, err := TagMapping(keylessSch, keyedSch)
+		require.NoError(t, err)
+		rConv, err := NewRowConverter(ctx, vrw, mapping)
+		require.NoError(t, err)
+		require.False(t, rConv.IdentityConverter)
+
+		requireConverted(t, rConv,
+			row.TaggedValues{0: types.String("7"), 1: types.String("seven")},
+			row.TaggedValues{0: types.Int(7), 1: types.String("seven")})
+	})
+
+	t.Run("keyless to keyed without the primary key", func(t *testing.T) {
+		mapping, err := NewFieldMapping(keylessSch, keyedSch, map[uint64]uint64{1: 1})
+		require.NoError(t, err)
+
+		_, err = NewRowConverter(ctx, vrw, mapping)
+		require.True(t, errors.Is(err, ErrUnmappedPrimaryKey))
+		require.Contains(t, err.Error(), "[id]")
+	})
+
+	t.Run("keyed to keyless", func(t *testing.T) {
+		mapping, err := TagMapping(keyedSch, keylessSch)
+		require.NoError(t, err)
+		rConv, err := NewRowConverter(ctx, vrw, mapping)
+		require.NoError(t, err)
+		require.False(t, rConv.IdentityConverter)
+
+		requireConverted(t, rConv,
+			row.TaggedValues{0: types.Int(7), 1: types.String("seven")},
+			row.TaggedValues{0: types.String("7"), 1: types.String("seven")})
+	})
+
+	t.Run("same types", func(t *testing.T) {
+		// only the primary keys differ, which still needs a conversion to build rows with the destination's key
+		keylessInts := schema.MustSchemaFromCols(schema.NewColCollection(
+			schema.NewColumn("id", 0, types.IntKind, false),
+			schema.NewColumn("name", 1, types.StringKind, false),
+		))
+
+		for _, schs := range [][2]schema.Schema{{keylessInts, keyedSch}, {keyedSch, keylessInts}} {
+			mapping, err := TagMapping(schs[0], schs[1])
+			require.NoError(t, err)
+			rConv, err := NewRowConverter(ctx, vrw, mapping)
+			require.NoError(t, err)
+			require.False(t, rConv.IdentityConverter)
+
+			vals := row.TaggedValues{0: types.Int(7), 1: types.String("seven")}
+			requireConverted(t, rConv, vals, vals)
+		}
+	})
+}
+
+func TestIsNecessaryPrimaryKeyOrder(t *testing.T) {
+	cols := []schema.Column{
+		schema.NewColumn("a", 0, types.IntKind, true),
+		schema.NewColumn("b", 1, types.IntKind, true),
+	}
+	srcSch := schema.MustSchemaFromCols(schema.NewColCollection(cols...))
+	destSch := schema.MustSchemaFromCols(schema.NewColCollection(cols[1], cols[0]))
+
+	nec, err := IsNecessary(srcSch, destSch, map[uint64]uint64{0: 0, 1: 1})
+	require.NoError(t, err)
+	require.True(t, nec)
+}
+
+func TestUnsupportedConversion(t *testing.T) {
+	srcSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.IntKind, true),
+		schema.NewColumn("flag", 1, types.BoolKind, false),
+	))
+	destSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.IntKind, true),
+		schema.NewColumn("flag", 1, types.UUIDKind, false),
+	))
+
+	mapping, err := TagMapping(srcSch, destSch)
+	require.NoError(t, err)
+
+	// the converter can't be created, so no rows are ever converted
+	_, err = NewRowConverter(context.Background(), types.NewMemoryValueStore(), mapping)
+	require.True(t, errors.Is(err, ErrUnsupportedConversion))
+
+	var convErr UnsupportedConversionError
+	require.True(t, errors.As(err, &convErr))
+	require.Equal(t, uint64(1), convErr.SrcTag)
+	require.Equal(t, uint64(1), convErr.DestTag)
+	require.Equal(t, typeinfo.BoolType, convErr.SrcType)
+	require.Equal(t, typeinfo.UuidType, convErr.DestType)
+	require.Error(t, convErr.Err)
+
+	// the compatibility check agrees that the conversion is unsupported
+	report, err := CheckCompatibility(context.Background(), mapping)
+	require.NoError(t, err)
+	require.Equal(t, Unsupported, report[1].Compatibility)
+}
+
+func TestConvertToFormat(t *testing.T) {
+	inRow, err := row.New(types.Format_7_18, srcSch, row.TaggedValues{
+		0: types.UUID(uuid.New()),
+		1: types.Float(1.25),
+		4: types.Int(-1234),
+	})
+	require.NoError(t, err)
+
+	typedToUntyped, err := TypedToUntypedMapping(srcSch)
+	require.NoError(t, err)
+	identity, err := TagMapping(srcSch, srcSch)
+	require.NoError(t, err)
+
+	vrw := types.NewMemoryValueStore()
+	for _, mapping := range []*FieldMapping{typedToUntyped, identity} {
+		rConv, err := NewRowConverterToFormat(context.Background(), vrw, mapping, types.Format_LD_1)
+		require.NoError(t, err)
+
+		outRow, err := rConv.Convert(inRow)
+		require.NoError(t, err)
+		require.Equal(t, types.Format_LD_1, outRow.Format())
+
+		outRows, err := rConv.ConvertBatch([]row.Row{inRow})
+		require.NoError(t, err)
+		require.Equal(t, types.Format_LD_1, outRows[0].Format())
+
+		outRow, err = rConv.ConvertInto(inRow, make(row.TaggedValues))
+		require.NoError(t, err)
+		require.Equal(t, types.Format_LD_1, outRow.Format())
+
+		outVals, err := outRow.TaggedValues()
+		require.NoError(t, err)
+		require.Len(t, outVals, 3)
+	}
+
+	// without a target format rows keep the format they were converted from
+	rConv, err := NewRowConverter(context.Background(), vrw, typedToUntyped)
+	require.NoError(t, err)
+	outRow, err := rConv.Convert(inRow)
+	require.NoError(t, err)
+	require.Equal(t, types.Format_7_18, outRow.Format())
+}
@@ -0,0 +1,85 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rowconv
+
+import (
+	"sync/atomic"
+)
+
+// ConversionStats accumulates counts of the work done by a RowConverter. It is safe for concurrent use, so a single
+// ConversionStats can be shared by converters used from several goroutines.
+type ConversionStats struct {
+	rows    int64
+	columns int64
+	nulls   int64
+	lossy   int64
+	errs    int64
+}
+
+// ConversionSummary is a snapshot of the counts of a ConversionStats.
+type ConversionSummary struct {
+	// Rows is the number of rows converted successfully, including rows passed through unchanged by an identity
+	// converter.
+	Rows int64
+	// Columns is the number of column values converted. Values passed through by an identity converter aren't counted.
+	Columns int64
+	// NullColumns is the number of mapped columns which were null, or converted to null, and so were left out of the
+	// converted row.
+	NullColumns int64
+	// LossyConversions is the number of values which were changed to fit their destination column. Lossy conversions
+	// are only made by converters with a Warn func, and fail otherwise.
+	LossyConversions int64
+	// Errors is the number of column values which failed to convert, plus the number of rows which failed for other
+	// reasons.
+	Errors int64
+}
+
+// Summary returns the current counts.
+func (s *ConversionStats) Summary() ConversionSummary {
+	return ConversionSummary{
+		Rows:             atomic.LoadInt64(&s.rows),
+		Columns:          atomic.LoadInt64(&s.columns),
+		NullColumns:      atomic.LoadInt64(&s.nulls),
+		LossyConversions: atomic.LoadInt64(&s.lossy),
+		Errors:           atomic.LoadInt64(&s.errs),
+	}
+}
+
+// conversionCounts are the counts for a single row, which are added to a ConversionStats once the row is converted.
+type conversionCounts struct {
+	nulls int64
+	lossy int64
+}
+
+// addRow adds the counts of a row which converted to |columns| values with |colErrs| column errors, and failed with
+// |err| if it's non-nil.
+func (s *ConversionStats) addRow(counts conversionCounts, columns, colErrs int, err error) {
+	atomic.AddInt64(&s.nulls, counts.nulls)
+	atomic.AddInt64(&s.lossy, counts.lossy)
+	atomic.AddInt64(&s.errs, int64(colErrs))
+
+	if err != nil {
+		atomic.AddInt64(&s.errs, 1)
+		return
+	}
+
+	atomic.AddInt64(&s.rows, 1)
+	atomic.AddInt64(&s.columns, int64(columns))
+}
+
+// addIdentityRows adds |n| rows passed through by an identity converter.
+func (s *ConversionStats) addIdentityRows(n int) {
+	atomic.AddInt64(&s.rows, int64(n))
+}
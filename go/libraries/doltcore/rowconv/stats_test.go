@@ -0,0 +1,113 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rowconv
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dolthub/dolt/go/libraries/doltcore/row"
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema"
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema/typeinfo"
+	"github.com/dolthub/dolt/go/store/types"
+)
+
+func TestConversionStats(t *testing.T) {
+	srcSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.IntKind, true),
+		schema.NewColumn("count", 1, types.IntKind, false),
+		schema.NewColumn("name", 2, types.StringKind, false),
+	))
+	destSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.IntKind, true),
+		mustColumnWithTypeInfo("count", 1, typeinfo.Int8Type, false),
+		schema.NewColumn("name", 2, types.StringKind, false),
+	))
+
+	mapping, err := TagMapping(srcSch, destSch)
+	require.NoError(t, err)
+
+	vrw := types.NewMemoryValueStore()
+	rConv, err := NewRowConverter(context.Background(), vrw, mapping)
+	require.NoError(t, err)
+
+	newRow := func(vals row.TaggedValues) row.Row {
+		r, err := row.New(vrw.Format(), srcSch, vals)
+		require.NoError(t, err)
+		return r
+	}
+
+	// without stats nothing is counted
+	_, err = rConv.Convert(newRow(row.TaggedValues{0: types.Int(0), 1: types.Int(1), 2: types.String("a")}))
+	require.NoError(t, err)
+
+	rConv.Stats = &ConversionStats{}
+
+	// 3 columns
+	_, err = rConv.Convert(newRow(row.TaggedValues{0: types.Int(1), 1: types.Int(1), 2: types.String("a")}))
+	require.NoError(t, err)
+
+	// 2 columns and a null
+	_, err = rConv.Convert(newRow(row.TaggedValues{0: types.Int(2), 1: types.Int(2)}))
+	require.NoError(t, err)
+
+	// an overflow fails the row
+	_, err = rConv.Convert(newRow(row.TaggedValues{0: types.Int(3), 1: types.Int(1000), 2: types.String("c")}))
+	require.Error(t, err)
+
+	require.Equal(t, ConversionSummary{Rows: 2, Columns: 5, NullColumns: 1, Errors: 1}, rConv.Stats.Summary())
+
+	// with a warning func the overflow is a lossy conversion instead
+	rConv.Warn = func(LossyConversion) {}
+	_, err = rConv.Convert(newRow(row.TaggedValues{0: types.Int(3), 1: types.Int(1000), 2: types.String("c")}))
+	require.NoError(t, err)
+
+	require.Equal(t, ConversionSummary{Rows: 3, Columns: 8, NullColumns: 1, LossyConversions: 1, Errors: 1}, rConv.Stats.Summary())
+}
+
+func TestConversionStatsConcurrent(t *testing.T) {
+	mapping, err := TypedToUntypedMapping(srcSch)
+	require.NoError(t, err)
+
+	vrw := types.NewMemoryValueStore()
+	rConv, err := NewRowConverter(context.Background(), vrw, mapping)
+	require.NoError(t, err)
+
+	rConv.Stats = &ConversionStats{}
+	inRow := benchmarkRow(t, vrw)
+
+	const goroutines = 8
+	const rowsEach = 100
+	wg := &sync.WaitGroup{}
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < rowsEach; j++ {
+				_, err := rConv.Convert(inRow)
+				require.NoError(t, err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	summary := rConv.Stats.Summary()
+	require.Equal(t, int64(goroutines*rowsEach), summary.Rows)
+	require.Equal(t, int64(goroutines*rowsEach*srcCols.Size()), summary.Columns)
+}
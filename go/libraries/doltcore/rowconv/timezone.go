@@ -0,0 +1,70 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rowconv
+
+import (
+	"context"
+	"time"
+
+	"github.com/dolthub/vitess/go/sqltypes"
+
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema/typeinfo"
+	"github.com/dolthub/dolt/go/store/types"
+)
+
+// timeZoneConv returns the conversion between the TIMESTAMP type |srcTi| and the DATETIME or DATE type |destTi|, or
+// the reverse, using the wall clock time in |loc|. It returns nil for any other pair of types, and when |loc| is nil.
+func timeZoneConv(ctx context.Context, vrw types.ValueReadWriter, srcTi, destTi typeinfo.TypeInfo, loc *time.Location) types.MarshalCallback {
+	if loc == nil {
+		return nil
+	}
+
+	srcType := srcTi.ToSqlType().Type()
+	destType := destTi.ToSqlType().Type()
+	srcIsWallClock := srcType == sqltypes.Datetime || srcType == sqltypes.Date
+	destIsWallClock := destType == sqltypes.Datetime || destType == sqltypes.Date
+
+	var shift func(t time.Time) time.Time
+	if srcType == sqltypes.Timestamp && destIsWallClock {
+		shift = func(t time.Time) time.Time {
+			return wallClock(t.In(loc), time.UTC)
+		}
+	} else if srcIsWallClock && destType == sqltypes.Timestamp {
+		shift = func(t time.Time) time.Time {
+			return wallClock(t.UTC(), loc).UTC()
+		}
+	} else {
+		return nil
+	}
+
+	return func(v types.Value) (types.Value, error) {
+		if types.IsNull(v) {
+			return types.NullValue, nil
+		}
+
+		val, err := srcTi.ConvertNomsValueToValue(v)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return destTi.ConvertValueToNomsValue(ctx, vrw, shift(val.(time.Time)))
+	}
+}
+
+// wallClock returns the time in |loc| with the same wall clock reading as |t|.
+func wallClock(t time.Time, loc *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
@@ -0,0 +1,110 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rowconv
+
+import (
+	"context"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/dolthub/dolt/go/libraries/doltcore/row"
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema"
+	"github.com/dolthub/dolt/go/libraries/doltcore/schema/typeinfo"
+	"github.com/dolthub/dolt/go/store/types"
+)
+
+func TestTimestampToDatetimeInLocation(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	tsSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.IntKind, true),
+		mustColumnWithTypeInfo("at", 1, typeinfo.TimestampType, false),
+	))
+	dtSch := schema.MustSchemaFromCols(schema.NewColCollection(
+		schema.NewColumn("id", 0, types.IntKind, true),
+		mustColumnWithTypeInfo("at", 1, typeinfo.DatetimeType, false),
+	))
+
+	vrw := types.NewMemoryValueStore()
+	toDatetime, err := TagMapping(tsSch, dtSch)
+	require.NoError(t, err)
+	tsToDt, err := NewRowConverterInLocation(context.Background(), vrw, toDatetime, loc)
+	require.NoError(t, err)
+
+	toTimestamp, err := TagMapping(dtSch, tsSch)
+	require.NoError(t, err)
+	dtToTs, err := NewRowConverterInLocation(context.Background(), vrw, toTimestamp, loc)
+	require.NoError(t, err)
+
+	// clocks in New York went from 01:59:59 EST to 03:00:00 EDT at 2021-03-14 07:00:00 UTC
+	tests := []struct {
+		name      string
+		timestamp time.Time
+		wallClock time.Time
+	}{
+		{
+			"before dst",
+			time.Date(2021, 3, 14, 6, 59, 0, 0, time.UTC),
+			time.Date(2021, 3, 14, 1, 59, 0, 0, time.UTC),
+		},
+		{
+			"after dst",
+			time.Date(2021, 3, 14, 7, 0, 0, 0, time.UTC),
+			time.Date(2021, 3, 14, 3, 0, 0, 0, time.UTC),
+		},
+		{
+			"summer",
+			time.Date(2021, 7, 1, 16, 30, 0, 0, time.UTC),
+			time.Date(2021, 7, 1, 12, 30, 0, 0, time.UTC),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tsRow, err := row.New(vrw.Format(), tsSch, row.TaggedValues{0: types.Int(1), 1: types.Timestamp(test.timestamp)})
+			require.NoError(t, err)
+
+			dtRow, err := tsToDt.Convert(tsRow)
+			require.NoError(t, err)
+
+			val, ok := dtRow.GetColVal(1)
+			require.True(t, ok)
+			require.True(t, test.wallClock.Equal(time.Time(val.(types.Timestamp))), "%v != %v", test.wallClock, time.Time(val.(types.Timestamp)))
+
+			// and converting the wall clock time back gives the original instant
+			roundTrip, err := dtToTs.Convert(dtRow)
+			require.NoError(t, err)
+			require.True(t, row.AreEqual(tsRow, roundTrip, tsSch), row.Fmt(context.Background(), roundTrip, tsSch))
+		})
+	}
+
+	// without a location the wall clock time in UTC is used
+	rConv, err := NewRowConverter(context.Background(), vrw, toDatetime)
+	require.NoError(t, err)
+
+	tsRow, err := row.New(vrw.Format(), tsSch, row.TaggedValues{0: types.Int(1), 1: types.Timestamp(tests[2].timestamp)})
+	require.NoError(t, err)
+
+	dtRow, err := rConv.Convert(tsRow)
+	require.NoError(t, err)
+
+	val, ok := dtRow.GetColVal(1)
+	require.True(t, ok)
+	require.True(t, tests[2].timestamp.Equal(time.Time(val.(types.Timestamp))))
+}
@@ -602,7 +602,7 @@ func (dp *diffPartitions) Close(*sql.Context) error {
 // creates a RowConverter for transforming rows with the the given schema to this super schema.
 func rowConvForSchema(ctx context.Context, vrw types.ValueReadWriter, ss *schema.SuperSchema, sch schema.Schema) (*rowconv.RowConverter, error) {
 	if schema.SchemasAreEqual(sch, schema.EmptySchema) {
-		return rowconv.IdentityConverter, nil
+		return rowconv.NewIdentityConverter(), nil
 	}
 
 	inNameToOutName, err := ss.NameMapForSchema(sch)
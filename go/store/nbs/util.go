@@ -73,3 +73,16 @@ func readNFrom(rd io.ReadSeeker, offset uint64, length uint32) ([]byte, error) {
 
 	return iohelp.ReadNBytes(rd, int(length))
 }
+
+// TableFileName computes the name of the table file read from |rd| from its index. Table files are named by the
+// sha512 of the address suffixes stored in their index, so a table file's name can be checked against its contents.
+func TableFileName(rd io.ReadSeeker) (hash.Hash, error) {
+	idx, err := ReadTableIndex(rd)
+	if err != nil {
+		return hash.Hash{}, err
+	}
+
+	defer idx.Close()
+
+	return hash.Hash(nameFromSuffixes(idx.suffixes)), nil
+}
@@ -0,0 +1,51 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package nbs
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dolthub/dolt/go/store/chunks"
+	"github.com/dolthub/dolt/go/store/hash"
+)
+
+func TestTableFileName(t *testing.T) {
+	chnks := []chunks.Chunk{
+		chunks.NewChunk([]byte("hello")),
+		chunks.NewChunk([]byte("goodbye")),
+		chunks.NewChunk([]byte("badbye")),
+	}
+
+	name, data, err := WriteChunks(chnks)
+	require.NoError(t, err)
+
+	computed, err := TableFileName(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, name, computed.String())
+
+	data, blockHash, err := buildTable([][]byte{[]byte("hello"), []byte("goodbye")})
+	require.NoError(t, err)
+
+	computed, err = TableFileName(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, hash.Hash(blockHash), computed)
+
+	_, err = TableFileName(bytes.NewReader([]byte("not a table file")))
+	assert.Error(t, err)
+}
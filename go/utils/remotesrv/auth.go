@@ -0,0 +1,132 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// authResult is the outcome of authorizing a request.
+type authResult int
+
+const (
+	// authAllowed allows the request to proceed.
+	authAllowed authResult = iota
+	// authUnauthenticated rejects a request whose client could not be identified with a 401.
+	authUnauthenticated
+	// authForbidden rejects a request from an identified client which is not allowed to make it with a 403.
+	authForbidden
+)
+
+// requestAuthorizer decides whether an http request may access the table files of |org|/|repo|. It is invoked for
+// every table file request before it is dispatched. The returned reason is logged, but not sent to the client.
+type requestAuthorizer interface {
+	authorize(method, org, repo string, req *http.Request) (authResult, string)
+}
+
+// allowAll is a requestAuthorizer which allows every request.
+type allowAll struct{}
+
+func (allowAll) authorize(method, org, repo string, req *http.Request) (authResult, string) {
+	return authAllowed, "all requests are allowed"
+}
+
+// tokenPermission is the access granted to the holder of a bearer token.
+type tokenPermission int
+
+const (
+	// readPermission allows GET and HEAD requests.
+	readPermission tokenPermission = iota
+	// writePermission allows every request.
+	writePermission
+)
+
+// bearerTokenAuth is a requestAuthorizer which requires clients to present a known token in an
+// "Authorization: Bearer <token>" header, and limits clients to the permission granted to their token.
+type bearerTokenAuth struct {
+	tokens map[string]tokenPermission
+}
+
+func newBearerTokenAuth(tokens map[string]tokenPermission) *bearerTokenAuth {
+	return &bearerTokenAuth{tokens}
+}
+
+// loadBearerTokenAuth reads tokens from the file at |path|. Each non empty line which is not a # comment holds a
+// token followed by its permission, either "read" or "write".
+func loadBearerTokenAuth(path string) (*bearerTokenAuth, error) {
+	f, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	tokens := make(map[string]tokenPermission)
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected a token and a permission", path, lineNum)
+		}
+
+		switch fields[1] {
+		case "read":
+			tokens[fields[0]] = readPermission
+		case "write":
+			tokens[fields[0]] = writePermission
+		default:
+			return nil, fmt.Errorf("%s:%d: unknown permission '%s'", path, lineNum, fields[1])
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return newBearerTokenAuth(tokens), nil
+}
+
+func (ba *bearerTokenAuth) authorize(method, org, repo string, req *http.Request) (authResult, string) {
+	authHeader := req.Header.Get("Authorization")
+	const prefix = "bearer "
+
+	if len(authHeader) <= len(prefix) || !strings.EqualFold(authHeader[:len(prefix)], prefix) {
+		return authUnauthenticated, "no bearer token provided"
+	}
+
+	perm, ok := ba.tokens[strings.TrimSpace(authHeader[len(prefix):])]
+
+	if !ok {
+		return authUnauthenticated, "unknown bearer token"
+	}
+
+	if perm == writePermission || method == http.MethodGet || method == http.MethodHead {
+		return authAllowed, "bearer token grants access"
+	}
+
+	return authForbidden, fmt.Sprintf("bearer token does not allow %s requests to %s/%s", method, org, repo)
+}
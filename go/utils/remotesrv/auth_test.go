@@ -0,0 +1,111 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBearerTokenAuth(t *testing.T) {
+	fh := newTestHandler(t)
+	fh.auth = newBearerTokenAuth(map[string]tokenPermission{
+		"reader": readPermission,
+		"writer": writePermission,
+	})
+
+	existing := []byte("an existing table file")
+	existingId := writeTestFile(t, fh, existing)
+
+	tests := []struct {
+		name     string
+		method   string
+		authz    string
+		expected int
+	}{
+		{"read without token", http.MethodGet, "", http.StatusUnauthorized},
+		{"read with unknown token", http.MethodGet, "Bearer unknown", http.StatusUnauthorized},
+		{"read with basic auth", http.MethodGet, "Basic cmVhZGVyOg==", http.StatusUnauthorized},
+		{"read with read token", http.MethodGet, "Bearer reader", http.StatusOK},
+		{"head with read token", http.MethodHead, "Bearer reader", http.StatusOK},
+		{"read with lowercase scheme", http.MethodGet, "bearer reader", http.StatusOK},
+		{"read with write token", http.MethodGet, "Bearer writer", http.StatusOK},
+		{"write without token", http.MethodPost, "", http.StatusUnauthorized},
+		{"write with read token", http.MethodPost, "Bearer reader", http.StatusForbidden},
+		{"delete with read token", http.MethodDelete, "Bearer reader", http.StatusForbidden},
+		{"write with write token", http.MethodPost, "Bearer writer", http.StatusCreated},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fileId := existingId
+			var body []byte
+			if test.method == http.MethodPost {
+				body = []byte("uploaded by " + test.name)
+				fileId = expectUpload(t, body)
+			}
+
+			req := httptest.NewRequest(test.method, fileUrl(testOrg, testRepo, fileId), bytes.NewReader(body))
+			if test.authz != "" {
+				req.Header.Set("Authorization", test.authz)
+			}
+
+			rec := doRequest(fh, req)
+			assert.Equal(t, test.expected, rec.Code)
+
+			if test.expected == http.StatusUnauthorized {
+				assert.Equal(t, `Bearer realm="remotesrv"`, rec.Header().Get("WWW-Authenticate"))
+			}
+
+			if test.method == http.MethodPost && test.expected != http.StatusCreated {
+				assert.NoFileExists(t, filepath.Join(testRoot(fh), testOrg, testRepo, fileId))
+			}
+		})
+	}
+
+	assert.FileExists(t, filepath.Join(testRoot(fh), testOrg, testRepo, existingId))
+}
+
+func TestLoadBearerTokenAuth(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tokens")
+	require.NoError(t, os.WriteFile(path, []byte("# comment\n\nreader read\n  writer   write  \n"), 0600))
+
+	auth, err := loadBearerTokenAuth(path)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]tokenPermission{"reader": readPermission, "writer": writePermission}, auth.tokens)
+
+	invalid := []string{
+		"token\n",
+		"token read extra\n",
+		"token admin\n",
+	}
+
+	for _, contents := range invalid {
+		require.NoError(t, os.WriteFile(path, []byte(contents), 0600))
+		_, err = loadBearerTokenAuth(path)
+		assert.Error(t, err, contents)
+	}
+
+	_, err = loadBearerTokenAuth(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,150 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dolthub/dolt/go/libraries/utils/file"
+)
+
+// errBlobNotFound is returned by a BlobStore when the requested blob does not exist.
+var errBlobNotFound = errors.New("blob not found")
+
+// errInvalidBlobRange is returned by a BlobStore when a requested range is not contained within the blob.
+var errInvalidBlobRange = errors.New("range is outside of the blob")
+
+// BlobInfo describes a stored blob.
+type BlobInfo struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// BlobListing describes a blob in the listing of a repo.
+type BlobListing struct {
+	FileId string `json:"file_id"`
+	Size   int64  `json:"size"`
+}
+
+// BlobStore is the storage backend for the table files served by the http file server. Blobs are identified by the
+// org and repo they belong to and their file id, each of which has already been validated as a safe path element.
+type BlobStore interface {
+	// Get returns the contents and size of a blob. The caller must close the returned reader.
+	Get(ctx context.Context, org, repo, fileId string) (io.ReadCloser, int64, error)
+
+	// GetRange returns |length| bytes of a blob starting at |offset|. The caller must close the returned reader.
+	GetRange(ctx context.Context, org, repo, fileId string, offset, length int64) (io.ReadCloser, error)
+
+	// Put stores the contents of |rd| as a blob, replacing any existing blob. If |validate| is not nil it is called
+	// with the complete contents, positioned at the start, before they become visible, and an error from it aborts
+	// the Put. A failed Put never leaves a partial blob behind.
+	Put(ctx context.Context, org, repo, fileId string, rd io.Reader, validate func(io.ReadSeeker) error) error
+
+	// Stat returns the BlobInfo of a blob.
+	Stat(ctx context.Context, org, repo, fileId string) (BlobInfo, error)
+
+	// Delete removes a blob.
+	Delete(ctx context.Context, org, repo, fileId string) error
+
+	// List returns up to |limit| of the blobs of a repo, ordered by file id, beginning with the first file id which
+	// sorts after |after|. A repo which has no blobs has an empty listing.
+	List(ctx context.Context, org, repo, after string, limit int) ([]BlobListing, error)
+}
+
+// blobErrStatus maps an error returned by a BlobStore to the http status code to respond with.
+func blobErrStatus(err error) int {
+	switch {
+	case errors.Is(err, errBlobNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errInvalidBlobRange):
+		return http.StatusRequestedRangeNotSatisfiable
+	case errors.Is(err, errUnsafePath):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// checksummer is implemented by BlobStores which record the md5 of each blob as it is stored, so that its contents can
+// be verified long after the upload which stored it.
+type checksummer interface {
+	// Checksum returns the md5 recorded for a blob, or nil if none was recorded.
+	Checksum(ctx context.Context, org, repo, fileId string) ([]byte, error)
+}
+
+// tempFileRemover is implemented by types which create temp files that must be removed on shutdown.
+type tempFileRemover interface {
+	removeTempFiles() error
+}
+
+// tempFileSet tracks the paths of temp files which are in use so that they can be removed if the server shuts down
+// before they are.
+type tempFileSet struct {
+	mu    *sync.Mutex
+	paths map[string]struct{}
+}
+
+func newTempFileSet() *tempFileSet {
+	return &tempFileSet{&sync.Mutex{}, make(map[string]struct{})}
+}
+
+func (ts *tempFileSet) track(path string) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.paths[path] = struct{}{}
+}
+
+func (ts *tempFileSet) untrack(path string) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	delete(ts.paths, path)
+}
+
+// remove deletes the temp file at |path| and stops tracking it.
+func (ts *tempFileSet) remove(path string) error {
+	defer ts.untrack(path)
+	err := file.Remove(path)
+
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// removeTempFiles deletes every tracked temp file.
+func (ts *tempFileSet) removeTempFiles() error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	var firstErr error
+	for path := range ts.paths {
+		err := file.Remove(path)
+
+		if err != nil && !os.IsNotExist(err) && firstErr == nil {
+			firstErr = err
+		}
+
+		delete(ts.paths, path)
+	}
+
+	return firstErr
+}
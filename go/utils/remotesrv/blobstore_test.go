@@ -0,0 +1,183 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dolthub/dolt/go/store/hash"
+)
+
+func TestBlobStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) BlobStore{
+		"file": func(t *testing.T) BlobStore {
+			dir := t.TempDir()
+			require.NoError(t, os.MkdirAll(dir+"/"+testOrg+"/"+testRepo, os.ModePerm))
+			store, err := newFileStore(dir)
+			require.NoError(t, err)
+			return store
+		},
+		"sharded file": func(t *testing.T) BlobStore {
+			store, err := newFileStore(t.TempDir())
+			require.NoError(t, err)
+			store.shardDepth = 2
+			return store
+		},
+		"memory": func(t *testing.T) BlobStore {
+			return newMemBlobStore()
+		},
+		"s3": func(t *testing.T) BlobStore {
+			store := newS3Store(newFakeS3(), "bucket", "prefix")
+			store.tmpDir = t.TempDir()
+			return store
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			testBlobStore(t, newStore(t))
+		})
+		t.Run(name+" list", func(t *testing.T) {
+			testBlobStoreList(t, newStore(t))
+		})
+	}
+}
+
+// otherTestRepo is a repo whose name starts with testRepo, so its blobs share a prefix with the blobs of testRepo.
+const otherTestRepo = testRepo + "2"
+
+func testBlobStoreList(t *testing.T, store BlobStore) {
+	ctx := context.Background()
+
+	listing, err := store.List(ctx, testOrg, testRepo, "", 10)
+	require.NoError(t, err)
+	assert.NotNil(t, listing)
+	assert.Empty(t, listing)
+
+	var expected []BlobListing
+	for i := 0; i < 5; i++ {
+		data := []byte(strings.Repeat("x", i+1))
+		fileId := hash.Of(data).String()
+		require.NoError(t, store.Put(ctx, testOrg, testRepo, fileId, bytes.NewReader(data), nil))
+		expected = append(expected, BlobListing{FileId: fileId, Size: int64(len(data))})
+	}
+
+	sort.Slice(expected, func(i, j int) bool {
+		return expected[i].FileId < expected[j].FileId
+	})
+
+	// the blobs of other repos are not listed, even when the name of the repo starts with the name of the listed repo
+	require.NoError(t, store.Put(ctx, testOrg, otherTestRepo, hash.Of([]byte("other")).String(), bytes.NewReader([]byte("other")), nil))
+
+	listing, err = store.List(ctx, testOrg, testRepo, "", 10)
+	require.NoError(t, err)
+	assert.Equal(t, expected, listing)
+
+	listing, err = store.List(ctx, testOrg, testRepo, "", 2)
+	require.NoError(t, err)
+	assert.Equal(t, expected[:2], listing)
+
+	listing, err = store.List(ctx, testOrg, testRepo, expected[1].FileId, 2)
+	require.NoError(t, err)
+	assert.Equal(t, expected[2:4], listing)
+
+	listing, err = store.List(ctx, testOrg, testRepo, expected[4].FileId, 2)
+	require.NoError(t, err)
+	assert.Empty(t, listing)
+}
+
+func testBlobStore(t *testing.T, store BlobStore) {
+	ctx := context.Background()
+	data := []byte("0123456789")
+	fileId := "blob"
+
+	_, err := store.Stat(ctx, testOrg, testRepo, fileId)
+	assert.True(t, errors.Is(err, errBlobNotFound))
+	_, _, err = store.Get(ctx, testOrg, testRepo, fileId)
+	assert.True(t, errors.Is(err, errBlobNotFound))
+	_, err = store.GetRange(ctx, testOrg, testRepo, fileId, 0, 1)
+	assert.True(t, errors.Is(err, errBlobNotFound))
+	assert.True(t, errors.Is(store.Delete(ctx, testOrg, testRepo, fileId), errBlobNotFound))
+
+	validationErr := errors.New("validation failed")
+	err = store.Put(ctx, testOrg, testRepo, fileId, bytes.NewReader(data), func(rd io.ReadSeeker) error {
+		contents, err := io.ReadAll(rd)
+		require.NoError(t, err)
+		assert.Equal(t, data, contents)
+		return validationErr
+	})
+	assert.True(t, errors.Is(err, validationErr))
+	_, err = store.Stat(ctx, testOrg, testRepo, fileId)
+	assert.True(t, errors.Is(err, errBlobNotFound), "a blob which failed validation was stored")
+
+	require.NoError(t, store.Put(ctx, testOrg, testRepo, fileId, bytes.NewReader(data), nil))
+
+	info, err := store.Stat(ctx, testOrg, testRepo, fileId)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), info.Size)
+
+	rd, size, err := store.Get(ctx, testOrg, testRepo, fileId)
+	require.NoError(t, err)
+	contents, err := io.ReadAll(rd)
+	require.NoError(t, err)
+	require.NoError(t, rd.Close())
+	assert.Equal(t, int64(len(data)), size)
+	assert.Equal(t, data, contents)
+
+	rd, err = store.GetRange(ctx, testOrg, testRepo, fileId, 3, 4)
+	require.NoError(t, err)
+	contents, err = io.ReadAll(rd)
+	require.NoError(t, err)
+	require.NoError(t, rd.Close())
+	assert.Equal(t, []byte("3456"), contents)
+
+	// ranges which end exactly at the end of the blob
+	for _, rng := range []byteRange{{9, 1}, {0, 10}, {10, 0}} {
+		rd, err = store.GetRange(ctx, testOrg, testRepo, fileId, rng.offset, rng.length)
+		require.NoError(t, err)
+		contents, err = io.ReadAll(rd)
+		require.NoError(t, err)
+		require.NoError(t, rd.Close())
+		assert.Equal(t, data[rng.offset:], contents)
+	}
+
+	// ranges which end one or more bytes past it
+	for _, rng := range []byteRange{{9, 2}, {8, 4}, {10, 1}, {11, 0}} {
+		_, err = store.GetRange(ctx, testOrg, testRepo, fileId, rng.offset, rng.length)
+		assert.True(t, errors.Is(err, errInvalidBlobRange), "range %v", rng)
+	}
+
+	require.NoError(t, store.Put(ctx, testOrg, testRepo, fileId, bytes.NewReader([]byte("replaced")), nil))
+	rd, _, err = store.Get(ctx, testOrg, testRepo, fileId)
+	require.NoError(t, err)
+	contents, err = io.ReadAll(rd)
+	require.NoError(t, err)
+	require.NoError(t, rd.Close())
+	assert.Equal(t, []byte("replaced"), contents)
+
+	require.NoError(t, store.Delete(ctx, testOrg, testRepo, fileId))
+	_, err = store.Stat(ctx, testOrg, testRepo, fileId)
+	assert.True(t, errors.Is(err, errBlobNotFound))
+}
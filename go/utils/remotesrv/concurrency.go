@@ -0,0 +1,101 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// concurrencyMode is what a concurrencyLimiter does with requests which arrive while every slot is in use.
+type concurrencyMode int
+
+const (
+	// queueExcess makes excess requests wait for a slot.
+	queueExcess concurrencyMode = iota
+
+	// rejectExcess rejects excess requests.
+	rejectExcess
+)
+
+// parseConcurrencyMode parses the name of a concurrencyMode, which is either "queue" or "reject".
+func parseConcurrencyMode(mode string) (concurrencyMode, error) {
+	switch mode {
+	case "queue":
+		return queueExcess, nil
+	case "reject":
+		return rejectExcess, nil
+	default:
+		return 0, fmt.Errorf("unknown concurrency limit mode '%s'. expected 'queue' or 'reject'", mode)
+	}
+}
+
+// concurrencyLimiter limits the number of requests which are served at once. Each request being served holds one of
+// a fixed number of slots, and requests which arrive while every slot is in use are either queued or rejected.
+type concurrencyLimiter struct {
+	slots  chan struct{}
+	mode   concurrencyMode
+	queued int64
+}
+
+func newConcurrencyLimiter(limit int, mode concurrencyMode) *concurrencyLimiter {
+	return &concurrencyLimiter{slots: make(chan struct{}, limit), mode: mode}
+}
+
+// acquire takes a slot, waiting for one to be released if every slot is in use and excess requests are queued. It
+// returns false if the request is rejected, or if |ctx| is done before a slot is available. Every successful acquire
+// must be paired with a call to release.
+func (cl *concurrencyLimiter) acquire(ctx context.Context) bool {
+	select {
+	case cl.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if cl.mode == rejectExcess {
+		return false
+	}
+
+	atomic.AddInt64(&cl.queued, 1)
+	defer atomic.AddInt64(&cl.queued, -1)
+
+	select {
+	case cl.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// release returns a slot taken by acquire.
+func (cl *concurrencyLimiter) release() {
+	<-cl.slots
+}
+
+// limit returns the number of requests which may be served at once.
+func (cl *concurrencyLimiter) limit() int {
+	return cap(cl.slots)
+}
+
+// inUse returns the number of requests currently holding a slot.
+func (cl *concurrencyLimiter) inUse() int {
+	return len(cl.slots)
+}
+
+// queuedRequests returns the number of requests currently waiting for a slot.
+func (cl *concurrencyLimiter) queuedRequests() int64 {
+	return atomic.LoadInt64(&cl.queued)
+}
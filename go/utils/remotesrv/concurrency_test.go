@@ -0,0 +1,143 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingBlobStore blocks every Stat until release is closed, so that the requests which make them hold their
+// concurrency limit slots.
+type blockingBlobStore struct {
+	*memBlobStore
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingBlobStore() *blockingBlobStore {
+	return &blockingBlobStore{newMemBlobStore(), make(chan struct{}, 16), make(chan struct{})}
+}
+
+func (bs *blockingBlobStore) Stat(ctx context.Context, org, repo, fileId string) (BlobInfo, error) {
+	bs.started <- struct{}{}
+	<-bs.release
+	return bs.memBlobStore.Stat(ctx, org, repo, fileId)
+}
+
+// newConcurrencyTestHandler returns a handler limited to |limit| concurrent requests, which serves a single file whose
+// url is returned.
+func newConcurrencyTestHandler(t *testing.T, limit int, mode concurrencyMode) (*fileHandler, *blockingBlobStore, string) {
+	store := newBlockingBlobStore()
+	data := []byte("a table file which is requested concurrently")
+	require.NoError(t, store.memBlobStore.Put(context.Background(), testOrg, testRepo, "file", bytes.NewReader(data), nil))
+
+	fh := newFileHandler(store)
+	fh.concurrency = newConcurrencyLimiter(limit, mode)
+	fh.metrics = newHttpMetrics()
+	fh.metrics.concurrency = fh.concurrency
+	return fh, store, fileUrl(testOrg, testRepo, "file")
+}
+
+// startRequests starts |n| GET requests of |url| in the background, and returns a channel of their status codes.
+func startRequests(fh *fileHandler, url string, n int) chan int {
+	codes := make(chan int, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			codes <- doRequest(fh, httptest.NewRequest(http.MethodGet, url, nil)).Code
+		}()
+	}
+
+	return codes
+}
+
+func TestParseConcurrencyMode(t *testing.T) {
+	mode, err := parseConcurrencyMode("queue")
+	require.NoError(t, err)
+	assert.Equal(t, queueExcess, mode)
+
+	mode, err = parseConcurrencyMode("reject")
+	require.NoError(t, err)
+	assert.Equal(t, rejectExcess, mode)
+
+	_, err = parseConcurrencyMode("drop")
+	assert.Error(t, err)
+}
+
+func TestConcurrencyLimitRejects(t *testing.T) {
+	fh, store, url := newConcurrencyTestHandler(t, 2, rejectExcess)
+
+	codes := startRequests(fh, url, 2)
+	<-store.started
+	<-store.started
+	assert.Equal(t, 2, fh.concurrency.inUse())
+	assert.Contains(t, scrapeMetrics(t, fh.metrics), "remotesrv_http_requests_active 2")
+
+	rec := doRequest(fh, httptest.NewRequest(http.MethodGet, url, nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get("Retry-After"))
+
+	close(store.release)
+	assert.Equal(t, http.StatusOK, <-codes)
+	assert.Equal(t, http.StatusOK, <-codes)
+	assert.Equal(t, 0, fh.concurrency.inUse())
+
+	rec = doRequest(fh, httptest.NewRequest(http.MethodGet, url, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestConcurrencyLimitQueues(t *testing.T) {
+	fh, store, url := newConcurrencyTestHandler(t, 1, queueExcess)
+
+	first := startRequests(fh, url, 1)
+	<-store.started
+
+	queued := startRequests(fh, url, 2)
+	require.Eventually(t, func() bool {
+		return fh.concurrency.queuedRequests() == 2
+	}, 5*time.Second, time.Millisecond)
+
+	scraped := scrapeMetrics(t, fh.metrics)
+	assert.Contains(t, scraped, "remotesrv_http_concurrency_limit 1")
+	assert.Contains(t, scraped, "remotesrv_http_requests_active 1")
+	assert.Contains(t, scraped, "remotesrv_http_requests_queued 2")
+
+	// a queued request whose client goes away gives up its place in the queue
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := make(chan int)
+	go func() {
+		cancelled <- doRequest(fh, httptest.NewRequest(http.MethodGet, url, nil).WithContext(ctx)).Code
+	}()
+
+	require.Eventually(t, func() bool {
+		return fh.concurrency.queuedRequests() == 3
+	}, 5*time.Second, time.Millisecond)
+	cancel()
+	assert.Equal(t, http.StatusServiceUnavailable, <-cancelled)
+
+	close(store.release)
+	assert.Equal(t, http.StatusOK, <-first)
+	assert.Equal(t, http.StatusOK, <-queued)
+	assert.Equal(t, http.StatusOK, <-queued)
+	assert.Zero(t, fh.concurrency.queuedRequests())
+	assert.Zero(t, fh.concurrency.inUse())
+}
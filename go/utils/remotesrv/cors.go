@@ -0,0 +1,142 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// corsPolicy decides which cross-origin requests browsers may make to the http file server. Preflight requests are
+// answered directly, and responses to permitted cross-origin requests carry an Access-Control-Allow-Origin header
+// echoing the request's origin.
+type corsPolicy struct {
+	origins   map[string]struct{}
+	anyOrigin bool
+	methods   []string
+	headers   []string
+	maxAge    time.Duration
+}
+
+// corsExposedHeaders are the response headers which scripts are allowed to read from cross-origin responses.
+var corsExposedHeaders = []string{"Accept-Ranges", "Content-Length", "Content-Range", "ETag"}
+
+// newCORSPolicy creates a corsPolicy allowing requests from |origins|, where "*" allows any origin, using any of
+// |methods| and sending any of |headers|. Preflight responses may be cached by browsers for |maxAge|.
+func newCORSPolicy(origins, methods, headers []string, maxAge time.Duration) *corsPolicy {
+	cp := &corsPolicy{origins: make(map[string]struct{}), maxAge: maxAge}
+
+	for _, origin := range origins {
+		if origin == "*" {
+			cp.anyOrigin = true
+		} else {
+			cp.origins[origin] = struct{}{}
+		}
+	}
+
+	for _, method := range methods {
+		cp.methods = append(cp.methods, strings.ToUpper(method))
+	}
+
+	for _, header := range headers {
+		cp.headers = append(cp.headers, http.CanonicalHeaderKey(header))
+	}
+
+	return cp
+}
+
+func (cp *corsPolicy) originAllowed(origin string) bool {
+	_, ok := cp.origins[origin]
+	return ok || cp.anyOrigin
+}
+
+func (cp *corsPolicy) methodAllowed(method string) bool {
+	for _, allowed := range cp.methods {
+		if allowed == method {
+			return true
+		}
+	}
+
+	return false
+}
+
+// headersAllowed returns true if every header in the comma separated list |headers| is allowed.
+func (cp *corsPolicy) headersAllowed(headers string) bool {
+	for _, header := range strings.Split(headers, ",") {
+		header = http.CanonicalHeaderKey(strings.TrimSpace(header))
+
+		if header == "" {
+			continue
+		}
+
+		allowed := false
+		for _, h := range cp.headers {
+			if h == header {
+				allowed = true
+				break
+			}
+		}
+
+		if !allowed {
+			return false
+		}
+	}
+
+	return true
+}
+
+// apply adds the CORS headers for |req| to the response. If |req| is a preflight request it returns the status to
+// respond with and true, and the request needs no further handling.
+func (cp *corsPolicy) apply(respWr http.ResponseWriter, req *http.Request) (int, bool) {
+	origin := req.Header.Get("Origin")
+
+	if origin == "" {
+		return 0, false
+	}
+
+	respWr.Header().Add("Vary", "Origin")
+	reqMethod := req.Header.Get("Access-Control-Request-Method")
+
+	if req.Method != http.MethodOptions || reqMethod == "" {
+		if cp.originAllowed(origin) && cp.methodAllowed(req.Method) {
+			respWr.Header().Set("Access-Control-Allow-Origin", origin)
+			respWr.Header().Set("Access-Control-Expose-Headers", strings.Join(corsExposedHeaders, ", "))
+		}
+
+		return 0, false
+	}
+
+	respWr.Header().Add("Vary", "Access-Control-Request-Method")
+	respWr.Header().Add("Vary", "Access-Control-Request-Headers")
+
+	if !cp.originAllowed(origin) || !cp.methodAllowed(reqMethod) || !cp.headersAllowed(req.Header.Get("Access-Control-Request-Headers")) {
+		return http.StatusForbidden, true
+	}
+
+	respWr.Header().Set("Access-Control-Allow-Origin", origin)
+	respWr.Header().Set("Access-Control-Allow-Methods", strings.Join(cp.methods, ", "))
+
+	if len(cp.headers) > 0 {
+		respWr.Header().Set("Access-Control-Allow-Headers", strings.Join(cp.headers, ", "))
+	}
+
+	if cp.maxAge > 0 {
+		respWr.Header().Set("Access-Control-Max-Age", strconv.FormatInt(int64(cp.maxAge/time.Second), 10))
+	}
+
+	return http.StatusNoContent, true
+}
@@ -0,0 +1,130 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testOrigin = "https://ui.example.com"
+
+func newCORSTestHandler(t *testing.T) *fileHandler {
+	fh := newTestHandler(t)
+	fh.cors = newCORSPolicy([]string{testOrigin}, []string{"get", "HEAD"}, []string{"range", "Authorization"}, 5*time.Minute)
+	return fh
+}
+
+func preflightRequest(fileId, origin, method, headers string) *http.Request {
+	req := httptest.NewRequest(http.MethodOptions, fileUrl(testOrg, testRepo, fileId), nil)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", method)
+
+	if headers != "" {
+		req.Header.Set("Access-Control-Request-Headers", headers)
+	}
+
+	return req
+}
+
+func TestCORSPreflight(t *testing.T) {
+	fh := newCORSTestHandler(t)
+	fileId := writeTestFile(t, fh, []byte("0123456789"))
+
+	rec := doRequest(fh, preflightRequest(fileId, testOrigin, http.MethodGet, "range, authorization"))
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, testOrigin, rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, HEAD", rec.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Range, Authorization", rec.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "300", rec.Header().Get("Access-Control-Max-Age"))
+	assert.Contains(t, rec.Header().Values("Vary"), "Origin")
+	assert.Empty(t, rec.Body.Bytes())
+
+	tests := []struct {
+		name    string
+		origin  string
+		method  string
+		headers string
+	}{
+		{"unknown origin", "https://evil.example.com", http.MethodGet, ""},
+		{"method not allowed", testOrigin, http.MethodDelete, ""},
+		{"header not allowed", testOrigin, http.MethodGet, "Range, X-Custom"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := doRequest(fh, preflightRequest(fileId, test.origin, test.method, test.headers))
+			assert.Equal(t, http.StatusForbidden, rec.Code)
+			assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+		})
+	}
+}
+
+func TestCORSRequests(t *testing.T) {
+	fh := newCORSTestHandler(t)
+	fileId := writeTestFile(t, fh, []byte("0123456789"))
+
+	req := httptest.NewRequest(http.MethodGet, fileUrl(testOrg, testRepo, fileId), nil)
+	req.Header.Set("Origin", testOrigin)
+	rec := doRequest(fh, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "0123456789", rec.Body.String())
+	assert.Equal(t, testOrigin, rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, rec.Header().Get("Access-Control-Expose-Headers"), "Content-Range")
+	assert.Contains(t, rec.Header().Values("Vary"), "Origin")
+
+	req = httptest.NewRequest(http.MethodGet, fileUrl(testOrg, testRepo, fileId), nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	rec = doRequest(fh, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+
+	// same origin requests don't send an Origin header and get no cors headers
+	rec = doRequest(fh, httptest.NewRequest(http.MethodGet, fileUrl(testOrg, testRepo, fileId), nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, rec.Header().Values("Vary"))
+}
+
+func TestCORSAnyOrigin(t *testing.T) {
+	fh := newTestHandler(t)
+	fh.cors = newCORSPolicy([]string{"*"}, []string{http.MethodGet}, nil, 0)
+	fileId := writeTestFile(t, fh, []byte("0123456789"))
+
+	rec := doRequest(fh, preflightRequest(fileId, "https://anywhere.example.com", http.MethodGet, ""))
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "https://anywhere.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Empty(t, rec.Header().Get("Access-Control-Max-Age"))
+}
+
+func TestCORSDisabledByDefault(t *testing.T) {
+	fh := newTestHandler(t)
+	fileId := writeTestFile(t, fh, []byte("0123456789"))
+
+	rec := doRequest(fh, preflightRequest(fileId, testOrigin, http.MethodGet, ""))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+
+	req := httptest.NewRequest(http.MethodGet, fileUrl(testOrg, testRepo, fileId), nil)
+	req.Header.Set("Origin", testOrigin)
+	rec = doRequest(fh, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+}
@@ -0,0 +1,145 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// etagComparison is one of the two ways of comparing entity tags defined by RFC 7232 section 2.3.2.
+type etagComparison int
+
+const (
+	// strongComparison matches entity tags which are both strong and have identical opaque tags. It is used for
+	// If-Range.
+	strongComparison etagComparison = iota
+
+	// weakComparison matches entity tags which have identical opaque tags, whether or not either of them is weak. It is
+	// used for If-None-Match.
+	weakComparison
+)
+
+// entityTag is a parsed entity tag.
+type entityTag struct {
+	// opaque is the quoted opaque tag
+	opaque string
+	weak   bool
+}
+
+// matches returns true if |et| matches |other| using the comparison |cmp|.
+func (et entityTag) matches(other entityTag, cmp etagComparison) bool {
+	if cmp == strongComparison && (et.weak || other.weak) {
+		return false
+	}
+
+	return et.opaque == other.opaque
+}
+
+// parseEntityTag parses the entity tag at the start of |s|, returning it along with the rest of |s|. ok is false if |s|
+// does not start with a valid entity tag.
+func parseEntityTag(s string) (et entityTag, rest string, ok bool) {
+	if strings.HasPrefix(s, "W/") {
+		et.weak = true
+		s = s[2:]
+	}
+
+	if len(s) < 2 || s[0] != '"' {
+		return entityTag{}, "", false
+	}
+
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			et.opaque = s[:i+1]
+			return et, s[i+1:], true
+		case c != 0x21 && (c < 0x23 || c == 0x7f):
+			// not an etagc. the opaque tag may only contain visible characters other than a quote
+			return entityTag{}, "", false
+		}
+	}
+
+	return entityTag{}, "", false
+}
+
+// etagListMatches returns true if the value of an If-None-Match or If-Match header, which is either `*` or a comma
+// separated list of entity tags, matches |et| using the comparison |cmp|. Parsing stops at the first malformed entity
+// tag, which along with anything after it never matches.
+func etagListMatches(list string, et entityTag, cmp etagComparison) bool {
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+
+	for {
+		list = strings.TrimLeft(list, ", \t")
+
+		if list == "" {
+			return false
+		}
+
+		candidate, rest, ok := parseEntityTag(list)
+
+		if !ok {
+			return false
+		}
+
+		if candidate.matches(et, cmp) {
+			return true
+		}
+
+		list = strings.TrimLeft(rest, " \t")
+
+		if list != "" && list[0] != ',' {
+			return false
+		}
+	}
+}
+
+// etagFor returns the ETag of a table file. Table files are content addressed, so the file id is a strong validator.
+func etagFor(fileId string) string {
+	return `"` + fileId + `"`
+}
+
+// entityTagFor returns the parsed ETag of a table file.
+func entityTagFor(fileId string) entityTag {
+	return entityTag{opaque: etagFor(fileId)}
+}
+
+// etagMatches returns true if the value of an If-None-Match header matches the ETag of |fileId|. As with any
+// If-None-Match, weak comparison is used, so weak validators of the same file match.
+func etagMatches(ifNoneMatch, fileId string) bool {
+	return etagListMatches(ifNoneMatch, entityTagFor(fileId), weakComparison)
+}
+
+// ifRangeMatches returns true if a range request with the If-Range header value |ifRange| should be served as a partial
+// response. A missing header always matches. Otherwise the validator must be an entity tag which strongly matches the
+// ETag of |fileId|, or a date equal to its Last-Modified time |modTime|. Weak entity tags never match, so the client
+// gets the full file.
+func ifRangeMatches(ifRange, fileId string, modTime time.Time) bool {
+	if ifRange == "" {
+		return true
+	}
+
+	ifRange = strings.TrimSpace(ifRange)
+
+	if et, rest, ok := parseEntityTag(ifRange); ok && rest == "" {
+		return et.matches(entityTagFor(fileId), strongComparison)
+	}
+
+	date, err := http.ParseTime(ifRange)
+
+	return err == nil && !modTime.IsZero() && modTime.Truncate(time.Second).Equal(date)
+}
@@ -0,0 +1,123 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseEntityTag(t *testing.T) {
+	tests := []struct {
+		in       string
+		expected entityTag
+		rest     string
+		ok       bool
+	}{
+		{`"abc"`, entityTag{`"abc"`, false}, "", true},
+		{`W/"abc"`, entityTag{`"abc"`, true}, "", true},
+		{`""`, entityTag{`""`, false}, "", true},
+		{`"a,b", "c"`, entityTag{`"a,b"`, false}, `, "c"`, true},
+		{`abc`, entityTag{}, "", false},
+		{`"abc`, entityTag{}, "", false},
+		{`w/"abc"`, entityTag{}, "", false},
+		{`"a b"`, entityTag{}, "", false},
+		{`W/`, entityTag{}, "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.in, func(t *testing.T) {
+			et, rest, ok := parseEntityTag(test.in)
+			assert.Equal(t, test.ok, ok)
+			assert.Equal(t, test.expected, et)
+			assert.Equal(t, test.rest, rest)
+		})
+	}
+}
+
+func TestETagListMatches(t *testing.T) {
+	strong := entityTag{opaque: `"abc"`}
+	weak := entityTag{opaque: `"abc"`, weak: true}
+
+	tests := []struct {
+		name     string
+		list     string
+		et       entityTag
+		cmp      etagComparison
+		expected bool
+	}{
+		{"wildcard", "*", strong, weakComparison, true},
+		{"wildcard strong", " * ", strong, strongComparison, true},
+		{"empty", "", strong, weakComparison, false},
+		{"same", `"abc"`, strong, weakComparison, true},
+		{"same strong", `"abc"`, strong, strongComparison, true},
+		{"different", `"abd"`, strong, weakComparison, false},
+		{"unquoted", `abc`, strong, weakComparison, false},
+		{"weak validator", `W/"abc"`, strong, weakComparison, true},
+		{"weak validator strong", `W/"abc"`, strong, strongComparison, false},
+		{"weak etag", `"abc"`, weak, weakComparison, true},
+		{"weak etag strong", `"abc"`, weak, strongComparison, false},
+		{"both weak", `W/"abc"`, weak, weakComparison, true},
+		{"both weak strong", `W/"abc"`, weak, strongComparison, false},
+		{"list", `"xyz", "abc"`, strong, weakComparison, true},
+		{"list without spaces", `"xyz","abc"`, strong, weakComparison, true},
+		{"list with empty elements", `, "xyz",, "abc" ,`, strong, weakComparison, true},
+		{"list without match", `"xyz", W/"uvw"`, strong, weakComparison, false},
+		{"list with weak match", `"xyz", W/"abc"`, strong, weakComparison, true},
+		{"list with weak match strong", `"xyz", W/"abc"`, strong, strongComparison, false},
+		{"list with strong and weak", `W/"abc", "abc"`, strong, strongComparison, true},
+		{"comma in tag", `"x,abc"`, strong, weakComparison, false},
+		{"wildcard in list", `"xyz", *`, strong, weakComparison, false},
+		{"malformed before match", `xyz, "abc"`, strong, weakComparison, false},
+		{"missing comma", `"xyz" "abc"`, strong, weakComparison, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, etagListMatches(test.list, test.et, test.cmp))
+		})
+	}
+}
+
+func TestIfRangeMatches(t *testing.T) {
+	fileId := "abc"
+	modTime := time.Date(2021, time.March, 4, 5, 6, 7, 500, time.UTC)
+
+	tests := []struct {
+		name     string
+		ifRange  string
+		expected bool
+	}{
+		{"missing", "", true},
+		{"matching etag", `"abc"`, true},
+		{"padded etag", ` "abc" `, true},
+		{"different etag", `"abd"`, false},
+		{"weak etag", `W/"abc"`, false},
+		{"list", `"xyz", "abc"`, false},
+		{"wildcard", "*", false},
+		{"matching date", modTime.Format(http.TimeFormat), true},
+		{"earlier date", modTime.Add(-time.Second).Format(http.TimeFormat), false},
+		{"garbage", "yesterday", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, ifRangeMatches(test.ifRange, fileId, modTime))
+		})
+	}
+}
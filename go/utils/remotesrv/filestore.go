@@ -0,0 +1,536 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/dolthub/dolt/go/libraries/utils/file"
+	"github.com/dolthub/dolt/go/store/hash"
+)
+
+// errUnsafePath is returned when a requested path would resolve to a location outside of the storage root.
+var errUnsafePath = errors.New("path is outside of the storage root")
+
+// fileStore stores table files on the local filesystem in an org/repo/fileId layout beneath a root directory.
+type fileStore struct {
+	root string
+
+	// shardDepth is the number of directories files are nested in beneath their repo's directory, each named by the
+	// next two characters of the file id, so that no directory holds too many files. With a shardDepth of 2 files are
+	// stored at org/repo/ab/cd/abcd... It is 0 by default, which stores files directly in their repo's directory.
+	shardDepth int
+
+	// fileMode is the permissions of stored files, and dirMode the permissions of the directories created to hold them.
+	fileMode os.FileMode
+	dirMode  os.FileMode
+
+	// syncer, when set, is called to flush each stored file to disk, and then the directory it is renamed into, before
+	// a Put returns, so that a successful upload survives a power loss. It is nil by default, which leaves flushing to
+	// the operating system.
+	syncer func(f *os.File) error
+
+	// tmpFiles holds the paths of the temp files of Puts which are in progress.
+	tmpFiles *tempFileSet
+}
+
+var _ BlobStore = (*fileStore)(nil)
+var _ checksummer = (*fileStore)(nil)
+
+// defaultFileMode and defaultDirMode allow other local users to read stored files, but not to modify them.
+const (
+	defaultFileMode os.FileMode = 0644
+	defaultDirMode  os.FileMode = 0755
+)
+
+// newFileStore creates a fileStore rooted at |root|, which must be an existing directory.
+func newFileStore(root string) (*fileStore, error) {
+	abs, err := filepath.Abs(root)
+
+	if err != nil {
+		return nil, err
+	}
+
+	resolved, err := filepath.EvalSymlinks(abs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileStore{root: resolved, fileMode: defaultFileMode, dirMode: defaultDirMode, tmpFiles: newTempFileSet()}, nil
+}
+
+// path returns the path of the file identified by |org|, |repo| and |fileId| within the storage root. errUnsafePath
+// is returned if the path, after resolving any symlinks, is not contained within the storage root.
+func (fs *fileStore) path(org, repo, fileId string) (string, error) {
+	elems := append([]string{fs.root, org, repo}, shardDirs(fileId, fs.shardDepth)...)
+	path := filepath.Join(append(elems, fileId)...)
+	resolved, err := resolveSymlinks(path)
+
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(fs.root, resolved)
+
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errUnsafePath
+	}
+
+	return path, nil
+}
+
+// maxShardDepth is the largest supported shardDepth of a fileStore.
+const maxShardDepth = 4
+
+// shardDirs returns the names of the |depth| directories the file |fileId| is nested in, each of which is the next two
+// characters of the file id. File ids too short to fill every directory are nested in fewer.
+func shardDirs(fileId string, depth int) []string {
+	dirs := make([]string, 0, depth)
+	for i := 0; i < depth && 2*i+2 < len(fileId); i++ {
+		dirs = append(dirs, fileId[2*i:2*i+2])
+	}
+
+	return dirs
+}
+
+// resolveSymlinks evaluates the symlinks in the longest existing prefix of |path| so that the paths of files which
+// have not been written yet can still be checked.
+func resolveSymlinks(path string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+
+	if err == nil {
+		return resolved, nil
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	if _, err := os.Lstat(path); err == nil {
+		// the path exists but can't be resolved, so it is a dangling symlink
+		return "", errUnsafePath
+	}
+
+	parent := filepath.Dir(path)
+
+	if parent == path {
+		return path, nil
+	}
+
+	resolvedParent, err := resolveSymlinks(parent)
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(resolvedParent, filepath.Base(path)), nil
+}
+
+// Get implements BlobStore.
+func (fs *fileStore) Get(ctx context.Context, org, repo, fileId string) (io.ReadCloser, int64, error) {
+	f, info, err := fs.open(org, repo, fileId)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return f, info.Size(), nil
+}
+
+// GetRange implements BlobStore.
+func (fs *fileStore) GetRange(ctx context.Context, org, repo, fileId string, offset, length int64) (io.ReadCloser, error) {
+	f, info, err := fs.open(org, repo, fileId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if offset < 0 || length < 0 || offset+length > info.Size() {
+		f.Close()
+		return nil, errInvalidBlobRange
+	}
+
+	return &sectionReadCloser{io.NewSectionReader(f, offset, length), f}, nil
+}
+
+// sectionReadCloser reads a section of a file and closes the file when it is closed.
+type sectionReadCloser struct {
+	*io.SectionReader
+	io.Closer
+}
+
+func (fs *fileStore) open(org, repo, fileId string) (*os.File, os.FileInfo, error) {
+	path, err := fs.path(org, repo, fileId)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := os.Open(path)
+
+	if os.IsNotExist(err) {
+		return nil, nil, errBlobNotFound
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	info, err := f.Stat()
+
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+
+	return f, info, nil
+}
+
+// Put implements BlobStore. The contents are streamed to a temporary file in the destination directory which is then
+// renamed into place, so readers never observe a partially written file. The temporary file is removed if anything
+// fails before the rename.
+func (fs *fileStore) Put(ctx context.Context, org, repo, fileId string, rd io.Reader, validate func(io.ReadSeeker) error) error {
+	path, err := fs.path(org, repo, fileId)
+
+	if err != nil {
+		return err
+	}
+
+	// the first file stored for a repo, or in a shard, creates its directory
+	err = os.MkdirAll(filepath.Dir(path), fs.dirMode)
+
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), fileId+"-*.tmp")
+
+	if err != nil {
+		return err
+	}
+
+	tmpPath := f.Name()
+	fs.tmpFiles.track(tmpPath)
+	renamed := false
+	defer func() {
+		if renamed {
+			fs.tmpFiles.untrack(tmpPath)
+		} else {
+			_ = fs.tmpFiles.remove(tmpPath)
+		}
+	}()
+
+	digest := md5.New()
+	_, err = io.Copy(io.MultiWriter(f, digest), rd)
+
+	if err == nil {
+		// temp files are created readable only by their owner
+		err = f.Chmod(fs.fileMode)
+	}
+
+	if err == nil && validate != nil {
+		_, err = f.Seek(0, io.SeekStart)
+
+		if err == nil {
+			err = validate(f)
+		}
+	}
+
+	if err == nil && fs.syncer != nil {
+		err = fs.syncer(f)
+	}
+
+	closeErr := f.Close()
+
+	if err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		// the checksum is recorded first, so a stored file never lacks one
+		err = fs.writeChecksum(path, digest.Sum(nil))
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = file.Rename(tmpPath, path)
+
+	if err != nil {
+		return err
+	}
+
+	renamed = true
+
+	if fs.syncer != nil {
+		// the rename is only durable once the directory holding the file is flushed as well
+		return fs.syncDir(filepath.Dir(path))
+	}
+
+	return nil
+}
+
+// syncDir flushes the directory |dir| to disk with the fileStore's syncer. Directories can't be flushed on windows,
+// where renames are durable once the file has been flushed.
+func (fs *fileStore) syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	d, err := os.Open(dir)
+
+	if err != nil {
+		return err
+	}
+
+	err = fs.syncer(d)
+	closeErr := d.Close()
+
+	if err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// checksumExt is the extension of the sidecar file which records the md5 of a stored file, and is stored alongside it.
+const checksumExt = ".md5"
+
+// writeChecksum records |sum| as the md5 of the file at |path| in its sidecar file, which is written in the same way
+// as the file itself.
+func (fs *fileStore) writeChecksum(path string, sum []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+checksumExt+"-*.tmp")
+
+	if err != nil {
+		return err
+	}
+
+	tmpPath := f.Name()
+	fs.tmpFiles.track(tmpPath)
+	renamed := false
+	defer func() {
+		if renamed {
+			fs.tmpFiles.untrack(tmpPath)
+		} else {
+			_ = fs.tmpFiles.remove(tmpPath)
+		}
+	}()
+
+	_, err = f.WriteString(hex.EncodeToString(sum) + "\n")
+
+	if err == nil {
+		err = f.Chmod(fs.fileMode)
+	}
+
+	if err == nil && fs.syncer != nil {
+		err = fs.syncer(f)
+	}
+
+	closeErr := f.Close()
+
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = file.Rename(tmpPath, path+checksumExt)
+
+	if err != nil {
+		return err
+	}
+
+	renamed = true
+	return nil
+}
+
+// Checksum implements checksummer. The md5 is read from the sidecar file written alongside the file when it was
+// stored, so the file itself isn't read. Files stored before sidecar files were written have no checksum.
+func (fs *fileStore) Checksum(ctx context.Context, org, repo, fileId string) ([]byte, error) {
+	path, err := fs.path(org, repo, fileId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path + checksumExt)
+
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	sum, err := hex.DecodeString(strings.TrimSpace(string(data)))
+
+	if err != nil || len(sum) != md5.Size {
+		return nil, fmt.Errorf("checksum file of %s/%s/%s is corrupt", org, repo, fileId)
+	}
+
+	return sum, nil
+}
+
+// Stat implements BlobStore.
+func (fs *fileStore) Stat(ctx context.Context, org, repo, fileId string) (BlobInfo, error) {
+	path, err := fs.path(org, repo, fileId)
+
+	if err != nil {
+		return BlobInfo{}, err
+	}
+
+	info, err := os.Stat(path)
+
+	if os.IsNotExist(err) {
+		return BlobInfo{}, errBlobNotFound
+	} else if err != nil {
+		return BlobInfo{}, err
+	}
+
+	return BlobInfo{Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// Delete implements BlobStore.
+func (fs *fileStore) Delete(ctx context.Context, org, repo, fileId string) error {
+	path, err := fs.path(org, repo, fileId)
+
+	if err != nil {
+		return err
+	}
+
+	err = file.Remove(path)
+
+	if os.IsNotExist(err) {
+		return errBlobNotFound
+	} else if err != nil {
+		return err
+	}
+
+	// files stored before sidecar files were written don't have one
+	err = file.Remove(path + checksumExt)
+
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+// List implements BlobStore. Only files named by a valid hash are listed, which leaves out temp files along with the
+// manifest and other files the grpc chunk store keeps alongside the table files.
+func (fs *fileStore) List(ctx context.Context, org, repo, after string, limit int) ([]BlobListing, error) {
+	// the path of an empty file id is the repo's directory
+	dir, err := fs.path(org, repo, "")
+
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err = filepath.EvalSymlinks(dir)
+
+	if os.IsNotExist(err) {
+		return []BlobListing{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	listing := make([]BlobListing, 0)
+	err = filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			rel, err := filepath.Rel(dir, path)
+
+			if err != nil {
+				return err
+			}
+
+			if rel != "." && strings.Count(rel, string(filepath.Separator)) >= fs.shardDepth {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if _, ok := hash.MaybeParse(d.Name()); !ok || !d.Type().IsRegular() || d.Name() <= after {
+			return nil
+		}
+
+		info, err := d.Info()
+
+		if os.IsNotExist(err) {
+			// deleted since the directory was read
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		listing = append(listing, BlobListing{FileId: d.Name(), Size: info.Size()})
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(listing, func(i, j int) bool {
+		return listing[i].FileId < listing[j].FileId
+	})
+
+	if len(listing) > limit {
+		listing = listing[:limit]
+	}
+
+	return listing, nil
+}
+
+// removeTempFiles deletes the temp files of any Puts which are still in progress. Those Puts will fail.
+func (fs *fileStore) removeTempFiles() error {
+	return fs.tmpFiles.removeTempFiles()
+}
+
+// checkReady checks that files can be written to the storage root.
+func (fs *fileStore) checkReady(ctx context.Context) error {
+	f, err := os.CreateTemp(fs.root, ".readyz-*.tmp")
+
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write([]byte("ready"))
+	closeErr := f.Close()
+	rmErr := os.Remove(f.Name())
+
+	if err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = rmErr
+	}
+
+	return err
+}
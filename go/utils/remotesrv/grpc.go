@@ -16,6 +16,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -36,22 +37,26 @@ import (
 
 type RemoteChunkStore struct {
 	HttpHost string
-	csCache  *DBCache
-	bucket   string
+	// HttpScheme is the scheme of the urls handed out for the http file server, either http or https.
+	HttpScheme string
+	csCache    *DBCache
+	bucket     string
 	remotesapi.UnimplementedChunkStoreServiceServer
 }
 
 func NewHttpFSBackedChunkStore(httpHost string, csCache *DBCache) *RemoteChunkStore {
 	return &RemoteChunkStore{
-		HttpHost: httpHost,
-		csCache:  csCache,
-		bucket:   "",
+		HttpHost:   httpHost,
+		HttpScheme: "http",
+		csCache:    csCache,
+		bucket:     "",
 	}
 }
 
 func (rs *RemoteChunkStore) HasChunks(ctx context.Context, req *remotesapi.HasChunksRequest) (*remotesapi.HasChunksResponse, error) {
-	logger := getReqLogger("GRPC", "HasChunks")
-	defer func() { logger("finished") }()
+	rl := getReqLogger("GRPC", "HasChunks")
+	logger := rl.log
+	defer rl.finish("finished", infoLevel, false)
 
 	cs := rs.getStore(req.RepoId, "HasChunks")
 
@@ -87,8 +92,9 @@ func (rs *RemoteChunkStore) HasChunks(ctx context.Context, req *remotesapi.HasCh
 }
 
 func (rs *RemoteChunkStore) GetDownloadLocations(ctx context.Context, req *remotesapi.GetDownloadLocsRequest) (*remotesapi.GetDownloadLocsResponse, error) {
-	logger := getReqLogger("GRPC", "GetDownloadLocations")
-	defer func() { logger("finished") }()
+	rl := getReqLogger("GRPC", "GetDownloadLocations")
+	logger := rl.log
+	defer rl.finish("finished", infoLevel, false)
 
 	cs := rs.getStore(req.RepoId, "GetDownloadLoctions")
 
@@ -131,8 +137,9 @@ func (rs *RemoteChunkStore) GetDownloadLocations(ctx context.Context, req *remot
 }
 
 func (rs *RemoteChunkStore) StreamDownloadLocations(stream remotesapi.ChunkStoreService_StreamDownloadLocationsServer) error {
-	logger := getReqLogger("GRPC", "StreamDownloadLocations")
-	defer func() { logger("finished") }()
+	rl := getReqLogger("GRPC", "StreamDownloadLocations")
+	logger := rl.log
+	defer rl.finish("finished", infoLevel, false)
 
 	var repoID *remotesapi.RepoId
 	var cs *nbs.NomsBlockStore
@@ -189,7 +196,7 @@ func (rs *RemoteChunkStore) StreamDownloadLocations(stream remotesapi.ChunkStore
 }
 
 func (rs *RemoteChunkStore) getDownloadUrl(logger func(string), org, repoName, fileId string) (string, error) {
-	return fmt.Sprintf("http://%s/%s/%s/%s", rs.HttpHost, org, repoName, fileId), nil
+	return fmt.Sprintf("%s://%s/%s/%s/%s", rs.HttpScheme, rs.HttpHost, org, repoName, fileId), nil
 }
 
 func parseTableFileDetails(req *remotesapi.GetUploadLocsRequest) []*remotesapi.TableFileDetails {
@@ -212,8 +219,9 @@ func parseTableFileDetails(req *remotesapi.GetUploadLocsRequest) []*remotesapi.T
 }
 
 func (rs *RemoteChunkStore) GetUploadLocations(ctx context.Context, req *remotesapi.GetUploadLocsRequest) (*remotesapi.GetUploadLocsResponse, error) {
-	logger := getReqLogger("GRPC", "GetUploadLocations")
-	defer func() { logger("finished") }()
+	rl := getReqLogger("GRPC", "GetUploadLocations")
+	logger := rl.log
+	defer rl.finish("finished", infoLevel, false)
 
 	cs := rs.getStore(req.RepoId, "GetWriteChunkUrls")
 
@@ -232,7 +240,11 @@ func (rs *RemoteChunkStore) GetUploadLocations(ctx context.Context, req *remotes
 		h := hash.New(tfd.Id)
 		url, err := rs.getUploadUrl(logger, org, repoName, tfd)
 
-		if err != nil {
+		if errors.Is(err, errInvalidUpload) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		} else if errors.Is(err, errConflictingUpload) {
+			return nil, status.Error(codes.AlreadyExists, err.Error())
+		} else if err != nil {
 			return nil, status.Error(codes.Internal, "Failed to get upload Url.")
 		}
 
@@ -247,13 +259,19 @@ func (rs *RemoteChunkStore) GetUploadLocations(ctx context.Context, req *remotes
 
 func (rs *RemoteChunkStore) getUploadUrl(logger func(string), org, repoName string, tfd *remotesapi.TableFileDetails) (string, error) {
 	fileID := hash.New(tfd.Id).String()
-	expectedFiles[fileID] = tfd
-	return fmt.Sprintf("http://%s/%s/%s/%s", rs.HttpHost, org, repoName, fileID), nil
+
+	if err := RegisterExpectedUpload(fileID, tfd); err != nil {
+		logger(fmt.Sprintf("failed to register upload of %s: %v", fileID, err))
+		return "", err
+	}
+
+	return fmt.Sprintf("%s://%s/%s/%s/%s", rs.HttpScheme, rs.HttpHost, org, repoName, fileID), nil
 }
 
 func (rs *RemoteChunkStore) Rebase(ctx context.Context, req *remotesapi.RebaseRequest) (*remotesapi.RebaseResponse, error) {
-	logger := getReqLogger("GRPC", "Rebase")
-	defer func() { logger("finished") }()
+	rl := getReqLogger("GRPC", "Rebase")
+	logger := rl.log
+	defer rl.finish("finished", infoLevel, false)
 
 	cs := rs.getStore(req.RepoId, "Rebase")
 
@@ -274,8 +292,9 @@ func (rs *RemoteChunkStore) Rebase(ctx context.Context, req *remotesapi.RebaseRe
 }
 
 func (rs *RemoteChunkStore) Root(ctx context.Context, req *remotesapi.RootRequest) (*remotesapi.RootResponse, error) {
-	logger := getReqLogger("GRPC", "Root")
-	defer func() { logger("finished") }()
+	rl := getReqLogger("GRPC", "Root")
+	logger := rl.log
+	defer rl.finish("finished", infoLevel, false)
 
 	cs := rs.getStore(req.RepoId, "Root")
 
@@ -294,8 +313,9 @@ func (rs *RemoteChunkStore) Root(ctx context.Context, req *remotesapi.RootReques
 }
 
 func (rs *RemoteChunkStore) Commit(ctx context.Context, req *remotesapi.CommitRequest) (*remotesapi.CommitResponse, error) {
-	logger := getReqLogger("GRPC", "Commit")
-	defer func() { logger("finished") }()
+	rl := getReqLogger("GRPC", "Commit")
+	logger := rl.log
+	defer rl.finish("finished", infoLevel, false)
 
 	cs := rs.getStore(req.RepoId, "Commit")
 
@@ -334,8 +354,8 @@ func (rs *RemoteChunkStore) Commit(ctx context.Context, req *remotesapi.CommitRe
 }
 
 func (rs *RemoteChunkStore) GetRepoMetadata(ctx context.Context, req *remotesapi.GetRepoMetadataRequest) (*remotesapi.GetRepoMetadataResponse, error) {
-	logger := getReqLogger("GRPC", "GetRepoMetadata")
-	defer func() { logger("finished") }()
+	rl := getReqLogger("GRPC", "GetRepoMetadata")
+	defer rl.finish("finished", infoLevel, false)
 
 	cs := rs.getOrCreateStore(req.RepoId, "GetRepoMetadata", req.ClientRepoFormat.NbfVersion)
 	if cs == nil {
@@ -368,8 +388,9 @@ func (rs *RemoteChunkStore) GetRepoMetadata(ctx context.Context, req *remotesapi
 }
 
 func (rs *RemoteChunkStore) ListTableFiles(ctx context.Context, req *remotesapi.ListTableFilesRequest) (*remotesapi.ListTableFilesResponse, error) {
-	logger := getReqLogger("GRPC", "ListTableFiles")
-	defer func() { logger("finished") }()
+	rl := getReqLogger("GRPC", "ListTableFiles")
+	logger := rl.log
+	defer rl.finish("finished", infoLevel, false)
 
 	cs := rs.getStore(req.RepoId, "ListTableFiles")
 
@@ -423,8 +444,9 @@ func getTableFileInfo(rs *RemoteChunkStore, logger func(string), tableList []nbs
 
 // AddTableFiles updates the remote manifest with new table files without modifying the root hash.
 func (rs *RemoteChunkStore) AddTableFiles(ctx context.Context, req *remotesapi.AddTableFilesRequest) (*remotesapi.AddTableFilesResponse, error) {
-	logger := getReqLogger("GRPC", "Commit")
-	defer func() { logger("finished") }()
+	rl := getReqLogger("GRPC", "Commit")
+	logger := rl.log
+	defer rl.finish("finished", infoLevel, false)
 
 	cs := rs.getStore(req.RepoId, "Commit")
 
@@ -473,11 +495,16 @@ func incReqId() int32 {
 	return atomic.AddInt32(&requestId, 1)
 }
 
-func getReqLogger(method, callName string) func(string) {
+// getReqLogger returns a requestLogger which writes text log lines identified by a new call id for a request of
+// |callName|.
+func getReqLogger(method, callName string) *requestLogger {
 	callId := fmt.Sprintf("%s(%05d)", method, incReqId())
-	log.Println(callId, "new request for:", callName)
 
-	return func(msg string) {
-		log.Println(callId, "-", msg)
+	if logVerbosity >= debugLevel {
+		log.Println(callId, "new request for:", callName)
 	}
+
+	return &requestLogger{write: func(msg string) {
+		log.Println(callId, "-", msg)
+	}}
 }
@@ -0,0 +1,78 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// acceptsGzip returns true if the Accept-Encoding header value |acceptEnc| allows a gzip encoded response.
+func acceptsGzip(acceptEnc string) bool {
+	for _, enc := range strings.Split(acceptEnc, ",") {
+		params := strings.Split(enc, ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+
+		if coding != "gzip" && coding != "*" {
+			continue
+		}
+
+		allowed := true
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(param[2:], 64)
+				allowed = err == nil && q > 0
+			}
+		}
+
+		return allowed
+	}
+
+	return false
+}
+
+// gzipResponseWriter compresses everything written to it. The Content-Encoding header is only set, and the gzip stream
+// only started, on the first call to Write so that error responses which have no body are sent unencoded.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	gz *gzip.Writer
+}
+
+func newGzipResponseWriter(wr http.ResponseWriter) *gzipResponseWriter {
+	wr.Header().Add("Vary", "Accept-Encoding")
+	return &gzipResponseWriter{ResponseWriter: wr}
+}
+
+func (gw *gzipResponseWriter) Write(p []byte) (int, error) {
+	if gw.gz == nil {
+		gw.Header().Set("Content-Encoding", "gzip")
+		gw.Header().Del("Content-Length")
+		gw.gz = gzip.NewWriter(gw.ResponseWriter)
+	}
+
+	return gw.gz.Write(p)
+}
+
+// Close flushes any buffered data and writes the gzip footer if anything was written.
+func (gw *gzipResponseWriter) Close() error {
+	if gw.gz == nil {
+		return nil
+	}
+
+	return gw.gz.Close()
+}
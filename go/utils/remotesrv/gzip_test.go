@@ -0,0 +1,97 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := []struct {
+		acceptEnc string
+		expected  bool
+	}{
+		{"", false},
+		{"gzip", true},
+		{"GZIP", true},
+		{"deflate, gzip", true},
+		{"deflate, gzip;q=0.5", true},
+		{"gzip;q=0", false},
+		{"gzip; q=0.0", false},
+		{"*", true},
+		{"identity", false},
+		{"deflate, br", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.acceptEnc, func(t *testing.T) {
+			assert.Equal(t, test.expected, acceptsGzip(test.acceptEnc))
+		})
+	}
+}
+
+func TestGzipResponse(t *testing.T) {
+	fh := newTestHandler(t)
+	data := bytes.Repeat([]byte("highly compressible table file data "), 1024)
+	fileId := writeTestFile(t, fh, data)
+
+	req := httptest.NewRequest(http.MethodGet, fileUrl(testOrg, testRepo, fileId), nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp := doRequest(fh, req)
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "gzip", resp.Header().Get("Content-Encoding"))
+	assert.Less(t, resp.Body.Len(), len(data))
+
+	gzRd, err := gzip.NewReader(resp.Body)
+	require.NoError(t, err)
+	decompressed, err := io.ReadAll(gzRd)
+	require.NoError(t, err)
+	assert.Equal(t, data, decompressed)
+
+	resp = doRequest(fh, httptest.NewRequest(http.MethodGet, fileUrl(testOrg, testRepo, fileId), nil))
+	require.Equal(t, http.StatusOK, resp.Code)
+	assert.Empty(t, resp.Header().Get("Content-Encoding"))
+	assert.Equal(t, data, resp.Body.Bytes())
+}
+
+func TestGzipSkippedForRanges(t *testing.T) {
+	fh := newTestHandler(t)
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	fileId := writeTestFile(t, fh, data)
+
+	req := rangeRequest(fileId, "bytes=10-19")
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp := doRequest(fh, req)
+	require.Equal(t, http.StatusPartialContent, resp.Code)
+	assert.Empty(t, resp.Header().Get("Content-Encoding"))
+	assert.Equal(t, data[10:20], resp.Body.Bytes())
+}
+
+func TestGzipNotUsedForMissingFile(t *testing.T) {
+	fh := newTestHandler(t)
+	req := httptest.NewRequest(http.MethodGet, fileUrl(testOrg, testRepo, expectUpload(t, []byte("never uploaded"))), nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp := doRequest(fh, req)
+	require.Equal(t, http.StatusNotFound, resp.Code)
+	assert.Empty(t, resp.Header().Get("Content-Encoding"))
+}
@@ -0,0 +1,84 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+)
+
+// readinessChecker is implemented by BlobStores which can check that they are able to serve requests.
+type readinessChecker interface {
+	checkReady(ctx context.Context) error
+}
+
+// readinessTimeout bounds how long a readiness check may take, so that a hung backend fails the check rather than
+// the probe.
+const readinessTimeout = 5 * time.Second
+
+// healthHandler serves the liveness and readiness checks used by load balancers and orchestrators. GET /healthz
+// responds with a 200 whenever the server is running. GET /readyz responds with a 200 when the BlobStore is able to
+// serve requests and a 503 otherwise.
+type healthHandler struct {
+	store BlobStore
+}
+
+func (hh healthHandler) ServeHTTP(respWr http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		respWr.Header().Set("Allow", "GET, HEAD")
+		respWr.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	respWr.Header().Set("Cache-Control", "no-store")
+
+	switch req.URL.Path {
+	case "/healthz":
+		writeHealthStatus(respWr, http.StatusOK, "ok")
+
+	case "/readyz":
+		if err := hh.checkReady(req.Context()); err != nil {
+			log.Println("readiness check failed. error:", err)
+			writeHealthStatus(respWr, http.StatusServiceUnavailable, "not ready")
+			return
+		}
+
+		writeHealthStatus(respWr, http.StatusOK, "ok")
+
+	default:
+		respWr.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func writeHealthStatus(respWr http.ResponseWriter, statusCode int, msg string) {
+	respWr.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	respWr.WriteHeader(statusCode)
+	_, _ = respWr.Write([]byte(msg + "\n"))
+}
+
+func (hh healthHandler) checkReady(ctx context.Context) error {
+	checker, ok := hh.store.(readinessChecker)
+
+	if !ok {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+
+	return checker.checkReady(ctx)
+}
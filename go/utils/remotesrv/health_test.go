@@ -0,0 +1,92 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func doHealthRequest(store BlobStore, method, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	healthHandler{store}.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+	return rec
+}
+
+func TestHealthz(t *testing.T) {
+	fh := newTestHandler(t)
+
+	rec := doHealthRequest(fh.store, http.MethodGet, "/healthz")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "ok\n", rec.Body.String())
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+
+	// liveness doesn't depend on the storage
+	require.NoError(t, os.RemoveAll(testRoot(fh)))
+	rec = doHealthRequest(fh.store, http.MethodGet, "/healthz")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = doHealthRequest(fh.store, http.MethodPost, "/healthz")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestReadyz(t *testing.T) {
+	fh := newTestHandler(t)
+
+	rec := doHealthRequest(fh.store, http.MethodGet, "/readyz")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "ok\n", rec.Body.String())
+
+	entries, err := os.ReadDir(testRoot(fh))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "the readiness check left a file behind")
+
+	// replacing the storage root with a file makes it unwritable, even for root
+	require.NoError(t, os.RemoveAll(testRoot(fh)))
+	require.NoError(t, os.WriteFile(testRoot(fh), []byte("not a directory"), os.ModePerm))
+
+	rec = doHealthRequest(fh.store, http.MethodGet, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, "not ready\n", rec.Body.String())
+}
+
+// forbiddenS3 rejects every HeadObject request, as S3 does for credentials which lack permission.
+type forbiddenS3 struct {
+	*fakeS3
+}
+
+func (f forbiddenS3) HeadObjectWithContext(ctx aws.Context, input *s3.HeadObjectInput, opts ...request.Option) (*s3.HeadObjectOutput, error) {
+	return nil, awserr.NewRequestFailure(awserr.New("Forbidden", "Forbidden", nil), http.StatusForbidden, "")
+}
+
+func TestReadyzBackends(t *testing.T) {
+	rec := doHealthRequest(newMemBlobStore(), http.MethodGet, "/readyz")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = doHealthRequest(newS3Store(newFakeS3(), "bucket", "prefix"), http.MethodGet, "/readyz")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = doHealthRequest(newS3Store(forbiddenS3{newFakeS3()}, "bucket", "prefix"), http.MethodGet, "/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+}
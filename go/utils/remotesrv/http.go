@@ -16,27 +16,312 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/md5"
+	"crypto/sha512"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	gohash "hash"
 	"io"
+	"log"
+	"mime/multipart"
+	"net"
 	"net/http"
+	"net/textproto"
 	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	remotesapi "github.com/dolthub/dolt/go/gen/proto/dolt/services/remotesapi/v1alpha1"
 
-	"github.com/dolthub/dolt/go/libraries/utils/iohelp"
 	"github.com/dolthub/dolt/go/store/hash"
+	"github.com/dolthub/dolt/go/store/nbs"
 )
 
-var expectedFiles = make(map[string]*remotesapi.TableFileDetails)
+// responseAborted is returned by handlers in place of a status code when the response body could not be completely
+// written after part of it was sent.
+const responseAborted = -2
+
+// expectedFileMap holds the details of the table files which clients have been given upload locations for. It is
+// read by the http handlers and written by the grpc service, so all access is synchronized. Registrations are kept
+// after an upload completes so that it can be retried, and are removed by sweep once they are older than a ttl.
+type expectedFileMap struct {
+	mu    *sync.RWMutex
+	files map[string]expectedFile
+	now   func() time.Time
+}
+
+type expectedFile struct {
+	tfd        *remotesapi.TableFileDetails
+	registered time.Time
+}
+
+var expectedFiles = newExpectedFileMap(time.Now)
+
+func newExpectedFileMap(now func() time.Time) *expectedFileMap {
+	return &expectedFileMap{&sync.RWMutex{}, make(map[string]expectedFile), now}
+}
+
+func (m *expectedFileMap) get(fileId string) (*remotesapi.TableFileDetails, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ef, ok := m.files[fileId]
+	return ef.tfd, ok
+}
+
+func (m *expectedFileMap) set(fileId string, tfd *remotesapi.TableFileDetails) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.files[fileId] = expectedFile{tfd, m.now()}
+}
+
+// register is set, but fails with errConflictingUpload if |fileId| is already registered with a different length or
+// content hash. Registering the same details again refreshes the registration.
+func (m *expectedFileMap) register(fileId string, tfd *remotesapi.TableFileDetails) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if ef, ok := m.files[fileId]; ok {
+		if ef.tfd.ContentLength != tfd.ContentLength {
+			return fmt.Errorf("%w: %s is registered with a length of %d bytes, not %d", errConflictingUpload, fileId, ef.tfd.ContentLength, tfd.ContentLength)
+		} else if !bytes.Equal(ef.tfd.ContentHash, tfd.ContentHash) {
+			return fmt.Errorf("%w: %s is registered with a different content hash", errConflictingUpload, fileId)
+		}
+	}
+
+	m.files[fileId] = expectedFile{tfd, m.now()}
+	return nil
+}
+
+func (m *expectedFileMap) delete(fileId string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.files, fileId)
+}
+
+// sweep removes the registrations which are older than |ttl| and returns the number removed.
+func (m *expectedFileMap) sweep(ttl time.Duration) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cutoff := m.now().Add(-ttl)
+	removed := 0
+	for fileId, ef := range m.files {
+		if ef.registered.Before(cutoff) {
+			delete(m.files, fileId)
+			removed++
+		}
+	}
+
+	return removed
+}
+
+// sweepEvery calls sweep with |ttl| each time |tick| fires until |stop| is closed.
+func (m *expectedFileMap) sweepEvery(ttl time.Duration, tick <-chan time.Time, stop <-chan struct{}) {
+	for {
+		select {
+		case <-tick:
+			if removed := m.sweep(ttl); removed > 0 {
+				log.Printf("removed %d expired upload registrations", removed)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+func getExpectedFile(fileId string) (*remotesapi.TableFileDetails, bool) {
+	return expectedFiles.get(fileId)
+}
+
+func setExpectedFile(fileId string, tfd *remotesapi.TableFileDetails) {
+	expectedFiles.set(fileId, tfd)
+}
+
+func deleteExpectedFile(fileId string) {
+	expectedFiles.delete(fileId)
+}
+
+// errInvalidUpload is returned when registering an upload whose file id or details are not valid.
+var errInvalidUpload = errors.New("invalid upload")
+
+// errConflictingUpload is returned when registering an upload to a file id which is already registered with different
+// details.
+var errConflictingUpload = errors.New("upload conflicts with an existing registration")
+
+// RegisterExpectedUpload registers |tfd| as the details of an upload to |fileId|, so that the http file server accepts
+// an upload to it. It is called by the grpc service when handing out upload locations. |fileId| must be a valid hash
+// which matches the id of |tfd|, and if |fileId| is already registered it must be with the same length and content
+// hash.
+func RegisterExpectedUpload(fileId string, tfd *remotesapi.TableFileDetails) error {
+	h, ok := hash.MaybeParse(fileId)
+
+	if !ok {
+		return fmt.Errorf("%w: %s is not a valid hash", errInvalidUpload, fileId)
+	} else if tfd == nil {
+		return fmt.Errorf("%w: %s has no table file details", errInvalidUpload, fileId)
+	} else if !bytes.Equal(tfd.Id, h[:]) {
+		return fmt.Errorf("%w: %s does not match the id of its table file details", errInvalidUpload, fileId)
+	}
+
+	if _, err := digestForContentHash(tfd.ContentHash); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidUpload, err)
+	}
+
+	return expectedFiles.register(fileId, tfd)
+}
+
+// validPathToken returns true if |tok| can safely be used as a single element of a path within the storage root.
+func validPathToken(tok string) bool {
+	return tok != "" && tok != "." && !strings.Contains(tok, "..") && !strings.ContainsAny(tok, "/\\\x00")
+}
+
+// fileHandler serves table files from a BlobStore over http.
+type fileHandler struct {
+	store BlobStore
+
+	// verifyReads causes the contents of a file to be checked against its expected content hash before it is served.
+	verifyReads bool
 
-func ServeHTTP(respWr http.ResponseWriter, req *http.Request) {
-	logger := getReqLogger("HTTP_"+req.Method, req.RequestURI)
-	defer func() { logger("finished") }()
+	// maxUploadSize is the largest table file in bytes which may be uploaded. A value of 0 means there is no limit.
+	maxUploadSize int64
+
+	// jsonLog, when set, receives structured JSON request logs in place of the default text logs.
+	jsonLog *log.Logger
+
+	// metrics, when set, records request counts, durations and sizes.
+	metrics *httpMetrics
+
+	// auth decides which requests are allowed.
+	auth requestAuthorizer
+
+	// sessions holds the state of resumable uploads which are in progress.
+	sessions *uploadSessionMap
+
+	// verifyFileIds causes uploads to be rejected unless the table file name computed from the uploaded table file's
+	// index matches the file id it was uploaded to.
+	verifyFileIds bool
+
+	// contentType is the Content-Type of table file downloads.
+	contentType string
+
+	// limiter, when set, limits the rate of requests from each client.
+	limiter *rateLimiter
+
+	// concurrency, when set, limits the number of requests which are served at once.
+	concurrency *concurrencyLimiter
+
+	// cors, when set, allows browsers to make cross-origin requests.
+	cors *corsPolicy
+
+	// uploadTimeout is how long the body of an upload may take to be received. A value of 0 means there is no limit.
+	uploadTimeout time.Duration
+
+	// maxOpenRangeSize is the most bytes served for an open ended range, such as bytes=100-, which is shortened to
+	// end sooner than the end of the file when it would be larger. A value of 0 means there is no limit.
+	maxOpenRangeSize int64
+
+	// allowEmptyUploads causes uploads with an empty body to be stored as empty table files. An empty table file is
+	// almost always the result of a bug in the client, so they are rejected by default.
+	allowEmptyUploads bool
+
+	// quotas, when set, limits the total size of the table files stored for each repo.
+	quotas *repoQuotas
+}
+
+// defaultContentType is the Content-Type table files are served with unless another is configured.
+const defaultContentType = "application/octet-stream"
+
+func newFileHandler(store BlobStore) *fileHandler {
+	return &fileHandler{
+		store:         store,
+		auth:          allowAll{},
+		sessions:      newUploadSessionMap(),
+		verifyFileIds: true,
+		contentType:   defaultContentType,
+	}
+}
+
+// removeTempFiles deletes the staging files of resumable uploads, along with the temp files of the BlobStore if it
+// creates any.
+func (fh *fileHandler) removeTempFiles() error {
+	err := fh.sessions.removeTempFiles()
+
+	if remover, ok := fh.store.(tempFileRemover); ok {
+		if storeErr := remover.removeTempFiles(); err == nil {
+			err = storeErr
+		}
+	}
+
+	return err
+}
+
+func (fh *fileHandler) ServeHTTP(wr http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+	respWr := &statusWriter{ResponseWriter: wr}
+	logEntry := &requestLogEntry{Method: req.Method, URI: req.RequestURI}
+	rl := fh.getReqLogger(logEntry)
+	logger := rl.log
+
+	body := &countingReadCloser{ReadCloser: req.Body}
+	if req.Body != nil {
+		req.Body = body
+	}
+
+	if fh.metrics != nil {
+		fh.metrics.requestStarted()
+	}
+
+	defer func() {
+		elapsed := time.Since(start)
+		logEntry.Status = respWr.statusCode()
+		logEntry.Bytes = respWr.n
+		logEntry.DurationMs = durationMs(elapsed)
+		level := infoLevel
+		if logEntry.Status >= http.StatusInternalServerError {
+			level = errorLevel
+		}
+
+		rl.finish(fmt.Sprintf("finished. status: %d, bytes written: %d, duration: %v", logEntry.Status, logEntry.Bytes, elapsed), level, logEntry.Status >= http.StatusBadRequest)
+
+		if fh.metrics != nil {
+			fh.metrics.requestFinished(req.Method, logEntry.Status, elapsed, body.n, respWr.n)
+		}
+	}()
+
+	if fh.cors != nil {
+		if statusCode, preflight := fh.cors.apply(respWr, req); preflight {
+			logger(fmt.Sprintf("answered cors preflight from %s with %d", req.Header.Get("Origin"), statusCode))
+			respWr.WriteHeader(statusCode)
+			return
+		}
+	}
+
+	if fh.limiter != nil {
+		if ok, wait := fh.limiter.allow(clientIP(req)); !ok {
+			logger(fmt.Sprintf("rate limit exceeded by %s. retry in %v", clientIP(req), wait))
+			respWr.Header().Set("Retry-After", strconv.FormatInt(retryAfterSeconds(wait), 10))
+			respWr.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+	}
+
+	if fh.concurrency != nil {
+		if !fh.concurrency.acquire(req.Context()) {
+			logger(fmt.Sprintf("concurrency limit of %d requests reached", fh.concurrency.limit()))
+			respWr.Header().Set("Retry-After", "1")
+			respWr.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		defer fh.concurrency.release()
+	}
 
 	path := strings.TrimLeft(req.URL.Path, "/")
 	tokens := strings.Split(path, "/")
@@ -44,25 +329,104 @@ func ServeHTTP(respWr http.ResponseWriter, req *http.Request) {
 	if len(tokens) != 3 {
 		logger(fmt.Sprintf("response to: %v method: %v http response code: %v", req.RequestURI, req.Method, http.StatusNotFound))
 		respWr.WriteHeader(http.StatusNotFound)
+		return
 	}
 
 	org := tokens[0]
 	repo := tokens[1]
 	hashStr := tokens[2]
+	logEntry.Org, logEntry.Repo, logEntry.FileId = org, repo, hashStr
+
+	pathToks := tokens
+	if hashStr == "" {
+		// a path which ends in a slash rather than a file id lists the table files of the repo
+		pathToks = tokens[:2]
+	}
+
+	for _, tok := range pathToks {
+		if !validPathToken(tok) {
+			logger(fmt.Sprintf("response to: %v method: %v http response code: %v", req.RequestURI, req.Method, http.StatusBadRequest))
+			respWr.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+
+	switch result, reason := fh.auth.authorize(req.Method, org, repo, req); result {
+	case authUnauthenticated:
+		logger("unauthenticated request: " + reason)
+		respWr.Header().Set("WWW-Authenticate", `Bearer realm="remotesrv"`)
+		respWr.WriteHeader(http.StatusUnauthorized)
+		return
+	case authForbidden:
+		logger("forbidden request: " + reason)
+		respWr.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	if hashStr == "" {
+		if statusCode := fh.listTableFiles(req.Context(), logger, org, repo, respWr, req); statusCode != -1 {
+			respWr.WriteHeader(statusCode)
+		}
+
+		return
+	}
+
+	if isUploadSessionRequest(req) {
+		if statusCode := fh.serveUploadSession(logger, org, repo, hashStr, respWr, req); statusCode != -1 {
+			respWr.WriteHeader(statusCode)
+		}
+
+		return
+	}
 
 	statusCode := http.StatusMethodNotAllowed
 	switch req.Method {
-	case http.MethodGet:
-		rangeStr := req.Header.Get("Range")
+	case http.MethodGet, http.MethodHead:
+		respWr.Header().Set("Accept-Ranges", "bytes")
+
+		var info BlobInfo
+		info, statusCode = fh.statFile(req.Context(), logger, org, repo, hashStr, respWr)
 
-		if rangeStr == "" {
-			statusCode = readFile(logger, org, repo, hashStr, respWr)
+		if statusCode != http.StatusOK {
+			break
+		}
+
+		if notModified(req.Header, hashStr, info.ModTime) {
+			logger("client already has " + hashStr)
+			statusCode = http.StatusNotModified
+			break
+		}
+
+		respWr.Header().Set("Content-Type", fh.contentType)
+
+		if req.Method == http.MethodHead {
+			respWr.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+			break
+		}
+
+		if fh.verifyReads {
+			if statusCode = fh.verifyFile(req.Context(), logger, org, repo, hashStr); statusCode != http.StatusOK {
+				break
+			}
+		}
+
+		if rangeStr := req.Header.Get("Range"); rangeStr == "" || !ifRangeMatches(req.Header.Get("If-Range"), hashStr, info.ModTime) {
+			statusCode = fh.readFile(req.Context(), logger, org, repo, hashStr, req.Header.Get("Accept-Encoding"), respWr)
 		} else {
-			statusCode = readChunk(logger, org, repo, hashStr, rangeStr, respWr)
+			statusCode = fh.readChunk(req.Context(), logger, org, repo, hashStr, rangeStr, respWr)
 		}
 
 	case http.MethodPost, http.MethodPut:
-		statusCode = writeTableFile(logger, org, repo, hashStr, req)
+		statusCode = fh.writeTableFile(logger, org, repo, hashStr, respWr, req)
+
+	case http.MethodDelete:
+		statusCode = fh.deleteTableFile(req.Context(), logger, org, repo, hashStr)
+	}
+
+	if statusCode == responseAborted {
+		// the client has already been sent part of a response, so the connection is closed to let it know the
+		// response is incomplete
+		panic(http.ErrAbortHandler)
 	}
 
 	if statusCode != -1 {
@@ -70,7 +434,10 @@ func ServeHTTP(respWr http.ResponseWriter, req *http.Request) {
 	}
 }
 
-func writeTableFile(logger func(string), org, repo, fileId string, request *http.Request) int {
+// writeTableFile stores the body of |request| as the table file |fileId|. A |fileId| which is not a valid hash is a bad
+// request, while a valid hash which was never registered through the grpc upload location api results in a 404, as the
+// server has no record of the upload.
+func (fh *fileHandler) writeTableFile(logger func(string), org, repo, fileId string, respWr http.ResponseWriter, request *http.Request) int {
 	_, ok := hash.MaybeParse(fileId)
 
 	if !ok {
@@ -78,65 +445,490 @@ func writeTableFile(logger func(string), org, repo, fileId string, request *http
 		return http.StatusBadRequest
 	}
 
-	tfd, ok := expectedFiles[fileId]
+	tfd, ok := getExpectedFile(fileId)
 
 	if !ok {
-		return http.StatusBadRequest
+		logger(fileId + " was not registered for upload")
+		return http.StatusNotFound
 	}
 
 	logger(fileId + " is valid")
-	data, err := io.ReadAll(request.Body)
 
-	if tfd.ContentLength != 0 && tfd.ContentLength != uint64(len(data)) {
+	info, statErr := fh.store.Stat(request.Context(), org, repo, fileId)
+	exists := statErr == nil
+
+	if exists && etagMatches(request.Header.Get("If-None-Match"), fileId) {
+		// table files are content addressed, so the stored file already has the contents of the upload
+		logger(fileId + " already exists. skipping upload")
+		respWr.Header().Set("ETag", etagFor(fileId))
+		return http.StatusPreconditionFailed
+	}
+
+	if exists && expectsContinue(request) && info.Size == int64(tfd.ContentLength) && fh.storedChecksumMatches(request.Context(), org, repo, fileId, tfd) {
+		// the client is waiting to be told to send the body, which a retried upload of a file that was stored in
+		// full doesn't need. Not reading the body keeps the client from sending it.
+		logger(fileId + " already exists. completing retried upload without its body")
+		respWr.Header().Set("ETag", etagFor(fileId))
+		return http.StatusOK
+	}
+
+	if request.ContentLength == 0 && !fh.allowEmptyUploads {
+		return fh.rejectInvalidUpload(logger, org, repo, fileId, errEmptyUpload, respWr)
+	}
+
+	reqBody := fh.limitUploadTime(request, request.Body)
+
+	if fh.maxUploadSize > 0 {
+		if request.ContentLength > fh.maxUploadSize || tfd.ContentLength > uint64(fh.maxUploadSize) {
+			logger(fmt.Sprintf("upload of %d bytes exceeds the maximum upload size of %d bytes", request.ContentLength, fh.maxUploadSize))
+			return http.StatusRequestEntityTooLarge
+		}
+
+		reqBody = limitUploadSize(reqBody, fh.maxUploadSize)
+	}
+
+	// clients which registered their uploads by hash alone didn't give a length, so the request's length is reserved
+	// instead, or the most that may be uploaded if that isn't known either
+	size := int64(tfd.ContentLength)
+	if size == 0 {
+		size = request.ContentLength
+
+		if size < 0 && fh.maxUploadSize > 0 {
+			size = fh.maxUploadSize
+		}
+	}
+
+	reservation, err := fh.reserveQuota(request.Context(), org, repo, fileId, size)
+
+	if errors.Is(err, errQuotaExceeded) {
+		logger(err.Error())
+		return http.StatusRequestEntityTooLarge
+	} else if err != nil {
+		logger(fmt.Sprintf("failed to compute the size of %s/%s: %v", org, repo, err))
+		return blobErrStatus(err)
+	} else if reservation != nil {
+		// no more than was reserved is read, so nothing larger is stored
+		reqBody = limitUploadSize(reqBody, reservation.size)
+	}
+
+	body, err := newValidatingReader(reqBody, tfd)
+
+	if err != nil {
+		logger(err.Error())
 		return http.StatusBadRequest
 	}
 
-	if len(tfd.ContentHash) > 0 {
-		actualMD5Bytes := md5.Sum(data)
-		if !bytes.Equal(tfd.ContentHash, actualMD5Bytes[:]) {
+	// the length of a chunked upload isn't known until its body has been read
+	body.rejectEmpty = !fh.allowEmptyUploads
+
+	var validate func(io.ReadSeeker) error
+	if fh.verifyFileIds {
+		validate = func(rd io.ReadSeeker) error {
+			return verifyTableFileName(rd, fileId)
+		}
+	}
+
+	err = fh.store.Put(request.Context(), org, repo, fileId, body, validate)
+
+	if err == nil {
+		reservation.stored(int64(body.n))
+	} else {
+		reservation.release()
+	}
+
+	if body.readErr != nil && !errors.Is(body.readErr, errUploadTooLarge) {
+		logger("failed to read body " + body.readErr.Error())
+
+		if errors.Is(body.readErr, errUploadTimeout) {
+			// the rest of the body may never arrive, so the connection can't be reused
+			respWr.Header().Set("Connection", "close")
+			return http.StatusRequestTimeout
+		} else if errors.Is(body.readErr, io.ErrUnexpectedEOF) {
+			// the client went away before sending the whole body
 			return http.StatusBadRequest
 		}
+
+		return http.StatusInternalServerError
+	} else if errors.Is(err, errUploadTooLarge) {
+		// the rest of the body is never read, so the connection can't be reused
+		respWr.Header().Set("Connection", "close")
+		return http.StatusRequestEntityTooLarge
+	} else if isValidationError(err) {
+		return fh.rejectInvalidUpload(logger, org, repo, fileId, err, respWr)
+	} else if err != nil {
+		logger(fmt.Sprintf("failed to store %s/%s/%s: %v", org, repo, fileId, err))
+		return blobErrStatus(err)
 	}
 
+	logger(fmt.Sprintf("Successfully wrote object to storage. %d bytes written", body.n))
+	body.setReceivedHeaders(respWr.Header())
+
+	if exists {
+		return http.StatusOK
+	}
+
+	respWr.Header().Set("Location", request.URL.Path)
+	return http.StatusCreated
+}
+
+// expectsContinue returns whether the client of |req| is waiting for a 100 Continue response before sending the body.
+func expectsContinue(req *http.Request) bool {
+	return strings.EqualFold(req.Header.Get("Expect"), "100-continue")
+}
+
+func (fh *fileHandler) deleteTableFile(ctx context.Context, logger func(string), org, repo, fileId string) int {
+	_, ok := hash.MaybeParse(fileId)
+
+	if !ok {
+		logger(fileId + " is not a valid hash")
+		return http.StatusBadRequest
+	}
+
+	err := fh.store.Delete(ctx, org, repo, fileId)
+
 	if err != nil {
-		logger("failed to read body " + err.Error())
-		return http.StatusInternalServerError
+		logger(fmt.Sprintf("failed to delete %s/%s/%s: %v", org, repo, fileId, err))
+		return blobErrStatus(err)
 	}
 
-	err = writeLocal(logger, org, repo, fileId, data)
+	if fh.quotas != nil {
+		fh.quotas.deleted(org, repo, fileId)
+	}
+
+	logger(fmt.Sprintf("Successfully deleted %s/%s/%s", org, repo, fileId))
+	return http.StatusNoContent
+}
+
+// errUploadTooLarge is returned when the body of an upload is larger than the limit on its size.
+var errUploadTooLarge = errors.New("upload is larger than the size limit")
+
+// limitUploadSize returns a reader of the upload |body| which fails with errUploadTooLarge once more than |limit| bytes
+// have been read. Unlike io.LimitReader the excess is an error rather than the end of the body.
+func limitUploadSize(body io.ReadCloser, limit int64) io.ReadCloser {
+	return &sizeLimitedReader{ReadCloser: body, remaining: limit}
+}
+
+// sizeLimitedReader fails with errUploadTooLarge once more than |remaining| bytes have been read.
+type sizeLimitedReader struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (sr *sizeLimitedReader) Read(p []byte) (int, error) {
+	if sr.remaining < 0 {
+		return 0, errUploadTooLarge
+	}
+
+	// read one byte more than the limit allows, so that a body which is exactly at the limit ends normally
+	if int64(len(p)) > sr.remaining+1 {
+		p = p[:sr.remaining+1]
+	}
+
+	n, err := sr.ReadCloser.Read(p)
+
+	if int64(n) <= sr.remaining {
+		sr.remaining -= int64(n)
+		return n, err
+	}
+
+	n = int(sr.remaining)
+	sr.remaining = -1
+	return n, errUploadTooLarge
+}
+
+// errUploadTimeout is returned when the body of an upload is not received within the upload timeout.
+var errUploadTimeout = errors.New("upload was not received within the upload timeout")
+
+// storedChecksumMatches returns whether the md5 recorded for the stored file |fileId| is the content hash of |tfd|. It
+// is false when the store doesn't record checksums, or none was recorded for the file.
+func (fh *fileHandler) storedChecksumMatches(ctx context.Context, org, repo, fileId string, tfd *remotesapi.TableFileDetails) bool {
+	cs, ok := fh.store.(checksummer)
+
+	if !ok {
+		return false
+	}
+
+	stored, err := cs.Checksum(ctx, org, repo, fileId)
+	return err == nil && len(stored) > 0 && bytes.Equal(stored, tfd.ContentHash)
+}
+
+// connContextKey is the context key of the net.Conn a request was received on.
+type connContextKey struct{}
+
+// withConn returns a copy of |ctx| holding the net.Conn |conn|. It is used as the ConnContext of the http server so
+// that handlers can reach the connection of a request.
+func withConn(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, connContextKey{}, conn)
+}
+
+// limitUploadTime returns a reader of the upload |body| of |req| which fails with errUploadTimeout once the upload
+// timeout has passed, or |body| itself if there is no upload timeout. For HTTP/1 requests the read deadline of the
+// connection is set as well, so that a read which is blocked on a stalled client is interrupted rather than waiting
+// for more of the body. An HTTP/2 connection is shared by many requests, so its deadline is left alone.
+func (fh *fileHandler) limitUploadTime(req *http.Request, body io.ReadCloser) io.ReadCloser {
+	if fh.uploadTimeout <= 0 {
+		return body
+	}
+
+	deadline := time.Now().Add(fh.uploadTimeout)
+
+	// without the connection, such as in tests which call the handler directly, the timeout is only checked between
+	// reads
+	if conn, ok := req.Context().Value(connContextKey{}).(net.Conn); ok && req.ProtoMajor == 1 {
+		_ = conn.SetReadDeadline(deadline)
+	}
+
+	return &deadlineReader{ReadCloser: body, deadline: deadline}
+}
+
+// deadlineReader fails with errUploadTimeout once its deadline has passed.
+type deadlineReader struct {
+	io.ReadCloser
+	deadline time.Time
+}
+
+func (dr *deadlineReader) Read(p []byte) (int, error) {
+	if !time.Now().Before(dr.deadline) {
+		return 0, errUploadTimeout
+	}
+
+	n, err := dr.ReadCloser.Read(p)
+
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		err = errUploadTimeout
+	}
+
+	return n, err
+}
+
+var errContentLengthMismatch = errors.New("content length does not match the expected length")
+var errContentHashMismatch = errors.New("content hash does not match the expected hash")
+var errUnsupportedContentHash = errors.New("unsupported content hash")
+var errEmptyUpload = errors.New("upload is empty")
+
+// contentMismatchError describes an upload whose length or content hash differs from the one it was registered with.
+type contentMismatchError struct {
+	// err is either errContentLengthMismatch or errContentHashMismatch
+	err      error
+	expected string
+	actual   string
+}
+
+func (e *contentMismatchError) Error() string {
+	return fmt.Sprintf("%v. expected: %s, actual: %s", e.err, e.expected, e.actual)
+}
+
+func (e *contentMismatchError) Unwrap() error {
+	return e.err
+}
+
+// isValidationError returns true if |err| is the result of an upload failing validation.
+func isValidationError(err error) bool {
+	return errors.Is(err, errContentLengthMismatch) || errors.Is(err, errContentHashMismatch) || errors.Is(err, errFileIdMismatch) ||
+		errors.Is(err, errEmptyUpload)
+}
+
+// rejectInvalidUpload logs why an upload failed validation and responds with a 400 and a plain text body explaining
+// the failure. When requests are authorized the expected length or hash is left out of the body, so that clients
+// can't learn anything about a registered upload by sending content which doesn't match it.
+func (fh *fileHandler) rejectInvalidUpload(logger func(string), org, repo, fileId string, err error, respWr http.ResponseWriter) int {
+	logger(fmt.Sprintf("upload of %s/%s/%s failed validation: %v", org, repo, fileId, err))
+
+	msg := err.Error()
+	var mismatch *contentMismatchError
+	if _, open := fh.auth.(allowAll); !open && errors.As(err, &mismatch) {
+		msg = fmt.Sprintf("%v. received: %s", mismatch.err, mismatch.actual)
+	}
+
+	http.Error(respWr, "upload failed validation: "+msg, http.StatusBadRequest)
+	return -1
+}
+
+// errFileIdMismatch is returned when an uploaded table file is not the table file named by its file id.
+var errFileIdMismatch = errors.New("table file does not match its file id")
+
+// verifyTableFileName checks that the table file read from |rd| is named |fileId|. Table file names are computed from
+// the chunk addresses in the table file's index, so this ensures that content cannot be stored under the wrong name.
+func verifyTableFileName(rd io.ReadSeeker, fileId string) error {
+	name, err := nbs.TableFileName(rd)
 
 	if err != nil {
-		return http.StatusInternalServerError
+		return fmt.Errorf("%w: %v", errFileIdMismatch, err)
 	}
 
-	return http.StatusOK
+	if name.String() != fileId {
+		return fmt.Errorf("%w: table file is named %s", errFileIdMismatch, name.String())
+	}
+
+	return nil
 }
 
-func writeLocal(logger func(string), org, repo, fileId string, data []byte) error {
-	path := filepath.Join(org, repo, fileId)
+// digestForContentHash returns a constructor for the digest used to produce |contentHash|. The algorithm is determined
+// by the length of the hash: 16 bytes for MD5 and 64 bytes for SHA-512. MD5 is used if no hash is provided.
+func digestForContentHash(contentHash []byte) (func() gohash.Hash, error) {
+	switch len(contentHash) {
+	case 0, md5.Size:
+		return md5.New, nil
+	case sha512.Size:
+		return sha512.New, nil
+	}
+
+	return nil, fmt.Errorf("%w: content hashes of %d bytes are not supported", errUnsupportedContentHash, len(contentHash))
+}
 
-	err := os.WriteFile(path, data, os.ModePerm)
+// validatingReader computes the length and digest of an upload incrementally as it is read. Once the wrapped reader has
+// been exhausted the totals are checked against the expected TableFileDetails, and a mismatch is returned as an error
+// in place of io.EOF. Validation only happens after a successful read of the entire body, so partial data from a
+// failed read is never validated.
+type validatingReader struct {
+	rd     io.Reader
+	tfd    *remotesapi.TableFileDetails
+	digest gohash.Hash
+	n      uint64
+
+	// readErr is the first error, other than io.EOF, returned by the wrapped reader
+	readErr error
+
+	// rejectEmpty causes validation to fail if the wrapped reader is empty
+	rejectEmpty bool
+}
+
+func newValidatingReader(rd io.Reader, tfd *remotesapi.TableFileDetails) (*validatingReader, error) {
+	newDigest, err := digestForContentHash(tfd.ContentHash)
 
 	if err != nil {
-		logger(fmt.Sprintf("failed to write file %s", path))
-		return err
+		return nil, err
 	}
 
-	logger("Successfully wrote object to storage")
+	return &validatingReader{rd: rd, tfd: tfd, digest: newDigest()}, nil
+}
+
+func (vr *validatingReader) Read(p []byte) (int, error) {
+	n, err := vr.rd.Read(p)
+	vr.n += uint64(n)
+	_, _ = vr.digest.Write(p[:n])
+
+	if err == io.EOF {
+		if verr := vr.validate(); verr != nil {
+			return n, verr
+		}
+	} else if err != nil && vr.readErr == nil {
+		vr.readErr = err
+	}
+
+	return n, err
+}
+
+// receivedBytesHeader is the response header holding the number of bytes received by a successful upload.
+const receivedBytesHeader = "X-Dolt-Received-Bytes"
+
+// contentMD5Header and contentSHA512Header are the response headers holding the hex encoded digest of a successful
+// upload. The digest is computed with the algorithm of the content hash the upload was registered with.
+const (
+	contentMD5Header    = "X-Dolt-Content-MD5"
+	contentSHA512Header = "X-Dolt-Content-SHA512"
+)
+
+// setReceivedHeaders sets the headers describing the data read so far, so that clients can check what the server
+// received.
+func (vr *validatingReader) setReceivedHeaders(header http.Header) {
+	header.Set(receivedBytesHeader, strconv.FormatUint(vr.n, 10))
+
+	switch digest := vr.digest.Sum(nil); len(digest) {
+	case md5.Size:
+		header.Set(contentMD5Header, hex.EncodeToString(digest))
+	case sha512.Size:
+		header.Set(contentSHA512Header, hex.EncodeToString(digest))
+	}
+}
+
+func (vr *validatingReader) validate() error {
+	if vr.rejectEmpty && vr.n == 0 {
+		return errEmptyUpload
+	}
+
+	if vr.tfd.ContentLength != 0 && vr.tfd.ContentLength != vr.n {
+		return &contentMismatchError{
+			err:      errContentLengthMismatch,
+			expected: strconv.FormatUint(vr.tfd.ContentLength, 10),
+			actual:   strconv.FormatUint(vr.n, 10),
+		}
+	}
+
+	if actual := vr.digest.Sum(nil); len(vr.tfd.ContentHash) > 0 && !bytes.Equal(vr.tfd.ContentHash, actual) {
+		return &contentMismatchError{
+			err:      errContentHashMismatch,
+			expected: hex.EncodeToString(vr.tfd.ContentHash),
+			actual:   hex.EncodeToString(actual),
+		}
+	}
 
 	return nil
 }
 
 func offsetAndLenFromRange(rngStr string) (int64, int64, error) {
-	if rngStr == "" {
+	if strings.TrimSpace(rngStr) == "" {
 		return -1, -1, nil
 	}
 
-	if !strings.HasPrefix(rngStr, "bytes=") {
-		return -1, -1, errors.New("range string does not start with 'bytes=")
+	spec, err := byteRangeSpecs(rngStr)
+
+	if err != nil {
+		return -1, -1, err
+	}
+
+	return offsetAndLenFromRangeSpec(spec)
+}
+
+// byteRangeSpecs returns the range specs which follow the bytes unit in a Range header. The unit is matched case
+// insensitively and whitespace around the unit and the header is ignored, so " Bytes = 0-99" yields "0-99".
+func byteRangeSpecs(rngStr string) (string, error) {
+	rngStr = strings.TrimSpace(rngStr)
+	eq := strings.Index(rngStr, "=")
+
+	if eq == -1 || !strings.EqualFold(strings.TrimSpace(rngStr[:eq]), "bytes") {
+		return "", errors.New("range string does not start with 'bytes='")
 	}
 
-	tokens := strings.Split(rngStr[6:], "-")
+	return rngStr[eq+1:], nil
+}
+
+// byteRange is a single range of bytes within a file
+type byteRange struct {
+	offset int64
+	length int64
+}
+
+// byteRangesFromRange parses a Range header which may contain multiple comma separated ranges,
+// e.g. bytes=0-99,500-599
+func byteRangesFromRange(rngStr string) ([]byteRange, error) {
+	rngSpecs, err := byteRangeSpecs(rngStr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	specs := strings.Split(rngSpecs, ",")
+	ranges := make([]byteRange, len(specs))
+	for i, spec := range specs {
+		offset, length, err := offsetAndLenFromRangeSpec(spec)
+
+		if err != nil {
+			return nil, err
+		}
+
+		ranges[i] = byteRange{offset, length}
+	}
+
+	return ranges, nil
+}
+
+// toEndOfFile is the length of an open ended range, such as bytes=100-, which runs to the end of the file.
+const toEndOfFile = -1
+
+// offsetAndLenFromRangeSpec parses a single #-# range, or an open ended #- range whose length is toEndOfFile.
+func offsetAndLenFromRangeSpec(spec string) (int64, int64, error) {
+	tokens := strings.Split(spec, "-")
 
 	if len(tokens) != 2 {
 		return -1, -1, errors.New("invalid range format. should be bytes=#-#")
@@ -148,136 +940,343 @@ func offsetAndLenFromRange(rngStr string) (int64, int64, error) {
 		return -1, -1, errors.New("invalid offset is not a number. should be bytes=#-#")
 	}
 
+	if strings.TrimSpace(tokens[1]) == "" {
+		return int64(start), toEndOfFile, nil
+	}
+
 	end, err := strconv.ParseUint(strings.TrimSpace(tokens[1]), 10, 64)
 
 	if err != nil {
 		return -1, -1, errors.New("invalid length is not a number. should be bytes=#-#")
 	}
 
+	if end < start {
+		return -1, -1, errors.New("invalid range. the end is before the start")
+	}
+
 	return int64(start), int64(end-start) + 1, nil
 }
 
-func readFile(logger func(string), org, repo, fileId string, writer io.Writer) int {
-	path := filepath.Join(org, repo, fileId)
+// statFile checks that a file exists and sets its ETag and Last-Modified headers on the response. It returns the
+// BlobInfo of the file along with http.StatusOK, or an error status if the file cannot be found.
+func (fh *fileHandler) statFile(ctx context.Context, logger func(string), org, repo, fileId string, respWr http.ResponseWriter) (BlobInfo, int) {
+	info, err := fh.store.Stat(ctx, org, repo, fileId)
+
+	if err != nil {
+		logger(fmt.Sprintf("failed to stat %s/%s/%s: %v", org, repo, fileId, err))
+		return BlobInfo{}, blobErrStatus(err)
+	}
+
+	respWr.Header().Set("ETag", etagFor(fileId))
 
-	info, err := os.Stat(path)
+	if !info.ModTime.IsZero() {
+		respWr.Header().Set("Last-Modified", info.ModTime.UTC().Format(http.TimeFormat))
+	}
+
+	return info, http.StatusOK
+}
+
+// verifyFile checks the contents of a file against the content hash it was expected to have when it was uploaded, or
+// when its upload registration has expired, the checksum the BlobStore recorded when it was stored. Files for which
+// no content hash is known are assumed to be valid.
+func (fh *fileHandler) verifyFile(ctx context.Context, logger func(string), org, repo, fileId string) int {
+	var expected []byte
+	if tfd, ok := getExpectedFile(fileId); ok {
+		expected = tfd.ContentHash
+	}
+
+	if cs, ok := fh.store.(checksummer); ok && len(expected) == 0 {
+		var err error
+		expected, err = cs.Checksum(ctx, org, repo, fileId)
+
+		if err != nil {
+			logger(fmt.Sprintf("failed to read the checksum of %s/%s/%s: %v", org, repo, fileId, err))
+			return http.StatusInternalServerError
+		}
+	}
+
+	if len(expected) == 0 {
+		logger("no checksum is known for " + fileId + ". skipping verification")
+		return http.StatusOK
+	}
+
+	newDigest, err := digestForContentHash(expected)
 
 	if err != nil {
-		logger("file not found. path: " + path)
-		return http.StatusNotFound
+		logger(err.Error())
+		return http.StatusInternalServerError
+	}
+
+	rd, _, err := fh.store.Get(ctx, org, repo, fileId)
+
+	if err != nil {
+		logger(fmt.Sprintf("failed to read %s/%s/%s: %v", org, repo, fileId, err))
+		return blobErrStatus(err)
 	}
 
-	f, err := os.Open(path)
+	defer rd.Close()
+
+	digest := newDigest()
+	_, err = io.Copy(digest, &contextReader{ctx, rd})
 
 	if err != nil {
-		logger("failed to open file. file: " + path + " err: " + err.Error())
+		logger(fmt.Sprintf("failed to checksum %s/%s/%s: %v", org, repo, fileId, err))
 		return http.StatusInternalServerError
 	}
 
-	defer func() {
-		err := f.Close()
+	actual := digest.Sum(nil)
 
-		if err != nil {
-			logger(fmt.Sprintf("Close failed. file: %s, err: %v", path, err))
-		} else {
-			logger("Close Successful")
-		}
-	}()
+	if !bytes.Equal(expected, actual) {
+		logger(fmt.Sprintf("checksum mismatch for %s/%s/%s. expected: %x actual: %x", org, repo, fileId, expected, actual))
+		return http.StatusInternalServerError
+	}
+
+	logger("Verified checksum of " + fileId)
+	return http.StatusOK
+}
+
+// notModified returns true if the conditional headers of a GET or HEAD request show that the client's copy of |fileId|,
+// last modified at |modTime|, is current. As with other http servers If-Modified-Since is ignored when If-None-Match
+// is present, since the ETag is the more precise validator.
+func notModified(header http.Header, fileId string, modTime time.Time) bool {
+	if ifNoneMatch := header.Get("If-None-Match"); ifNoneMatch != "" {
+		return etagMatches(ifNoneMatch, fileId)
+	}
+
+	return notModifiedSince(header.Get("If-Modified-Since"), modTime)
+}
+
+// notModifiedSince returns true if |modTime| is not after the date of an If-Modified-Since header. Missing or invalid
+// dates, and unknown modification times, never match.
+func notModifiedSince(ifModifiedSince string, modTime time.Time) bool {
+	if ifModifiedSince == "" || modTime.IsZero() {
+		return false
+	}
+
+	since, err := http.ParseTime(ifModifiedSince)
+
+	if err != nil {
+		return false
+	}
+
+	// Last-Modified only has a resolution of seconds
+	return !modTime.Truncate(time.Second).After(since)
+}
+
+// readFile writes the entire file to the response, gzip encoding it if the client accepts gzip.
+func (fh *fileHandler) readFile(ctx context.Context, logger func(string), org, repo, fileId, acceptEnc string, respWr http.ResponseWriter) int {
+	if !acceptsGzip(acceptEnc) {
+		return fh.writeBlob(ctx, logger, org, repo, fileId, respWr)
+	}
+
+	gzWr := newGzipResponseWriter(respWr)
+	statusCode := fh.writeBlob(ctx, logger, org, repo, fileId, gzWr)
+
+	if statusCode == responseAborted {
+		// finishing the gzip stream would make the truncated response look complete
+		return statusCode
+	}
+
+	if err := gzWr.Close(); err != nil {
+		logger("failed to finish gzip response. err: " + err.Error())
+		return responseAborted
+	}
+
+	return statusCode
+}
 
-	n, err := io.Copy(writer, f)
+// writeBlob writes the contents of a blob to |writer|. It returns -1 on success, an error status if the blob could not
+// be read before anything was written, and responseAborted if the copy failed part way through.
+func (fh *fileHandler) writeBlob(ctx context.Context, logger func(string), org, repo, fileId string, writer io.Writer) int {
+	rd, size, err := fh.store.Get(ctx, org, repo, fileId)
 
 	if err != nil {
-		logger("failed to write data to response. err : " + err.Error())
-		return -1
+		logger(fmt.Sprintf("failed to read %s/%s/%s: %v", org, repo, fileId, err))
+		return blobErrStatus(err)
 	}
 
-	if n != info.Size() {
-		logger(fmt.Sprintf("failed to write entire file to response. Copied %d of %d err: %v", n, info.Size(), err))
-		return -1
+	defer rd.Close()
+
+	n, err := io.Copy(writer, &contextReader{ctx, rd})
+
+	if err == nil && n != size {
+		err = io.ErrUnexpectedEOF
+	}
+
+	if ctx.Err() != nil {
+		logger(fmt.Sprintf("request cancelled after writing %d of %d bytes: %v", n, size, ctx.Err()))
+		return responseAborted
+	} else if err != nil {
+		logger(fmt.Sprintf("failed to write entire file to response. Copied %d of %d err: %v", n, size, err))
+
+		if n == 0 {
+			return http.StatusInternalServerError
+		}
+
+		return responseAborted
 	}
 
 	return -1
 }
 
-func readChunk(logger func(string), org, repo, fileId, rngStr string, writer io.Writer) int {
+func (fh *fileHandler) readChunk(ctx context.Context, logger func(string), org, repo, fileId, rngStr string, respWr http.ResponseWriter) int {
+	if strings.Contains(rngStr, ",") {
+		return fh.readChunks(ctx, logger, org, repo, fileId, rngStr, respWr)
+	}
+
 	offset, length, err := offsetAndLenFromRange(rngStr)
 
 	if err != nil {
-		logger(fmt.Sprintln(rngStr, "is not a valid range"))
+		logger(fmt.Sprintf("%q is not a valid range: %v", rngStr, err))
 		return http.StatusBadRequest
 	}
 
-	data, retVal := readLocalRange(logger, org, repo, fileId, int64(offset), int64(length))
+	ranges := []byteRange{{offset, length}}
+	size, retVal := fh.checkRanges(ctx, logger, org, repo, fileId, ranges, respWr)
 
 	if retVal != -1 {
 		return retVal
 	}
 
-	logger(fmt.Sprintf("writing %d bytes", len(data)))
-	err = iohelp.WriteAll(writer, data)
+	rng := ranges[0]
+
+	rd, err := fh.store.GetRange(ctx, org, repo, fileId, rng.offset, rng.length)
 
 	if err != nil {
+		logger(fmt.Sprintf("failed to read range of %s/%s/%s: %v", org, repo, fileId, err))
+		return blobErrStatus(err)
+	}
+
+	defer rd.Close()
+
+	logger(fmt.Sprintf("writing %d bytes", rng.length))
+	respWr.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", rng.offset, rng.offset+rng.length-1, size))
+	respWr.Header().Set("Content-Length", strconv.FormatInt(rng.length, 10))
+	respWr.WriteHeader(http.StatusPartialContent)
+	n, err := io.CopyN(respWr, &contextReader{ctx, rd}, rng.length)
+
+	if ctx.Err() != nil {
+		logger(fmt.Sprintf("request cancelled after writing %d of %d bytes: %v", n, rng.length, ctx.Err()))
+		return responseAborted
+	} else if err != nil {
 		logger("failed to write data to response " + err.Error())
-		return -1
+		return responseAborted
 	}
 
 	logger("Successfully wrote data")
 	return -1
 }
 
-func readLocalRange(logger func(string), org, repo, fileId string, offset, length int64) ([]byte, int) {
-	path := filepath.Join(org, repo, fileId)
-
-	logger(fmt.Sprintf("Attempting to read bytes %d to %d from %s", offset, offset+length, path))
-	info, err := os.Stat(path)
+// checkRanges verifies that a blob contains all of |ranges| and returns its size. Open ended ranges are given the
+// length which runs to the end of the blob, or maxOpenRangeSize if that is shorter. It returns -1 as the status when
+// the ranges can be served. Otherwise the status to respond with is returned, and for unsatisfiable ranges the
+// Content-Range header is set.
+func (fh *fileHandler) checkRanges(ctx context.Context, logger func(string), org, repo, fileId string, ranges []byteRange, respWr http.ResponseWriter) (int64, int) {
+	info, err := fh.store.Stat(ctx, org, repo, fileId)
 
 	if err != nil {
-		logger(fmt.Sprintf("file %s not found", path))
-		return nil, http.StatusNotFound
+		logger(fmt.Sprintf("failed to stat %s/%s/%s: %v", org, repo, fileId, err))
+		return 0, blobErrStatus(err)
 	}
 
-	logger(fmt.Sprintf("Verified file %s exists", path))
+	for i, rng := range ranges {
+		if rng.length == toEndOfFile {
+			rng.length = info.Size - rng.offset
+
+			if fh.maxOpenRangeSize > 0 && rng.length > fh.maxOpenRangeSize {
+				rng.length = fh.maxOpenRangeSize
+			}
+
+			ranges[i] = rng
+		}
+
+		// end is exclusive, so a range which finishes on the last byte of the file has an end equal to its size
+		end := rng.offset + rng.length
 
-	if info.Size() < int64(offset+length) {
-		logger(fmt.Sprintf("Attempted to read bytes %d to %d, but the file is only %d bytes in size", offset, offset+length, info.Size()))
-		return nil, http.StatusBadRequest
+		// an open ended range which starts at or past the end of the file has no bytes to serve
+		if end > info.Size || rng.length <= 0 {
+			logger(fmt.Sprintf("Attempted to read bytes %d to %d, but the file is only %d bytes in size", rng.offset, end-1, info.Size))
+			respWr.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", info.Size))
+			return info.Size, http.StatusRequestedRangeNotSatisfiable
+		}
 	}
 
-	logger(fmt.Sprintf("Verified the file is large enough to contain the range"))
-	f, err := os.Open(path)
+	return info.Size, -1
+}
+
+func (fh *fileHandler) readChunks(ctx context.Context, logger func(string), org, repo, fileId, rngStr string, respWr http.ResponseWriter) int {
+	ranges, err := byteRangesFromRange(rngStr)
 
 	if err != nil {
-		logger(fmt.Sprintf("Failed to open %s: %v", path, err))
-		return nil, http.StatusInternalServerError
+		logger(fmt.Sprintf("%q is not a valid range: %v", rngStr, err))
+		return http.StatusBadRequest
 	}
 
-	defer func() {
-		err := f.Close()
+	size, retVal := fh.checkRanges(ctx, logger, org, repo, fileId, ranges, respWr)
 
-		if err != nil {
-			logger(fmt.Sprintf("Close failed. file: %s, err: %v", path, err))
-		} else {
-			logger("Close Successful")
+	if retVal != -1 {
+		return retVal
+	}
+
+	mpWr := multipart.NewWriter(respWr)
+	respWr.Header().Set("Content-Type", "multipart/byteranges; boundary="+mpWr.Boundary())
+	respWr.WriteHeader(http.StatusPartialContent)
+
+	for _, rng := range ranges {
+		partWr, err := mpWr.CreatePart(textproto.MIMEHeader{
+			"Content-Type":  {fh.contentType},
+			"Content-Range": {fmt.Sprintf("bytes %d-%d/%d", rng.offset, rng.offset+rng.length-1, size)},
+		})
+
+		if err == nil {
+			err = fh.copyRange(ctx, org, repo, fileId, rng, partWr)
 		}
-	}()
 
-	logger(fmt.Sprintf("Successfully opened file"))
-	pos, err := f.Seek(int64(offset), 0)
+		if ctx.Err() != nil {
+			logger(fmt.Sprintf("request cancelled while writing range %d-%d: %v", rng.offset, rng.offset+rng.length-1, ctx.Err()))
+			return responseAborted
+		} else if err != nil {
+			logger("failed to write data to response " + err.Error())
+			return responseAborted
+		}
+	}
+
+	err = mpWr.Close()
 
 	if err != nil {
-		logger(fmt.Sprintf("Failed to seek to %d: %v", offset, err))
-		return nil, http.StatusInternalServerError
+		logger("failed to write data to response " + err.Error())
+		return responseAborted
 	}
 
-	logger(fmt.Sprintf("Seek succeeded.  Current position is %d", pos))
-	diff := offset - pos
-	data, err := iohelp.ReadNBytes(f, int(diff+int64(length)))
+	logger(fmt.Sprintf("Successfully wrote %d ranges", len(ranges)))
+	return -1
+}
+
+// copyRange writes |rng| of a blob to |wr|.
+func (fh *fileHandler) copyRange(ctx context.Context, org, repo, fileId string, rng byteRange, wr io.Writer) error {
+	rd, err := fh.store.GetRange(ctx, org, repo, fileId, rng.offset, rng.length)
 
 	if err != nil {
-		logger(fmt.Sprintf("Failed to read %d bytes: %v", diff+length, err))
-		return nil, http.StatusInternalServerError
+		return err
+	}
+
+	defer rd.Close()
+
+	_, err = io.CopyN(wr, &contextReader{ctx, rd}, rng.length)
+	return err
+}
+
+// contextReader is an io.Reader which fails with the error of its context once the context is done, so that copies
+// from it stop when a request is cancelled.
+type contextReader struct {
+	ctx context.Context
+	rd  io.Reader
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
 	}
 
-	logger(fmt.Sprintf("Successfully read %d bytes", len(data)))
-	return data[diff:], -1
+	return cr.rd.Read(p)
 }
@@ -0,0 +1,1795 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	remotesapi "github.com/dolthub/dolt/go/gen/proto/dolt/services/remotesapi/v1alpha1"
+	"github.com/dolthub/dolt/go/store/chunks"
+	"github.com/dolthub/dolt/go/store/hash"
+	"github.com/dolthub/dolt/go/store/nbs"
+)
+
+const (
+	testOrg  = "org"
+	testRepo = "repo"
+)
+
+// newTestHandler creates a fileHandler backed by a fileStore rooted at a new temp dir containing an empty org/repo
+// directory. Most tests upload arbitrary bytes rather than table files, so the handler does not verify file ids.
+func newTestHandler(t *testing.T) *fileHandler {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, testOrg, testRepo), os.ModePerm))
+
+	store, err := newFileStore(dir)
+	require.NoError(t, err)
+
+	fh := newFileHandler(store)
+	fh.verifyFileIds = false
+	fh.sessions.stagingDir = t.TempDir()
+	return fh
+}
+
+// testRoot returns the root directory of the fileStore of a handler created by newTestHandler.
+func testRoot(fh *fileHandler) string {
+	return fh.store.(*fileStore).root
+}
+
+// expectUploadDetails registers an expected upload of |length| bytes with an md5 of |md5Hash| and returns its file id.
+func expectUploadDetails(t *testing.T, name string, length uint64, md5Hash []byte) string {
+	h := hash.Of([]byte(name))
+	fileId := h.String()
+
+	setExpectedFile(fileId, &remotesapi.TableFileDetails{
+		Id:            h[:],
+		ContentLength: length,
+		ContentHash:   md5Hash,
+	})
+	t.Cleanup(func() {
+		deleteExpectedFile(fileId)
+	})
+
+	return fileId
+}
+
+// expectUpload registers |data| as an expected upload and returns its file id.
+func expectUpload(t *testing.T, data []byte) string {
+	md5Hash := md5.Sum(data)
+	return expectUploadDetails(t, string(data), uint64(len(data)), md5Hash[:])
+}
+
+func fileUrl(org, repo, fileId string) string {
+	return fmt.Sprintf("/%s/%s/%s", org, repo, fileId)
+}
+
+func doRequest(fh *fileHandler, req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	fh.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestConcurrentUploads(t *testing.T) {
+	fh := newTestHandler(t)
+
+	const numUploads = 64
+	wg := &sync.WaitGroup{}
+	for i := 0; i < numUploads; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			data := []byte(fmt.Sprintf("table file contents %d", i))
+			fileId := expectUpload(t, data)
+
+			req := httptest.NewRequest(http.MethodPost, fileUrl(testOrg, testRepo, fileId), bytes.NewReader(data))
+			rec := doRequest(fh, req)
+			assert.Equal(t, http.StatusCreated, rec.Code)
+
+			written, err := os.ReadFile(filepath.Join(testRoot(fh), testOrg, testRepo, fileId))
+			if assert.NoError(t, err) {
+				assert.Equal(t, data, written)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+}
+
+// headerCountingRecorder counts the number of times WriteHeader is called on the wrapped recorder.
+type headerCountingRecorder struct {
+	*httptest.ResponseRecorder
+	headerWrites int
+}
+
+func (rec *headerCountingRecorder) WriteHeader(statusCode int) {
+	rec.headerWrites++
+	rec.ResponseRecorder.WriteHeader(statusCode)
+}
+
+func TestMalformedPaths(t *testing.T) {
+	fh := newTestHandler(t)
+
+	for _, path := range []string{"/foo", "/a/b/c/d"} {
+		t.Run(path, func(t *testing.T) {
+			rec := &headerCountingRecorder{ResponseRecorder: httptest.NewRecorder()}
+			require.NotPanics(t, func() {
+				fh.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+			})
+			assert.Equal(t, http.StatusNotFound, rec.Code)
+			assert.Equal(t, 1, rec.headerWrites)
+		})
+	}
+}
+
+func TestPathTraversalRejected(t *testing.T) {
+	fh := newTestHandler(t)
+	fileId := hash.Of([]byte("secret")).String()
+
+	tests := []string{
+		"/%2e%2e/" + testRepo + "/" + fileId,
+		"/" + testOrg + "/%2E%2E/" + fileId,
+		"/" + testOrg + "/" + testRepo + "/..",
+		"/" + testOrg + "/" + testRepo + "/a%5Cb",
+		"/" + testOrg + "/" + testRepo + "/a%00b",
+	}
+
+	for _, path := range tests {
+		t.Run(path, func(t *testing.T) {
+			rec := doRequest(fh, httptest.NewRequest(http.MethodGet, path, nil))
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+		})
+	}
+
+	t.Run("symlink escape", func(t *testing.T) {
+		outside := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(outside, fileId), []byte("secret"), os.ModePerm))
+		require.NoError(t, os.Symlink(outside, filepath.Join(testRoot(fh), testOrg, "escape")))
+
+		rec := doRequest(fh, httptest.NewRequest(http.MethodGet, fileUrl(testOrg, "escape", fileId), nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Empty(t, rec.Body.Bytes())
+
+		data := []byte("not so secret")
+		uploadId := expectUpload(t, data)
+		rec = doRequest(fh, httptest.NewRequest(http.MethodPost, fileUrl(testOrg, "escape", uploadId), bytes.NewReader(data)))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.NoFileExists(t, filepath.Join(outside, uploadId))
+	})
+}
+
+func largeBody(size int64) io.Reader {
+	return io.LimitReader(rand.New(rand.NewSource(1)), size)
+}
+
+func TestLargeUploadIsStreamed(t *testing.T) {
+	fh := newTestHandler(t)
+
+	const size = 64 * 1024 * 1024
+	md5Hash := md5.New()
+	_, err := io.Copy(md5Hash, largeBody(size))
+	require.NoError(t, err)
+
+	t.Run("valid", func(t *testing.T) {
+		fileId := expectUploadDetails(t, "large", size, md5Hash.Sum(nil))
+
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+
+		rec := doRequest(fh, httptest.NewRequest(http.MethodPost, fileUrl(testOrg, testRepo, fileId), largeBody(size)))
+
+		runtime.ReadMemStats(&after)
+		require.Equal(t, http.StatusCreated, rec.Code)
+		assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(size/4))
+
+		info, err := os.Stat(filepath.Join(testRoot(fh), testOrg, testRepo, fileId))
+		require.NoError(t, err)
+		assert.Equal(t, int64(size), info.Size())
+	})
+
+	t.Run("length mismatch", func(t *testing.T) {
+		fileId := expectUploadDetails(t, "large length mismatch", size+1, md5Hash.Sum(nil))
+		rec := doRequest(fh, httptest.NewRequest(http.MethodPost, fileUrl(testOrg, testRepo, fileId), largeBody(size)))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.NoFileExists(t, filepath.Join(testRoot(fh), testOrg, testRepo, fileId))
+	})
+
+	t.Run("hash mismatch", func(t *testing.T) {
+		fileId := expectUploadDetails(t, "large hash mismatch", size, make([]byte, md5.Size))
+		rec := doRequest(fh, httptest.NewRequest(http.MethodPost, fileUrl(testOrg, testRepo, fileId), largeBody(size)))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.NoFileExists(t, filepath.Join(testRoot(fh), testOrg, testRepo, fileId))
+	})
+}
+
+// limitedResponseWriter fails every write once |limit| bytes have been written.
+type limitedResponseWriter struct {
+	*httptest.ResponseRecorder
+	limit int
+}
+
+func (lw *limitedResponseWriter) Write(p []byte) (int, error) {
+	if len(p) > lw.limit {
+		n, _ := lw.ResponseRecorder.Write(p[:lw.limit])
+		lw.limit = 0
+		return n, errors.New("connection reset by peer")
+	}
+
+	lw.limit -= len(p)
+	return lw.ResponseRecorder.Write(p)
+}
+
+func TestReadFileCopyFailure(t *testing.T) {
+	fh := newTestHandler(t)
+	data := bytes.Repeat([]byte("0123456789"), 10*1024)
+	fileId := writeTestFile(t, fh, data)
+	url := fileUrl(testOrg, testRepo, fileId)
+
+	t.Run("nothing written", func(t *testing.T) {
+		// a directory can be opened, but fails on the first read
+		unreadableId := hash.Of([]byte("unreadable")).String()
+		require.NoError(t, os.Mkdir(filepath.Join(testRoot(fh), testOrg, testRepo, unreadableId), os.ModePerm))
+
+		rec := doRequest(fh, httptest.NewRequest(http.MethodGet, fileUrl(testOrg, testRepo, unreadableId), nil))
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.Empty(t, rec.Body.Bytes())
+	})
+
+	t.Run("partially written", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+			fh.ServeHTTP(&limitedResponseWriter{rec, 1000}, httptest.NewRequest(http.MethodGet, url, nil))
+		})
+		assert.Equal(t, data[:1000], rec.Body.Bytes())
+	})
+
+	t.Run("partially written gzip", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+			fh.ServeHTTP(&limitedResponseWriter{rec, 10}, req)
+		})
+	})
+
+	t.Run("partially written range", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+			fh.ServeHTTP(&limitedResponseWriter{rec, 1000}, rangeRequest(fileId, "bytes=0-49999"))
+		})
+	})
+}
+
+// cancellingBlobStore serves every blob as an endless stream of bytes, and calls cancel once cancelAfter reads have
+// been made from it.
+type cancellingBlobStore struct {
+	*memBlobStore
+	cancelAfter int
+	cancel      func()
+	reads       int
+}
+
+func (cs *cancellingBlobStore) Read(p []byte) (int, error) {
+	cs.reads++
+	if cs.reads == cs.cancelAfter {
+		cs.cancel()
+	}
+
+	return len(p), nil
+}
+
+func (cs *cancellingBlobStore) Get(ctx context.Context, org, repo, fileId string) (io.ReadCloser, int64, error) {
+	return io.NopCloser(cs), 1 << 40, nil
+}
+
+func (cs *cancellingBlobStore) GetRange(ctx context.Context, org, repo, fileId string, offset, length int64) (io.ReadCloser, error) {
+	return io.NopCloser(cs), nil
+}
+
+func (cs *cancellingBlobStore) Stat(ctx context.Context, org, repo, fileId string) (BlobInfo, error) {
+	return BlobInfo{Size: 1 << 40}, nil
+}
+
+func TestReadStopsWhenCancelled(t *testing.T) {
+	fileId := hash.Of([]byte("endless")).String()
+
+	tests := []struct {
+		name string
+		rng  string
+	}{
+		{"full", ""},
+		{"range", "bytes=0-1099511627775"},
+		{"multiple ranges", "bytes=0-9,10-1099511627775"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			store := &cancellingBlobStore{memBlobStore: newMemBlobStore(), cancelAfter: 5, cancel: cancel}
+			fh := newFileHandler(store)
+
+			req := httptest.NewRequest(http.MethodGet, fileUrl(testOrg, testRepo, fileId), nil).WithContext(ctx)
+			if test.rng != "" {
+				req.Header.Set("Range", test.rng)
+			}
+
+			start := time.Now()
+			assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+				fh.ServeHTTP(&discardResponseWriter{http.Header{}}, req)
+			})
+			assert.Less(t, time.Since(start), 5*time.Second)
+			assert.Equal(t, store.cancelAfter, store.reads, "the copy continued after the request was cancelled")
+		})
+	}
+}
+
+func TestInterruptedUploadIsNotVisible(t *testing.T) {
+	fh := newTestHandler(t)
+
+	data := []byte("a table file which will never be fully uploaded")
+	fileId := expectUpload(t, data)
+	repoDir := filepath.Join(testRoot(fh), testOrg, testRepo)
+
+	pr, pw := io.Pipe()
+	done := make(chan int)
+	go func() {
+		rec := doRequest(fh, httptest.NewRequest(http.MethodPost, fileUrl(testOrg, testRepo, fileId), pr))
+		done <- rec.Code
+	}()
+
+	_, err := pw.Write(data[:len(data)/2])
+	require.NoError(t, err)
+
+	// half of the body has been consumed, but readers should not see anything yet
+	rec := doRequest(fh, httptest.NewRequest(http.MethodGet, fileUrl(testOrg, testRepo, fileId), nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	require.NoError(t, pw.CloseWithError(errors.New("connection reset")))
+	assert.Equal(t, http.StatusInternalServerError, <-done)
+
+	rec = doRequest(fh, httptest.NewRequest(http.MethodGet, fileUrl(testOrg, testRepo, fileId), nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	entries, err := os.ReadDir(repoDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "temp file was not cleaned up")
+}
+
+// slowReader reads one byte of |rd| at a time, waiting |delay| before each read.
+type slowReader struct {
+	rd    io.Reader
+	delay time.Duration
+}
+
+func (sr *slowReader) Read(p []byte) (int, error) {
+	time.Sleep(sr.delay)
+
+	if len(p) > 1 {
+		p = p[:1]
+	}
+
+	return sr.rd.Read(p)
+}
+
+func TestUploadTimeout(t *testing.T) {
+	fh := newTestHandler(t)
+	fh.uploadTimeout = 50 * time.Millisecond
+
+	t.Run("slow body", func(t *testing.T) {
+		data := []byte("a table file which is uploaded too slowly")
+		fileId := expectUpload(t, data)
+		body := &slowReader{bytes.NewReader(data), 10 * time.Millisecond}
+
+		rec := doRequest(fh, httptest.NewRequest(http.MethodPost, fileUrl(testOrg, testRepo, fileId), body))
+		assert.Equal(t, http.StatusRequestTimeout, rec.Code)
+		assert.Equal(t, "close", rec.Header().Get("Connection"))
+		assert.NoFileExists(t, filepath.Join(testRoot(fh), testOrg, testRepo, fileId))
+	})
+
+	t.Run("fast body", func(t *testing.T) {
+		data := []byte("a table file which is uploaded in time")
+		fileId := expectUpload(t, data)
+
+		rec := doRequest(fh, httptest.NewRequest(http.MethodPost, fileUrl(testOrg, testRepo, fileId), bytes.NewReader(data)))
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.FileExists(t, filepath.Join(testRoot(fh), testOrg, testRepo, fileId))
+	})
+}
+
+// writeTestFile writes |data| directly to storage and returns its file id.
+func writeTestFile(t *testing.T, fh *fileHandler, data []byte) string {
+	fileId := hash.Of(data).String()
+	require.NoError(t, os.WriteFile(filepath.Join(testRoot(fh), testOrg, testRepo, fileId), data, os.ModePerm))
+	return fileId
+}
+
+func rangeRequest(fileId, rng string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, fileUrl(testOrg, testRepo, fileId), nil)
+	req.Header.Set("Range", rng)
+	return req
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		name   string
+		rngStr string
+		ranges []byteRange
+	}{
+		{"simple", "bytes=0-99", []byteRange{{0, 100}}},
+		{"single byte", "bytes=5-5", []byteRange{{5, 1}}},
+		{"capitalized unit", "Bytes=0-99", []byteRange{{0, 100}}},
+		{"upper case unit", "BYTES=10-19", []byteRange{{10, 10}}},
+		{"surrounding whitespace", "  bytes=0-99\t", []byteRange{{0, 100}}},
+		{"whitespace around equals", "bytes = 0-99", []byteRange{{0, 100}}},
+		{"whitespace around numbers", "bytes= 0 - 99 ", []byteRange{{0, 100}}},
+		{"multiple ranges", "bytes=0-9, 20-29", []byteRange{{0, 10}, {20, 10}}},
+		{"multiple ranges mixed case", "bYtEs=0-9,20-29", []byteRange{{0, 10}, {20, 10}}},
+		{"wrong unit", "items=0-99", nil},
+		{"unit prefix only", "bytesx=0-99", nil},
+		{"missing equals", "bytes 0-99", nil},
+		{"missing unit", "=0-99", nil},
+		{"open ended", "bytes=10-", []byteRange{{10, toEndOfFile}}},
+		{"open ended with whitespace", "bytes=10 - ", []byteRange{{10, toEndOfFile}}},
+		{"open ended in list", "bytes=0-9,20-", []byteRange{{0, 10}, {20, toEndOfFile}}},
+		{"suffix range", "bytes=-99", nil},
+		{"not a number", "bytes=a-b", nil},
+		{"negative", "bytes=-1-5", nil},
+		{"end before start", "bytes=10-5", nil},
+		{"empty range in list", "bytes=0-9,,20-29", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ranges, err := byteRangesFromRange(test.rngStr)
+
+			if test.ranges == nil {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.ranges, ranges)
+
+			if len(test.ranges) == 1 {
+				offset, length, err := offsetAndLenFromRange(test.rngStr)
+				require.NoError(t, err)
+				assert.Equal(t, test.ranges[0], byteRange{offset, length})
+			}
+		})
+	}
+}
+
+func TestRangeAtEndOfFile(t *testing.T) {
+	fh := newTestHandler(t)
+	fileId := writeTestFile(t, fh, []byte("0123456789"))
+
+	tests := []struct {
+		rng          string
+		status       int
+		body         string
+		contentRange string
+	}{
+		{"bytes=9-9", http.StatusPartialContent, "9", "bytes 9-9/10"},
+		{"bytes=5-9", http.StatusPartialContent, "56789", "bytes 5-9/10"},
+		{"bytes=0-9", http.StatusPartialContent, "0123456789", "bytes 0-9/10"},
+		{"bytes=5-10", http.StatusRequestedRangeNotSatisfiable, "", "bytes */10"},
+		{"bytes=9-10", http.StatusRequestedRangeNotSatisfiable, "", "bytes */10"},
+		{"bytes=10-10", http.StatusRequestedRangeNotSatisfiable, "", "bytes */10"},
+		{"bytes=0-0,9-10", http.StatusRequestedRangeNotSatisfiable, "", "bytes */10"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.rng, func(t *testing.T) {
+			rec := doRequest(fh, rangeRequest(fileId, test.rng))
+			require.Equal(t, test.status, rec.Code)
+			assert.Equal(t, test.contentRange, rec.Header().Get("Content-Range"))
+			assert.Equal(t, test.body, rec.Body.String())
+		})
+	}
+
+	rec := doRequest(fh, rangeRequest(fileId, "bytes=0-0,9-9"))
+	require.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Content-Range: bytes 9-9/10")
+}
+
+func TestOpenEndedRange(t *testing.T) {
+	fh := newTestHandler(t)
+	fileId := writeTestFile(t, fh, []byte("0123456789"))
+
+	tests := []struct {
+		name         string
+		maxSize      int64
+		rng          string
+		status       int
+		body         string
+		contentRange string
+	}{
+		{"no limit", 0, "bytes=3-", http.StatusPartialContent, "3456789", "bytes 3-9/10"},
+		{"under the limit", 8, "bytes=3-", http.StatusPartialContent, "3456789", "bytes 3-9/10"},
+		{"at the limit", 7, "bytes=3-", http.StatusPartialContent, "3456789", "bytes 3-9/10"},
+		{"over the limit", 4, "bytes=3-", http.StatusPartialContent, "3456", "bytes 3-6/10"},
+		{"whole file over the limit", 4, "bytes=0-", http.StatusPartialContent, "0123", "bytes 0-3/10"},
+		{"last byte", 4, "bytes=9-", http.StatusPartialContent, "9", "bytes 9-9/10"},
+		{"closed range over the limit", 4, "bytes=0-9", http.StatusPartialContent, "0123456789", "bytes 0-9/10"},
+		{"at the end", 4, "bytes=10-", http.StatusRequestedRangeNotSatisfiable, "", "bytes */10"},
+		{"past the end", 4, "bytes=20-", http.StatusRequestedRangeNotSatisfiable, "", "bytes */10"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fh.maxOpenRangeSize = test.maxSize
+			rec := doRequest(fh, rangeRequest(fileId, test.rng))
+			require.Equal(t, test.status, rec.Code)
+			assert.Equal(t, test.contentRange, rec.Header().Get("Content-Range"))
+			assert.Equal(t, test.body, rec.Body.String())
+
+			if test.status == http.StatusPartialContent {
+				assert.Equal(t, fmt.Sprint(len(test.body)), rec.Header().Get("Content-Length"))
+			}
+		})
+	}
+
+	t.Run("multiple ranges", func(t *testing.T) {
+		fh.maxOpenRangeSize = 2
+		rec := doRequest(fh, rangeRequest(fileId, "bytes=0-0,5-"))
+		require.Equal(t, http.StatusPartialContent, rec.Code)
+		assert.Contains(t, rec.Body.String(), "Content-Range: bytes 5-6/10")
+		// the random boundary may contain any digits, so the data is matched along with the line breaks around it
+		assert.Contains(t, rec.Body.String(), "\r\n\r\n56\r\n--")
+	})
+}
+
+func TestRangeHeaderVariations(t *testing.T) {
+	fh := newTestHandler(t)
+	fileId := writeTestFile(t, fh, []byte("0123456789"))
+
+	rec := doRequest(fh, rangeRequest(fileId, " Bytes = 2-5 "))
+	require.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Equal(t, "2345", rec.Body.String())
+
+	rec = doRequest(fh, rangeRequest(fileId, "BYTES=0-1, 8-9"))
+	require.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Contains(t, rec.Body.String(), "01")
+	assert.Contains(t, rec.Body.String(), "89")
+
+	rec = doRequest(fh, rangeRequest(fileId, "bytes=5-2"))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestRangeNotSatisfiable(t *testing.T) {
+	fh := newTestHandler(t)
+	fileId := writeTestFile(t, fh, []byte("0123456789"))
+
+	for _, rng := range []string{"bytes=10-19", "bytes=100-199"} {
+		t.Run(rng, func(t *testing.T) {
+			rec := doRequest(fh, rangeRequest(fileId, rng))
+			assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, rec.Code)
+			assert.Equal(t, "bytes */10", rec.Header().Get("Content-Range"))
+			assert.Empty(t, rec.Body.Bytes())
+		})
+	}
+}
+
+func TestRangeResponseHeaders(t *testing.T) {
+	fh := newTestHandler(t)
+	fileId := writeTestFile(t, fh, []byte("0123456789"))
+
+	rec := doRequest(fh, rangeRequest(fileId, "bytes=2-5"))
+	assert.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Equal(t, "bytes", rec.Header().Get("Accept-Ranges"))
+	assert.Equal(t, "bytes 2-5/10", rec.Header().Get("Content-Range"))
+	assert.Equal(t, "4", rec.Header().Get("Content-Length"))
+	assert.Equal(t, "2345", rec.Body.String())
+
+	rec = doRequest(fh, httptest.NewRequest(http.MethodGet, fileUrl(testOrg, testRepo, fileId), nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "bytes", rec.Header().Get("Accept-Ranges"))
+	assert.Empty(t, rec.Header().Get("Content-Range"))
+	assert.Equal(t, "0123456789", rec.Body.String())
+}
+
+func TestMultiRangeRequest(t *testing.T) {
+	fh := newTestHandler(t)
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	fileId := writeTestFile(t, fh, data)
+
+	rec := doRequest(fh, rangeRequest(fileId, "bytes=0-99,500-599"))
+	require.Equal(t, http.StatusPartialContent, rec.Code)
+
+	mediaType, params, err := mime.ParseMediaType(rec.Header().Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/byteranges", mediaType)
+
+	expected := []struct {
+		contentRange string
+		data         []byte
+	}{
+		{"bytes 0-99/1000", data[0:100]},
+		{"bytes 500-599/1000", data[500:600]},
+	}
+
+	mpRd := multipart.NewReader(rec.Body, params["boundary"])
+	for _, exp := range expected {
+		part, err := mpRd.NextPart()
+		require.NoError(t, err)
+		assert.Equal(t, exp.contentRange, part.Header.Get("Content-Range"))
+
+		partData, err := io.ReadAll(part)
+		require.NoError(t, err)
+		assert.Equal(t, exp.data, partData)
+	}
+
+	_, err = mpRd.NextPart()
+	assert.Equal(t, io.EOF, err)
+}
+
+// discardResponseWriter is an http.ResponseWriter which throws away everything written to it.
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (d *discardResponseWriter) Header() http.Header {
+	return d.header
+}
+
+func (d *discardResponseWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (d *discardResponseWriter) WriteHeader(int) {}
+
+func BenchmarkLargeRangeRead(b *testing.B) {
+	const size = 32 * 1024 * 1024
+	dir := b.TempDir()
+	require.NoError(b, os.MkdirAll(filepath.Join(dir, testOrg, testRepo), os.ModePerm))
+	store, err := newFileStore(dir)
+	require.NoError(b, err)
+	fh := newFileHandler(store)
+	fh.jsonLog = log.New(io.Discard, "", 0)
+
+	data, err := io.ReadAll(largeBody(size))
+	require.NoError(b, err)
+	fileId := hash.Of(data).String()
+	require.NoError(b, os.WriteFile(filepath.Join(dir, testOrg, testRepo, fileId), data, os.ModePerm))
+
+	req := rangeRequest(fileId, fmt.Sprintf("bytes=%d-%d", size/4, size-1))
+	b.SetBytes(size - size/4)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		fh.ServeHTTP(&discardResponseWriter{header: make(http.Header)}, req)
+	}
+}
+
+func TestHeadRequest(t *testing.T) {
+	fh := newTestHandler(t)
+	fileId := writeTestFile(t, fh, []byte("0123456789"))
+
+	rec := doRequest(fh, httptest.NewRequest(http.MethodHead, fileUrl(testOrg, testRepo, fileId), nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "10", rec.Header().Get("Content-Length"))
+	assert.Equal(t, "bytes", rec.Header().Get("Accept-Ranges"))
+	assert.Equal(t, `"`+fileId+`"`, rec.Header().Get("ETag"))
+	assert.Equal(t, "application/octet-stream", rec.Header().Get("Content-Type"))
+	assert.Empty(t, rec.Body.Bytes())
+
+	missingId := hash.Of([]byte("missing")).String()
+	rec = doRequest(fh, httptest.NewRequest(http.MethodHead, fileUrl(testOrg, testRepo, missingId), nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestContentType(t *testing.T) {
+	fh := newTestHandler(t)
+	fileId := writeTestFile(t, fh, []byte("0123456789"))
+
+	rec := doRequest(fh, httptest.NewRequest(http.MethodGet, fileUrl(testOrg, testRepo, fileId), nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/octet-stream", rec.Header().Get("Content-Type"))
+
+	rec = doRequest(fh, rangeRequest(fileId, "bytes=2-5"))
+	require.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Equal(t, "application/octet-stream", rec.Header().Get("Content-Type"))
+
+	fh.contentType = "application/vnd.dolthub.table-file"
+	rec = doRequest(fh, httptest.NewRequest(http.MethodGet, fileUrl(testOrg, testRepo, fileId), nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/vnd.dolthub.table-file", rec.Header().Get("Content-Type"))
+
+	// multiple range responses are multipart, with the configured type on each part
+	rec = doRequest(fh, rangeRequest(fileId, "bytes=0-1,4-5"))
+	require.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.True(t, strings.HasPrefix(rec.Header().Get("Content-Type"), "multipart/byteranges"))
+	assert.Equal(t, 2, strings.Count(rec.Body.String(), "Content-Type: application/vnd.dolthub.table-file"))
+}
+
+func TestIfRange(t *testing.T) {
+	fh := newTestHandler(t)
+	fileId := writeTestFile(t, fh, []byte("0123456789"))
+	otherId := hash.Of([]byte("other")).String()
+	modTime := time.Date(2021, time.March, 4, 5, 6, 7, 0, time.UTC)
+	require.NoError(t, os.Chtimes(filepath.Join(testRoot(fh), testOrg, testRepo, fileId), modTime, modTime))
+
+	tests := []struct {
+		name         string
+		ifRange      string
+		expected     int
+		expectedBody string
+	}{
+		{"no validator", "", http.StatusPartialContent, "2345"},
+		{"matching etag", `"` + fileId + `"`, http.StatusPartialContent, "2345"},
+		{"changed file", `"` + otherId + `"`, http.StatusOK, "0123456789"},
+		{"weak etag", `W/"` + fileId + `"`, http.StatusOK, "0123456789"},
+		{"matching date", modTime.Format(http.TimeFormat), http.StatusPartialContent, "2345"},
+		{"other date", "Wed, 21 Oct 2015 07:28:00 GMT", http.StatusOK, "0123456789"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := rangeRequest(fileId, "bytes=2-5")
+			if test.ifRange != "" {
+				req.Header.Set("If-Range", test.ifRange)
+			}
+
+			rec := doRequest(fh, req)
+			assert.Equal(t, test.expected, rec.Code)
+			assert.Equal(t, test.expectedBody, rec.Body.String())
+
+			if test.expected == http.StatusOK {
+				assert.Empty(t, rec.Header().Get("Content-Range"))
+			}
+		})
+	}
+}
+
+func TestIfNoneMatch(t *testing.T) {
+	fh := newTestHandler(t)
+	fileId := writeTestFile(t, fh, []byte("0123456789"))
+	otherId := hash.Of([]byte("other")).String()
+
+	tests := []struct {
+		name        string
+		method      string
+		ifNoneMatch string
+		expected    int
+	}{
+		{"get matching", http.MethodGet, `"` + fileId + `"`, http.StatusNotModified},
+		{"get matching in list", http.MethodGet, `"` + otherId + `", "` + fileId + `"`, http.StatusNotModified},
+		{"get non-matching", http.MethodGet, `"` + otherId + `"`, http.StatusOK},
+		{"get weak matching", http.MethodGet, `W/"` + fileId + `"`, http.StatusNotModified},
+		{"get wildcard", http.MethodGet, "*", http.StatusNotModified},
+		{"head matching", http.MethodHead, `"` + fileId + `"`, http.StatusNotModified},
+		{"head non-matching", http.MethodHead, `"` + otherId + `"`, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, fileUrl(testOrg, testRepo, fileId), nil)
+			req.Header.Set("If-None-Match", test.ifNoneMatch)
+			rec := doRequest(fh, req)
+
+			assert.Equal(t, test.expected, rec.Code)
+			assert.Equal(t, `"`+fileId+`"`, rec.Header().Get("ETag"))
+
+			if test.expected == http.StatusNotModified || test.method == http.MethodHead {
+				assert.Empty(t, rec.Body.Bytes())
+			} else {
+				assert.Equal(t, "0123456789", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestIfModifiedSince(t *testing.T) {
+	fh := newTestHandler(t)
+	fileId := writeTestFile(t, fh, []byte("0123456789"))
+	otherId := hash.Of([]byte("other")).String()
+	modTime := time.Date(2021, time.March, 4, 5, 6, 7, 0, time.UTC)
+	require.NoError(t, os.Chtimes(filepath.Join(testRoot(fh), testOrg, testRepo, fileId), modTime, modTime))
+
+	tests := []struct {
+		name            string
+		method          string
+		ifModifiedSince string
+		ifNoneMatch     string
+		expected        int
+	}{
+		{"fresh", http.MethodGet, modTime.Format(http.TimeFormat), "", http.StatusNotModified},
+		{"fresh later date", http.MethodGet, modTime.Add(time.Hour).Format(http.TimeFormat), "", http.StatusNotModified},
+		{"stale", http.MethodGet, modTime.Add(-time.Second).Format(http.TimeFormat), "", http.StatusOK},
+		{"invalid date", http.MethodGet, "yesterday", "", http.StatusOK},
+		{"head fresh", http.MethodHead, modTime.Format(http.TimeFormat), "", http.StatusNotModified},
+		{"head stale", http.MethodHead, modTime.Add(-time.Hour).Format(http.TimeFormat), "", http.StatusOK},
+		{"etag takes precedence", http.MethodGet, modTime.Format(http.TimeFormat), `"` + otherId + `"`, http.StatusOK},
+		{"stale with matching etag", http.MethodGet, modTime.Add(-time.Hour).Format(http.TimeFormat), `"` + fileId + `"`, http.StatusNotModified},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, fileUrl(testOrg, testRepo, fileId), nil)
+			req.Header.Set("If-Modified-Since", test.ifModifiedSince)
+			if test.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", test.ifNoneMatch)
+			}
+
+			rec := doRequest(fh, req)
+			assert.Equal(t, test.expected, rec.Code)
+			assert.Equal(t, modTime.Format(http.TimeFormat), rec.Header().Get("Last-Modified"))
+
+			if test.expected == http.StatusNotModified || test.method == http.MethodHead {
+				assert.Empty(t, rec.Body.Bytes())
+			} else {
+				assert.Equal(t, "0123456789", rec.Body.String())
+			}
+		})
+	}
+}
+
+// unreadBody records whether it was read.
+type unreadBody struct {
+	rd   io.Reader
+	read bool
+}
+
+func (ub *unreadBody) Read(p []byte) (int, error) {
+	ub.read = true
+	return ub.rd.Read(p)
+}
+
+func TestConditionalUpload(t *testing.T) {
+	fh := newTestHandler(t)
+	data := []byte("a table file which is only uploaded once")
+	fileId := expectUpload(t, data)
+	url := fileUrl(testOrg, testRepo, fileId)
+
+	// the precondition holds when the file doesn't exist yet
+	req := httptest.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	req.Header.Set("If-None-Match", "*")
+	rec := doRequest(fh, req)
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	for _, method := range []string{http.MethodPost, http.MethodPut} {
+		for _, ifNoneMatch := range []string{"*", `"` + fileId + `"`} {
+			t.Run(method+" "+ifNoneMatch, func(t *testing.T) {
+				body := &unreadBody{rd: bytes.NewReader(data)}
+				req := httptest.NewRequest(method, url, body)
+				req.Header.Set("If-None-Match", ifNoneMatch)
+				rec := doRequest(fh, req)
+
+				assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+				assert.Equal(t, `"`+fileId+`"`, rec.Header().Get("ETag"))
+				assert.False(t, body.read, "the body of a skipped upload was read")
+			})
+		}
+	}
+
+	// without the precondition the file is replaced
+	body := &unreadBody{rd: bytes.NewReader(data)}
+	rec = doRequest(fh, httptest.NewRequest(http.MethodPut, url, body))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, body.read)
+}
+
+// countingBlobStore counts the Puts made to it.
+type countingBlobStore struct {
+	*memBlobStore
+	puts int
+}
+
+func (bs *countingBlobStore) Put(ctx context.Context, org, repo, fileId string, rd io.Reader, validate func(io.ReadSeeker) error) error {
+	bs.puts++
+	return bs.memBlobStore.Put(ctx, org, repo, fileId, rd, validate)
+}
+
+func TestRetriedUpload(t *testing.T) {
+	store := &countingBlobStore{memBlobStore: newMemBlobStore()}
+	fh := newFileHandler(store)
+	fh.verifyFileIds = false
+	data := []byte("a table file which is uploaded again after a network hiccup")
+	fileId := expectUpload(t, data)
+	url := fileUrl(testOrg, testRepo, fileId)
+
+	retry := func(body io.Reader) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, url, body)
+		req.Header.Set("Expect", "100-continue")
+		return doRequest(fh, req)
+	}
+
+	// the first attempt has nothing to skip
+	rec := retry(bytes.NewReader(data))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Equal(t, 1, store.puts)
+
+	// a retry of the same upload is complete without its body
+	body := &unreadBody{rd: bytes.NewReader(data)}
+	rec = retry(body)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"`+fileId+`"`, rec.Header().Get("ETag"))
+	assert.False(t, body.read, "the body of a retried upload was read")
+	assert.Equal(t, 1, store.puts, "a retried upload was written again")
+
+	// without the Expect header the client is already sending the body, so the file is replaced
+	body = &unreadBody{rd: bytes.NewReader(data)}
+	rec = doRequest(fh, httptest.NewRequest(http.MethodPost, url, body))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, body.read)
+	assert.Equal(t, 2, store.puts)
+}
+
+func TestDelete(t *testing.T) {
+	fh := newTestHandler(t)
+
+	data := []byte("a table file which will be deleted")
+	fileId := expectUpload(t, data)
+	url := fileUrl(testOrg, testRepo, fileId)
+
+	rec := doRequest(fh, httptest.NewRequest(http.MethodPost, url, bytes.NewReader(data)))
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	rec = doRequest(fh, httptest.NewRequest(http.MethodDelete, url, nil))
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = doRequest(fh, httptest.NewRequest(http.MethodGet, url, nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = doRequest(fh, httptest.NewRequest(http.MethodDelete, url, nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = doRequest(fh, httptest.NewRequest(http.MethodDelete, fileUrl(testOrg, testRepo, "not-a-hash"), nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	outside := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(outside, fileId), data, os.ModePerm))
+	require.NoError(t, os.Symlink(outside, filepath.Join(testRoot(fh), testOrg, "escape")))
+	rec = doRequest(fh, httptest.NewRequest(http.MethodDelete, fileUrl(testOrg, "escape", fileId), nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.FileExists(t, filepath.Join(outside, fileId))
+}
+
+func TestFileStorePaths(t *testing.T) {
+	dir := t.TempDir()
+	store, err := newFileStore(dir)
+	require.NoError(t, err)
+
+	resolved, err := filepath.EvalSymlinks(dir)
+	require.NoError(t, err)
+
+	path, err := store.path(testOrg, testRepo, "file")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(resolved, testOrg, testRepo, "file"), path)
+
+	_, err = newFileStore(filepath.Join(dir, "does_not_exist"))
+	assert.Error(t, err)
+}
+
+func TestUploadToNewRepo(t *testing.T) {
+	fh := newTestHandler(t)
+
+	data := []byte("the first table file of a new repo")
+	fileId := expectUpload(t, data)
+	url := fileUrl("neworg", "newrepo", fileId)
+	require.NoDirExists(t, filepath.Join(testRoot(fh), "neworg"))
+
+	rec := doRequest(fh, httptest.NewRequest(http.MethodPost, url, bytes.NewReader(data)))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	assert.FileExists(t, filepath.Join(testRoot(fh), "neworg", "newrepo", fileId))
+
+	rec = doRequest(fh, httptest.NewRequest(http.MethodGet, url, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, data, rec.Body.Bytes())
+}
+
+func TestShardedFileStore(t *testing.T) {
+	fh := newTestHandler(t)
+	fh.store.(*fileStore).shardDepth = 2
+
+	data := []byte("a table file stored in a sharded layout")
+	fileId := expectUpload(t, data)
+
+	rec := doRequest(fh, httptest.NewRequest(http.MethodPost, fileUrl(testOrg, testRepo, fileId), bytes.NewReader(data)))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	assert.FileExists(t, filepath.Join(testRoot(fh), testOrg, testRepo, fileId[0:2], fileId[2:4], fileId))
+	assert.NoFileExists(t, filepath.Join(testRoot(fh), testOrg, testRepo, fileId))
+
+	rec = doRequest(fh, httptest.NewRequest(http.MethodGet, fileUrl(testOrg, testRepo, fileId), nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, data, rec.Body.Bytes())
+
+	rec = doRequest(fh, rangeRequest(fileId, "bytes=2-6"))
+	assert.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Equal(t, data[2:7], rec.Body.Bytes())
+
+	rec = doRequest(fh, httptest.NewRequest(http.MethodHead, fileUrl(testOrg, testRepo, fileId), nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, fmt.Sprint(len(data)), rec.Header().Get("Content-Length"))
+}
+
+func TestFileStorePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("windows does not support unix file permissions")
+	}
+
+	ctx := context.Background()
+	store, err := newFileStore(t.TempDir())
+	require.NoError(t, err)
+	store.shardDepth = 1
+
+	data := []byte("a table file which other users may read")
+	fileId := hash.Of(data).String()
+	require.NoError(t, store.Put(ctx, testOrg, testRepo, fileId, bytes.NewReader(data), nil))
+
+	path, err := store.path(testOrg, testRepo, fileId)
+	require.NoError(t, err)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+
+	// directories are subject to the umask, but are never writable by other users
+	info, err = os.Stat(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Zero(t, info.Mode().Perm()&0022, "directory mode %v", info.Mode().Perm())
+
+	store.fileMode = 0600
+	data = []byte("a table file only its owner may read")
+	fileId = hash.Of(data).String()
+	require.NoError(t, store.Put(ctx, testOrg, testRepo, fileId, bytes.NewReader(data), nil))
+
+	path, err = store.path(testOrg, testRepo, fileId)
+	require.NoError(t, err)
+	info, err = os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestFileStoreSync(t *testing.T) {
+	ctx := context.Background()
+	store, err := newFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	var synced []string
+	var syncErr error
+	store.syncer = func(f *os.File) error {
+		synced = append(synced, f.Name())
+		return syncErr
+	}
+
+	data := []byte("a table file which must survive a power loss")
+	fileId := hash.Of(data).String()
+	require.NoError(t, store.Put(ctx, testOrg, testRepo, fileId, bytes.NewReader(data), nil))
+
+	path, err := store.path(testOrg, testRepo, fileId)
+	require.NoError(t, err)
+
+	// the temp files of the file and its checksum are flushed before they are renamed into place, and then the
+	// directory holding the renamed files
+	tmpPrefixes := []string{path + "-", path + checksumExt + "-"}
+	expectedLen := len(tmpPrefixes)
+	if runtime.GOOS != "windows" {
+		expectedLen++
+	}
+
+	require.Len(t, synced, expectedLen)
+	for i, prefix := range tmpPrefixes {
+		assert.True(t, strings.HasPrefix(synced[i], prefix), synced[i])
+		assert.True(t, strings.HasSuffix(synced[i], ".tmp"), synced[i])
+	}
+
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, filepath.Dir(path), synced[2])
+	}
+
+	// an upload which can't be flushed fails, and nothing is stored
+	syncErr = errors.New("disk on fire")
+	data = []byte("a table file which can't be flushed")
+	fileId = hash.Of(data).String()
+	err = store.Put(ctx, testOrg, testRepo, fileId, bytes.NewReader(data), nil)
+	assert.Equal(t, syncErr, err)
+	_, err = store.Stat(ctx, testOrg, testRepo, fileId)
+	assert.Equal(t, errBlobNotFound, err)
+
+	matches, err := filepath.Glob(filepath.Join(filepath.Dir(path), "*.tmp"))
+	require.NoError(t, err)
+	assert.Empty(t, matches)
+}
+
+func TestShardDirs(t *testing.T) {
+	assert.Empty(t, shardDirs("abcdef", 0))
+	assert.Equal(t, []string{"ab"}, shardDirs("abcdef", 1))
+	assert.Equal(t, []string{"ab", "cd"}, shardDirs("abcdef", 2))
+	assert.Equal(t, []string{"ab", "cd"}, shardDirs("abcdef", 4))
+	assert.Empty(t, shardDirs("ab", 2))
+}
+
+func TestVerifyReads(t *testing.T) {
+	fh := newTestHandler(t)
+	fh.verifyReads = true
+
+	data := []byte("a table file which will be corrupted")
+	fileId := expectUpload(t, data)
+	url := fileUrl(testOrg, testRepo, fileId)
+
+	rec := doRequest(fh, httptest.NewRequest(http.MethodPost, url, bytes.NewReader(data)))
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	rec = doRequest(fh, httptest.NewRequest(http.MethodGet, url, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, data, rec.Body.Bytes())
+
+	corrupted := append([]byte{}, data...)
+	corrupted[0] ^= 0xff
+	require.NoError(t, os.WriteFile(filepath.Join(testRoot(fh), testOrg, testRepo, fileId), corrupted, os.ModePerm))
+
+	rec = doRequest(fh, httptest.NewRequest(http.MethodGet, url, nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Empty(t, rec.Body.Bytes())
+
+	rec = doRequest(fh, rangeRequest(fileId, "bytes=0-3"))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
+
+func TestChecksumSidecar(t *testing.T) {
+	fh := newTestHandler(t)
+	fh.store.(*fileStore).shardDepth = 1
+	data := []byte("a table file whose checksum is recorded")
+	fileId := expectUpload(t, data)
+	url := fileUrl(testOrg, testRepo, fileId)
+
+	rec := doRequest(fh, httptest.NewRequest(http.MethodPost, url, bytes.NewReader(data)))
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	store := fh.store.(*fileStore)
+	path, err := store.path(testOrg, testRepo, fileId)
+	require.NoError(t, err)
+
+	// the sidecar is stored alongside the file, and holds the md5 of its contents
+	md5Hash := md5.Sum(data)
+	sidecar, err := os.ReadFile(path + checksumExt)
+	require.NoError(t, err)
+	assert.Equal(t, hex.EncodeToString(md5Hash[:])+"\n", string(sidecar))
+
+	sum, err := store.Checksum(context.Background(), testOrg, testRepo, fileId)
+	require.NoError(t, err)
+	assert.Equal(t, md5Hash[:], sum)
+
+	// sidecars aren't table files, so they aren't listed
+	listing, err := store.List(context.Background(), testOrg, testRepo, "", maxListLimit)
+	require.NoError(t, err)
+	assert.Equal(t, []BlobListing{{FileId: fileId, Size: int64(len(data))}}, listing)
+
+	rec = doRequest(fh, httptest.NewRequest(http.MethodDelete, url, nil))
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	assert.NoFileExists(t, path)
+	assert.NoFileExists(t, path+checksumExt)
+
+	sum, err = store.Checksum(context.Background(), testOrg, testRepo, fileId)
+	require.NoError(t, err)
+	assert.Nil(t, sum)
+}
+
+func TestVerifyReadsWithSidecar(t *testing.T) {
+	fh := newTestHandler(t)
+	fh.verifyReads = true
+
+	data := []byte("a table file which is corrupted after its registration expires")
+	fileId := expectUpload(t, data)
+	url := fileUrl(testOrg, testRepo, fileId)
+
+	rec := doRequest(fh, httptest.NewRequest(http.MethodPost, url, bytes.NewReader(data)))
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	// the checksum the upload was registered with is gone, so only the sidecar remains to verify against
+	deleteExpectedFile(fileId)
+
+	rec = doRequest(fh, httptest.NewRequest(http.MethodGet, url, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, data, rec.Body.Bytes())
+
+	corrupted := append([]byte{}, data...)
+	corrupted[0] ^= 0xff
+	require.NoError(t, os.WriteFile(filepath.Join(testRoot(fh), testOrg, testRepo, fileId), corrupted, os.ModePerm))
+
+	rec = doRequest(fh, httptest.NewRequest(http.MethodGet, url, nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+
+	// files stored without a sidecar are served unverified
+	require.NoError(t, os.Remove(filepath.Join(testRoot(fh), testOrg, testRepo, fileId+checksumExt)))
+	rec = doRequest(fh, httptest.NewRequest(http.MethodGet, url, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, corrupted, rec.Body.Bytes())
+}
+
+func TestUploadContentHashAlgorithms(t *testing.T) {
+	fh := newTestHandler(t)
+	data := []byte("a table file with a strong content hash")
+	md5Hash := md5.Sum(data)
+	sha512Hash := sha512.Sum512(data)
+
+	tests := []struct {
+		name        string
+		contentHash []byte
+		expected    int
+	}{
+		{"md5", md5Hash[:], http.StatusCreated},
+		{"md5 mismatch", make([]byte, md5.Size), http.StatusBadRequest},
+		{"sha512", sha512Hash[:], http.StatusCreated},
+		{"sha512 mismatch", make([]byte, sha512.Size), http.StatusBadRequest},
+		{"unsupported", make([]byte, 20), http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fileId := expectUploadDetails(t, test.name, uint64(len(data)), test.contentHash)
+			rec := doRequest(fh, httptest.NewRequest(http.MethodPost, fileUrl(testOrg, testRepo, fileId), bytes.NewReader(data)))
+			assert.Equal(t, test.expected, rec.Code)
+		})
+	}
+}
+
+func TestUploadReceivedHeaders(t *testing.T) {
+	fh := newTestHandler(t)
+	data := []byte("a table file whose receipt is confirmed")
+	md5Hash := md5.Sum(data)
+	sha512Hash := sha512.Sum512(data)
+
+	tests := []struct {
+		name        string
+		contentHash []byte
+		header      string
+		notHeader   string
+	}{
+		{"md5", md5Hash[:], contentMD5Header, contentSHA512Header},
+		{"sha512", sha512Hash[:], contentSHA512Header, contentMD5Header},
+		{"no content hash", nil, contentMD5Header, contentSHA512Header},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fileId := expectUploadDetails(t, "received "+test.name, uint64(len(data)), test.contentHash)
+			rec := doRequest(fh, httptest.NewRequest(http.MethodPost, fileUrl(testOrg, testRepo, fileId), bytes.NewReader(data)))
+			require.Equal(t, http.StatusCreated, rec.Code)
+
+			expectedHash := test.contentHash
+			if expectedHash == nil {
+				expectedHash = md5Hash[:]
+			}
+
+			assert.Equal(t, fmt.Sprint(len(data)), rec.Header().Get(receivedBytesHeader))
+			assert.Equal(t, hex.EncodeToString(expectedHash), rec.Header().Get(test.header))
+			assert.Empty(t, rec.Header().Get(test.notHeader))
+		})
+	}
+
+	// failed uploads don't report what was received in headers
+	fileId := expectUploadDetails(t, "received mismatch", uint64(len(data)), make([]byte, md5.Size))
+	rec := doRequest(fh, httptest.NewRequest(http.MethodPost, fileUrl(testOrg, testRepo, fileId), bytes.NewReader(data)))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Empty(t, rec.Header().Get(receivedBytesHeader))
+	assert.Empty(t, rec.Header().Get(contentMD5Header))
+}
+
+func TestUploadValidationFailures(t *testing.T) {
+	data := []byte("an upload which does not match its registration")
+	md5Hash := md5.Sum(data)
+	actualHash := hex.EncodeToString(md5Hash[:])
+	expectedHash := hex.EncodeToString(make([]byte, md5.Size))
+
+	tests := []struct {
+		name        string
+		length      uint64
+		contentHash []byte
+		log         []string
+		body        string
+		authBody    string
+	}{
+		{
+			name:        "length mismatch",
+			length:      uint64(len(data)) + 1,
+			contentHash: md5Hash[:],
+			log:         []string{"content length does not match", fmt.Sprintf("expected: %d, actual: %d", len(data)+1, len(data))},
+			body:        fmt.Sprintf("upload failed validation: content length does not match the expected length. expected: %d, actual: %d\n", len(data)+1, len(data)),
+			authBody:    fmt.Sprintf("upload failed validation: content length does not match the expected length. received: %d\n", len(data)),
+		},
+		{
+			name:        "hash mismatch",
+			length:      uint64(len(data)),
+			contentHash: make([]byte, md5.Size),
+			log:         []string{"content hash does not match", "expected: " + expectedHash, "actual: " + actualHash},
+			body:        fmt.Sprintf("upload failed validation: content hash does not match the expected hash. expected: %s, actual: %s\n", expectedHash, actualHash),
+			authBody:    "upload failed validation: content hash does not match the expected hash. received: " + actualHash + "\n",
+		},
+	}
+
+	for _, test := range tests {
+		for _, withAuth := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s auth=%t", test.name, withAuth), func(t *testing.T) {
+				fh := newTestHandler(t)
+				logs := &bytes.Buffer{}
+				fh.jsonLog = log.New(logs, "", 0)
+
+				if withAuth {
+					fh.auth = newBearerTokenAuth(map[string]tokenPermission{"writer": writePermission})
+				}
+
+				fileId := expectUploadDetails(t, test.name, test.length, test.contentHash)
+				req := httptest.NewRequest(http.MethodPost, fileUrl(testOrg, testRepo, fileId), bytes.NewReader(data))
+				req.Header.Set("Authorization", "Bearer writer")
+				rec := doRequest(fh, req)
+
+				require.Equal(t, http.StatusBadRequest, rec.Code)
+				assert.True(t, strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain"))
+
+				for _, expected := range test.log {
+					assert.Contains(t, logs.String(), expected)
+				}
+
+				if withAuth {
+					assert.Equal(t, test.authBody, rec.Body.String())
+					assert.NotContains(t, rec.Body.String(), "expected:")
+				} else {
+					assert.Equal(t, test.body, rec.Body.String())
+				}
+
+				assert.NoFileExists(t, filepath.Join(testRoot(fh), testOrg, testRepo, fileId))
+			})
+		}
+	}
+}
+
+func TestMaxUploadSize(t *testing.T) {
+	fh := newTestHandler(t)
+	fh.maxUploadSize = 16
+
+	t.Run("declared too large", func(t *testing.T) {
+		data := []byte("this upload declares that it is too large")
+		fileId := expectUpload(t, data)
+		req := httptest.NewRequest(http.MethodPost, fileUrl(testOrg, testRepo, fileId), bytes.NewReader(data))
+		rec := doRequest(fh, req)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+		assert.NoFileExists(t, filepath.Join(testRoot(fh), testOrg, testRepo, fileId))
+	})
+
+	t.Run("streamed too large", func(t *testing.T) {
+		data := []byte("this upload does not declare its length")
+		fileId := expectUploadDetails(t, "streamed too large", 0, nil)
+		req := httptest.NewRequest(http.MethodPost, fileUrl(testOrg, testRepo, fileId), io.MultiReader(bytes.NewReader(data)))
+		req.ContentLength = -1
+		rec := doRequest(fh, req)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+		assert.NoFileExists(t, filepath.Join(testRoot(fh), testOrg, testRepo, fileId))
+	})
+
+	t.Run("within limit", func(t *testing.T) {
+		data := []byte("small")
+		fileId := expectUpload(t, data)
+		rec := doRequest(fh, httptest.NewRequest(http.MethodPost, fileUrl(testOrg, testRepo, fileId), bytes.NewReader(data)))
+		assert.Equal(t, http.StatusCreated, rec.Code)
+	})
+}
+
+func TestLimitUploadSize(t *testing.T) {
+	data := []byte("exactly sixteen!")
+
+	read, err := io.ReadAll(limitUploadSize(io.NopCloser(bytes.NewReader(data)), 16))
+	require.NoError(t, err)
+	assert.Equal(t, data, read)
+
+	read, err = io.ReadAll(limitUploadSize(io.NopCloser(bytes.NewReader(data)), 15))
+	assert.ErrorIs(t, err, errUploadTooLarge)
+	assert.Equal(t, data[:15], read)
+}
+
+func TestEmptyUploads(t *testing.T) {
+	t.Run("rejected by default", func(t *testing.T) {
+		fh := newTestHandler(t)
+		fileId := expectUpload(t, []byte{})
+
+		rec := doRequest(fh, httptest.NewRequest(http.MethodPost, fileUrl(testOrg, testRepo, fileId), http.NoBody))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), errEmptyUpload.Error())
+		assert.NoFileExists(t, filepath.Join(testRoot(fh), testOrg, testRepo, fileId))
+
+		// a chunked upload doesn't declare that it is empty
+		req := httptest.NewRequest(http.MethodPost, fileUrl(testOrg, testRepo, fileId), io.MultiReader())
+		req.ContentLength = -1
+		rec = doRequest(fh, req)
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), errEmptyUpload.Error())
+		assert.NoFileExists(t, filepath.Join(testRoot(fh), testOrg, testRepo, fileId))
+	})
+
+	t.Run("conditional upload of an existing file", func(t *testing.T) {
+		fh := newTestHandler(t)
+		data := []byte("a table file which already exists")
+		fileId := expectUpload(t, data)
+		writeTestFile(t, fh, data)
+
+		// the precondition is checked before the body, so a client need not send one
+		req := httptest.NewRequest(http.MethodPut, fileUrl(testOrg, testRepo, fileId), http.NoBody)
+		req.Header.Set("If-None-Match", "*")
+		rec := doRequest(fh, req)
+		assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+	})
+
+	t.Run("accepted", func(t *testing.T) {
+		fh := newTestHandler(t)
+		fh.allowEmptyUploads = true
+		fileId := expectUpload(t, []byte{})
+
+		rec := doRequest(fh, httptest.NewRequest(http.MethodPost, fileUrl(testOrg, testRepo, fileId), http.NoBody))
+		require.Equal(t, http.StatusCreated, rec.Code)
+		emptyMD5 := md5.Sum(nil)
+		assert.Equal(t, hex.EncodeToString(emptyMD5[:]), rec.Header().Get(contentMD5Header))
+
+		info, err := os.Stat(filepath.Join(testRoot(fh), testOrg, testRepo, fileId))
+		require.NoError(t, err)
+		assert.Zero(t, info.Size())
+	})
+
+	t.Run("accepted with the wrong hash", func(t *testing.T) {
+		fh := newTestHandler(t)
+		fh.allowEmptyUploads = true
+		otherMD5 := md5.Sum([]byte("not empty"))
+		fileId := expectUploadDetails(t, "empty upload with the wrong hash", 0, otherMD5[:])
+
+		rec := doRequest(fh, httptest.NewRequest(http.MethodPost, fileUrl(testOrg, testRepo, fileId), http.NoBody))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Contains(t, rec.Body.String(), errContentHashMismatch.Error())
+		assert.NoFileExists(t, filepath.Join(testRoot(fh), testOrg, testRepo, fileId))
+	})
+}
+
+func TestUploadStatus(t *testing.T) {
+	fh := newTestHandler(t)
+
+	data := []byte("a table file which is uploaded twice")
+	fileId := expectUpload(t, data)
+	url := fileUrl(testOrg, testRepo, fileId)
+
+	rec := doRequest(fh, httptest.NewRequest(http.MethodPost, url, bytes.NewReader(data)))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, url, rec.Header().Get("Location"))
+
+	rec = doRequest(fh, httptest.NewRequest(http.MethodPut, url, bytes.NewReader(data)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get("Location"))
+}
+
+func TestUploadUnregisteredFile(t *testing.T) {
+	fh := newTestHandler(t)
+	data := []byte("a table file which was never negotiated")
+
+	tests := []struct {
+		name     string
+		fileId   string
+		expected int
+	}{
+		{"malformed hash", "not-a-hash", http.StatusBadRequest},
+		{"unregistered hash", hash.Of([]byte("unregistered")).String(), http.StatusNotFound},
+		{"registered hash", expectUpload(t, data), http.StatusCreated},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := doRequest(fh, httptest.NewRequest(http.MethodPost, fileUrl(testOrg, testRepo, test.fileId), bytes.NewReader(data)))
+			assert.Equal(t, test.expected, rec.Code)
+
+			if test.expected != http.StatusCreated {
+				assert.NoFileExists(t, filepath.Join(testRoot(fh), testOrg, testRepo, test.fileId))
+			}
+		})
+	}
+}
+
+// fakeClock is a manually advanced clock for tests.
+type fakeClock struct {
+	mu  *sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{&sync.Mutex{}, time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestExpectedFileSweep(t *testing.T) {
+	clock := newFakeClock()
+	m := newExpectedFileMap(clock.Now)
+	tfd := &remotesapi.TableFileDetails{}
+
+	m.set("old", tfd)
+	clock.Advance(30 * time.Minute)
+	m.set("new", tfd)
+	clock.Advance(45 * time.Minute)
+
+	assert.Equal(t, 1, m.sweep(time.Hour))
+	_, ok := m.get("old")
+	assert.False(t, ok)
+	_, ok = m.get("new")
+	assert.True(t, ok)
+
+	// re-registering an upload refreshes it
+	m.set("new", tfd)
+	clock.Advance(45 * time.Minute)
+	assert.Equal(t, 0, m.sweep(time.Hour))
+
+	clock.Advance(time.Hour)
+	assert.Equal(t, 1, m.sweep(time.Hour))
+	assert.Empty(t, m.files)
+}
+
+func TestRegisterExpectedUpload(t *testing.T) {
+	data := []byte("a table file registered through the api")
+	md5Hash := md5.Sum(data)
+	h := hash.Of(data)
+	fileId := h.String()
+	tfd := &remotesapi.TableFileDetails{Id: h[:], ContentLength: uint64(len(data)), ContentHash: md5Hash[:]}
+	t.Cleanup(func() {
+		deleteExpectedFile(fileId)
+	})
+
+	t.Run("registration", func(t *testing.T) {
+		require.NoError(t, RegisterExpectedUpload(fileId, tfd))
+		registered, ok := getExpectedFile(fileId)
+		require.True(t, ok)
+		assert.Equal(t, tfd, registered)
+
+		fh := newTestHandler(t)
+		rec := doRequest(fh, httptest.NewRequest(http.MethodPost, fileUrl(testOrg, testRepo, fileId), bytes.NewReader(data)))
+		assert.Equal(t, http.StatusCreated, rec.Code)
+	})
+
+	t.Run("duplicate registration", func(t *testing.T) {
+		// clients which retry an upload ask for its location again
+		same := &remotesapi.TableFileDetails{Id: h[:], ContentLength: tfd.ContentLength, ContentHash: md5Hash[:]}
+		require.NoError(t, RegisterExpectedUpload(fileId, same))
+
+		otherLength := &remotesapi.TableFileDetails{Id: h[:], ContentLength: tfd.ContentLength + 1, ContentHash: md5Hash[:]}
+		assert.ErrorIs(t, RegisterExpectedUpload(fileId, otherLength), errConflictingUpload)
+
+		otherMD5 := md5.Sum([]byte("other content"))
+		otherHash := &remotesapi.TableFileDetails{Id: h[:], ContentLength: tfd.ContentLength, ContentHash: otherMD5[:]}
+		assert.ErrorIs(t, RegisterExpectedUpload(fileId, otherHash), errConflictingUpload)
+
+		registered, ok := getExpectedFile(fileId)
+		require.True(t, ok)
+		assert.Equal(t, same, registered)
+	})
+
+	t.Run("invalid registration", func(t *testing.T) {
+		otherId := hash.Of([]byte("another table file"))
+
+		tests := []struct {
+			name   string
+			fileId string
+			tfd    *remotesapi.TableFileDetails
+		}{
+			{"invalid hash", "not-a-hash", &remotesapi.TableFileDetails{Id: h[:]}},
+			{"id mismatch", otherId.String(), &remotesapi.TableFileDetails{Id: h[:]}},
+			{"no details", otherId.String(), nil},
+			{"unsupported content hash", otherId.String(), &remotesapi.TableFileDetails{Id: otherId[:], ContentHash: []byte{1, 2, 3}}},
+		}
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				assert.ErrorIs(t, RegisterExpectedUpload(test.fileId, test.tfd), errInvalidUpload)
+				_, ok := getExpectedFile(test.fileId)
+				assert.False(t, ok)
+			})
+		}
+	})
+}
+
+func TestExpectedFileSweeper(t *testing.T) {
+	clock := newFakeClock()
+	m := newExpectedFileMap(clock.Now)
+	m.set("stale", &remotesapi.TableFileDetails{})
+
+	tick := make(chan time.Time)
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.sweepEvery(time.Hour, tick, stop)
+	}()
+
+	tick <- clock.Now()
+	_, ok := m.get("stale")
+	assert.True(t, ok)
+
+	clock.Advance(2 * time.Hour)
+	tick <- clock.Now()
+	// a second tick can only be received once the sweep triggered by the first has finished
+	tick <- clock.Now()
+	_, ok = m.get("stale")
+	assert.False(t, ok)
+
+	close(stop)
+	<-done
+}
+
+// expectTableFileUpload registers |data| as an expected upload to |fileId|.
+func expectTableFileUpload(t *testing.T, fileId string, data []byte) {
+	md5Hash := md5.Sum(data)
+	h := hash.Parse(fileId)
+	setExpectedFile(fileId, &remotesapi.TableFileDetails{
+		Id:            h[:],
+		ContentLength: uint64(len(data)),
+		ContentHash:   md5Hash[:],
+	})
+	t.Cleanup(func() {
+		deleteExpectedFile(fileId)
+	})
+}
+
+func TestUploadFileIdVerification(t *testing.T) {
+	fh := newTestHandler(t)
+	fh.verifyFileIds = true
+
+	name, data, err := nbs.WriteChunks([]chunks.Chunk{
+		chunks.NewChunk([]byte("first chunk")),
+		chunks.NewChunk([]byte("second chunk")),
+	})
+	require.NoError(t, err)
+	_, otherData, err := nbs.WriteChunks([]chunks.Chunk{chunks.NewChunk([]byte("another chunk"))})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		data     []byte
+		expected int
+	}{
+		{"other table file", otherData, http.StatusBadRequest},
+		{"not a table file", []byte("definitely not a table file"), http.StatusBadRequest},
+		{"matching table file", data, http.StatusCreated},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expectTableFileUpload(t, name, test.data)
+			rec := doRequest(fh, httptest.NewRequest(http.MethodPost, fileUrl(testOrg, testRepo, name), bytes.NewReader(test.data)))
+			assert.Equal(t, test.expected, rec.Code)
+
+			if test.expected == http.StatusBadRequest {
+				assert.NoFileExists(t, filepath.Join(testRoot(fh), testOrg, testRepo, name))
+				matches, err := filepath.Glob(filepath.Join(testRoot(fh), testOrg, testRepo, "*.tmp"))
+				require.NoError(t, err)
+				assert.Empty(t, matches)
+			}
+		})
+	}
+
+	stored, err := os.ReadFile(filepath.Join(testRoot(fh), testOrg, testRepo, name))
+	require.NoError(t, err)
+	assert.Equal(t, data, stored)
+}
+
+// failingReader returns |data| followed by |err|.
+type failingReader struct {
+	data []byte
+	err  error
+}
+
+func (fr *failingReader) Read(p []byte) (int, error) {
+	if len(fr.data) == 0 {
+		return 0, fr.err
+	}
+
+	n := copy(p, fr.data)
+	fr.data = fr.data[n:]
+	return n, nil
+}
+
+func TestUploadBodyReadErrors(t *testing.T) {
+	fh := newTestHandler(t)
+	partial := []byte("the first half of a table file")
+
+	tests := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{"client abort", io.ErrUnexpectedEOF, http.StatusBadRequest},
+		{"server error", errors.New("read failed"), http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// the expected details match the partial data, so a read error must be detected before validation
+			md5Hash := md5.Sum(partial)
+			fileId := expectUploadDetails(t, test.name, 0, md5Hash[:])
+			body := &failingReader{append([]byte{}, partial...), test.err}
+
+			rec := doRequest(fh, httptest.NewRequest(http.MethodPost, fileUrl(testOrg, testRepo, fileId), body))
+			assert.Equal(t, test.expected, rec.Code)
+			assert.NoFileExists(t, filepath.Join(testRoot(fh), testOrg, testRepo, fileId))
+		})
+	}
+}
+
+func TestJSONRequestLogs(t *testing.T) {
+	fh := newTestHandler(t)
+	buf := &bytes.Buffer{}
+	fh.jsonLog = log.New(buf, "", 0)
+
+	fileId := writeTestFile(t, fh, []byte("0123456789"))
+	rec := doRequest(fh, httptest.NewRequest(http.MethodGet, fileUrl(testOrg, testRepo, fileId), nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.NotEmpty(t, lines)
+
+	var entries []requestLogEntry
+	for _, line := range lines {
+		var entry requestLogEntry
+		require.NoError(t, json.Unmarshal([]byte(line), &entry), line)
+		entries = append(entries, entry)
+	}
+
+	last := entries[len(entries)-1]
+	assert.True(t, strings.HasPrefix(last.Msg, "finished"), last.Msg)
+	assert.Equal(t, http.MethodGet, last.Method)
+	assert.Equal(t, fileUrl(testOrg, testRepo, fileId), last.URI)
+	assert.Equal(t, testOrg, last.Org)
+	assert.Equal(t, testRepo, last.Repo)
+	assert.Equal(t, fileId, last.FileId)
+	assert.Equal(t, http.StatusOK, last.Status)
+	assert.Equal(t, int64(10), last.Bytes)
+	assert.NotEmpty(t, last.CallId)
+
+	for _, entry := range entries {
+		assert.Equal(t, last.CallId, entry.CallId)
+	}
+}
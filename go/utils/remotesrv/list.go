@@ -0,0 +1,85 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// maxListLimit is the largest number of table files returned by a single listing request, and the number returned when
+// the request doesn't give a limit.
+const maxListLimit = 1000
+
+// listTableFiles responds to a request for the path of a repo, ending in a slash, with a JSON array of the file ids and
+// sizes of the repo's table files ordered by file id. The query parameter |limit| sets the number of table files in
+// the response, and |after| continues a previous listing from the last file id it returned. When more table files
+// remain the response has a Link header with the url of the next page.
+func (fh *fileHandler) listTableFiles(ctx context.Context, logger func(string), org, repo string, respWr http.ResponseWriter, req *http.Request) int {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		respWr.Header().Set("Allow", "GET, HEAD")
+		return http.StatusMethodNotAllowed
+	}
+
+	query := req.URL.Query()
+	after := query.Get("after")
+	limit := maxListLimit
+
+	if limitStr := query.Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+
+		if err != nil || limit < 1 || limit > maxListLimit {
+			logger(fmt.Sprintf("invalid listing limit '%s'", limitStr))
+			return http.StatusBadRequest
+		}
+	}
+
+	// one more table file than was asked for is listed to find out if there is another page
+	listing, err := fh.store.List(ctx, org, repo, after, limit+1)
+
+	if err != nil {
+		logger(fmt.Sprintf("failed to list %s/%s: %v", org, repo, err))
+		return blobErrStatus(err)
+	}
+
+	if len(listing) > limit {
+		listing = listing[:limit]
+		next := url.Values{"after": {listing[limit-1].FileId}, "limit": {strconv.Itoa(limit)}}
+		respWr.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, req.URL.Path, next.Encode()))
+	}
+
+	data, err := json.Marshal(listing)
+
+	if err != nil {
+		logger(fmt.Sprintf("failed to encode the listing of %s/%s: %v", org, repo, err))
+		return http.StatusInternalServerError
+	}
+
+	logger(fmt.Sprintf("listed %d table files of %s/%s", len(listing), org, repo))
+	respWr.Header().Set("Content-Type", "application/json")
+	respWr.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	respWr.WriteHeader(http.StatusOK)
+
+	if req.Method == http.MethodGet {
+		_, _ = respWr.Write(data)
+	}
+
+	return -1
+}
@@ -0,0 +1,176 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dolthub/dolt/go/store/hash"
+)
+
+func listRequest(fh *fileHandler, url string) ([]BlobListing, *httptest.ResponseRecorder) {
+	rec := doRequest(fh, httptest.NewRequest(http.MethodGet, url, nil))
+
+	var listing []BlobListing
+	if rec.Code == http.StatusOK {
+		_ = json.Unmarshal(rec.Body.Bytes(), &listing)
+	}
+
+	return listing, rec
+}
+
+func TestListEmptyRepo(t *testing.T) {
+	fh := newTestHandler(t)
+
+	listing, rec := listRequest(fh, "/"+testOrg+"/"+testRepo+"/")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "[]", rec.Body.String())
+	assert.Empty(t, listing)
+	assert.Empty(t, rec.Header().Get("Link"))
+
+	// a repo which has never been written to is empty as well
+	listing, rec = listRequest(fh, "/"+testOrg+"/does_not_exist/")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, listing)
+}
+
+func TestListRepo(t *testing.T) {
+	fh := newTestHandler(t)
+	repoDir := filepath.Join(testRoot(fh), testOrg, testRepo)
+
+	var expected []BlobListing
+	for i := 0; i < 5; i++ {
+		data := []byte(fmt.Sprintf("table file %d", i))
+		expected = append(expected, BlobListing{FileId: writeTestFile(t, fh, data), Size: int64(len(data))})
+	}
+
+	sort.Slice(expected, func(i, j int) bool {
+		return expected[i].FileId < expected[j].FileId
+	})
+
+	// files which aren't table files are left out
+	require.NoError(t, os.WriteFile(filepath.Join(repoDir, "manifest"), []byte("manifest"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(repoDir, expected[0].FileId+"-123.tmp"), []byte("partial"), os.ModePerm))
+
+	// as are the files of other repos
+	otherRepo := filepath.Join(testRoot(fh), testOrg, "other")
+	require.NoError(t, os.MkdirAll(otherRepo, os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(otherRepo, hash.Of([]byte("other")).String()), []byte("other"), os.ModePerm))
+
+	listing, rec := listRequest(fh, "/"+testOrg+"/"+testRepo+"/")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, expected, listing)
+
+	rec = doRequest(fh, httptest.NewRequest(http.MethodHead, "/"+testOrg+"/"+testRepo+"/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Body.Bytes())
+	assert.NotEmpty(t, rec.Header().Get("Content-Length"))
+
+	t.Run("sharded", func(t *testing.T) {
+		fh.store.(*fileStore).shardDepth = 2
+		defer func() {
+			fh.store.(*fileStore).shardDepth = 0
+		}()
+
+		data := []byte("a sharded table file")
+		fileId := hash.Of(data).String()
+		path, err := fh.store.(*fileStore).path(testOrg, testRepo, fileId)
+		require.NoError(t, err)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), os.ModePerm))
+		require.NoError(t, os.WriteFile(path, data, os.ModePerm))
+
+		listing, rec := listRequest(fh, "/"+testOrg+"/"+testRepo+"/")
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.Len(t, listing, len(expected)+1)
+		assert.Contains(t, listing, BlobListing{FileId: fileId, Size: int64(len(data))})
+	})
+}
+
+func TestListPagination(t *testing.T) {
+	fh := newTestHandler(t)
+
+	var fileIds []string
+	for i := 0; i < 5; i++ {
+		fileIds = append(fileIds, writeTestFile(t, fh, []byte(fmt.Sprintf("table file %d", i))))
+	}
+
+	sort.Strings(fileIds)
+
+	var listed []string
+	url := "/" + testOrg + "/" + testRepo + "/?limit=2"
+	for pages := 0; url != ""; pages++ {
+		require.Less(t, pages, 3)
+
+		listing, rec := listRequest(fh, url)
+		require.Equal(t, http.StatusOK, rec.Code)
+		assert.LessOrEqual(t, len(listing), 2)
+
+		for _, l := range listing {
+			listed = append(listed, l.FileId)
+		}
+
+		url = ""
+		if link := rec.Header().Get("Link"); link != "" {
+			require.True(t, strings.HasPrefix(link, "<") && strings.HasSuffix(link, `>; rel="next"`), link)
+			url = strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+		}
+	}
+
+	assert.Equal(t, fileIds, listed)
+
+	listing, rec := listRequest(fh, "/"+testOrg+"/"+testRepo+"/?after="+fileIds[3])
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Len(t, listing, 1)
+	assert.Equal(t, fileIds[4], listing[0].FileId)
+	assert.Empty(t, rec.Header().Get("Link"))
+}
+
+func TestListErrors(t *testing.T) {
+	fh := newTestHandler(t)
+
+	tests := []struct {
+		name     string
+		method   string
+		url      string
+		expected int
+	}{
+		{"zero limit", http.MethodGet, "/" + testOrg + "/" + testRepo + "/?limit=0", http.StatusBadRequest},
+		{"limit too large", http.MethodGet, fmt.Sprintf("/%s/%s/?limit=%d", testOrg, testRepo, maxListLimit+1), http.StatusBadRequest},
+		{"invalid limit", http.MethodGet, "/" + testOrg + "/" + testRepo + "/?limit=ten", http.StatusBadRequest},
+		{"unsafe repo", http.MethodGet, "/" + testOrg + "/../", http.StatusBadRequest},
+		{"unsafe org", http.MethodGet, "/../" + testRepo + "/", http.StatusBadRequest},
+		{"empty repo name", http.MethodGet, "/" + testOrg + "//", http.StatusBadRequest},
+		{"post", http.MethodPost, "/" + testOrg + "/" + testRepo + "/", http.StatusMethodNotAllowed},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := doRequest(fh, httptest.NewRequest(test.method, test.url, nil))
+			assert.Equal(t, test.expected, rec.Code)
+		})
+	}
+}
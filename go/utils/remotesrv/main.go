@@ -16,28 +16,75 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"flag"
 	"fmt"
 	"log"
-	"net"
+	"math"
 	"net/http"
 	"os"
 	"os/signal"
-	"sync"
+	"strconv"
+	"strings"
+	"time"
 
-	"google.golang.org/grpc"
-
-	remotesapi "github.com/dolthub/dolt/go/gen/proto/dolt/services/remotesapi/v1alpha1"
-	"github.com/dolthub/dolt/go/libraries/utils/filesys"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
 )
 
 func main() {
 	dirParam := flag.String("dir", "", "root directory that this command will run in.")
 	grpcPortParam := flag.Int("grpc-port", -1, "root directory that this command will run in.")
+	disableGRPCParam := flag.Bool("disable-grpc", false, "only serve the http file server, without the grpc chunk store api.")
 	httpPortParam := flag.Int("http-port", -1, "root directory that this command will run in.")
 	httpHostParam := flag.String("http-host", "localhost", "host url that this command will assume.")
+	verifyReadsParam := flag.Bool("verify-reads", false, "verify the checksum of table files before serving them.")
+	logLevelParam := flag.String("log-level", "info", "verbosity of the logs. one of error, info or debug.")
+	jsonLogsParam := flag.Bool("json-logs", false, "log http requests as JSON.")
+	maxUploadSizeParam := flag.Int64("max-upload-size", 0, "maximum size in bytes of an uploaded table file. 0 means no limit.")
+	repoQuotaParam := flag.Int64("repo-quota", 0, "maximum total size in bytes of the table files stored for each repo. 0 means no limit.")
+	repoQuotasParam := flag.String("repo-quotas", "", "path to a file of org/repo names and their quotas in bytes, which override -repo-quota.")
+	allowEmptyUploadsParam := flag.Bool("allow-empty-uploads", false, "store uploads with an empty body as empty table files rather than rejecting them.")
+	maxOpenRangeSizeParam := flag.Int64("max-open-range-size", 0, "maximum number of bytes served for an open ended range such as bytes=100-. 0 means no limit.")
+	uploadSessionTTLParam := flag.Duration("upload-session-ttl", time.Hour, "how long a resumable upload session may be idle before it is abandoned. 0 means forever.")
+	maxUploadSessionsParam := flag.Int("max-upload-sessions", 100, "maximum number of resumable upload sessions each repo may have in progress. 0 means no limit.")
+	uploadTimeoutParam := flag.Duration("upload-timeout", 0, "how long the body of an upload may take to be received. 0 means no limit.")
+	shutdownTimeoutParam := flag.Duration("shutdown-timeout", 30*time.Second, "how long to wait for in flight requests to finish when shutting down.")
+	expectedFileTTLParam := flag.Duration("upload-registration-ttl", 24*time.Hour, "how long an upload location stays valid after it is handed out. 0 means forever.")
+	tlsCertParam := flag.String("tls-cert", "", "path to a PEM encoded tls certificate. requires -tls-key.")
+	tlsKeyParam := flag.String("tls-key", "", "path to the PEM encoded private key of the tls certificate.")
+	tlsClientCAParam := flag.String("tls-client-ca", "", "path to PEM encoded CA certificates. clients must present a certificate signed by one of them.")
+	http2Param := flag.Bool("http2", false, "allow http clients to use HTTP/2.")
+	insecureParam := flag.Bool("insecure", false, "serve plain text http and grpc without tls. only intended for local use and testing.")
+	authTokensParam := flag.String("auth-tokens", "", "path to a file of bearer tokens and their permissions. when provided, http requests require a token.")
+	s3BucketParam := flag.String("s3-bucket", "", "store table files in this S3 bucket instead of the local filesystem.")
+	s3PrefixParam := flag.String("s3-prefix", "", "prefix of the keys of the table files stored in the S3 bucket.")
+	s3RegionParam := flag.String("s3-region", "", "region of the S3 bucket. the aws sdk default is used if not provided.")
+	contentTypeParam := flag.String("content-type", defaultContentType, "Content-Type of table file downloads.")
+	rateLimitParam := flag.Float64("rate-limit", 0, "maximum http requests per second from each client. 0 means no limit.")
+	rateLimitBurstParam := flag.Int("rate-limit-burst", 0, "number of http requests a client may make at once before -rate-limit applies. defaults to the rate limit rounded up.")
+	maxConcurrentParam := flag.Int("max-concurrent-requests", 0, "maximum number of http requests served at once. 0 means no limit.")
+	concurrencyModeParam := flag.String("concurrency-limit-mode", "queue", "what to do with requests over -max-concurrent-requests. either queue or reject.")
+	inMemoryParam := flag.Bool("in-memory", false, "keep table files in memory instead of on the local filesystem. they are lost when the server stops.")
+	corsOriginsParam := flag.String("cors-allowed-origins", "", "comma separated origins browsers may make cross-origin requests from. * allows any origin. cors is disabled if empty.")
+	corsMethodsParam := flag.String("cors-allowed-methods", "GET,HEAD", "comma separated methods allowed in cross-origin requests.")
+	corsHeadersParam := flag.String("cors-allowed-headers", "Authorization,If-None-Match,If-Range,Range", "comma separated request headers allowed in cross-origin requests.")
+	fileModeParam := flag.String("file-mode", "0644", "octal permissions of table files stored beneath -dir.")
+	dirModeParam := flag.String("dir-mode", "0755", "octal permissions of the directories created beneath -dir to hold table files.")
+	fsyncParam := flag.Bool("fsync", false, "flush each table file stored beneath -dir to disk before reporting its upload as successful.")
+	shardDepthParam := flag.Int("shard-depth", 0, "number of directories table files are nested in by the prefix of their file id. 0 stores them directly in their repo's directory.")
+	internalAddrParam := flag.String("internal-addr", "", "address such as 127.0.0.1:9090 of a separate plain text http listener serving /metrics, /healthz and /readyz. disabled if empty.")
+	corsMaxAgeParam := flag.Duration("cors-max-age", 10*time.Minute, "how long browsers may cache the response to a cors preflight request.")
 	flag.Parse()
 
+	var err error
+	logVerbosity, err = parseLogLevel(*logLevelParam)
+
+	if err != nil {
+		log.Fatalln(err)
+	}
+
 	if dirParam != nil && len(*dirParam) > 0 {
 		err := os.Chdir(*dirParam)
 
@@ -64,80 +111,192 @@ func main() {
 		log.Println("'grpc-port' parameter not provided. Using default port 50051")
 	}
 
-	stopChan, wg := startServer(*httpHostParam, *httpPortParam, *grpcPortParam)
-	waitForSignal()
+	var tlsCfg *tls.Config
+	if *tlsCertParam != "" || *tlsKeyParam != "" {
+		tlsCfg, err = newTLSConfig(*tlsCertParam, *tlsKeyParam, *tlsClientCAParam)
 
-	close(stopChan)
-	wg.Wait()
-}
+		if err != nil {
+			log.Fatalf("failed to configure tls: %v", err)
+		}
+	} else if *tlsClientCAParam != "" {
+		log.Fatalln("'tls-client-ca' requires 'tls-cert' and 'tls-key'")
+	} else if !*insecureParam {
+		log.Fatalln("no tls certificate provided. provide 'tls-cert' and 'tls-key', or pass 'insecure' to serve without tls")
+	}
 
-func waitForSignal() {
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, os.Kill)
-	<-c
-}
+	var store BlobStore
+	if *inMemoryParam {
+		if !*disableGRPCParam {
+			log.Fatalln("the grpc chunk store only reads table files beneath -dir, so 'in-memory' requires 'disable-grpc'")
+		}
+
+		store = newMemBlobStore()
+		log.Println("storing table files in memory")
+	} else if *s3BucketParam != "" {
+		if !*disableGRPCParam {
+			log.Fatalln("the grpc chunk store only reads table files beneath -dir, so 's3-bucket' requires 'disable-grpc'")
+		}
+
+		cfg := aws.NewConfig()
+		if *s3RegionParam != "" {
+			cfg = cfg.WithRegion(*s3RegionParam)
+		}
 
-func startServer(httpHost string, httpPort, grpcPort int) (chan interface{}, *sync.WaitGroup) {
-	wg := sync.WaitGroup{}
-	stopChan := make(chan interface{})
+		sess := session.Must(session.NewSession(cfg))
+		store = newS3Store(s3.New(sess), *s3BucketParam, *s3PrefixParam)
+		log.Printf("storing table files in s3://%s/%s", *s3BucketParam, *s3PrefixParam)
+	} else {
+		if *shardDepthParam < 0 || *shardDepthParam > maxShardDepth {
+			log.Fatalf("'shard-depth' must be between 0 and %d", maxShardDepth)
+		} else if *shardDepthParam > 0 && !*disableGRPCParam {
+			log.Fatalln("the grpc chunk store only reads table files from the flat layout, so 'shard-depth' requires 'disable-grpc'")
+		}
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		httpServer(httpPort, stopChan)
-	}()
+		fs, err := newFileStore(".")
 
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		grpcServer(httpHost, grpcPort, stopChan)
-	}()
+		if err != nil {
+			log.Fatalf("failed to create file store: %v", err)
+		}
 
-	return stopChan, &wg
-}
+		fs.shardDepth = *shardDepthParam
+		fs.fileMode = parseFileMode("file-mode", *fileModeParam)
+		fs.dirMode = parseFileMode("dir-mode", *dirModeParam)
+
+		if *fsyncParam {
+			fs.syncer = (*os.File).Sync
+		}
+
+		store = fs
+	}
+
+	handler := newFileHandler(store)
+	handler.verifyReads = *verifyReadsParam
+	handler.maxUploadSize = *maxUploadSizeParam
+	handler.sessions.maxPerRepo = *maxUploadSessionsParam
+	handler.allowEmptyUploads = *allowEmptyUploadsParam
+	handler.maxOpenRangeSize = *maxOpenRangeSizeParam
+	handler.contentType = *contentTypeParam
+	handler.uploadTimeout = *uploadTimeoutParam
 
-func grpcServer(httpHost string, grpcPort int, stopChan chan interface{}) {
-	defer func() {
-		log.Println("exiting grpc Server go routine")
-	}()
+	if *repoQuotasParam != "" {
+		handler.quotas, err = loadRepoQuotas(*repoQuotasParam, *repoQuotaParam)
 
-	dbCache := NewLocalCSCache(filesys.LocalFS)
-	chnkSt := NewHttpFSBackedChunkStore(httpHost, dbCache)
+		if err != nil {
+			log.Fatalf("failed to load repo quotas: %v", err)
+		}
+	} else if *repoQuotaParam > 0 {
+		handler.quotas = newRepoQuotas(*repoQuotaParam)
+	}
+
+	if *rateLimitParam > 0 {
+		burst := *rateLimitBurstParam
+		if burst <= 0 {
+			burst = int(math.Ceil(*rateLimitParam))
+		}
+
+		handler.limiter = newRateLimiter(*rateLimitParam, burst, time.Now)
+	}
+
+	if *maxConcurrentParam > 0 {
+		mode, err := parseConcurrencyMode(*concurrencyModeParam)
+
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		handler.concurrency = newConcurrencyLimiter(*maxConcurrentParam, mode)
+	}
+
+	if *jsonLogsParam {
+		handler.jsonLog = log.New(os.Stderr, "", 0)
+	}
+
+	if *authTokensParam != "" {
+		handler.auth, err = loadBearerTokenAuth(*authTokensParam)
+
+		if err != nil {
+			log.Fatalf("failed to load auth tokens: %v", err)
+		}
+	}
+
+	if *corsOriginsParam != "" {
+		handler.cors = newCORSPolicy(splitList(*corsOriginsParam), splitList(*corsMethodsParam), splitList(*corsHeadersParam), *corsMaxAgeParam)
+	}
+
+	var internalMux *http.ServeMux
+	if *internalAddrParam != "" {
+		handler.metrics = newHttpMetrics()
+		handler.metrics.concurrency = handler.concurrency
+
+		internalMux = http.NewServeMux()
+		internalMux.Handle("/metrics", handler.metrics)
+		internalMux.Handle("/healthz", healthHandler{store})
+		internalMux.Handle("/readyz", healthHandler{store})
+	}
+
+	server := newRemoteServer(*httpHostParam, *httpPortParam, *grpcPortParam, handler, handler, tlsCfg)
+	server.expectedFileTTL = *expectedFileTTLParam
+
+	if *disableGRPCParam {
+		server.disableGRPC()
+	}
+	server.uploadSessions = handler.sessions
+	server.uploadSessionTTL = *uploadSessionTTLParam
+
+	if internalMux != nil {
+		server.serveInternal(*internalAddrParam, internalMux)
+	}
+
+	if *http2Param {
+		err = server.enableHTTP2()
+
+		if err != nil {
+			log.Fatalf("failed to enable HTTP/2: %v", err)
+		}
+	}
+	err = server.start()
 
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", grpcPort))
 	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+		log.Fatalf("failed to start server: %v", err)
 	}
 
-	grpcServer := grpc.NewServer(grpc.MaxRecvMsgSize(128 * 1024 * 1024))
-	go func() {
-		remotesapi.RegisterChunkStoreServiceServer(grpcServer, chnkSt)
+	waitForSignal()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeoutParam)
+	defer cancel()
 
-		log.Println("Starting grpc server on port", grpcPort)
-		err := grpcServer.Serve(lis)
-		log.Println("grpc server exited. error:", err)
-	}()
+	err = server.Shutdown(ctx)
 
-	<-stopChan
-	grpcServer.GracefulStop()
+	if err != nil {
+		log.Println("shutdown did not complete cleanly. error:", err)
+	}
 }
 
-func httpServer(httpPort int, stopChan chan interface{}) {
-	defer func() {
-		log.Println("exiting http Server go routine")
-	}()
+// splitList splits a comma separated flag value, ignoring whitespace and empty elements.
+func splitList(list string) []string {
+	var elems []string
+	for _, elem := range strings.Split(list, ",") {
+		if elem = strings.TrimSpace(elem); elem != "" {
+			elems = append(elems, elem)
+		}
+	}
+
+	return elems
+}
 
-	server := http.Server{
-		Addr:    fmt.Sprintf(":%d", httpPort),
-		Handler: http.HandlerFunc(ServeHTTP),
+// parseFileMode parses the octal permissions given by the flag |name|, exiting if they are not valid.
+func parseFileMode(name, mode string) os.FileMode {
+	perm, err := strconv.ParseUint(mode, 8, 32)
+
+	if err != nil || os.FileMode(perm)&^os.ModePerm != 0 {
+		log.Fatalf("'%s' must be octal permissions such as 0644. got '%s'", name, mode)
 	}
 
-	go func() {
-		log.Println("Starting http server on port ", httpPort)
-		err := server.ListenAndServe()
-		log.Println("http server exited. exit error:", err)
-	}()
+	return os.FileMode(perm)
+}
 
-	<-stopChan
-	server.Shutdown(context.Background())
+func waitForSignal() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, os.Kill)
+	<-c
 }
@@ -0,0 +1,173 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memBlobStore is a BlobStore which keeps table files in memory. It is intended for tests and short lived mirrors,
+// as everything it stores is lost when the server stops.
+type memBlobStore struct {
+	mu    *sync.RWMutex
+	blobs map[string]memBlob
+	now   func() time.Time
+}
+
+// memBlob is a stored blob. Its data is never modified after it is stored, so it can be read without holding the
+// store's lock.
+type memBlob struct {
+	data    []byte
+	md5     []byte
+	modTime time.Time
+}
+
+var _ BlobStore = (*memBlobStore)(nil)
+var _ checksummer = (*memBlobStore)(nil)
+
+func newMemBlobStore() *memBlobStore {
+	return &memBlobStore{mu: &sync.RWMutex{}, blobs: make(map[string]memBlob), now: time.Now}
+}
+
+func (ms *memBlobStore) get(org, repo, fileId string) (memBlob, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	blob, ok := ms.blobs[path.Join(org, repo, fileId)]
+
+	if !ok {
+		return memBlob{}, errBlobNotFound
+	}
+
+	return blob, nil
+}
+
+// Get implements BlobStore.
+func (ms *memBlobStore) Get(ctx context.Context, org, repo, fileId string) (io.ReadCloser, int64, error) {
+	blob, err := ms.get(org, repo, fileId)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return io.NopCloser(bytes.NewReader(blob.data)), int64(len(blob.data)), nil
+}
+
+// GetRange implements BlobStore.
+func (ms *memBlobStore) GetRange(ctx context.Context, org, repo, fileId string, offset, length int64) (io.ReadCloser, error) {
+	blob, err := ms.get(org, repo, fileId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if offset < 0 || length < 0 || offset+length > int64(len(blob.data)) {
+		return nil, errInvalidBlobRange
+	}
+
+	return io.NopCloser(bytes.NewReader(blob.data[offset : offset+length])), nil
+}
+
+// Put implements BlobStore.
+func (ms *memBlobStore) Put(ctx context.Context, org, repo, fileId string, rd io.Reader, validate func(io.ReadSeeker) error) error {
+	data, err := io.ReadAll(rd)
+
+	if err != nil {
+		return err
+	}
+
+	if validate != nil {
+		err = validate(bytes.NewReader(data))
+
+		if err != nil {
+			return err
+		}
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	sum := md5.Sum(data)
+	ms.blobs[path.Join(org, repo, fileId)] = memBlob{data: data, md5: sum[:], modTime: ms.now()}
+	return nil
+}
+
+// Checksum implements checksummer. The md5 of each blob is computed when it is stored.
+func (ms *memBlobStore) Checksum(ctx context.Context, org, repo, fileId string) ([]byte, error) {
+	blob, err := ms.get(org, repo, fileId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return blob.md5, nil
+}
+
+// Stat implements BlobStore.
+func (ms *memBlobStore) Stat(ctx context.Context, org, repo, fileId string) (BlobInfo, error) {
+	blob, err := ms.get(org, repo, fileId)
+
+	if err != nil {
+		return BlobInfo{}, err
+	}
+
+	return BlobInfo{Size: int64(len(blob.data)), ModTime: blob.modTime}, nil
+}
+
+// Delete implements BlobStore.
+func (ms *memBlobStore) Delete(ctx context.Context, org, repo, fileId string) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	key := path.Join(org, repo, fileId)
+	if _, ok := ms.blobs[key]; !ok {
+		return errBlobNotFound
+	}
+
+	delete(ms.blobs, key)
+	return nil
+}
+
+// List implements BlobStore.
+func (ms *memBlobStore) List(ctx context.Context, org, repo, after string, limit int) ([]BlobListing, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	prefix := path.Join(org, repo) + "/"
+	listing := make([]BlobListing, 0)
+	for key, blob := range ms.blobs {
+		if fileId := strings.TrimPrefix(key, prefix); fileId != key && fileId > after {
+			listing = append(listing, BlobListing{FileId: fileId, Size: int64(len(blob.data))})
+		}
+	}
+
+	sort.Slice(listing, func(i, j int) bool {
+		return listing[i].FileId < listing[j].FileId
+	})
+
+	if len(listing) > limit {
+		listing = listing[:limit]
+	}
+
+	return listing, nil
+}
@@ -0,0 +1,154 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMemTestHandler(t *testing.T) (*fileHandler, *memBlobStore) {
+	store := newMemBlobStore()
+	fh := newFileHandler(store)
+	fh.verifyFileIds = false
+	fh.sessions.stagingDir = t.TempDir()
+	return fh, store
+}
+
+func TestMemBlobStoreStat(t *testing.T) {
+	clock := newFakeClock()
+	store := newMemBlobStore()
+	store.now = clock.Now
+
+	require.NoError(t, store.Put(context.Background(), testOrg, testRepo, "blob", bytes.NewReader([]byte("0123456789")), nil))
+
+	info, err := store.Stat(context.Background(), testOrg, testRepo, "blob")
+	require.NoError(t, err)
+	assert.Equal(t, BlobInfo{Size: 10, ModTime: clock.Now()}, info)
+
+	// blobs are keyed by org and repo as well as file id
+	_, err = store.Stat(context.Background(), testOrg, "other", "blob")
+	assert.True(t, errors.Is(err, errBlobNotFound))
+}
+
+func TestMemBlobStoreConcurrentAccess(t *testing.T) {
+	store := newMemBlobStore()
+	ctx := context.Background()
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			fileId := fmt.Sprintf("blob-%d", i%4)
+			data := bytes.Repeat([]byte{byte(i)}, 1024)
+
+			for j := 0; j < 50; j++ {
+				assert.NoError(t, store.Put(ctx, testOrg, testRepo, fileId, bytes.NewReader(data), nil))
+
+				rd, err := store.GetRange(ctx, testOrg, testRepo, fileId, 0, 1024)
+				if err == nil {
+					rd.Close()
+				}
+
+				if j%10 == 0 {
+					_ = store.Delete(ctx, testOrg, testRepo, fileId)
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+}
+
+func TestMemBlobStoreHandler(t *testing.T) {
+	fh, store := newMemTestHandler(t)
+
+	data := []byte("table file stored in memory")
+	fileId := expectUpload(t, data)
+
+	rec := doRequest(fh, httptest.NewRequest(http.MethodPost, fileUrl(testOrg, testRepo, fileId), bytes.NewReader(data)))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	stored, err := store.get(testOrg, testRepo, fileId)
+	require.NoError(t, err)
+	assert.Equal(t, data, stored.data)
+
+	rec = doRequest(fh, httptest.NewRequest(http.MethodGet, fileUrl(testOrg, testRepo, fileId), nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, data, rec.Body.Bytes())
+
+	rec = doRequest(fh, httptest.NewRequest(http.MethodHead, fileUrl(testOrg, testRepo, fileId), nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Body.Bytes())
+
+	rec = doRequest(fh, rangeRequest(fileId, "bytes=6-9"))
+	require.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Equal(t, []byte("file"), rec.Body.Bytes())
+	assert.Equal(t, "bytes 6-9/27", rec.Header().Get("Content-Range"))
+
+	rec = doRequest(fh, rangeRequest(fileId, "bytes=0-4,6-9"))
+	require.Equal(t, http.StatusPartialContent, rec.Code)
+	assert.Contains(t, rec.Body.String(), "table")
+	assert.Contains(t, rec.Body.String(), "file")
+
+	rec = doRequest(fh, rangeRequest(fileId, "bytes=20-39"))
+	assert.Equal(t, http.StatusRequestedRangeNotSatisfiable, rec.Code)
+	assert.Equal(t, "bytes */27", rec.Header().Get("Content-Range"))
+
+	rec = doRequest(fh, httptest.NewRequest(http.MethodDelete, fileUrl(testOrg, testRepo, fileId), nil))
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	rec = doRequest(fh, httptest.NewRequest(http.MethodGet, fileUrl(testOrg, testRepo, fileId), nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = doRequest(fh, httptest.NewRequest(http.MethodDelete, fileUrl(testOrg, testRepo, fileId), nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestMemBlobStoreResumableUpload(t *testing.T) {
+	fh, store := newMemTestHandler(t)
+
+	data := bytes.Repeat([]byte("staged parts "), 100)
+	fileId := expectUpload(t, data)
+	sessionUrl := startSession(t, fh, fileId)
+
+	half := len(data) / 2
+	require.Equal(t, http.StatusNoContent, sendPart(fh, sessionUrl, 0, data[:half]).Code)
+	require.Equal(t, http.StatusNoContent, sendPart(fh, sessionUrl, half, data[half:]).Code)
+
+	_, err := store.get(testOrg, testRepo, fileId)
+	assert.True(t, errors.Is(err, errBlobNotFound), "parts were written to the store before the upload was committed")
+
+	rec := doRequest(fh, httptest.NewRequest(http.MethodPut, sessionUrl, nil))
+	require.Equal(t, http.StatusCreated, rec.Code)
+
+	stored, err := store.get(testOrg, testRepo, fileId)
+	require.NoError(t, err)
+	assert.Equal(t, data, stored.data)
+
+	staged, err := os.ReadDir(fh.sessions.stagingDir)
+	require.NoError(t, err)
+	assert.Empty(t, staged)
+}
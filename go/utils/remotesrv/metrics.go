@@ -0,0 +1,195 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var durationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+var sizeBuckets = []float64{1 << 10, 1 << 12, 1 << 14, 1 << 16, 1 << 18, 1 << 20, 1 << 22, 1 << 24, 1 << 26, 1 << 28, 1 << 30}
+
+// httpMetrics records metrics about the requests served by the http file server, and serves them in the Prometheus
+// text exposition format.
+type httpMetrics struct {
+	mu            *sync.Mutex
+	requests      map[requestMetricKey]uint64
+	duration      *histogram
+	uploadBytes   *histogram
+	downloadBytes *histogram
+
+	inFlight int64
+
+	// concurrency, when set, is the concurrencyLimiter of the requests being recorded, whose slots are reported.
+	concurrency *concurrencyLimiter
+}
+
+type requestMetricKey struct {
+	method string
+	status int
+}
+
+func newHttpMetrics() *httpMetrics {
+	return &httpMetrics{
+		mu:            &sync.Mutex{},
+		requests:      make(map[requestMetricKey]uint64),
+		duration:      newHistogram(durationBuckets),
+		uploadBytes:   newHistogram(sizeBuckets),
+		downloadBytes: newHistogram(sizeBuckets),
+	}
+}
+
+// requestStarted increments the in flight request gauge. It must be paired with a call to requestFinished.
+func (m *httpMetrics) requestStarted() {
+	atomic.AddInt64(&m.inFlight, 1)
+}
+
+// requestFinished records a completed request.
+func (m *httpMetrics) requestFinished(method string, status int, duration time.Duration, bytesRead, bytesWritten int64) {
+	atomic.AddInt64(&m.inFlight, -1)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestMetricKey{method, status}]++
+	m.duration.observe(duration.Seconds())
+
+	if bytesRead > 0 {
+		m.uploadBytes.observe(float64(bytesRead))
+	}
+
+	if bytesWritten > 0 {
+		m.downloadBytes.observe(float64(bytesWritten))
+	}
+}
+
+// requestsInFlight returns the number of requests currently being served.
+func (m *httpMetrics) requestsInFlight() int64 {
+	return atomic.LoadInt64(&m.inFlight)
+}
+
+func (m *httpMetrics) ServeHTTP(respWr http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		respWr.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	respWr.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	err := m.write(respWr)
+
+	if err != nil {
+		getReqLogger("HTTP_"+req.Method, req.RequestURI).finish("failed to write metrics: "+err.Error(), errorLevel, false)
+	}
+}
+
+func (m *httpMetrics) write(wr io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	bufWr := bufio.NewWriter(wr)
+
+	keys := make([]requestMetricKey, 0, len(m.requests))
+	for k := range m.requests {
+		keys = append(keys, k)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].status < keys[j].status
+	})
+
+	writeMetricHeader(bufWr, "remotesrv_http_requests_total", "counter", "Total number of http requests by method and status code.")
+	for _, k := range keys {
+		fmt.Fprintf(bufWr, "remotesrv_http_requests_total{method=%q,status=\"%d\"} %d\n", k.method, k.status, m.requests[k])
+	}
+
+	writeMetricHeader(bufWr, "remotesrv_http_requests_in_flight", "gauge", "Number of http requests currently being served.")
+	fmt.Fprintf(bufWr, "remotesrv_http_requests_in_flight %d\n", m.requestsInFlight())
+
+	if m.concurrency != nil {
+		writeMetricHeader(bufWr, "remotesrv_http_concurrency_limit", "gauge", "Maximum number of http requests served at once.")
+		fmt.Fprintf(bufWr, "remotesrv_http_concurrency_limit %d\n", m.concurrency.limit())
+		writeMetricHeader(bufWr, "remotesrv_http_requests_active", "gauge", "Number of http requests holding one of the concurrency limit's slots.")
+		fmt.Fprintf(bufWr, "remotesrv_http_requests_active %d\n", m.concurrency.inUse())
+		writeMetricHeader(bufWr, "remotesrv_http_requests_queued", "gauge", "Number of http requests waiting for one of the concurrency limit's slots.")
+		fmt.Fprintf(bufWr, "remotesrv_http_requests_queued %d\n", m.concurrency.queuedRequests())
+	}
+
+	m.duration.write(bufWr, "remotesrv_http_request_duration_seconds", "Duration of http requests in seconds.")
+	m.uploadBytes.write(bufWr, "remotesrv_http_upload_bytes", "Size of http request bodies in bytes.")
+	m.downloadBytes.write(bufWr, "remotesrv_http_download_bytes", "Size of http response bodies in bytes.")
+
+	return bufWr.Flush()
+}
+
+func writeMetricHeader(wr io.Writer, name, metricType, help string) {
+	fmt.Fprintf(wr, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+// histogram is a cumulative histogram with fixed upper bounds. It is not safe for concurrent use.
+type histogram struct {
+	bounds []float64
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(v float64) {
+	for i, bound := range h.bounds {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+
+	h.sum += v
+	h.count++
+}
+
+func (h *histogram) write(wr io.Writer, name, help string) {
+	writeMetricHeader(wr, name, "histogram", help)
+	for i, bound := range h.bounds {
+		fmt.Fprintf(wr, "%s_bucket{le=\"%s\"} %d\n", name, strconv.FormatFloat(bound, 'g', -1, 64), h.counts[i])
+	}
+
+	fmt.Fprintf(wr, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(wr, "%s_sum %s\n", name, strconv.FormatFloat(h.sum, 'g', -1, 64))
+	fmt.Fprintf(wr, "%s_count %d\n", name, h.count)
+}
+
+// countingReadCloser counts the bytes read through it
+type countingReadCloser struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,81 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func scrapeMetrics(t *testing.T, m *httpMetrics) string {
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	return rec.Body.String()
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	fh := newTestHandler(t)
+	fh.metrics = newHttpMetrics()
+
+	data := []byte("some table file data")
+	fileId := expectUpload(t, data)
+
+	resp := doRequest(fh, httptest.NewRequest(http.MethodPost, fileUrl(testOrg, testRepo, fileId), bytes.NewReader(data)))
+	require.Equal(t, http.StatusCreated, resp.Code)
+
+	resp = doRequest(fh, httptest.NewRequest(http.MethodGet, fileUrl(testOrg, testRepo, fileId), nil))
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	resp = doRequest(fh, httptest.NewRequest(http.MethodGet, fileUrl(testOrg, testRepo, fileId), nil))
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	scraped := scrapeMetrics(t, fh.metrics)
+	assert.Contains(t, scraped, `remotesrv_http_requests_total{method="POST",status="201"} 1`)
+	assert.Contains(t, scraped, `remotesrv_http_requests_total{method="GET",status="200"} 2`)
+	assert.Contains(t, scraped, "remotesrv_http_requests_in_flight 0")
+	assert.Contains(t, scraped, "remotesrv_http_request_duration_seconds_count 3")
+	assert.Contains(t, scraped, "remotesrv_http_upload_bytes_count 1")
+	assert.Contains(t, scraped, "remotesrv_http_upload_bytes_sum 20")
+	assert.Contains(t, scraped, "remotesrv_http_download_bytes_sum 40")
+}
+
+func TestMetricsInFlight(t *testing.T) {
+	m := newHttpMetrics()
+	m.requestStarted()
+	m.requestStarted()
+	assert.Equal(t, int64(2), m.requestsInFlight())
+	assert.Contains(t, scrapeMetrics(t, m), "remotesrv_http_requests_in_flight 2")
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	h := newHistogram([]float64{1, 10})
+	h.observe(0.5)
+	h.observe(5)
+	h.observe(50)
+
+	buf := &bytes.Buffer{}
+	h.write(buf, "test", "test histogram")
+	assert.Contains(t, buf.String(), `test_bucket{le="1"} 1`)
+	assert.Contains(t, buf.String(), `test_bucket{le="10"} 2`)
+	assert.Contains(t, buf.String(), `test_bucket{le="+Inf"} 3`)
+	assert.Contains(t, buf.String(), "test_sum 55.5")
+}
@@ -0,0 +1,278 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// errQuotaExceeded is returned when reserving space for an upload which would take its repo over its quota.
+var errQuotaExceeded = errors.New("upload exceeds the repo's quota")
+
+// repoQuotas holds the most bytes of table files each repo may store. Repos without a quota of their own have the
+// default quota. A quota of 0 means there is no limit.
+//
+// The space used by a repo is listed from storage the first time its quota is checked, and is then kept up to date
+// as files are uploaded and deleted. Uploads reserve their size before they are written, so concurrent uploads can't
+// take a repo over its quota together.
+type repoQuotas struct {
+	defaultQuota int64
+	quotas       map[string]int64
+
+	mu    *sync.Mutex
+	usage map[string]*repoUsage
+}
+
+// repoUsage is the space used by a repo with a quota.
+type repoUsage struct {
+	// files are the sizes of the stored files by file id, and stored is their total
+	files  map[string]int64
+	stored int64
+
+	// reserved is the number of bytes reserved by uploads which are being written
+	reserved int64
+}
+
+func newRepoQuotas(defaultQuota int64) *repoQuotas {
+	return &repoQuotas{
+		defaultQuota: defaultQuota,
+		quotas:       make(map[string]int64),
+		mu:           &sync.Mutex{},
+		usage:        make(map[string]*repoUsage),
+	}
+}
+
+// loadRepoQuotas reads the quotas of individual repos from the file at |path|. Each line holds an org/repo and its
+// quota in bytes, separated by whitespace. Blank lines and lines beginning with # are ignored.
+func loadRepoQuotas(path string, defaultQuota int64) (*repoQuotas, error) {
+	f, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	rq := newRepoQuotas(defaultQuota)
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected an org/repo and a quota", path, lineNum)
+		}
+
+		org, repo, ok := splitRepoPath(fields[0])
+
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: '%s' is not an org/repo", path, lineNum, fields[0])
+		}
+
+		quota, err := strconv.ParseInt(fields[1], 10, 64)
+
+		if err != nil || quota < 0 {
+			return nil, fmt.Errorf("%s:%d: '%s' is not a quota in bytes", path, lineNum, fields[1])
+		}
+
+		rq.set(org, repo, quota)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return rq, nil
+}
+
+// splitRepoPath splits |path| into an org and a repo which are both valid path tokens.
+func splitRepoPath(path string) (string, string, bool) {
+	i := strings.IndexByte(path, '/')
+
+	if i == -1 || !validPathToken(path[:i]) || !validPathToken(path[i+1:]) {
+		return "", "", false
+	}
+
+	return path[:i], path[i+1:], true
+}
+
+func (rq *repoQuotas) set(org, repo string, quota int64) {
+	rq.quotas[org+"/"+repo] = quota
+}
+
+// quota returns the quota of |org|/|repo|.
+func (rq *repoQuotas) quota(org, repo string) int64 {
+	if quota, ok := rq.quotas[org+"/"+repo]; ok {
+		return quota
+	}
+
+	return rq.defaultQuota
+}
+
+// listRepoUsage lists the sizes of the blobs stored for |org|/|repo|.
+func listRepoUsage(ctx context.Context, store BlobStore, org, repo string) (*repoUsage, error) {
+	usage := &repoUsage{files: make(map[string]int64)}
+	after := ""
+	for {
+		listing, err := store.List(ctx, org, repo, after, maxListLimit)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, blob := range listing {
+			usage.files[blob.FileId] = blob.Size
+			usage.stored += blob.Size
+		}
+
+		if len(listing) < maxListLimit {
+			return usage, nil
+		}
+
+		after = listing[len(listing)-1].FileId
+	}
+}
+
+// repoUsage returns the usage of |org|/|repo|, listing it from |store| if it hasn't been yet. Its fields are guarded
+// by the mutex.
+func (rq *repoQuotas) repoUsage(ctx context.Context, store BlobStore, org, repo string) (*repoUsage, error) {
+	id := org + "/" + repo
+
+	rq.mu.Lock()
+	usage, ok := rq.usage[id]
+	rq.mu.Unlock()
+
+	if ok {
+		return usage, nil
+	}
+
+	// the listing is made without holding the mutex so that uploads to other repos aren't held up by it
+	listed, err := listRepoUsage(ctx, store, org, repo)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rq.mu.Lock()
+	defer rq.mu.Unlock()
+
+	if usage, ok = rq.usage[id]; !ok {
+		usage = listed
+		rq.usage[id] = usage
+	}
+
+	return usage, nil
+}
+
+// reserve reserves |size| bytes of the quota of |org|/|repo| for an upload of |fileId|, failing with errQuotaExceeded
+// if there isn't enough space left. An existing file named |fileId| would be replaced, so its size is not counted
+// against the quota. A negative |size| reserves whatever is left of the quota. The returned reservation is nil if the
+// repo has no quota.
+func (rq *repoQuotas) reserve(ctx context.Context, store BlobStore, org, repo, fileId string, size int64) (*quotaReservation, error) {
+	quota := rq.quota(org, repo)
+
+	if quota <= 0 {
+		return nil, nil
+	}
+
+	usage, err := rq.repoUsage(ctx, store, org, repo)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rq.mu.Lock()
+	defer rq.mu.Unlock()
+
+	used := usage.stored - usage.files[fileId] + usage.reserved
+
+	if size < 0 && used < quota {
+		size = quota - used
+	}
+
+	if size < 0 || used+size > quota {
+		return nil, fmt.Errorf("%w: %d of the %d bytes of %s/%s are used", errQuotaExceeded, used, quota, org, repo)
+	}
+
+	usage.reserved += size
+	return &quotaReservation{rq: rq, usage: usage, fileId: fileId, size: size}, nil
+}
+
+// deleted records that |fileId| is no longer stored for |org|/|repo|.
+func (rq *repoQuotas) deleted(org, repo, fileId string) {
+	rq.mu.Lock()
+	defer rq.mu.Unlock()
+
+	if usage, ok := rq.usage[org+"/"+repo]; ok {
+		usage.stored -= usage.files[fileId]
+		delete(usage.files, fileId)
+	}
+}
+
+// quotaReservation is space in a repo's quota reserved for an upload. Exactly one of stored and release must be
+// called once the upload is finished. The methods of a nil reservation, for a repo without a quota, do nothing.
+type quotaReservation struct {
+	rq     *repoQuotas
+	usage  *repoUsage
+	fileId string
+	size   int64
+}
+
+// stored records that the upload was stored, with a size of |size| bytes, and frees the reservation.
+func (res *quotaReservation) stored(size int64) {
+	if res == nil {
+		return
+	}
+
+	res.rq.mu.Lock()
+	defer res.rq.mu.Unlock()
+
+	res.usage.reserved -= res.size
+	res.usage.stored += size - res.usage.files[res.fileId]
+	res.usage.files[res.fileId] = size
+}
+
+// release frees the reservation of an upload which was not stored.
+func (res *quotaReservation) release() {
+	if res == nil {
+		return
+	}
+
+	res.rq.mu.Lock()
+	defer res.rq.mu.Unlock()
+
+	res.usage.reserved -= res.size
+}
+
+// reserveQuota reserves |size| bytes for an upload of |fileId| if the handler limits the size of repos.
+func (fh *fileHandler) reserveQuota(ctx context.Context, org, repo, fileId string, size int64) (*quotaReservation, error) {
+	if fh.quotas == nil {
+		return nil, nil
+	}
+
+	return fh.quotas.reserve(ctx, fh.store, org, repo, fileId, size)
+}
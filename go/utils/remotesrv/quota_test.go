@@ -0,0 +1,179 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepoQuota(t *testing.T) {
+	fh := newTestHandler(t)
+	fh.quotas = newRepoQuotas(64)
+	fh.quotas.set(testOrg, "big", 128)
+	fh.quotas.set(testOrg, "unlimited", 0)
+
+	upload := func(repo string, data []byte) int {
+		fileId := expectUpload(t, data)
+		return doRequest(fh, httptest.NewRequest(http.MethodPost, fileUrl(testOrg, repo, fileId), bytes.NewReader(data))).Code
+	}
+
+	first := bytes.Repeat([]byte("a"), 40)
+	require.Equal(t, http.StatusCreated, upload(testRepo, first))
+	require.Equal(t, http.StatusCreated, upload(testRepo, bytes.Repeat([]byte("b"), 24)))
+
+	// the repo is full
+	over := []byte("c")
+	overId := expectUpload(t, over)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, upload(testRepo, over))
+	assert.NoFileExists(t, filepath.Join(testRoot(fh), testOrg, testRepo, overId))
+
+	// as is an upload which doesn't declare its length
+	req := httptest.NewRequest(http.MethodPost, fileUrl(testOrg, testRepo, overId), io.MultiReader(bytes.NewReader(over)))
+	req.ContentLength = -1
+	assert.Equal(t, http.StatusRequestEntityTooLarge, doRequest(fh, req).Code)
+	assert.NoFileExists(t, filepath.Join(testRoot(fh), testOrg, testRepo, overId))
+
+	// replacing a stored file doesn't count its existing size against the quota
+	assert.Equal(t, http.StatusOK, upload(testRepo, first))
+
+	// deleting a file frees its space
+	rec := doRequest(fh, httptest.NewRequest(http.MethodDelete, fileUrl(testOrg, testRepo, expectUpload(t, first)), nil))
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, http.StatusCreated, upload(testRepo, over))
+
+	// each repo has its own quota
+	assert.Equal(t, http.StatusCreated, upload("other", over))
+	assert.Equal(t, http.StatusCreated, upload("big", bytes.Repeat([]byte("d"), 100)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, upload("big", bytes.Repeat([]byte("e"), 29)))
+	assert.Equal(t, http.StatusCreated, upload("unlimited", bytes.Repeat([]byte("f"), 1000)))
+}
+
+func TestRepoQuotaUnregisteredLength(t *testing.T) {
+	fh := newTestHandler(t)
+	fh.quotas = newRepoQuotas(64)
+
+	// older clients register their uploads without a length
+	upload := func(repo string, data []byte, contentLength int64) int {
+		md5Hash := md5.Sum(data)
+		fileId := expectUploadDetails(t, string(data), 0, md5Hash[:])
+		req := httptest.NewRequest(http.MethodPost, fileUrl(testOrg, repo, fileId), io.MultiReader(bytes.NewReader(data)))
+		req.ContentLength = contentLength
+		return doRequest(fh, req).Code
+	}
+
+	// the length of the request is reserved instead
+	data := bytes.Repeat([]byte("h"), 40)
+	require.Equal(t, http.StatusCreated, upload(testRepo, data, int64(len(data))))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, upload(testRepo, bytes.Repeat([]byte("i"), 25), 25))
+
+	// or the rest of the quota if the request doesn't declare its length either
+	require.Equal(t, http.StatusCreated, upload(testRepo, bytes.Repeat([]byte("j"), 20), -1))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, upload(testRepo, bytes.Repeat([]byte("k"), 5), -1))
+
+	// or the maximum upload size, if there is one, however little is sent
+	fh.maxUploadSize = 48
+	require.Equal(t, http.StatusCreated, upload("other", bytes.Repeat([]byte("l"), 40), -1))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, upload("other", bytes.Repeat([]byte("m"), 4), -1))
+}
+
+func TestRepoQuotaReservations(t *testing.T) {
+	ctx := context.Background()
+	store := newMemBlobStore()
+	require.NoError(t, store.Put(ctx, testOrg, testRepo, "stored", bytes.NewReader(make([]byte, 20)), nil))
+	rq := newRepoQuotas(64)
+
+	// concurrent uploads can't reserve more than the quota between them
+	first, err := rq.reserve(ctx, store, testOrg, testRepo, "first", 30)
+	require.NoError(t, err)
+	_, err = rq.reserve(ctx, store, testOrg, testRepo, "second", 30)
+	assert.True(t, errors.Is(err, errQuotaExceeded))
+
+	// the space reserved by an upload which failed is freed
+	first.release()
+	second, err := rq.reserve(ctx, store, testOrg, testRepo, "second", 30)
+	require.NoError(t, err)
+	second.stored(30)
+	_, err = rq.reserve(ctx, store, testOrg, testRepo, "third", 15)
+	assert.True(t, errors.Is(err, errQuotaExceeded))
+
+	// replacing a stored file only counts its new size
+	replace, err := rq.reserve(ctx, store, testOrg, testRepo, "stored", 34)
+	require.NoError(t, err)
+	replace.release()
+
+	// files are only listed from storage once, so deletions are recorded as they are made
+	rq.deleted(testOrg, testRepo, "stored")
+	third, err := rq.reserve(ctx, store, testOrg, testRepo, "third", 34)
+	require.NoError(t, err)
+	third.stored(34)
+
+	// a repo without a quota has nothing to reserve
+	unlimited, err := newRepoQuotas(0).reserve(ctx, store, testOrg, testRepo, "fourth", 1000)
+	require.NoError(t, err)
+	assert.Nil(t, unlimited)
+	unlimited.stored(1000)
+}
+
+func TestRepoQuotaResumableUpload(t *testing.T) {
+	fh := newTestHandler(t)
+	fh.quotas = newRepoQuotas(64)
+
+	data := bytes.Repeat([]byte("g"), 65)
+	fileId := expectUpload(t, data)
+	sessionUrl := startSession(t, fh, fileId)
+	require.Equal(t, http.StatusNoContent, sendPart(fh, sessionUrl, 0, data).Code)
+
+	rec := doRequest(fh, httptest.NewRequest(http.MethodPut, sessionUrl, nil))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	assert.NoFileExists(t, filepath.Join(testRoot(fh), testOrg, testRepo, fileId))
+}
+
+func TestLoadRepoQuotas(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quotas")
+	require.NoError(t, os.WriteFile(path, []byte("# quotas\n\norg/repo 1024\n  org/other\t0\n"), 0600))
+
+	rq, err := loadRepoQuotas(path, 64)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1024), rq.quota("org", "repo"))
+	assert.Equal(t, int64(0), rq.quota("org", "other"))
+	assert.Equal(t, int64(64), rq.quota("org", "unlisted"))
+
+	invalid := []string{
+		"org/repo\n",
+		"org/repo 1024 extra\n",
+		"repo 1024\n",
+		"org/../repo 1024\n",
+		"org/repo lots\n",
+		"org/repo -1\n",
+	}
+
+	for _, contents := range invalid {
+		require.NoError(t, os.WriteFile(path, []byte(contents), 0600))
+		_, err = loadRepoQuotas(path, 64)
+		assert.Error(t, err, contents)
+	}
+}
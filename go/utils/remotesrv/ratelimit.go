@@ -0,0 +1,133 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// rateLimiter limits the rate of requests from each client using a token bucket per client. Each bucket holds up to
+// |burst| tokens and is refilled at |rate| tokens per second. Every request takes a token, and a request which finds
+// its client's bucket empty is rejected.
+type rateLimiter struct {
+	mu      *sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*tokenBucket
+	now     func() time.Time
+
+	// pruneAt is the number of buckets at which full buckets are removed. A full bucket behaves in the same way as a
+	// missing one, so removing them bounds the memory used by clients which have stopped sending requests.
+	pruneAt int
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+const minRateLimiterPruneAt = 1024
+
+// newRateLimiter creates a rateLimiter which allows each client |rate| requests per second with bursts of up to
+// |burst| requests.
+func newRateLimiter(rate float64, burst int, now func() time.Time) *rateLimiter {
+	return &rateLimiter{
+		mu:      &sync.Mutex{},
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*tokenBucket),
+		now:     now,
+		pruneAt: minRateLimiterPruneAt,
+	}
+}
+
+// allow takes a token from the bucket of the client identified by |key|. If the bucket is empty it returns false
+// along with how long the client must wait before a token is available.
+func (rl *rateLimiter) allow(key string) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := rl.now()
+	b, ok := rl.buckets[key]
+
+	if !ok {
+		if len(rl.buckets) >= rl.pruneAt {
+			rl.prune(now)
+		}
+
+		b = &tokenBucket{tokens: rl.burst, last: now}
+		rl.buckets[key] = b
+	} else {
+		b.refill(now, rl.rate, rl.burst)
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - b.tokens) / rl.rate * float64(time.Second))
+	return false, wait
+}
+
+func (b *tokenBucket) refill(now time.Time, rate, burst float64) {
+	elapsed := now.Sub(b.last).Seconds()
+
+	if elapsed > 0 {
+		b.tokens = math.Min(burst, b.tokens+elapsed*rate)
+		b.last = now
+	}
+}
+
+func (rl *rateLimiter) prune(now time.Time) {
+	for key, b := range rl.buckets {
+		b.refill(now, rl.rate, rl.burst)
+
+		if b.tokens >= rl.burst {
+			delete(rl.buckets, key)
+		}
+	}
+
+	rl.pruneAt = 2 * len(rl.buckets)
+	if rl.pruneAt < minRateLimiterPruneAt {
+		rl.pruneAt = minRateLimiterPruneAt
+	}
+}
+
+// clientIP returns the IP address of the client which sent |req|.
+func clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+
+	if err != nil {
+		return req.RemoteAddr
+	}
+
+	return host
+}
+
+// retryAfterSeconds converts a wait into the whole number of seconds sent in a Retry-After header.
+func retryAfterSeconds(wait time.Duration) int64 {
+	secs := int64(math.Ceil(wait.Seconds()))
+
+	if secs < 1 {
+		return 1
+	}
+
+	return secs
+}
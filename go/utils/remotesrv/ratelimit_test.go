@@ -0,0 +1,113 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter(t *testing.T) {
+	clock := newFakeClock()
+	rl := newRateLimiter(2, 3, clock.Now)
+
+	for i := 0; i < 3; i++ {
+		ok, _ := rl.allow("a")
+		assert.True(t, ok)
+	}
+
+	ok, wait := rl.allow("a")
+	assert.False(t, ok)
+	assert.Equal(t, 500*time.Millisecond, wait)
+
+	// other clients have their own buckets
+	ok, _ = rl.allow("b")
+	assert.True(t, ok)
+
+	clock.Advance(500 * time.Millisecond)
+	ok, _ = rl.allow("a")
+	assert.True(t, ok)
+	ok, _ = rl.allow("a")
+	assert.False(t, ok)
+
+	// a bucket never holds more than the burst
+	clock.Advance(time.Hour)
+	for i := 0; i < 3; i++ {
+		ok, _ := rl.allow("a")
+		assert.True(t, ok)
+	}
+	ok, _ = rl.allow("a")
+	assert.False(t, ok)
+}
+
+func TestRateLimiterPrunesFullBuckets(t *testing.T) {
+	clock := newFakeClock()
+	rl := newRateLimiter(1, 1, clock.Now)
+
+	for i := 0; i < minRateLimiterPruneAt; i++ {
+		rl.allow(fmt.Sprintf("client-%d", i))
+	}
+	require.Len(t, rl.buckets, minRateLimiterPruneAt)
+
+	clock.Advance(time.Second)
+	rl.allow("recent")
+	assert.Len(t, rl.buckets, 1)
+
+	// a client which was pruned still gets a full bucket
+	ok, _ := rl.allow("client-0")
+	assert.True(t, ok)
+}
+
+func TestRateLimitedRequests(t *testing.T) {
+	fh := newTestHandler(t)
+	clock := newFakeClock()
+	fh.limiter = newRateLimiter(0.5, 2, clock.Now)
+	fileId := writeTestFile(t, fh, []byte("0123456789"))
+
+	get := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, fileUrl(testOrg, testRepo, fileId), nil)
+		req.RemoteAddr = remoteAddr
+		return doRequest(fh, req)
+	}
+
+	assert.Equal(t, http.StatusOK, get("10.0.0.1:1234").Code)
+	assert.Equal(t, http.StatusOK, get("10.0.0.1:1235").Code)
+
+	for i := 0; i < 3; i++ {
+		rec := get("10.0.0.1:1236")
+		assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+		assert.Equal(t, "2", rec.Header().Get("Retry-After"))
+		assert.Empty(t, rec.Body.Bytes())
+	}
+
+	assert.Equal(t, http.StatusOK, get("10.0.0.2:1234").Code)
+
+	clock.Advance(2 * time.Second)
+	assert.Equal(t, http.StatusOK, get("10.0.0.1:1234").Code)
+	assert.Equal(t, http.StatusTooManyRequests, get("10.0.0.1:1234").Code)
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	assert.Equal(t, int64(1), retryAfterSeconds(0))
+	assert.Equal(t, int64(1), retryAfterSeconds(10*time.Millisecond))
+	assert.Equal(t, int64(1), retryAfterSeconds(time.Second))
+	assert.Equal(t, int64(2), retryAfterSeconds(1500*time.Millisecond))
+}
@@ -0,0 +1,162 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// logLevel is the verbosity of the server's logs.
+type logLevel int
+
+const (
+	// errorLevel only logs the requests which fail.
+	errorLevel logLevel = iota
+
+	// infoLevel logs a single line summarizing each request.
+	infoLevel
+
+	// debugLevel also logs every step taken to serve each request.
+	debugLevel
+)
+
+// logVerbosity is the logLevel of the server's logs.
+var logVerbosity = infoLevel
+
+// parseLogLevel parses the name of a logLevel, which is one of "error", "info" or "debug".
+func parseLogLevel(level string) (logLevel, error) {
+	switch strings.ToLower(level) {
+	case "error":
+		return errorLevel, nil
+	case "info":
+		return infoLevel, nil
+	case "debug":
+		return debugLevel, nil
+	default:
+		return 0, fmt.Errorf("unknown log level '%s'. expected 'error', 'info' or 'debug'", level)
+	}
+}
+
+// requestLogger logs the messages of a single request. The steps taken to serve the request are only logged at
+// debugLevel, while the line summarizing the request when it finishes is logged at the level it is given.
+type requestLogger struct {
+	write func(msg string)
+
+	// lastStep is the most recent step logged
+	lastStep string
+}
+
+// log logs a step taken to serve the request.
+func (rl *requestLogger) log(msg string) {
+	rl.lastStep = msg
+
+	if logVerbosity >= debugLevel {
+		rl.write(msg)
+	}
+}
+
+// finish logs the line summarizing the request at |level|. When steps are not being logged the summary of an
+// |unsuccessful| request includes its last step, which usually describes what went wrong.
+func (rl *requestLogger) finish(msg string, level logLevel, unsuccessful bool) {
+	if unsuccessful && logVerbosity < debugLevel && rl.lastStep != "" {
+		msg += ". last step: " + rl.lastStep
+	}
+
+	if logVerbosity >= level {
+		rl.write(msg)
+	}
+}
+
+// requestLogEntry is a single structured log line for an http request. The status, bytes and duration are only set on
+// the final line logged for the request.
+type requestLogEntry struct {
+	CallId     string  `json:"call_id"`
+	Method     string  `json:"method"`
+	URI        string  `json:"uri"`
+	Org        string  `json:"org,omitempty"`
+	Repo       string  `json:"repo,omitempty"`
+	FileId     string  `json:"file_id,omitempty"`
+	Status     int     `json:"status,omitempty"`
+	Bytes      int64   `json:"bytes,omitempty"`
+	DurationMs float64 `json:"duration_ms,omitempty"`
+	Msg        string  `json:"msg"`
+}
+
+// getReqLogger returns the logger for a single http request. Unless json logging is enabled this is the same text
+// logger used by the grpc service. Otherwise each message is written as a JSON object containing the current state of
+// |entry|.
+func (fh *fileHandler) getReqLogger(entry *requestLogEntry) *requestLogger {
+	if fh.jsonLog == nil {
+		return getReqLogger("HTTP_"+entry.Method, entry.URI)
+	}
+
+	entry.CallId = fmt.Sprintf("HTTP_%s(%05d)", entry.Method, incReqId())
+	return &requestLogger{write: func(msg string) {
+		line := *entry
+		line.Msg = msg
+
+		data, err := json.Marshal(line)
+
+		if err != nil {
+			log.Println(line.CallId, "- failed to marshal log entry:", err)
+			return
+		}
+
+		fh.jsonLog.Println(string(data))
+	}}
+}
+
+// statusWriter wraps an http.ResponseWriter and records the status code and number of bytes written.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	n      int64
+}
+
+func (sw *statusWriter) WriteHeader(statusCode int) {
+	if sw.status == 0 {
+		sw.status = statusCode
+	}
+
+	sw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (sw *statusWriter) Write(p []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+
+	n, err := sw.ResponseWriter.Write(p)
+	sw.n += int64(n)
+	return n, err
+}
+
+// statusCode returns the status code of the response, which is http.StatusOK if nothing has been written.
+func (sw *statusWriter) statusCode() int {
+	if sw.status == 0 {
+		return http.StatusOK
+	}
+
+	return sw.status
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,178 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dolthub/dolt/go/store/hash"
+)
+
+func TestStatusWriter(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		status  int
+		body    string
+	}{
+		{
+			name: "explicit status",
+			handler: func(wr http.ResponseWriter, req *http.Request) {
+				wr.WriteHeader(http.StatusCreated)
+				_, _ = wr.Write([]byte("created"))
+			},
+			status: http.StatusCreated,
+			body:   "created",
+		},
+		{
+			name: "implicit status",
+			handler: func(wr http.ResponseWriter, req *http.Request) {
+				_, _ = wr.Write([]byte("hello "))
+				_, _ = wr.Write([]byte("world"))
+			},
+			status: http.StatusOK,
+			body:   "hello world",
+		},
+		{
+			name:    "no response",
+			handler: func(wr http.ResponseWriter, req *http.Request) {},
+			status:  http.StatusOK,
+			body:    "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			sw := &statusWriter{ResponseWriter: rec}
+			test.handler(sw, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			assert.Equal(t, test.status, sw.statusCode())
+			assert.Equal(t, rec.Code, sw.statusCode())
+			assert.Equal(t, int64(len(test.body)), sw.n)
+			assert.Equal(t, test.body, rec.Body.String())
+		})
+	}
+}
+
+// setLogVerbosity sets the logLevel of the server's logs for the duration of a test.
+func setLogVerbosity(t *testing.T, level logLevel) {
+	prev := logVerbosity
+	logVerbosity = level
+	t.Cleanup(func() {
+		logVerbosity = prev
+	})
+}
+
+func TestParseLogLevel(t *testing.T) {
+	for name, expected := range map[string]logLevel{"error": errorLevel, "info": infoLevel, "debug": debugLevel, "DEBUG": debugLevel} {
+		level, err := parseLogLevel(name)
+		require.NoError(t, err)
+		assert.Equal(t, expected, level)
+	}
+
+	_, err := parseLogLevel("trace")
+	assert.Error(t, err)
+}
+
+// brokenBlobStore fails every Stat.
+type brokenBlobStore struct {
+	*memBlobStore
+}
+
+func (bs brokenBlobStore) Stat(ctx context.Context, org, repo, fileId string) (BlobInfo, error) {
+	return BlobInfo{}, errors.New("disk on fire")
+}
+
+// logRequest serves |req| with |fh| and returns the messages which were logged.
+func logRequest(t *testing.T, fh *fileHandler, req *http.Request, expectedStatus int) []string {
+	buf := &bytes.Buffer{}
+	fh.jsonLog = log.New(buf, "", 0)
+	rec := doRequest(fh, req)
+	require.Equal(t, expectedStatus, rec.Code)
+
+	var msgs []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line != "" {
+			var entry requestLogEntry
+			require.NoError(t, json.Unmarshal([]byte(line), &entry))
+			msgs = append(msgs, entry.Msg)
+		}
+	}
+
+	return msgs
+}
+
+func TestLogLevels(t *testing.T) {
+	fh := newTestHandler(t)
+	fileId := writeTestFile(t, fh, []byte("0123456789"))
+	missingId := hash.Of([]byte("missing")).String()
+	broken := newFileHandler(brokenBlobStore{newMemBlobStore()})
+
+	upload := func() *http.Request {
+		data := []byte("a table file which is uploaded while logging")
+		return httptest.NewRequest(http.MethodPost, fileUrl(testOrg, testRepo, expectUpload(t, data)), bytes.NewReader(data))
+	}
+
+	get := func(fileId string) *http.Request {
+		return httptest.NewRequest(http.MethodGet, fileUrl(testOrg, testRepo, fileId), nil)
+	}
+
+	t.Run("debug", func(t *testing.T) {
+		setLogVerbosity(t, debugLevel)
+		msgs := logRequest(t, fh, upload(), http.StatusCreated)
+		assert.Greater(t, len(msgs), 1)
+		assert.True(t, strings.HasPrefix(msgs[len(msgs)-1], "finished. status: 201"), msgs[len(msgs)-1])
+	})
+
+	t.Run("info", func(t *testing.T) {
+		setLogVerbosity(t, infoLevel)
+		msgs := logRequest(t, fh, upload(), http.StatusOK)
+		require.Len(t, msgs, 1)
+		assert.True(t, strings.HasPrefix(msgs[0], "finished. status: 200"), msgs[0])
+
+		msgs = logRequest(t, fh, get(fileId), http.StatusOK)
+		require.Len(t, msgs, 1)
+		assert.True(t, strings.HasPrefix(msgs[0], "finished. status: 200"), msgs[0])
+
+		// the summary of an unsuccessful request says what went wrong
+		msgs = logRequest(t, fh, get(missingId), http.StatusNotFound)
+		require.Len(t, msgs, 1)
+		assert.Contains(t, msgs[0], "finished. status: 404")
+		assert.Contains(t, msgs[0], "last step: failed to stat")
+	})
+
+	t.Run("error", func(t *testing.T) {
+		setLogVerbosity(t, errorLevel)
+		assert.Empty(t, logRequest(t, fh, get(fileId), http.StatusOK))
+		assert.Empty(t, logRequest(t, fh, get(missingId), http.StatusNotFound))
+
+		msgs := logRequest(t, broken, get(fileId), http.StatusInternalServerError)
+		require.Len(t, msgs, 1)
+		assert.Contains(t, msgs[0], "finished. status: 500")
+		assert.Contains(t, msgs[0], "disk on fire")
+	})
+}
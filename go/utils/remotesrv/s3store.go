@@ -0,0 +1,279 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// s3svc is the subset of the S3 api used by s3Store.
+type s3svc interface {
+	GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error)
+	PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error)
+	HeadObjectWithContext(ctx aws.Context, input *s3.HeadObjectInput, opts ...request.Option) (*s3.HeadObjectOutput, error)
+	DeleteObjectWithContext(ctx aws.Context, input *s3.DeleteObjectInput, opts ...request.Option) (*s3.DeleteObjectOutput, error)
+	ListObjectsV2WithContext(ctx aws.Context, input *s3.ListObjectsV2Input, opts ...request.Option) (*s3.ListObjectsV2Output, error)
+}
+
+// s3Store stores table files as objects in an S3 bucket, with keys of the form prefix/org/repo/fileId.
+type s3Store struct {
+	s3     s3svc
+	bucket string
+	prefix string
+
+	// tmpDir is the directory uploads are spooled to before they are validated and sent to S3. The default temp
+	// directory is used if it is empty.
+	tmpDir   string
+	tmpFiles *tempFileSet
+}
+
+var _ BlobStore = (*s3Store)(nil)
+
+func newS3Store(s3 s3svc, bucket, prefix string) *s3Store {
+	return &s3Store{s3: s3, bucket: bucket, prefix: prefix, tmpFiles: newTempFileSet()}
+}
+
+func (ss *s3Store) key(org, repo, fileId string) string {
+	return path.Join(ss.prefix, org, repo, fileId)
+}
+
+// Get implements BlobStore.
+func (ss *s3Store) Get(ctx context.Context, org, repo, fileId string) (io.ReadCloser, int64, error) {
+	result, err := ss.s3.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(ss.bucket),
+		Key:    aws.String(ss.key(org, repo, fileId)),
+	})
+
+	if err != nil {
+		return nil, 0, s3BlobErr(err)
+	}
+
+	return result.Body, aws.Int64Value(result.ContentLength), nil
+}
+
+// GetRange implements BlobStore.
+func (ss *s3Store) GetRange(ctx context.Context, org, repo, fileId string, offset, length int64) (io.ReadCloser, error) {
+	if offset < 0 || length < 0 {
+		return nil, errInvalidBlobRange
+	}
+
+	if length == 0 {
+		// an empty range can't be expressed in a Range header, so just check that it is within the object
+		info, err := ss.Stat(ctx, org, repo, fileId)
+
+		if err != nil {
+			return nil, err
+		} else if offset > info.Size {
+			return nil, errInvalidBlobRange
+		}
+
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+
+	result, err := ss.s3.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(ss.bucket),
+		Key:    aws.String(ss.key(org, repo, fileId)),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+	})
+
+	if err != nil {
+		return nil, s3BlobErr(err)
+	}
+
+	if aws.Int64Value(result.ContentLength) != length {
+		// S3 truncates ranges which run past the end of the object rather than rejecting them
+		result.Body.Close()
+		return nil, errInvalidBlobRange
+	}
+
+	return result.Body, nil
+}
+
+// Put implements BlobStore. The contents are spooled to a local temp file so that they can be validated before they
+// are sent to S3, which makes the object visible in a single request.
+func (ss *s3Store) Put(ctx context.Context, org, repo, fileId string, rd io.Reader, validate func(io.ReadSeeker) error) error {
+	f, err := os.CreateTemp(ss.tmpDir, fileId+"-*.tmp")
+
+	if err != nil {
+		return err
+	}
+
+	tmpPath := f.Name()
+	ss.tmpFiles.track(tmpPath)
+	defer func() {
+		f.Close()
+		_ = ss.tmpFiles.remove(tmpPath)
+	}()
+
+	size, err := io.Copy(f, rd)
+
+	if err != nil {
+		return err
+	}
+
+	if validate != nil {
+		_, err = f.Seek(0, io.SeekStart)
+
+		if err == nil {
+			err = validate(f)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = f.Seek(0, io.SeekStart)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = ss.s3.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(ss.bucket),
+		Key:           aws.String(ss.key(org, repo, fileId)),
+		Body:          f,
+		ContentLength: aws.Int64(size),
+	})
+
+	return err
+}
+
+// Stat implements BlobStore.
+func (ss *s3Store) Stat(ctx context.Context, org, repo, fileId string) (BlobInfo, error) {
+	result, err := ss.s3.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(ss.bucket),
+		Key:    aws.String(ss.key(org, repo, fileId)),
+	})
+
+	if err != nil {
+		return BlobInfo{}, s3BlobErr(err)
+	}
+
+	return BlobInfo{Size: aws.Int64Value(result.ContentLength), ModTime: aws.TimeValue(result.LastModified)}, nil
+}
+
+// Delete implements BlobStore. S3 deletes succeed whether or not the object exists, so the object is checked for
+// first in order to return errBlobNotFound.
+func (ss *s3Store) Delete(ctx context.Context, org, repo, fileId string) error {
+	_, err := ss.Stat(ctx, org, repo, fileId)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = ss.s3.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(ss.bucket),
+		Key:    aws.String(ss.key(org, repo, fileId)),
+	})
+
+	return s3BlobErr(err)
+}
+
+// List implements BlobStore.
+func (ss *s3Store) List(ctx context.Context, org, repo, after string, limit int) ([]BlobListing, error) {
+	prefix := ss.key(org, repo, "") + "/"
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(ss.bucket),
+		Prefix:  aws.String(prefix),
+		MaxKeys: aws.Int64(int64(limit)),
+	}
+
+	if after != "" {
+		input.StartAfter = aws.String(prefix + after)
+	}
+
+	listing := make([]BlobListing, 0)
+	for len(listing) < limit {
+		result, err := ss.s3.ListObjectsV2WithContext(ctx, input)
+
+		if err != nil {
+			return nil, s3BlobErr(err)
+		}
+
+		for _, obj := range result.Contents {
+			listing = append(listing, BlobListing{FileId: strings.TrimPrefix(aws.StringValue(obj.Key), prefix), Size: aws.Int64Value(obj.Size)})
+		}
+
+		if !aws.BoolValue(result.IsTruncated) {
+			break
+		}
+
+		input.ContinuationToken = result.NextContinuationToken
+		input.MaxKeys = aws.Int64(int64(limit - len(listing)))
+	}
+
+	return listing, nil
+}
+
+// removeTempFiles deletes the spooled uploads of any Puts which are still in progress. Those Puts will fail.
+func (ss *s3Store) removeTempFiles() error {
+	return ss.tmpFiles.removeTempFiles()
+}
+
+// s3BlobErr converts the S3 errors which have BlobStore equivalents.
+func s3BlobErr(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if reqErr, ok := err.(awserr.RequestFailure); ok {
+		switch reqErr.StatusCode() {
+		case http.StatusNotFound:
+			return errBlobNotFound
+		case http.StatusRequestedRangeNotSatisfiable:
+			return errInvalidBlobRange
+		}
+	}
+
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == s3.ErrCodeNoSuchKey {
+		return errBlobNotFound
+	}
+
+	return err
+}
+
+// readinessProbeKey is the key, beneath the prefix, of the object requested to check that the bucket can be reached.
+// It does not need to exist.
+const readinessProbeKey = ".readyz"
+
+// checkReady checks that the bucket can be reached with the configured credentials. A missing object is only
+// reported as not found to credentials which are allowed to list the bucket, so those are required for the check to
+// pass.
+func (ss *s3Store) checkReady(ctx context.Context) error {
+	_, err := ss.s3.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(ss.bucket),
+		Key:    aws.String(path.Join(ss.prefix, readinessProbeKey)),
+	})
+
+	if err = s3BlobErr(err); errors.Is(err, errBlobNotFound) {
+		return nil
+	}
+
+	return err
+}
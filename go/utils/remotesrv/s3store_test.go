@@ -0,0 +1,171 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 is an in memory implementation of the S3 operations used by s3Store, which returns the same errors as S3.
+type fakeS3 struct {
+	mu      *sync.Mutex
+	objects map[string][]byte
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{&sync.Mutex{}, make(map[string][]byte)}
+}
+
+func (m *fakeS3) object(bucket, key *string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, ok := m.objects[*bucket+"/"+*key]
+	return data, ok
+}
+
+func (m *fakeS3) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	data, ok := m.object(input.Bucket, input.Key)
+
+	if !ok {
+		return nil, awserr.NewRequestFailure(awserr.New(s3.ErrCodeNoSuchKey, "The specified key does not exist.", nil), http.StatusNotFound, "")
+	}
+
+	if input.Range != nil {
+		var start, end int
+		_, err := fmt.Sscanf(*input.Range, "bytes=%d-%d", &start, &end)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if start >= len(data) {
+			return nil, awserr.NewRequestFailure(awserr.New("InvalidRange", "The requested range is not satisfiable", nil), http.StatusRequestedRangeNotSatisfiable, "")
+		}
+
+		if end >= len(data) {
+			end = len(data) - 1
+		}
+
+		data = data[start : end+1]
+	}
+
+	return &s3.GetObjectOutput{
+		Body:          io.NopCloser(bytes.NewReader(data)),
+		ContentLength: aws.Int64(int64(len(data))),
+	}, nil
+}
+
+func (m *fakeS3) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	data, err := io.ReadAll(input.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.objects[*input.Bucket+"/"+*input.Key] = data
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (m *fakeS3) HeadObjectWithContext(ctx aws.Context, input *s3.HeadObjectInput, opts ...request.Option) (*s3.HeadObjectOutput, error) {
+	data, ok := m.object(input.Bucket, input.Key)
+
+	if !ok {
+		return nil, awserr.NewRequestFailure(awserr.New("NotFound", "Not Found", nil), http.StatusNotFound, "")
+	}
+
+	return &s3.HeadObjectOutput{ContentLength: aws.Int64(int64(len(data))), LastModified: aws.Time(time.Now())}, nil
+}
+
+func (m *fakeS3) DeleteObjectWithContext(ctx aws.Context, input *s3.DeleteObjectInput, opts ...request.Option) (*s3.DeleteObjectOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.objects, *input.Bucket+"/"+*input.Key)
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+// ListObjectsV2WithContext returns at most one key per page, so that listings have to follow continuation tokens.
+func (m *fakeS3) ListObjectsV2WithContext(ctx aws.Context, input *s3.ListObjectsV2Input, opts ...request.Option) (*s3.ListObjectsV2Output, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	start := aws.StringValue(input.StartAfter)
+	if input.ContinuationToken != nil {
+		start = *input.ContinuationToken
+	}
+
+	bucketPrefix := *input.Bucket + "/"
+	var keys []string
+	for key := range m.objects {
+		key = strings.TrimPrefix(key, bucketPrefix)
+		if strings.HasPrefix(key, aws.StringValue(input.Prefix)) && key > start {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+	output := &s3.ListObjectsV2Output{IsTruncated: aws.Bool(len(keys) > 1)}
+
+	if len(keys) > 0 && aws.Int64Value(input.MaxKeys) > 0 {
+		output.Contents = []*s3.Object{{Key: aws.String(keys[0]), Size: aws.Int64(int64(len(m.objects[bucketPrefix+keys[0]])))}}
+		output.NextContinuationToken = aws.String(keys[0])
+	}
+
+	return output, nil
+}
+
+func TestS3StoreKeys(t *testing.T) {
+	s3 := newFakeS3()
+	store := newS3Store(s3, "bucket", "tables")
+	store.tmpDir = t.TempDir()
+
+	data := []byte("stored under the prefix")
+	require.NoError(t, store.Put(context.Background(), testOrg, testRepo, "fileid", bytes.NewReader(data), nil))
+
+	stored, ok := s3.object(aws.String("bucket"), aws.String("tables/"+testOrg+"/"+testRepo+"/fileid"))
+	require.True(t, ok)
+	assert.Equal(t, data, stored)
+}
+
+func TestS3StorePutRemovesSpooledFile(t *testing.T) {
+	store := newS3Store(newFakeS3(), "bucket", "")
+	store.tmpDir = t.TempDir()
+
+	require.NoError(t, store.Put(context.Background(), testOrg, testRepo, "fileid", bytes.NewReader([]byte("spooled")), nil))
+	spooled, err := os.ReadDir(store.tmpDir)
+	require.NoError(t, err)
+	assert.Empty(t, spooled)
+}
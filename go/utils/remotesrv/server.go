@@ -0,0 +1,277 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	remotesapi "github.com/dolthub/dolt/go/gen/proto/dolt/services/remotesapi/v1alpha1"
+	"github.com/dolthub/dolt/go/libraries/utils/filesys"
+)
+
+// remoteServer runs the http file server and the grpc chunk store server.
+type remoteServer struct {
+	httpPort int
+	grpcPort int
+	httpSrv  *http.Server
+	grpcSrv  *grpc.Server
+	tlsCfg   *tls.Config
+	tmpFiles tempFileRemover
+	wg       *sync.WaitGroup
+	stop     chan struct{}
+
+	// internalSrv serves endpoints meant for operators rather than clients on internalAddr. It is nil when no
+	// internal listener is configured.
+	internalSrv  *http.Server
+	internalAddr string
+
+	// expectedFileTTL is how long an upload registration is kept before it is removed. A value of 0 means
+	// registrations are never removed.
+	expectedFileTTL time.Duration
+
+	// uploadSessions are abandoned once they have been idle for longer than uploadSessionTTL. A value of 0 means they
+	// are never abandoned.
+	uploadSessions   *uploadSessionMap
+	uploadSessionTTL time.Duration
+}
+
+// newRemoteServer creates a remoteServer which serves |handler| over http on |httpPort| and the grpc chunk store api,
+// which hands out urls on |httpHost|, on |grpcPort|. The temp files of |tmpFiles| are removed on shutdown. If |tlsCfg| is not
+// nil both servers only accept TLS connections, otherwise they serve plain text.
+func newRemoteServer(httpHost string, httpPort, grpcPort int, handler http.Handler, tmpFiles tempFileRemover, tlsCfg *tls.Config) *remoteServer {
+	dbCache := NewLocalCSCache(filesys.LocalFS)
+	chnkSt := NewHttpFSBackedChunkStore(httpHost, dbCache)
+
+	opts := []grpc.ServerOption{grpc.MaxRecvMsgSize(128 * 1024 * 1024)}
+	if tlsCfg != nil {
+		chnkSt.HttpScheme = "https"
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsCfg)))
+	}
+
+	grpcSrv := grpc.NewServer(opts...)
+	remotesapi.RegisterChunkStoreServiceServer(grpcSrv, chnkSt)
+
+	return &remoteServer{
+		httpPort: httpPort,
+		grpcPort: grpcPort,
+		httpSrv:  &http.Server{Handler: handler, ConnContext: withConn},
+		grpcSrv:  grpcSrv,
+		tlsCfg:   tlsCfg,
+		tmpFiles: tmpFiles,
+		wg:       &sync.WaitGroup{},
+		stop:     make(chan struct{}),
+	}
+}
+
+// enableHTTP2 allows clients of the http server to use HTTP/2 as well as HTTP/1.1. Over tls it is negotiated with
+// ALPN. In plain text, such as behind a proxy which terminates tls, clients may either start with HTTP/2, known as
+// prior knowledge, or upgrade an HTTP/1.1 connection to it. It must be called before the server is started.
+func (s *remoteServer) enableHTTP2() error {
+	h2Srv := &http2.Server{}
+
+	// this also lets connections which have been switched to HTTP/2 shut down gracefully with the server
+	err := http2.ConfigureServer(s.httpSrv, h2Srv)
+
+	if err != nil {
+		return err
+	}
+
+	if s.tlsCfg != nil {
+		// the grpc server made its own copy of the config, so this only affects the http server
+		s.tlsCfg = s.tlsCfg.Clone()
+		s.tlsCfg.NextProtos = []string{http2.NextProtoTLS, "http/1.1"}
+	} else {
+		s.httpSrv.Handler = h2c.NewHandler(s.httpSrv.Handler, h2Srv)
+	}
+
+	return nil
+}
+
+// disableGRPC stops the grpc chunk store api from being served, leaving only the http file server. It must be called
+// before the server is started.
+func (s *remoteServer) disableGRPC() {
+	s.grpcSrv = nil
+}
+
+// serveInternal serves |handler| in plain text on |addr|, separately from the client facing servers, so that endpoints
+// such as metrics aren't exposed publicly. It must be called before the server is started.
+func (s *remoteServer) serveInternal(addr string, handler http.Handler) {
+	s.internalAddr = addr
+	s.internalSrv = &http.Server{Handler: handler}
+}
+
+// start listens on the configured ports and begins serving requests in the background.
+func (s *remoteServer) start() error {
+	var internalLis net.Listener
+	if s.internalSrv != nil {
+		var err error
+		internalLis, err = net.Listen("tcp", s.internalAddr)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	httpLis, err := net.Listen("tcp", fmt.Sprintf(":%d", s.httpPort))
+
+	if err != nil {
+		closeListener(internalLis)
+		return err
+	}
+
+	var grpcLis net.Listener
+	if s.grpcSrv != nil {
+		grpcLis, err = net.Listen("tcp", fmt.Sprintf(":%d", s.grpcPort))
+
+		if err != nil {
+			closeListener(internalLis)
+			httpLis.Close()
+			return err
+		}
+	}
+
+	s.serve(httpLis, grpcLis)
+
+	if internalLis != nil {
+		s.serveInternalListener(internalLis)
+	}
+
+	return nil
+}
+
+func closeListener(lis net.Listener) {
+	if lis != nil {
+		lis.Close()
+	}
+}
+
+// serveInternalListener begins serving the internal endpoints from |lis| in the background.
+func (s *remoteServer) serveInternalListener(lis net.Listener) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		log.Println("Starting internal http server on", lis.Addr())
+		err := s.internalSrv.Serve(lis)
+		log.Println("internal http server exited. exit error:", err)
+	}()
+}
+
+// serve begins serving requests from the given listeners in the background. |grpcLis| is not used if grpc is disabled.
+func (s *remoteServer) serve(httpLis, grpcLis net.Listener) {
+	if s.tlsCfg != nil {
+		httpLis = tls.NewListener(httpLis, s.tlsCfg)
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		log.Println("Starting http server on", httpLis.Addr())
+		err := s.httpSrv.Serve(httpLis)
+		log.Println("http server exited. exit error:", err)
+	}()
+
+	if s.grpcSrv != nil {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			log.Println("Starting grpc server on", grpcLis.Addr())
+			err := s.grpcSrv.Serve(grpcLis)
+			log.Println("grpc server exited. error:", err)
+		}()
+	}
+
+	if s.expectedFileTTL > 0 {
+		ticker := time.NewTicker(s.expectedFileTTL / 2)
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer ticker.Stop()
+			expectedFiles.sweepEvery(s.expectedFileTTL, ticker.C, s.stop)
+		}()
+	}
+
+	if s.uploadSessions != nil && s.uploadSessionTTL > 0 {
+		ticker := time.NewTicker(s.uploadSessionTTL / 2)
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer ticker.Stop()
+			s.uploadSessions.sweepEvery(s.uploadSessionTTL, ticker.C, s.stop)
+		}()
+	}
+}
+
+// Shutdown stops accepting new requests and waits for active requests to finish. If |ctx| is done before they finish,
+// the remaining connections are closed and ctx.Err() is returned. The temp files of any uploads which did not complete
+// are removed.
+func (s *remoteServer) Shutdown(ctx context.Context) error {
+	grpcStopped := make(chan struct{})
+	if s.grpcSrv == nil {
+		close(grpcStopped)
+	} else {
+		go func() {
+			defer close(grpcStopped)
+			s.grpcSrv.GracefulStop()
+		}()
+	}
+
+	err := s.httpSrv.Shutdown(ctx)
+
+	if err != nil {
+		log.Println("http server did not shut down cleanly. closing remaining connections. error:", err)
+		s.httpSrv.Close()
+	}
+
+	select {
+	case <-grpcStopped:
+	case <-ctx.Done():
+		if s.grpcSrv == nil {
+			break
+		}
+
+		log.Println("grpc server did not shut down cleanly. closing remaining connections.")
+		s.grpcSrv.Stop()
+		<-grpcStopped
+
+		if err == nil {
+			err = ctx.Err()
+		}
+	}
+
+	if s.internalSrv != nil {
+		// nothing served internally is worth waiting for once the client facing servers have stopped
+		s.internalSrv.Close()
+	}
+
+	if rmErr := s.tmpFiles.removeTempFiles(); rmErr != nil {
+		log.Println("failed to remove upload temp files. error:", rmErr)
+	}
+
+	close(s.stop)
+	s.wg.Wait()
+	return err
+}
@@ -0,0 +1,465 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/http2"
+)
+
+// startTestServer serves |handler| on ephemeral local ports and returns the server along with its http base url. The
+// server uses TLS if |tlsCfg| is not nil. Each of |configure| is called with the server before it is started.
+func startTestServer(t *testing.T, handler http.Handler, tmpFiles tempFileRemover, tlsCfg *tls.Config, configure ...func(*remoteServer)) (*remoteServer, string) {
+	httpLis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	grpcLis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := newRemoteServer("localhost", 0, 0, handler, tmpFiles, tlsCfg)
+	for _, cfg := range configure {
+		cfg(srv)
+	}
+
+	srv.serve(httpLis, grpcLis)
+
+	scheme := "http"
+	if tlsCfg != nil {
+		scheme = "https"
+	}
+
+	return srv, scheme + "://" + httpLis.Addr().String()
+}
+
+func TestShutdownWaitsForInFlightRequests(t *testing.T) {
+	fh := newTestHandler(t)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := http.HandlerFunc(func(wr http.ResponseWriter, req *http.Request) {
+		close(started)
+		<-release
+		wr.Write([]byte("done"))
+	})
+
+	srv, url := startTestServer(t, handler, fh, nil)
+
+	type result struct {
+		body string
+		err  error
+	}
+
+	respCh := make(chan result, 1)
+	go func() {
+		resp, err := http.Get(url + "/slow")
+		if err != nil {
+			respCh <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		respCh <- result{string(body), err}
+	}()
+
+	<-started
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		shutdownErr <- srv.Shutdown(context.Background())
+	}()
+
+	select {
+	case err := <-shutdownErr:
+		t.Fatalf("shutdown returned before the in flight request finished: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+
+	res := <-respCh
+	require.NoError(t, res.err)
+	assert.Equal(t, "done", res.body)
+	assert.NoError(t, <-shutdownErr)
+}
+
+func TestInternalListener(t *testing.T) {
+	fh := newTestHandler(t)
+	fh.metrics = newHttpMetrics()
+
+	internalMux := http.NewServeMux()
+	internalMux.Handle("/metrics", fh.metrics)
+	internalLis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv, url := startTestServer(t, fh, fh, nil, func(srv *remoteServer) {
+		srv.serveInternal(internalLis.Addr().String(), internalMux)
+	})
+	srv.serveInternalListener(internalLis)
+
+	resp, err := http.Get("http://" + internalLis.Addr().String() + "/metrics")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), "remotesrv_http_requests_in_flight")
+
+	// the client facing server doesn't serve metrics
+	resp, err = http.Get(url + "/metrics")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.NotEqual(t, http.StatusOK, resp.StatusCode)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, srv.Shutdown(ctx))
+
+	_, err = http.Get("http://" + internalLis.Addr().String() + "/metrics")
+	assert.Error(t, err)
+}
+
+func TestDisableGRPC(t *testing.T) {
+	fh := newTestHandler(t)
+	data := []byte("a table file served without grpc")
+	fileId := writeTestFile(t, fh, data)
+
+	srv, url := startTestServer(t, fh, fh, nil, func(srv *remoteServer) {
+		srv.disableGRPC()
+	})
+
+	resp, err := http.Get(url + fileUrl(testOrg, testRepo, fileId))
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, data, body)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, srv.Shutdown(ctx))
+}
+
+func TestShutdownRemovesPartialUploads(t *testing.T) {
+	fh := newTestHandler(t)
+	srv, url := startTestServer(t, fh, fh, nil)
+
+	data := []byte("an upload which will never finish")
+	md5Hash := md5.Sum(data)
+	fileId := expectUploadDetails(t, "partial upload", uint64(len(data)), md5Hash[:])
+
+	bodyRd, bodyWr := io.Pipe()
+	defer bodyWr.Close()
+
+	go func() {
+		req, err := http.NewRequest(http.MethodPost, url+fileUrl(testOrg, testRepo, fileId), bodyRd)
+		if err != nil {
+			return
+		}
+		req.ContentLength = int64(len(data))
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	_, err := bodyWr.Write(data[:10])
+	require.NoError(t, err)
+
+	tmpGlob := filepath.Join(testRoot(fh), testOrg, testRepo, fileId+"-*.tmp")
+	require.Eventually(t, func() bool {
+		matches, _ := filepath.Glob(tmpGlob)
+		return len(matches) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err = srv.Shutdown(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	matches, err := filepath.Glob(tmpGlob)
+	require.NoError(t, err)
+	assert.Empty(t, matches, fmt.Sprintf("temp files remain after shutdown: %v", matches))
+	assert.NoFileExists(t, filepath.Join(testRoot(fh), testOrg, testRepo, fileId))
+}
+
+func TestUploadTimeoutInterruptsStalledClient(t *testing.T) {
+	fh := newTestHandler(t)
+	fh.uploadTimeout = 100 * time.Millisecond
+	srv, url := startTestServer(t, fh, fh, nil)
+	defer srv.Shutdown(context.Background())
+
+	data := []byte("an upload which stalls part way through")
+	md5Hash := md5.Sum(data)
+	fileId := expectUploadDetails(t, "stalled upload", uint64(len(data)), md5Hash[:])
+
+	bodyRd, bodyWr := io.Pipe()
+	defer bodyWr.Close()
+
+	go func() {
+		// half of the body is sent, and then the client stalls
+		_, _ = bodyWr.Write(data[:len(data)/2])
+	}()
+
+	req, err := http.NewRequest(http.MethodPost, url+fileUrl(testOrg, testRepo, fileId), bodyRd)
+	require.NoError(t, err)
+	req.ContentLength = int64(len(data))
+
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusRequestTimeout, resp.StatusCode)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.NoFileExists(t, filepath.Join(testRoot(fh), testOrg, testRepo, fileId))
+}
+
+func TestRetriedUploadSkipsBody(t *testing.T) {
+	fh := newTestHandler(t)
+	srv, url := startTestServer(t, fh, fh, nil)
+	defer srv.Shutdown(context.Background())
+
+	data := []byte("an upload which is retried after it was stored")
+	fileId := expectUpload(t, data)
+	fileUrl := url + fileUrl(testOrg, testRepo, fileId)
+
+	resp, err := http.Post(fileUrl, "application/octet-stream", bytes.NewReader(data))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	client := &http.Client{Transport: &http.Transport{ExpectContinueTimeout: 5 * time.Second}}
+	defer client.CloseIdleConnections()
+
+	body := &unreadBody{rd: bytes.NewReader(data)}
+	req, err := http.NewRequest(http.MethodPost, fileUrl, body)
+	require.NoError(t, err)
+	req.ContentLength = int64(len(data))
+	req.Header.Set("Expect", "100-continue")
+
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.False(t, body.read, "the client sent the body of a retried upload")
+
+	// a stored file of the same length whose checksum doesn't match the upload is replaced
+	corrupt := bytes.Repeat([]byte("x"), len(data))
+	path := filepath.Join(testRoot(fh), testOrg, testRepo, fileId)
+	require.NoError(t, os.WriteFile(path, corrupt, os.ModePerm))
+	require.NoError(t, os.Remove(path+checksumExt))
+
+	body = &unreadBody{rd: bytes.NewReader(data)}
+	req, err = http.NewRequest(http.MethodPost, fileUrl, body)
+	require.NoError(t, err)
+	req.ContentLength = int64(len(data))
+	req.Header.Set("Expect", "100-continue")
+
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.True(t, body.read, "the body of an upload replacing a file with a different checksum was not sent")
+	stored, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, data, stored)
+}
+
+// countingDialer dials tcp connections and counts them.
+type countingDialer struct {
+	dials int32
+}
+
+func (cd *countingDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	atomic.AddInt32(&cd.dials, 1)
+	return (&net.Dialer{}).DialContext(ctx, network, addr)
+}
+
+// enableHTTP2 enables HTTP/2 on a test server.
+func enableHTTP2(t *testing.T) func(*remoteServer) {
+	return func(srv *remoteServer) {
+		require.NoError(t, srv.enableHTTP2())
+	}
+}
+
+// newH2CClient returns a client which only uses plain text HTTP/2 with prior knowledge, dialing with |dialer|.
+func newH2CClient(dialer *countingDialer) *http.Client {
+	return &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			return dialer.DialContext(context.Background(), network, addr)
+		},
+	}}
+}
+
+func TestHTTP2PriorKnowledge(t *testing.T) {
+	fh := newTestHandler(t)
+	data := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	fileId := writeTestFile(t, fh, data)
+	srv, url := startTestServer(t, fh, fh, nil, enableHTTP2(t))
+	defer srv.Shutdown(context.Background())
+	url += fileUrl(testOrg, testRepo, fileId)
+
+	dialer := &countingDialer{}
+	client := newH2CClient(dialer)
+
+	// a full download is streamed
+	resp, err := client.Get(url)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, 2, resp.ProtoMajor)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, data, body)
+
+	const parts = 16
+	partSize := len(data) / parts
+	errs := make(chan error, parts)
+	for i := 0; i < parts; i++ {
+		go func(offset int) {
+			errs <- func() error {
+				req, err := http.NewRequest(http.MethodGet, url, nil)
+
+				if err != nil {
+					return err
+				}
+
+				req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+partSize-1))
+				resp, err := client.Do(req)
+
+				if err != nil {
+					return err
+				}
+
+				defer resp.Body.Close()
+				body, err := io.ReadAll(resp.Body)
+
+				if err != nil {
+					return err
+				} else if resp.ProtoMajor != 2 {
+					return fmt.Errorf("range %d was served over %s", offset, resp.Proto)
+				} else if resp.StatusCode != http.StatusPartialContent {
+					return fmt.Errorf("range %d received status %d", offset, resp.StatusCode)
+				} else if !bytes.Equal(data[offset:offset+partSize], body) {
+					return fmt.Errorf("range %d has the wrong contents", offset)
+				}
+
+				return nil
+			}()
+		}(i * partSize)
+	}
+
+	for i := 0; i < parts; i++ {
+		assert.NoError(t, <-errs)
+	}
+
+	// every request shared the connection
+	assert.Equal(t, int32(1), atomic.LoadInt32(&dialer.dials))
+
+	// HTTP/1.1 clients are still served
+	resp, err = http.Get(url)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 1, resp.ProtoMajor)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestHTTP2Disabled(t *testing.T) {
+	fh := newTestHandler(t)
+	fileId := writeTestFile(t, fh, []byte("only served over HTTP/1.1"))
+	srv, url := startTestServer(t, fh, fh, nil)
+	defer srv.Shutdown(context.Background())
+
+	client := newH2CClient(&countingDialer{})
+
+	resp, err := client.Get(url + fileUrl(testOrg, testRepo, fileId))
+	if err == nil {
+		resp.Body.Close()
+	}
+	assert.Error(t, err)
+}
+
+func TestH2CUpgrade(t *testing.T) {
+	fh := newTestHandler(t)
+	fileId := writeTestFile(t, fh, []byte("served after an upgrade to HTTP/2"))
+	srv, url := startTestServer(t, fh, fh, nil, enableHTTP2(t))
+	defer srv.Shutdown(context.Background())
+
+	conn, err := net.Dial("tcp", url[len("http://"):])
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// the HTTP2-Settings header holds an empty SETTINGS payload
+	_, err = fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade, HTTP2-Settings\r\n"+
+		"Upgrade: h2c\r\nHTTP2-Settings: \r\n\r\n", fileUrl(testOrg, testRepo, fileId))
+	require.NoError(t, err)
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	assert.Equal(t, "h2c", resp.Header.Get("Upgrade"))
+}
+
+func TestHTTP2OverTLS(t *testing.T) {
+	ca := newTestCA(t, "test ca")
+	serverCert := newTestLeafCert(t, "server", x509.ExtKeyUsageServerAuth, ca)
+	tlsCfg := &tls.Config{Certificates: []tls.Certificate{serverCert.tlsCertificate(t)}, MinVersion: tls.VersionTLS12}
+
+	fh := newTestHandler(t)
+	data := []byte("served over HTTP/2 with tls")
+	fileId := writeTestFile(t, fh, data)
+	srv, url := startTestServer(t, fh, fh, tlsCfg, enableHTTP2(t))
+	defer srv.Shutdown(context.Background())
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}, ForceAttemptHTTP2: true}}
+
+	req, err := http.NewRequest(http.MethodGet, url+fileUrl(testOrg, testRepo, fileId), nil)
+	require.NoError(t, err)
+	req.Header.Set("Range", "bytes=10-")
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, 2, resp.ProtoMajor)
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, data[10:], body)
+
+	// the config shared with the grpc server is left unchanged
+	assert.Empty(t, tlsCfg.NextProtos)
+}
@@ -0,0 +1,186 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// newTestCert creates a certificate from |template| signed by |parent|, or self-signed if |parent| is nil.
+func newTestCert(t *testing.T, template *x509.Certificate, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}),
+	}
+}
+
+func newTestCA(t *testing.T, name string) *testCert {
+	return newTestCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}, nil)
+}
+
+func newTestLeafCert(t *testing.T, name string, usage x509.ExtKeyUsage, ca *testCert) *testCert {
+	return newTestCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}, ca)
+}
+
+func (tc *testCert) tlsCertificate(t *testing.T) tls.Certificate {
+	cert, err := tls.X509KeyPair(tc.certPEM, tc.keyPEM)
+	require.NoError(t, err)
+	return cert
+}
+
+func writeTestPEM(t *testing.T, dir, name string, data []byte) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, data, 0600))
+	return path
+}
+
+func TestTLSClientCertificates(t *testing.T) {
+	ca := newTestCA(t, "test ca")
+	serverCert := newTestLeafCert(t, "server", x509.ExtKeyUsageServerAuth, ca)
+	clientCert := newTestLeafCert(t, "client", x509.ExtKeyUsageClientAuth, ca)
+	untrustedCert := newTestLeafCert(t, "untrusted", x509.ExtKeyUsageClientAuth, newTestCA(t, "other ca"))
+
+	dir := t.TempDir()
+	tlsCfg, err := newTLSConfig(
+		writeTestPEM(t, dir, "server.crt", serverCert.certPEM),
+		writeTestPEM(t, dir, "server.key", serverCert.keyPEM),
+		writeTestPEM(t, dir, "ca.crt", ca.certPEM))
+	require.NoError(t, err)
+
+	fh := newTestHandler(t)
+	data := []byte("served over tls")
+	fileId := writeTestFile(t, fh, data)
+	srv, url := startTestServer(t, fh, fh, tlsCfg)
+	defer srv.Shutdown(context.Background())
+	url += fileUrl(testOrg, testRepo, fileId)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	newClient := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs}}}
+	}
+
+	t.Run("valid client certificate", func(t *testing.T) {
+		resp, err := newClient(clientCert.tlsCertificate(t)).Get(url)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, data, body)
+	})
+
+	t.Run("no client certificate", func(t *testing.T) {
+		resp, err := newClient().Get(url)
+		if err == nil {
+			resp.Body.Close()
+		}
+		assert.Error(t, err)
+	})
+
+	t.Run("untrusted client certificate", func(t *testing.T) {
+		resp, err := newClient(untrustedCert.tlsCertificate(t)).Get(url)
+		if err == nil {
+			resp.Body.Close()
+		}
+		assert.Error(t, err)
+	})
+
+	t.Run("plain text", func(t *testing.T) {
+		resp, err := http.Get("http" + url[len("https"):])
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func TestNewTLSConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	cert := newTestLeafCert(t, "server", x509.ExtKeyUsageServerAuth, newTestCA(t, "ca"))
+	certFile := writeTestPEM(t, dir, "server.crt", cert.certPEM)
+	keyFile := writeTestPEM(t, dir, "server.key", cert.keyPEM)
+
+	_, err := newTLSConfig(certFile, "", "")
+	assert.Error(t, err)
+
+	_, err = newTLSConfig(certFile, filepath.Join(dir, "missing.key"), "")
+	assert.Error(t, err)
+
+	_, err = newTLSConfig(certFile, keyFile, writeTestPEM(t, dir, "empty.crt", []byte("not a certificate")))
+	assert.Error(t, err)
+
+	cfg, err := newTLSConfig(certFile, keyFile, "")
+	require.NoError(t, err)
+	assert.Equal(t, tls.NoClientCert, cfg.ClientAuth)
+}
@@ -0,0 +1,493 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dolthub/dolt/go/store/hash"
+)
+
+// Resumable uploads let a client send a table file in parts and retry just the parts which fail. A session is
+// started with a POST to the file's url with an "uploads" query parameter. The response has a Location, and an
+// X-Dolt-Upload-Id header, identifying the session. Parts are sent with PATCH requests to the session url, each with
+// an X-Dolt-Upload-Offset header giving the offset of the part within the file. A part may overlap data which has
+// already been received, but may not start past the end of it. The number of bytes received so far is returned in the
+// X-Dolt-Upload-Offset header of every response, and can be requested with a HEAD. Once every part has been received a
+// PUT to the session url commits the file after validating it in the same way as a single request upload. A DELETE
+// abandons the session.
+const (
+	uploadsParam       = "uploads"
+	uploadIdParam      = "upload_id"
+	uploadIdHeader     = "X-Dolt-Upload-Id"
+	uploadOffsetHeader = "X-Dolt-Upload-Offset"
+)
+
+// uploadSession is the state of a resumable upload of a single table file.
+type uploadSession struct {
+	mu      *sync.Mutex
+	org     string
+	repo    string
+	fileId  string
+	tmpPath string
+
+	// size is the number of contiguous bytes received from the start of the file
+	size int64
+
+	// lastUsed is when the last request for the session finished, and inUse is the number of requests for it being
+	// served. Both are guarded by the mutex of the uploadSessionMap.
+	lastUsed time.Time
+	inUse    int
+}
+
+// uploadSessionMap holds the upload sessions which are in progress. The parts of each session are staged in a local
+// temp file until the session is committed to the BlobStore.
+type uploadSessionMap struct {
+	mu       *sync.Mutex
+	sessions map[string]*uploadSession
+	now      func() time.Time
+
+	// maxPerRepo is the number of sessions each repo may have in progress at once. A value of 0 means no limit.
+	maxPerRepo int
+
+	// stagingDir is the directory the staging files are created in. The default temp directory is used if it is empty.
+	stagingDir string
+	tmpFiles   *tempFileSet
+}
+
+// errTooManyUploadSessions is returned when starting a session for a repo which already has the maximum number of
+// sessions in progress.
+var errTooManyUploadSessions = errors.New("too many upload sessions in progress")
+
+func newUploadSessionMap() *uploadSessionMap {
+	return &uploadSessionMap{
+		mu:       &sync.Mutex{},
+		sessions: make(map[string]*uploadSession),
+		now:      time.Now,
+		tmpFiles: newTempFileSet(),
+	}
+}
+
+// get returns the session with the id |uploadId|. The session is not expired while it is in use, and release must be
+// called with it once the request for it has been served.
+func (m *uploadSessionMap) get(uploadId string) (*uploadSession, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sess, ok := m.sessions[uploadId]
+
+	if ok {
+		sess.inUse++
+	}
+
+	return sess, ok
+}
+
+// release marks a request for |sess| returned by get as finished.
+func (m *uploadSessionMap) release(sess *uploadSession) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sess.inUse--
+	sess.lastUsed = m.now()
+}
+
+// add stores |sess| and returns its id. It fails with errTooManyUploadSessions if the repo of |sess| already has
+// maxPerRepo sessions in progress.
+func (m *uploadSessionMap) add(sess *uploadSession) (string, error) {
+	var idBytes [16]byte
+	_, err := rand.Read(idBytes[:])
+
+	if err != nil {
+		return "", err
+	}
+
+	uploadId := hex.EncodeToString(idBytes[:])
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.maxPerRepo > 0 {
+		inProgress := 0
+		for _, other := range m.sessions {
+			if other.org == sess.org && other.repo == sess.repo {
+				inProgress++
+			}
+		}
+
+		if inProgress >= m.maxPerRepo {
+			return "", fmt.Errorf("%w: %s/%s has %d", errTooManyUploadSessions, sess.org, sess.repo, inProgress)
+		}
+	}
+
+	sess.lastUsed = m.now()
+	m.sessions[uploadId] = sess
+	return uploadId, nil
+}
+
+func (m *uploadSessionMap) delete(uploadId string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, uploadId)
+}
+
+// sweep abandons the sessions which have not been used for longer than |ttl|, removing their staging files, and
+// returns the number abandoned. Sessions which are in use are kept.
+func (m *uploadSessionMap) sweep(ttl time.Duration) int {
+	m.mu.Lock()
+	cutoff := m.now().Add(-ttl)
+	var expired []string
+	for uploadId, sess := range m.sessions {
+		if sess.inUse == 0 && sess.lastUsed.Before(cutoff) {
+			delete(m.sessions, uploadId)
+			expired = append(expired, sess.tmpPath)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, tmpPath := range expired {
+		if err := m.removeStagingFile(tmpPath); err != nil {
+			log.Printf("failed to remove staging file %s: %v", tmpPath, err)
+		}
+	}
+
+	return len(expired)
+}
+
+// sweepEvery calls sweep with |ttl| each time |tick| fires until |stop| is closed.
+func (m *uploadSessionMap) sweepEvery(ttl time.Duration, tick <-chan time.Time, stop <-chan struct{}) {
+	for {
+		select {
+		case <-tick:
+			if removed := m.sweep(ttl); removed > 0 {
+				log.Printf("abandoned %d idle upload sessions", removed)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// createStagingFile creates an empty staging file for the upload of |fileId| and returns its path.
+func (m *uploadSessionMap) createStagingFile(fileId string) (string, error) {
+	f, err := os.CreateTemp(m.stagingDir, fileId+"-*.upload")
+
+	if err != nil {
+		return "", err
+	}
+
+	m.tmpFiles.track(f.Name())
+	err = f.Close()
+
+	if err != nil {
+		m.tmpFiles.remove(f.Name())
+		return "", err
+	}
+
+	return f.Name(), nil
+}
+
+// writeStagingFileAt writes the contents of |rd| to the staging file at |tmpPath| starting at |offset|, and returns the
+// number of bytes written, which may be non-zero when an error is returned.
+func (m *uploadSessionMap) writeStagingFileAt(tmpPath string, offset int64, rd io.Reader) (int64, error) {
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY, 0)
+
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = f.Seek(offset, io.SeekStart)
+
+	var n int64
+	if err == nil {
+		n, err = io.Copy(f, rd)
+	}
+
+	closeErr := f.Close()
+
+	if err == nil {
+		err = closeErr
+	}
+
+	return n, err
+}
+
+// removeStagingFile deletes the staging file at |tmpPath|.
+func (m *uploadSessionMap) removeStagingFile(tmpPath string) error {
+	return m.tmpFiles.remove(tmpPath)
+}
+
+// removeTempFiles deletes the staging files of every session. Those sessions can no longer be committed.
+func (m *uploadSessionMap) removeTempFiles() error {
+	return m.tmpFiles.removeTempFiles()
+}
+
+// isUploadSessionRequest returns true if |req| is part of the resumable upload protocol.
+func isUploadSessionRequest(req *http.Request) bool {
+	query := req.URL.Query()
+	_, start := query[uploadsParam]
+	return start || query.Get(uploadIdParam) != ""
+}
+
+func (fh *fileHandler) serveUploadSession(logger func(string), org, repo, fileId string, respWr http.ResponseWriter, req *http.Request) int {
+	uploadId := req.URL.Query().Get(uploadIdParam)
+
+	if uploadId == "" {
+		if req.Method != http.MethodPost {
+			return http.StatusMethodNotAllowed
+		}
+
+		return fh.startUploadSession(logger, org, repo, fileId, respWr, req)
+	}
+
+	sess, ok := fh.sessions.get(uploadId)
+
+	if !ok {
+		logger(fmt.Sprintf("upload session %s not found for %s/%s/%s", uploadId, org, repo, fileId))
+		return http.StatusNotFound
+	}
+
+	defer fh.sessions.release(sess)
+
+	if sess.org != org || sess.repo != repo || sess.fileId != fileId {
+		logger(fmt.Sprintf("upload session %s not found for %s/%s/%s", uploadId, org, repo, fileId))
+		return http.StatusNotFound
+	}
+
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+
+	switch req.Method {
+	case http.MethodHead:
+		respWr.Header().Set(uploadOffsetHeader, strconv.FormatInt(sess.size, 10))
+		return http.StatusOK
+
+	case http.MethodPatch:
+		return fh.appendUploadSession(logger, sess, respWr, req)
+
+	case http.MethodPut:
+		statusCode := fh.commitUploadSession(req.Context(), logger, sess, respWr)
+
+		if statusCode == http.StatusOK || statusCode == http.StatusCreated {
+			fh.sessions.delete(uploadId)
+		}
+
+		return statusCode
+
+	case http.MethodDelete:
+		fh.sessions.delete(uploadId)
+
+		if err := fh.sessions.removeStagingFile(sess.tmpPath); err != nil {
+			logger(fmt.Sprintf("failed to remove staging file %s: %v", sess.tmpPath, err))
+		}
+
+		return http.StatusNoContent
+	}
+
+	return http.StatusMethodNotAllowed
+}
+
+func (fh *fileHandler) startUploadSession(logger func(string), org, repo, fileId string, respWr http.ResponseWriter, req *http.Request) int {
+	if _, ok := hash.MaybeParse(fileId); !ok {
+		logger(fileId + " is not a valid hash")
+		return http.StatusBadRequest
+	}
+
+	tfd, ok := getExpectedFile(fileId)
+
+	if !ok {
+		logger(fileId + " was not registered for upload")
+		return http.StatusNotFound
+	}
+
+	if fh.maxUploadSize > 0 && tfd.ContentLength > uint64(fh.maxUploadSize) {
+		logger(fmt.Sprintf("upload of %d bytes exceeds the maximum upload size of %d bytes", tfd.ContentLength, fh.maxUploadSize))
+		return http.StatusRequestEntityTooLarge
+	}
+
+	if _, err := digestForContentHash(tfd.ContentHash); err != nil {
+		logger(err.Error())
+		return http.StatusBadRequest
+	}
+
+	tmpPath, err := fh.sessions.createStagingFile(fileId)
+
+	if err != nil {
+		logger(fmt.Sprintf("failed to create staging file for %s/%s/%s: %v", org, repo, fileId, err))
+		return http.StatusInternalServerError
+	}
+
+	uploadId, err := fh.sessions.add(&uploadSession{mu: &sync.Mutex{}, org: org, repo: repo, fileId: fileId, tmpPath: tmpPath})
+
+	if errors.Is(err, errTooManyUploadSessions) {
+		logger(err.Error())
+		fh.sessions.removeStagingFile(tmpPath)
+		return http.StatusTooManyRequests
+	} else if err != nil {
+		logger("failed to create upload id: " + err.Error())
+		fh.sessions.removeStagingFile(tmpPath)
+		return http.StatusInternalServerError
+	}
+
+	logger(fmt.Sprintf("started upload session %s for %s/%s/%s", uploadId, org, repo, fileId))
+	respWr.Header().Set(uploadIdHeader, uploadId)
+	respWr.Header().Set(uploadOffsetHeader, "0")
+	respWr.Header().Set("Location", fmt.Sprintf("%s?%s=%s", req.URL.Path, uploadIdParam, uploadId))
+	return http.StatusCreated
+}
+
+func (fh *fileHandler) appendUploadSession(logger func(string), sess *uploadSession, respWr http.ResponseWriter, req *http.Request) int {
+	offset, err := strconv.ParseInt(req.Header.Get(uploadOffsetHeader), 10, 64)
+
+	if err != nil || offset < 0 {
+		logger(fmt.Sprintf("invalid %s header '%s'", uploadOffsetHeader, req.Header.Get(uploadOffsetHeader)))
+		return http.StatusBadRequest
+	}
+
+	defer func() {
+		respWr.Header().Set(uploadOffsetHeader, strconv.FormatInt(sess.size, 10))
+	}()
+
+	if offset > sess.size {
+		logger(fmt.Sprintf("part at offset %d would leave a gap after the %d bytes received", offset, sess.size))
+		return http.StatusConflict
+	}
+
+	body := fh.limitUploadTime(req, req.Body)
+	if fh.maxUploadSize > 0 {
+		if req.ContentLength > fh.maxUploadSize-offset {
+			logger(fmt.Sprintf("part would exceed the maximum upload size of %d bytes", fh.maxUploadSize))
+			return http.StatusRequestEntityTooLarge
+		}
+
+		body = limitUploadSize(body, fh.maxUploadSize-offset)
+	}
+
+	n, err := fh.sessions.writeStagingFileAt(sess.tmpPath, offset, body)
+
+	if offset+n > sess.size {
+		sess.size = offset + n
+	}
+
+	if errors.Is(err, errUploadTooLarge) {
+		respWr.Header().Set("Connection", "close")
+		return http.StatusRequestEntityTooLarge
+	} else if errors.Is(err, errUploadTimeout) {
+		logger(fmt.Sprintf("part at offset %d timed out after %d bytes", offset, n))
+		respWr.Header().Set("Connection", "close")
+		return http.StatusRequestTimeout
+	} else if errors.Is(err, io.ErrUnexpectedEOF) {
+		logger(fmt.Sprintf("part at offset %d was cut short after %d bytes", offset, n))
+		return http.StatusBadRequest
+	} else if err != nil {
+		logger(fmt.Sprintf("failed to write part at offset %d: %v", offset, err))
+		return http.StatusInternalServerError
+	}
+
+	logger(fmt.Sprintf("received %d bytes at offset %d. %d bytes received", n, offset, sess.size))
+	return http.StatusNoContent
+}
+
+func (fh *fileHandler) commitUploadSession(ctx context.Context, logger func(string), sess *uploadSession, respWr http.ResponseWriter) int {
+	tfd, ok := getExpectedFile(sess.fileId)
+
+	if !ok {
+		logger(sess.fileId + " is no longer registered for upload")
+		return http.StatusNotFound
+	}
+
+	f, err := os.Open(sess.tmpPath)
+
+	if err != nil {
+		logger(fmt.Sprintf("failed to open staging file %s: %v", sess.tmpPath, err))
+		return http.StatusInternalServerError
+	}
+
+	defer f.Close()
+
+	_, err = fh.store.Stat(ctx, sess.org, sess.repo, sess.fileId)
+	exists := err == nil
+
+	reservation, err := fh.reserveQuota(ctx, sess.org, sess.repo, sess.fileId, sess.size)
+
+	if errors.Is(err, errQuotaExceeded) {
+		logger(err.Error())
+		return http.StatusRequestEntityTooLarge
+	} else if err != nil {
+		logger(fmt.Sprintf("failed to compute the size of %s/%s: %v", sess.org, sess.repo, err))
+		return blobErrStatus(err)
+	}
+
+	var vr *validatingReader
+	err = fh.store.Put(ctx, sess.org, sess.repo, sess.fileId, f, func(rd io.ReadSeeker) error {
+		vr, err = newValidatingReader(rd, tfd)
+
+		if err != nil {
+			return err
+		}
+
+		vr.rejectEmpty = !fh.allowEmptyUploads
+
+		if _, err = io.Copy(io.Discard, vr); err != nil {
+			return err
+		}
+
+		if fh.verifyFileIds {
+			return verifyTableFileName(rd, sess.fileId)
+		}
+
+		return nil
+	})
+
+	if err == nil {
+		reservation.stored(sess.size)
+	} else {
+		reservation.release()
+	}
+
+	if isValidationError(err) {
+		respWr.Header().Set(uploadOffsetHeader, strconv.FormatInt(sess.size, 10))
+		return fh.rejectInvalidUpload(logger, sess.org, sess.repo, sess.fileId, err, respWr)
+	} else if err != nil {
+		logger(fmt.Sprintf("failed to commit upload of %s: %v", sess.fileId, err))
+		return blobErrStatus(err)
+	}
+
+	logger(fmt.Sprintf("committed upload of %s. %d bytes written", sess.fileId, sess.size))
+	vr.setReceivedHeaders(respWr.Header())
+
+	if err := fh.sessions.removeStagingFile(sess.tmpPath); err != nil {
+		logger(fmt.Sprintf("failed to remove staging file %s: %v", sess.tmpPath, err))
+	}
+
+	if exists {
+		return http.StatusOK
+	}
+
+	respWr.Header().Set("Location", fmt.Sprintf("/%s/%s/%s", sess.org, sess.repo, sess.fileId))
+	return http.StatusCreated
+}
@@ -0,0 +1,275 @@
+// Copyright 2021 Dolthub, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/dolthub/dolt/go/store/hash"
+)
+
+// startSession starts a resumable upload of |fileId| and returns the session url.
+func startSession(t *testing.T, fh *fileHandler, fileId string) string {
+	rec := doRequest(fh, httptest.NewRequest(http.MethodPost, fileUrl(testOrg, testRepo, fileId)+"?"+uploadsParam, nil))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.NotEmpty(t, rec.Header().Get(uploadIdHeader))
+	assert.Equal(t, fileUrl(testOrg, testRepo, fileId)+"?"+uploadIdParam+"="+rec.Header().Get(uploadIdHeader), rec.Header().Get("Location"))
+	return rec.Header().Get("Location")
+}
+
+func sendPart(fh *fileHandler, sessionUrl string, offset int, part []byte) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPatch, sessionUrl, bytes.NewReader(part))
+	req.Header.Set(uploadOffsetHeader, strconv.Itoa(offset))
+	return doRequest(fh, req)
+}
+
+// writeHeaderRecorder records each status code written to it, so that a response's status can be checked to have only
+// been written once.
+type writeHeaderRecorder struct {
+	*httptest.ResponseRecorder
+	codes []int
+}
+
+func (wr *writeHeaderRecorder) WriteHeader(statusCode int) {
+	wr.codes = append(wr.codes, statusCode)
+	wr.ResponseRecorder.WriteHeader(statusCode)
+}
+
+func TestResumableUpload(t *testing.T) {
+	fh := newTestHandler(t)
+	data := bytes.Repeat([]byte("resumable upload data "), 300)
+	fileId := expectUpload(t, data)
+	sessionUrl := startSession(t, fh, fileId)
+
+	third := len(data) / 3
+	parts := [][]byte{data[:third], data[third : 2*third], data[2*third:]}
+
+	rec := sendPart(fh, sessionUrl, 0, parts[0])
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, strconv.Itoa(third), rec.Header().Get(uploadOffsetHeader))
+
+	// the second part is dropped, so the third would leave a gap
+	rec = sendPart(fh, sessionUrl, 2*third, parts[2])
+	require.Equal(t, http.StatusConflict, rec.Code)
+	assert.Equal(t, strconv.Itoa(third), rec.Header().Get(uploadOffsetHeader))
+
+	rec = doRequest(fh, httptest.NewRequest(http.MethodHead, sessionUrl, nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, strconv.Itoa(third), rec.Header().Get(uploadOffsetHeader))
+
+	// committing before every part has been received fails validation
+	headerRec := &writeHeaderRecorder{ResponseRecorder: httptest.NewRecorder()}
+	fh.ServeHTTP(headerRec, httptest.NewRequest(http.MethodPut, sessionUrl, nil))
+	rec = headerRec.ResponseRecorder
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Equal(t, []int{http.StatusBadRequest}, headerRec.codes)
+	assert.Contains(t, rec.Body.String(), "content length does not match")
+	assert.Equal(t, strconv.Itoa(third), rec.Header().Get(uploadOffsetHeader))
+	assert.NoFileExists(t, filepath.Join(testRoot(fh), testOrg, testRepo, fileId))
+
+	rec = sendPart(fh, sessionUrl, third, parts[1])
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	// re-sending a part which was already received is harmless
+	rec = sendPart(fh, sessionUrl, third, parts[1])
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	rec = sendPart(fh, sessionUrl, 2*third, parts[2])
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, strconv.Itoa(len(data)), rec.Header().Get(uploadOffsetHeader))
+
+	rec = doRequest(fh, httptest.NewRequest(http.MethodPut, sessionUrl, nil))
+	require.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, fileUrl(testOrg, testRepo, fileId), rec.Header().Get("Location"))
+	md5Hash := md5.Sum(data)
+	assert.Equal(t, strconv.Itoa(len(data)), rec.Header().Get(receivedBytesHeader))
+	assert.Equal(t, hex.EncodeToString(md5Hash[:]), rec.Header().Get(contentMD5Header))
+
+	stored, err := os.ReadFile(filepath.Join(testRoot(fh), testOrg, testRepo, fileId))
+	require.NoError(t, err)
+	assert.Equal(t, data, stored)
+
+	matches, err := filepath.Glob(filepath.Join(testRoot(fh), testOrg, testRepo, "*.tmp"))
+	require.NoError(t, err)
+	assert.Empty(t, matches)
+	staged, err := os.ReadDir(fh.sessions.stagingDir)
+	require.NoError(t, err)
+	assert.Empty(t, staged)
+
+	// the session is gone once it has been committed
+	rec = sendPart(fh, sessionUrl, 0, parts[0])
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestResumableUploadErrors(t *testing.T) {
+	fh := newTestHandler(t)
+	data := []byte("some table file data")
+	fileId := expectUpload(t, data)
+
+	t.Run("unregistered file", func(t *testing.T) {
+		url := fileUrl(testOrg, testRepo, hash.Of([]byte("unregistered")).String()) + "?" + uploadsParam
+		rec := doRequest(fh, httptest.NewRequest(http.MethodPost, url, nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("invalid hash", func(t *testing.T) {
+		rec := doRequest(fh, httptest.NewRequest(http.MethodPost, fileUrl(testOrg, testRepo, "not-a-hash")+"?"+uploadsParam, nil))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("unknown session", func(t *testing.T) {
+		rec := sendPart(fh, fileUrl(testOrg, testRepo, fileId)+"?"+uploadIdParam+"=unknown", 0, data)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("session for another file", func(t *testing.T) {
+		sessionUrl := startSession(t, fh, fileId)
+		otherId := expectUpload(t, []byte("another file"))
+		query := sessionUrl[len(fileUrl(testOrg, testRepo, fileId)):]
+		rec := sendPart(fh, fileUrl(testOrg, testRepo, otherId)+query, 0, data)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("missing offset", func(t *testing.T) {
+		sessionUrl := startSession(t, fh, fileId)
+		rec := doRequest(fh, httptest.NewRequest(http.MethodPatch, sessionUrl, bytes.NewReader(data)))
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		fh.maxUploadSize = int64(len(data))
+		defer func() {
+			fh.maxUploadSize = 0
+		}()
+
+		sessionUrl := startSession(t, fh, fileId)
+		rec := sendPart(fh, sessionUrl, 0, data[:10])
+		require.Equal(t, http.StatusNoContent, rec.Code)
+		rec = sendPart(fh, sessionUrl, 10, data)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	})
+
+	t.Run("abort", func(t *testing.T) {
+		sessionUrl := startSession(t, fh, fileId)
+		rec := sendPart(fh, sessionUrl, 0, data[:10])
+		require.Equal(t, http.StatusNoContent, rec.Code)
+
+		rec = doRequest(fh, httptest.NewRequest(http.MethodDelete, sessionUrl, nil))
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+
+		rec = doRequest(fh, httptest.NewRequest(http.MethodHead, sessionUrl, nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.NoFileExists(t, filepath.Join(testRoot(fh), testOrg, testRepo, fileId))
+	})
+}
+
+func TestResumableUploadPartTimeout(t *testing.T) {
+	fh := newTestHandler(t)
+	fh.uploadTimeout = 50 * time.Millisecond
+	data := []byte("a resumable upload with a part which is sent too slowly")
+	fileId := expectUpload(t, data)
+	sessionUrl := startSession(t, fh, fileId)
+
+	req := httptest.NewRequest(http.MethodPatch, sessionUrl, &slowReader{bytes.NewReader(data), 10 * time.Millisecond})
+	req.Header.Set(uploadOffsetHeader, "0")
+	rec := doRequest(fh, req)
+	require.Equal(t, http.StatusRequestTimeout, rec.Code)
+
+	// the data received before the timeout is kept, so the upload can resume from there
+	received, err := strconv.Atoi(rec.Header().Get(uploadOffsetHeader))
+	require.NoError(t, err)
+	assert.Greater(t, received, 0)
+	assert.Less(t, received, len(data))
+
+	rec = sendPart(fh, sessionUrl, received, data[received:])
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	rec = doRequest(fh, httptest.NewRequest(http.MethodPut, sessionUrl, nil))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+}
+
+func TestUploadSessionExpiry(t *testing.T) {
+	fh := newTestHandler(t)
+	now := time.Now()
+	fh.sessions.now = func() time.Time {
+		return now
+	}
+
+	data := []byte("a resumable upload which is left idle")
+	fileId := expectUpload(t, data)
+	idleUrl := startSession(t, fh, fileId)
+	activeUrl := startSession(t, fh, fileId)
+	require.Len(t, fh.sessions.sessions, 2)
+
+	now = now.Add(30 * time.Minute)
+	rec := sendPart(fh, activeUrl, 0, data[:10])
+	require.Equal(t, http.StatusNoContent, rec.Code)
+
+	now = now.Add(45 * time.Minute)
+	assert.Equal(t, 1, fh.sessions.sweep(time.Hour))
+
+	rec = doRequest(fh, httptest.NewRequest(http.MethodHead, idleUrl, nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = doRequest(fh, httptest.NewRequest(http.MethodHead, activeUrl, nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	// a session which is in use is kept however long it has been since it was last used
+	sess, ok := fh.sessions.get(activeUrl[len(activeUrl)-32:])
+	require.True(t, ok)
+	now = now.Add(2 * time.Hour)
+	assert.Equal(t, 0, fh.sessions.sweep(time.Hour))
+	fh.sessions.release(sess)
+	now = now.Add(2 * time.Hour)
+	assert.Equal(t, 1, fh.sessions.sweep(time.Hour))
+
+	staged, err := os.ReadDir(fh.sessions.stagingDir)
+	require.NoError(t, err)
+	assert.Empty(t, staged)
+}
+
+func TestUploadSessionLimit(t *testing.T) {
+	fh := newTestHandler(t)
+	fh.sessions.maxPerRepo = 2
+
+	data := []byte("some table file data")
+	fileId := expectUpload(t, data)
+	startSession(t, fh, fileId)
+	sessionUrl := startSession(t, fh, fileId)
+
+	url := fileUrl(testOrg, testRepo, fileId) + "?" + uploadsParam
+	rec := doRequest(fh, httptest.NewRequest(http.MethodPost, url, nil))
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+
+	// other repos have their own limit
+	rec = doRequest(fh, httptest.NewRequest(http.MethodPost, fileUrl(testOrg, "other-repo", fileId)+"?"+uploadsParam, nil))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	rec = doRequest(fh, httptest.NewRequest(http.MethodDelete, sessionUrl, nil))
+	require.Equal(t, http.StatusNoContent, rec.Code)
+	startSession(t, fh, fileId)
+
+	staged, err := os.ReadDir(fh.sessions.stagingDir)
+	require.NoError(t, err)
+	assert.Len(t, staged, 3)
+}